@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/fapiko/go-learn-gl/opengl-tutorial/primitives"
 
 	"strings"
 
@@ -77,44 +78,8 @@ func main() {
 	// Get a handle for our buffers
 	vertexPositionModelspaceId := uint32(gl.GetAttribLocation(programId, gl.Str("vertexPosition_modelspace\x00")))
 
-	vertexBufferData := []float32{
-		-1.0, -1.0, -1.0, // triangle 1 : begin
-		-1.0, -1.0, 1.0,
-		-1.0, 1.0, 1.0, // triangle 1 : end
-		1.0, 1.0, -1.0, // triangle 2 : begin
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, -1.0, // triangle 2 : end
-		1.0, -1.0, 1.0,
-		-1.0, -1.0, -1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, -1.0,
-		1.0, -1.0, -1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		-1.0, 1.0, -1.0,
-		1.0, -1.0, 1.0,
-		-1.0, -1.0, 1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		-1.0, -1.0, 1.0,
-		1.0, -1.0, 1.0,
-		1.0, 1.0, 1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, -1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, 1.0,
-		1.0, -1.0, 1.0,
-		1.0, 1.0, 1.0,
-		1.0, 1.0, -1.0,
-		-1.0, 1.0, -1.0,
-		1.0, 1.0, 1.0,
-		-1.0, 1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		1.0, 1.0, 1.0,
-		-1.0, 1.0, 1.0,
-		1.0, -1.0, 1.0,
-	}
+	// A 2x2x2 cube as 12 separate triangles for gl.DrawArrays
+	vertexBufferData, _, _ := primitives.Unindex(primitives.Cube(2, 1))
 
 	colorBufferData := []float32{
 		0.583, 0.771, 0.014,
@@ -158,7 +123,7 @@ func main() {
 	var vertexBuffer uint32
 	gl.GenBuffers(1, &vertexBuffer)
 	gl.BindBuffer(gl.ARRAY_BUFFER, vertexBuffer)
-	gl.BufferData(gl.ARRAY_BUFFER, len(vertexBufferData)*4, gl.Ptr(vertexBufferData), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertexBufferData)*4*3, gl.Ptr(vertexBufferData), gl.STATIC_DRAW)
 	defer gl.DeleteBuffers(1, &vertexBuffer)
 
 	var colorBuffer uint32
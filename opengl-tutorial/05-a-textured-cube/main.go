@@ -5,6 +5,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/fapiko/go-learn-gl/opengl-tutorial/common"
+	"github.com/fapiko/go-learn-gl/opengl-tutorial/primitives"
 
 	"strings"
 
@@ -80,88 +81,13 @@ func main() {
 	// Get a handle for our buffers
 	vertexPositionModelspaceId := uint32(gl.GetAttribLocation(programId, gl.Str("vertexPosition_modelspace\x00")))
 
-	vertexBufferData := []float32{
-		-1.0, -1.0, -1.0, // triangle 1 : begin
-		-1.0, -1.0, 1.0,
-		-1.0, 1.0, 1.0, // triangle 1 : end
-		1.0, 1.0, -1.0, // triangle 2 : begin
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, -1.0, // triangle 2 : end
-		1.0, -1.0, 1.0,
-		-1.0, -1.0, -1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, -1.0,
-		1.0, -1.0, -1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		-1.0, 1.0, -1.0,
-		1.0, -1.0, 1.0,
-		-1.0, -1.0, 1.0,
-		-1.0, -1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		-1.0, -1.0, 1.0,
-		1.0, -1.0, 1.0,
-		1.0, 1.0, 1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, -1.0,
-		1.0, -1.0, -1.0,
-		1.0, 1.0, 1.0,
-		1.0, -1.0, 1.0,
-		1.0, 1.0, 1.0,
-		1.0, 1.0, -1.0,
-		-1.0, 1.0, -1.0,
-		1.0, 1.0, 1.0,
-		-1.0, 1.0, -1.0,
-		-1.0, 1.0, 1.0,
-		1.0, 1.0, 1.0,
-		-1.0, 1.0, 1.0,
-		1.0, -1.0, 1.0,
-	}
-
-	uvBufferData := []float32{
-		0.000059, 1.0 - 0.000004,
-		0.000103, 1.0 - 0.336048,
-		0.335973, 1.0 - 0.335903,
-		1.000023, 1.0 - 0.000013,
-		0.667979, 1.0 - 0.335851,
-		0.999958, 1.0 - 0.336064,
-		0.667979, 1.0 - 0.335851,
-		0.336024, 1.0 - 0.671877,
-		0.667969, 1.0 - 0.671889,
-		1.000023, 1.0 - 0.000013,
-		0.668104, 1.0 - 0.000013,
-		0.667979, 1.0 - 0.335851,
-		0.000059, 1.0 - 0.000004,
-		0.335973, 1.0 - 0.335903,
-		0.336098, 1.0 - 0.000071,
-		0.667979, 1.0 - 0.335851,
-		0.335973, 1.0 - 0.335903,
-		0.336024, 1.0 - 0.671877,
-		1.000004, 1.0 - 0.671847,
-		0.999958, 1.0 - 0.336064,
-		0.667979, 1.0 - 0.335851,
-		0.668104, 1.0 - 0.000013,
-		0.335973, 1.0 - 0.335903,
-		0.667979, 1.0 - 0.335851,
-		0.335973, 1.0 - 0.335903,
-		0.668104, 1.0 - 0.000013,
-		0.336098, 1.0 - 0.000071,
-		0.000103, 1.0 - 0.336048,
-		0.000004, 1.0 - 0.671870,
-		0.336024, 1.0 - 0.671877,
-		0.000103, 1.0 - 0.336048,
-		0.336024, 1.0 - 0.671877,
-		0.335973, 1.0 - 0.335903,
-		0.667969, 1.0 - 0.671889,
-		1.000004, 1.0 - 0.671847,
-		0.667979, 1.0 - 0.335851,
-	}
+	// A 2x2x2 cube as 12 separate triangles for gl.DrawArrays, each face showing the whole texture
+	vertexBufferData, uvBufferData, _ := primitives.Unindex(primitives.Cube(2, 1))
 
 	var vertexBuffer uint32
 	gl.GenBuffers(1, &vertexBuffer)
 	gl.BindBuffer(gl.ARRAY_BUFFER, vertexBuffer)
-	gl.BufferData(gl.ARRAY_BUFFER, len(vertexBufferData)*4, gl.Ptr(vertexBufferData), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertexBufferData)*4*3, gl.Ptr(vertexBufferData), gl.STATIC_DRAW)
 	defer gl.DeleteBuffers(1, &vertexBuffer)
 
 	//_, err = loadBmpCustom("uvtemplate.bmp")
@@ -174,7 +100,7 @@ func main() {
 	var textureBuffer uint32
 	gl.GenBuffers(1, &textureBuffer)
 	gl.BindBuffer(gl.TEXTURE_BUFFER, textureBuffer)
-	gl.BufferData(gl.TEXTURE_BUFFER, len(uvBufferData)*4, gl.Ptr(uvBufferData), gl.STATIC_DRAW)
+	gl.BufferData(gl.TEXTURE_BUFFER, len(uvBufferData)*4*2, gl.Ptr(uvBufferData), gl.STATIC_DRAW)
 	defer gl.DeleteBuffers(1, &textureBuffer)
 
 	for window.GetKey(glfw.KeyEscape) != glfw.Press && !window.ShouldClose() {
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fapiko/go-learn-gl/opengl-tutorial/common"
+)
+
+// img2dds compresses PNG, JPEG, GIF, BMP and TGA pictures into DXT1 or DXT5 DDS files that common.LoadDDS reads, and
+// reports the PSNR of the compressed full size level against the source. Pictures with any alpha below 255 default to
+// DXT5.
+//
+//	img2dds [-format auto|dxt1|dxt5] [-quality range|cluster] [-mipmaps] [-srgb] [-o out.DDS] picture.png...
+func main() {
+
+	format := flag.String("format", "auto", "block compression: dxt1, dxt5 or auto to use dxt5 only with alpha")
+	quality := flag.String("quality", "cluster", "end point search: range for speed or cluster for quality")
+	mipmaps := flag.Bool("mipmaps", true, "generate every mipmap level down to 1x1")
+	srgb := flag.Bool("srgb", false, "mark the colours as sRGB, mipmaps are then filtered in linear space")
+	output := flag.String("o", "", "output file, only valid with a single input (default: input with a .DDS extension)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] picture.png...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *output != "" && flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var compression common.CompressionQuality
+	switch *quality {
+	case "range":
+		compression = common.CompressRangeFit
+	case "cluster":
+		compression = common.CompressClusterFit
+	default:
+		log.Fatalf("Unknown quality %q", *quality)
+	}
+
+	for _, input := range flag.Args() {
+
+		source, err := loadPicture(input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		source.SRGB = *srgb
+
+		target := common.ImageDXT1
+		switch *format {
+		case "dxt1":
+		case "dxt5":
+			target = common.ImageDXT5
+		case "auto":
+			if hasAlpha(source) {
+				target = common.ImageDXT5
+			}
+		default:
+			log.Fatalf("Unknown format %q", *format)
+		}
+
+		if *mipmaps {
+			if source, err = common.GenerateMipmaps(source); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		compressed, err := common.CompressImage(source, target, compression)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		path := *output
+		if path == "" {
+			path = strings.TrimSuffix(input, filepath.Ext(input)) + ".DDS"
+		}
+
+		if err := common.SaveDDS(path, compressed); err != nil {
+			log.Fatal(err)
+		}
+
+		psnr, err := comparePicture(source, compressed)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("%s: %dx%d %v, %d levels, PSNR %.2f dB -> %s\n", input, compressed.Width, compressed.Height,
+			compressed.Format, compressed.Levels(), psnr, path)
+
+	}
+
+}
+
+// loadPicture decodes a picture with common.LoadImage into rows running from the top down as DDS stores them
+func loadPicture(path string) (*common.Image, error) {
+
+	picture, format, err := common.LoadImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Containers keep their rows as they are, already top down
+	if format == "dds" || format == "ktx" {
+		return picture, nil
+	}
+
+	return picture, picture.FlipVertical()
+
+}
+
+func hasAlpha(picture *common.Image) bool {
+
+	if picture.Format != common.ImageRGBA8 {
+		return false
+	}
+
+	for i := 3; i < len(picture.Pixels); i += 4 {
+		if picture.Pixels[i] != 255 {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// comparePicture decompresses the full size level and measures its PSNR against the source widened to RGBA8 like it
+func comparePicture(source *common.Image, compressed *common.Image) (float64, error) {
+
+	fullSize := *compressed
+	fullSize.Mipmaps = nil
+	decompressed, err := common.DecompressImage(&fullSize)
+	if err != nil {
+		return 0, err
+	}
+
+	reference := &common.Image{Width: source.Width, Height: source.Height, Format: common.ImageRGBA8}
+	channels := source.Format.BytesPerPixel()
+	for i := 0; i < source.Width*source.Height; i++ {
+
+		pixel := source.Pixels[i*channels : (i+1)*channels]
+		switch source.Format {
+		case common.ImageRGB8:
+			reference.Pixels = append(reference.Pixels, pixel[0], pixel[1], pixel[2], 255)
+		case common.ImageRGBA8:
+			reference.Pixels = append(reference.Pixels, pixel...)
+		case common.ImageL8:
+			reference.Pixels = append(reference.Pixels, pixel[0], pixel[0], pixel[0], 255)
+		}
+
+	}
+
+	// DXT1 can't keep partial alpha, leave it out of the comparison
+	if compressed.Format == common.ImageDXT1 {
+		for i := 3; i < len(reference.Pixels); i += 4 {
+			reference.Pixels[i] = decompressed.Pixels[i]
+		}
+	}
+
+	return common.PSNR(reference, decompressed)
+
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/fapiko/go-learn-gl/opengl-tutorial/common"
+)
+
+func TestHasAlpha(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		picture *common.Image
+		want    bool
+	}{
+		{"opaque", &common.Image{Width: 2, Height: 1, Format: common.ImageRGBA8,
+			Pixels: []byte{1, 2, 3, 255, 4, 5, 6, 255}}, false},
+		{"one translucent pixel", &common.Image{Width: 2, Height: 1, Format: common.ImageRGBA8,
+			Pixels: []byte{1, 2, 3, 255, 4, 5, 6, 254}}, true},
+		{"RGB", &common.Image{Width: 1, Height: 1, Format: common.ImageRGB8, Pixels: []byte{0, 0, 0}}, false},
+		{"luminance and alpha", &common.Image{Width: 1, Height: 1, Format: common.ImageLA8, Pixels: []byte{0, 0}},
+			false},
+	}
+
+	for _, test := range tests {
+		if alpha := hasAlpha(test.picture); alpha != test.want {
+			t.Errorf("%s: alpha %v, want %v", test.name, alpha, test.want)
+		}
+	}
+
+}
+
+func TestLoadPicture(t *testing.T) {
+
+	// A red top row over a blue bottom row
+	picture := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	for x := 0; x < 2; x++ {
+		picture.Set(x, 0, color.NRGBA{255, 0, 0, 255})
+		picture.Set(x, 1, color.NRGBA{0, 0, 255, 128})
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, picture); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "rows.png")
+	if err := ioutil.WriteFile(pngPath, encoded.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	top := []byte{255, 0, 0, 255, 255, 0, 0, 255}
+	loaded, err := loadPicture(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Format != common.ImageRGBA8 || !bytes.Equal(loaded.Pixels[:8], top) {
+		t.Errorf("PNG loaded as %v starting %v, want the top row %v", loaded.Format, loaded.Pixels[:8], top)
+	}
+
+	// A DDS file is already stored top down and comes back as it was written
+	ddsPath := filepath.Join(dir, "rows.DDS")
+	if err := common.SaveDDS(ddsPath, loaded); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := loadPicture(ddsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reloaded.Pixels, loaded.Pixels) {
+		t.Errorf("DDS loaded as %v, want %v", reloaded.Pixels, loaded.Pixels)
+	}
+
+	if _, err := loadPicture(filepath.Join(dir, "missing.png")); err == nil {
+		t.Errorf("Loaded a missing picture")
+	}
+
+}
+
+func TestComparePicture(t *testing.T) {
+
+	// A flat picture every format compresses exactly, with mipmaps the comparison should leave out
+	flat := func(format common.ImageFormat, pixel ...byte) *common.Image {
+		return &common.Image{Width: 8, Height: 8, Format: format, Pixels: bytes.Repeat(pixel, 64),
+			Mipmaps: [][]byte{bytes.Repeat(pixel, 16)}}
+	}
+
+	tests := []struct {
+		name    string
+		source  *common.Image
+		target  common.ImageFormat
+		minimum float64
+	}{
+		{"RGB8 to DXT1", flat(common.ImageRGB8, 0, 255, 0), common.ImageDXT1, math.Inf(1)},
+		{"L8 to DXT1", flat(common.ImageL8, 255), common.ImageDXT1, math.Inf(1)},
+		{"RGBA8 to DXT5", flat(common.ImageRGBA8, 255, 0, 255, 255), common.ImageDXT5, math.Inf(1)},
+
+		// DXT1 drops the partial alpha but the colour still matches
+		{"translucent RGBA8 to DXT1", flat(common.ImageRGBA8, 0, 0, 255, 200), common.ImageDXT1, math.Inf(1)},
+
+		// Every other pixel grey with a hard alpha edge, close but not exact
+		{"checkered RGBA8 to DXT5", &common.Image{Width: 4, Height: 4, Format: common.ImageRGBA8,
+			Pixels: bytes.Repeat([]byte{200, 30, 90, 255, 40, 40, 40, 0}, 8)}, common.ImageDXT5, 30},
+	}
+
+	for _, test := range tests {
+
+		compressed, err := common.CompressImage(test.source, test.target, common.CompressClusterFit)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		psnr, err := comparePicture(test.source, compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if psnr < test.minimum {
+			t.Errorf("%s: PSNR %.2f dB, want at least %v", test.name, psnr, test.minimum)
+		}
+
+	}
+
+}
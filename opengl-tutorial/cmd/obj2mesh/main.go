@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fapiko/go-learn-gl/opengl-tutorial/common"
+)
+
+// obj2mesh converts OBJ models into the binary mesh format read by common.LoadMesh, so programs can skip parsing
+// them at startup. The mesh attributes are positions, uvs and normals in that order.
+//
+//	obj2mesh [-epsilon 0.0001] [-optimize=false] [-o out.mesh] model.obj...
+func main() {
+
+	epsilon := flag.Float64("epsilon", 0, "weld vertices whose attributes differ by no more than this")
+	optimize := flag.Bool("optimize", true, "reorder the mesh for the vertex cache")
+	output := flag.String("o", "", "output file, only valid with a single input (default: input with a .mesh extension)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] model.obj...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || *output != "" && flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, input := range flag.Args() {
+
+		vertices, uvs, normals, err := common.LoadObj(input)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		mesh, err := common.IndexAttributes(
+			common.Vec3Attribute(vertices, float32(*epsilon)),
+			common.Vec2Attribute(uvs, float32(*epsilon)),
+			common.Vec3Attribute(normals, float32(*epsilon)))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if *optimize {
+			mesh.Optimize()
+		}
+
+		path := *output
+		if path == "" {
+			path = strings.TrimSuffix(input, filepath.Ext(input)) + ".mesh"
+		}
+
+		if err := common.SaveMesh(path, mesh); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("%s: %d triangles, %d vertices -> %s\n", input, len(mesh.Indices)/3, mesh.VertexCount(), path)
+
+	}
+
+}
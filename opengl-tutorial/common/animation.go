@@ -0,0 +1,403 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// JointPose is the transform of a joint relative to its parent
+type JointPose struct {
+	Translation mgl32.Vec3
+	Rotation    mgl32.Quat
+	Scale       mgl32.Vec3
+}
+
+func IdentityJointPose() JointPose {
+	return JointPose{Rotation: mgl32.QuatIdent(), Scale: mgl32.Vec3{1, 1, 1}}
+}
+
+func (pose JointPose) Mat4() mgl32.Mat4 {
+
+	return mgl32.Translate3D(pose.Translation.X(), pose.Translation.Y(), pose.Translation.Z()).
+		Mul4(pose.Rotation.Mat4()).
+		Mul4(mgl32.Scale3D(pose.Scale.X(), pose.Scale.Y(), pose.Scale.Z()))
+
+}
+
+var ErrSkeleton = errors.New("Invalid skeleton")
+
+// matrixJointPose splits a transform into a translation, rotation and scale. Shear is lost.
+func matrixJointPose(matrix mgl32.Mat4) JointPose {
+
+	pose := JointPose{Translation: matrix.Col(3).Vec3()}
+	pose.Scale[0], pose.Scale[1], pose.Scale[2] = mgl32.Extract3DScale(matrix)
+
+	// A mirrored matrix keeps the flip in its scale so what's left is a rotation
+	if matrix.Mat3().Det() < 0 {
+		pose.Scale[0] = -pose.Scale[0]
+	}
+
+	rotation := matrix
+	for c := 0; c < 3; c++ {
+		if pose.Scale[c] != 0 {
+			rotation.SetCol(c, rotation.Col(c).Mul(1/pose.Scale[c]))
+		}
+	}
+	pose.Rotation = mgl32.Mat4ToQuat(rotation).Normalize()
+
+	return pose
+
+}
+
+// Pose holds a JointPose for every joint of a skeleton
+type Pose []JointPose
+
+type Joint struct {
+	Name string
+
+	// Index of the parent joint, -1 for roots
+	Parent int
+
+	Rest JointPose
+}
+
+// Skeleton is a hierarchy of joints. LoadGltf and LoadCollada import them along with their skins and animation clips.
+type Skeleton struct {
+	Joints []Joint
+
+	// Transform is applied above the root joints, for the nodes a skeleton hangs from in a scene
+	Transform mgl32.Mat4
+}
+
+func (skeleton *Skeleton) RestPose() Pose {
+
+	pose := make(Pose, len(skeleton.Joints))
+	for i, joint := range skeleton.Joints {
+		pose[i] = joint.Rest
+	}
+
+	return pose
+
+}
+
+// Validate checks that every parent is another joint of the skeleton and that the parents don't form a cycle, which
+// GlobalTransforms relies on. The loaders validate the skeletons they build, call it on ones put together by hand.
+func (skeleton *Skeleton) Validate() error {
+
+	// 0 is unvisited, 1 is on the path being followed and 2 is known to reach a root
+	state := make([]byte, len(skeleton.Joints))
+
+	for joint := range skeleton.Joints {
+
+		var path []int
+		for j := joint; j >= 0 && state[j] == 0; j = skeleton.Joints[j].Parent {
+
+			state[j] = 1
+			path = append(path, j)
+
+			parent := skeleton.Joints[j].Parent
+			if parent < -1 || parent >= len(skeleton.Joints) {
+				return fmt.Errorf("%w: joint %d has parent %d", ErrSkeleton, j, parent)
+			}
+			if parent >= 0 && state[parent] == 1 {
+				return fmt.Errorf("%w: joint %d is in a cycle of parents", ErrSkeleton, j)
+			}
+
+		}
+
+		for _, j := range path {
+			state[j] = 2
+		}
+
+	}
+
+	return nil
+
+}
+
+// GlobalTransforms takes a pose from joint space to model space. Joints may come in any order, but the skeleton has
+// to pass Validate.
+func (skeleton *Skeleton) GlobalTransforms(pose Pose) []mgl32.Mat4 {
+
+	globals := make([]mgl32.Mat4, len(skeleton.Joints))
+	done := make([]bool, len(skeleton.Joints))
+
+	var resolve func(joint int) mgl32.Mat4
+	resolve = func(joint int) mgl32.Mat4 {
+
+		if !done[joint] {
+
+			parent := skeleton.Transform
+			if p := skeleton.Joints[joint].Parent; p >= 0 {
+				parent = resolve(p)
+			}
+
+			globals[joint] = parent.Mul4(pose[joint].Mat4())
+			done[joint] = true
+
+		}
+
+		return globals[joint]
+
+	}
+
+	for joint := range skeleton.Joints {
+		resolve(joint)
+	}
+
+	return globals
+
+}
+
+// Skin binds a mesh to a skeleton, InverseBindMatrices take each joint's bind pose back to the origin
+type Skin struct {
+	Skeleton            *Skeleton
+	InverseBindMatrices []mgl32.Mat4
+}
+
+// JointMatrices are the matrices SkinVertices uses to deform a mesh into the pose, also suitable for uploading to a
+// skinning shader
+func (skin *Skin) JointMatrices(pose Pose) []mgl32.Mat4 {
+
+	matrices := skin.Skeleton.GlobalTransforms(pose)
+	for i := range matrices {
+		if i < len(skin.InverseBindMatrices) {
+			matrices[i] = matrices[i].Mul4(skin.InverseBindMatrices[i])
+		}
+	}
+
+	return matrices
+
+}
+
+// SkinVertices deforms vertices and normals by up to four weighted joints each with linear blend skinning, writing the
+// results to skinnedVertices and skinnedNormals so the buffers can be reused every frame. Weights are normalized,
+// vertices with no weight are left where they are.
+func SkinVertices(vertices []mgl32.Vec3, normals []mgl32.Vec3, joints [][4]uint16, weights []mgl32.Vec4,
+	matrices []mgl32.Mat4, skinnedVertices []mgl32.Vec3, skinnedNormals []mgl32.Vec3) {
+
+	for v, vertex := range vertices {
+
+		var blended mgl32.Mat4
+		var total float32
+
+		for i := 0; i < 4; i++ {
+
+			weight := weights[v][i]
+			joint := int(joints[v][i])
+			if weight == 0 || joint >= len(matrices) {
+				continue
+			}
+
+			for c := range blended {
+				blended[c] += matrices[joint][c] * weight
+			}
+			total += weight
+
+		}
+
+		if total == 0 {
+			skinnedVertices[v] = vertex
+			if normals != nil {
+				skinnedNormals[v] = normals[v]
+			}
+			continue
+		}
+
+		blended = blended.Mul(1 / total)
+		skinnedVertices[v] = mgl32.TransformCoordinate(vertex, blended)
+
+		if normals != nil {
+
+			// The inverse transpose keeps normals perpendicular under non uniform scale
+			normalMatrix := blended.Mat3()
+			if normalMatrix.Det() != 0 {
+				normalMatrix = normalMatrix.Inv().Transpose()
+			}
+
+			normal := normalMatrix.Mul3x1(normals[v])
+			if normal.Len() > 0 {
+				normal = normal.Normalize()
+			}
+			skinnedNormals[v] = normal
+
+		}
+
+	}
+
+}
+
+type Interpolation int
+
+const (
+	InterpolationLinear Interpolation = iota
+	InterpolationStep
+	InterpolationCubicSpline
+)
+
+type AnimationPath int
+
+const (
+	AnimationTranslation AnimationPath = iota
+	AnimationRotation
+	AnimationScale
+)
+
+// AnimationChannel animates one property of one joint. Values holds 3 floats per key for translation and scale and 4
+// for rotation quaternions (x, y, z, w). Cubic spline channels store an in tangent, the value and an out tangent for
+// every key, the same layout as glTF.
+type AnimationChannel struct {
+	Joint         int
+	Path          AnimationPath
+	Interpolation Interpolation
+	Times         []float32
+	Values        []float32
+}
+
+type AnimationClip struct {
+	Name     string
+	Duration float32
+	Channels []AnimationChannel
+}
+
+// Sample writes the animated properties of the clip at time into pose, joints and properties without a channel keep
+// their value. Time is clamped to the clip, wrap it with math.Mod to loop.
+func (clip *AnimationClip) Sample(time float32, pose Pose) {
+
+	for i := range clip.Channels {
+
+		channel := &clip.Channels[i]
+		if channel.Joint < 0 || channel.Joint >= len(pose) || len(channel.Times) == 0 {
+			continue
+		}
+
+		switch channel.Path {
+		case AnimationTranslation:
+			pose[channel.Joint].Translation = channel.sampleVec3(time)
+		case AnimationScale:
+			pose[channel.Joint].Scale = channel.sampleVec3(time)
+		case AnimationRotation:
+			pose[channel.Joint].Rotation = channel.sampleQuat(time)
+		}
+
+	}
+
+}
+
+// key finds the keys either side of time and how far between them it is
+func (channel *AnimationChannel) key(time float32) (int, int, float32, float32) {
+
+	last := len(channel.Times) - 1
+	if time <= channel.Times[0] {
+		return 0, 0, 0, 0
+	}
+	if time >= channel.Times[last] {
+		return last, last, 0, 0
+	}
+
+	next := sort.Search(len(channel.Times), func(i int) bool {
+		return channel.Times[i] > time
+	})
+	previous := next - 1
+
+	delta := channel.Times[next] - channel.Times[previous]
+	if delta <= 0 {
+		return next, next, 0, 0
+	}
+
+	return previous, next, (time - channel.Times[previous]) / delta, delta
+
+}
+
+// value returns component c of key k, for cubic splines tangent is -1 for the in tangent and 1 for the out tangent
+func (channel *AnimationChannel) value(k int, c int, size int, tangent int) float32 {
+
+	if channel.Interpolation == InterpolationCubicSpline {
+		return channel.Values[(k*3+1+tangent)*size+c]
+	}
+
+	return channel.Values[k*size+c]
+
+}
+
+// sample interpolates the size components of the channel at time, rotations are slerped by sampleQuat instead
+func (channel *AnimationChannel) sample(time float32, size int) []float32 {
+
+	previous, next, t, delta := channel.key(time)
+	result := make([]float32, size)
+
+	for c := range result {
+
+		a := channel.value(previous, c, size, 0)
+		b := channel.value(next, c, size, 0)
+
+		switch {
+		case channel.Interpolation == InterpolationStep || previous == next:
+			result[c] = a
+		case channel.Interpolation == InterpolationCubicSpline:
+			// Hermite spline with tangents scaled by the time between the keys
+			t2, t3 := t*t, t*t*t
+			outTangent := channel.value(previous, c, size, 1) * delta
+			inTangent := channel.value(next, c, size, -1) * delta
+			result[c] = (2*t3-3*t2+1)*a + (t3-2*t2+t)*outTangent + (-2*t3+3*t2)*b + (t3-t2)*inTangent
+		default:
+			result[c] = a + (b-a)*t
+		}
+
+	}
+
+	return result
+
+}
+
+func (channel *AnimationChannel) sampleVec3(time float32) mgl32.Vec3 {
+
+	values := channel.sample(time, 3)
+	return mgl32.Vec3{values[0], values[1], values[2]}
+
+}
+
+func (channel *AnimationChannel) sampleQuat(time float32) mgl32.Quat {
+
+	if channel.Interpolation == InterpolationLinear {
+
+		previous, next, t, _ := channel.key(time)
+		a := mgl32.Quat{W: channel.value(previous, 3, 4, 0),
+			V: mgl32.Vec3{channel.value(previous, 0, 4, 0), channel.value(previous, 1, 4, 0), channel.value(previous, 2, 4, 0)}}
+		if previous == next {
+			return a.Normalize()
+		}
+
+		b := mgl32.Quat{W: channel.value(next, 3, 4, 0),
+			V: mgl32.Vec3{channel.value(next, 0, 4, 0), channel.value(next, 1, 4, 0), channel.value(next, 2, 4, 0)}}
+		return mgl32.QuatSlerp(a, b, t)
+
+	}
+
+	// Step and cubic spline results only need normalizing
+	values := channel.sample(time, 4)
+	rotation := mgl32.Quat{W: values[3], V: mgl32.Vec3{values[0], values[1], values[2]}}
+	if rotation.Len() == 0 {
+		return mgl32.QuatIdent()
+	}
+
+	return rotation.Normalize()
+
+}
+
+// BlendPoses mixes two poses of the same skeleton into out, weight 0 gives a and 1 gives b. Rotations are slerped along
+// the shortest path.
+func BlendPoses(a Pose, b Pose, weight float32, out Pose) {
+
+	for i := range out {
+		out[i] = JointPose{
+			Translation: a[i].Translation.Add(b[i].Translation.Sub(a[i].Translation).Mul(weight)),
+			Rotation:    mgl32.QuatSlerp(a[i].Rotation, b[i].Rotation, weight),
+			Scale:       a[i].Scale.Add(b[i].Scale.Sub(a[i].Scale).Mul(weight)),
+		}
+	}
+
+}
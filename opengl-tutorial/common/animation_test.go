@@ -0,0 +1,210 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestAnimationRotationShortestPath(t *testing.T) {
+
+	// The second key is a quarter turn about Z stored negated, the same rotation the long way round
+	quarter := mgl32.QuatRotate(math.Pi/2, mgl32.Vec3{0, 0, 1}).Scale(-1)
+	channel := AnimationChannel{
+		Path:          AnimationRotation,
+		Interpolation: InterpolationLinear,
+		Times:         []float32{0, 1},
+		Values:        []float32{0, 0, 0, 1, quarter.V[0], quarter.V[1], quarter.V[2], quarter.W},
+	}
+
+	clip := &AnimationClip{Duration: 1, Channels: []AnimationChannel{channel}}
+	pose := Pose{IdentityJointPose()}
+
+	for _, time := range []float32{0, 0.25, 0.5, 1} {
+
+		clip.Sample(time, pose)
+
+		angle := float64(time) * math.Pi / 2
+		want := mgl32.Vec3{float32(math.Cos(angle)), float32(math.Sin(angle)), 0}
+		if got := pose[0].Rotation.Rotate(mgl32.Vec3{1, 0, 0}); !nearVec3(got, want, 1e-5) {
+			t.Errorf("At %v X turns to %v, want %v", time, got, want)
+		}
+
+	}
+
+	// Blending goes the short way too
+	blended := Pose{{}}
+	BlendPoses(Pose{IdentityJointPose()}, Pose{{Rotation: quarter, Scale: mgl32.Vec3{1, 1, 1}}}, 0.5, blended)
+	want := mgl32.Vec3{float32(math.Sqrt(0.5)), float32(math.Sqrt(0.5)), 0}
+	if got := blended[0].Rotation.Rotate(mgl32.Vec3{1, 0, 0}); !nearVec3(got, want, 1e-5) {
+		t.Errorf("Blended halfway X turns to %v, want %v", got, want)
+	}
+
+}
+
+func TestAnimationInterpolation(t *testing.T) {
+
+	// Translation keys along X at 0, 1 and 3 seconds
+	keyed := func(interpolation Interpolation, values ...float32) *AnimationClip {
+
+		channel := AnimationChannel{Path: AnimationTranslation, Interpolation: interpolation, Times: []float32{0, 1, 3}}
+		for _, value := range values {
+			channel.Values = append(channel.Values, value, 0, 0)
+		}
+
+		return &AnimationClip{Duration: 3, Channels: []AnimationChannel{channel}}
+
+	}
+
+	tests := []struct {
+		name  string
+		clip  *AnimationClip
+		times []float32
+		want  []float32
+	}{
+		{
+			name:  "step",
+			clip:  keyed(InterpolationStep, 1, 2, 4),
+			times: []float32{-1, 0, 0.5, 1, 2.99, 3, 10},
+			want:  []float32{1, 1, 1, 2, 2, 4, 4},
+		},
+		{
+			name:  "linear",
+			clip:  keyed(InterpolationLinear, 1, 2, 4),
+			times: []float32{-1, 0, 0.5, 1, 2, 2.5, 3, 10},
+			want:  []float32{1, 1, 1.5, 2, 3, 3.5, 4, 4},
+		},
+		{
+			// Flat tangents ease in and out of every key
+			name:  "cubic spline with flat tangents",
+			clip:  keyed(InterpolationCubicSpline, 0, 1, 0, 0, 2, 0, 0, 4, 0),
+			times: []float32{0, 0.5, 1, 1.5, 2, 3},
+			want:  []float32{1, 1.5, 2, 2.3125, 3, 4},
+		},
+		{
+			// Tangents are per second, a slope of 1 between keys one second and 2 units apart follows a straight line
+			name:  "cubic spline with tangents",
+			clip:  keyed(InterpolationCubicSpline, 0, 1, 1, 1, 2, 1, 1, 4, 0),
+			times: []float32{0.25, 0.5, 1, 2},
+			want:  []float32{1.25, 1.5, 2, 3},
+		},
+	}
+
+	for _, test := range tests {
+
+		pose := Pose{IdentityJointPose()}
+		for i, time := range test.times {
+			test.clip.Sample(time, pose)
+			if x := pose[0].Translation.X(); math.Abs(float64(x-test.want[i])) > 1e-5 {
+				t.Errorf("%s: at %v x is %v, want %v", test.name, time, x, test.want[i])
+			}
+		}
+
+	}
+
+}
+
+func TestSkinVertices(t *testing.T) {
+
+	// An upper arm at the origin and a forearm a unit up, listed child first
+	skeleton := &Skeleton{
+		Transform: mgl32.Ident4(),
+		Joints: []Joint{
+			{Name: "forearm", Parent: 1, Rest: JointPose{Translation: mgl32.Vec3{0, 1, 0}, Rotation: mgl32.QuatIdent(),
+				Scale: mgl32.Vec3{1, 1, 1}}},
+			{Name: "arm", Parent: -1, Rest: IdentityJointPose()},
+		},
+	}
+
+	rest := skeleton.GlobalTransforms(skeleton.RestPose())
+	if want := mgl32.Translate3D(0, 1, 0); !rest[0].ApproxEqual(want) {
+		t.Errorf("Forearm rest transform %v, want %v", rest[0], want)
+	}
+
+	skin := &Skin{Skeleton: skeleton, InverseBindMatrices: []mgl32.Mat4{rest[0].Inv(), rest[1].Inv()}}
+
+	vertices := []mgl32.Vec3{{0, 2, 0}, {0, 2, 0}, {0, 0.5, 0}, {1, 1, 1}}
+	normals := []mgl32.Vec3{{0, 1, 0}, {0, 1, 0}, {1, 0, 0}, {0, 0, 1}}
+	joints := [][4]uint16{{0}, {0, 1}, {1}, {}}
+	weights := []mgl32.Vec4{{1}, {2, 2}, {1}, {}}
+
+	skinnedVertices := make([]mgl32.Vec3, len(vertices))
+	skinnedNormals := make([]mgl32.Vec3, len(normals))
+
+	// The bind pose leaves the mesh as it is
+	for i, matrix := range skin.JointMatrices(skeleton.RestPose()) {
+		if !matrix.ApproxEqual(mgl32.Ident4()) {
+			t.Errorf("Joint %d bind pose matrix %v", i, matrix)
+		}
+	}
+
+	// Bend the elbow a quarter turn about Z
+	pose := skeleton.RestPose()
+	pose[0].Rotation = mgl32.QuatRotate(math.Pi/2, mgl32.Vec3{0, 0, 1})
+	SkinVertices(vertices, normals, joints, weights, skin.JointMatrices(pose), skinnedVertices, skinnedNormals)
+
+	wantVertices := []mgl32.Vec3{{-1, 1, 0}, {-0.5, 1.5, 0}, {0, 0.5, 0}, {1, 1, 1}}
+	wantNormals := []mgl32.Vec3{{-1, 0, 0}, mgl32.Vec3{-1, 1, 0}.Normalize(), {1, 0, 0}, {0, 0, 1}}
+	for i := range vertices {
+		if !nearVec3(skinnedVertices[i], wantVertices[i], 1e-5) ||
+			!nearVec3(skinnedNormals[i], wantNormals[i], 1e-5) {
+			t.Errorf("Vertex %d skinned to %v with normal %v, want %v and %v", i, skinnedVertices[i],
+				skinnedNormals[i], wantVertices[i], wantNormals[i])
+		}
+	}
+
+}
+
+func TestSkeletonValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		parents []int
+		valid   bool
+	}{
+		{"empty", nil, true},
+		{"roots", []int{-1, -1}, true},
+		{"children before parents", []int{2, 2, 3, -1}, true},
+		{"own parent", []int{0}, false},
+		{"cycle of two", []int{1, 0}, false},
+		{"cycle under a root", []int{-1, 3, 1, 2}, false},
+		{"chain into a cycle", []int{1, 2, 3, 2}, false},
+		{"parent past the end", []int{-1, 2}, false},
+		{"parent below -1", []int{-2}, false},
+	}
+
+	for _, test := range tests {
+
+		skeleton := &Skeleton{Transform: mgl32.Ident4()}
+		for _, parent := range test.parents {
+			skeleton.Joints = append(skeleton.Joints, Joint{Parent: parent, Rest: IdentityJointPose()})
+		}
+
+		err := skeleton.Validate()
+		if (err == nil) != test.valid || err != nil && !errors.Is(err, ErrSkeleton) {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+
+		// Valid skeletons are safe to pose
+		if err == nil {
+			skeleton.GlobalTransforms(skeleton.RestPose())
+		}
+
+	}
+
+}
+
+// nearVec3 compares with an absolute tolerance, which unlike ApproxEqualThreshold also works for values near 0
+func nearVec3(a mgl32.Vec3, b mgl32.Vec3, tolerance float32) bool {
+
+	for c := range a {
+		if a[c]-b[c] > tolerance || b[c]-a[c] > tolerance {
+			return false
+		}
+	}
+
+	return true
+
+}
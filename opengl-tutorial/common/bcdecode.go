@@ -0,0 +1,209 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Decompressed formats of the block compressed formats DecompressImage handles. Signed BC4 and BC5 have no fallback as
+// there's no signed 8 bit ImageFormat to expand them into, and OpenGL 3.3 drivers all sample RGTC themselves.
+var decompressedFormats = map[ImageFormat]ImageFormat{
+	ImageDXT1: ImageRGBA8,
+	ImageDXT3: ImageRGBA8,
+	ImageDXT5: ImageRGBA8,
+	ImageBC4:  ImageR8,
+	ImageBC5:  ImageRG8,
+}
+
+// CanDecompress is whether DecompressImage handles the format
+func CanDecompress(format ImageFormat) bool {
+
+	_, ok := decompressedFormats[format]
+	return ok
+
+}
+
+// DecompressImage expands a DXT1, DXT3 or DXT5 image into RGBA8, an unsigned BC4 image into R8 or an unsigned BC5 image
+// into RG8, with all its mipmaps and slices. It's the fallback for drivers that can't sample the compressed formats
+// themselves. Rows stay in the order they were in.
+func DecompressImage(image *Image) (*Image, error) {
+
+	format, ok := decompressedFormats[image.Format]
+	if !ok {
+		return nil, fmt.Errorf("Can't decompress %v images", image.Format)
+	}
+
+	decompressed := *image
+	decompressed.Format = format
+	decompressed.Mipmaps = make([][]byte, len(image.Mipmaps))
+
+	for level := 0; level < image.Levels(); level++ {
+
+		data, width, height := image.Level(level)
+		if len(data) < image.LevelDataSize(level) {
+			return nil, fmt.Errorf("Image level %d holds %d bytes instead of %d", level, len(data),
+				image.LevelDataSize(level))
+		}
+
+		sliceSize := image.Format.DataSize(width, height)
+		pixels := make([]byte, 0, decompressed.LevelDataSize(level))
+		for slice := 0; slice < image.Slices()*image.LevelDepth(level); slice++ {
+			pixels = decompressSlice(image.Format, data[slice*sliceSize:(slice+1)*sliceSize], width, height, pixels)
+		}
+
+		if level == 0 {
+			decompressed.Pixels = pixels
+		} else {
+			decompressed.Mipmaps[level-1] = pixels
+		}
+
+	}
+
+	return &decompressed, nil
+
+}
+
+// decompressSlice appends the pixels of one 2D surface of blocks to pixels, cropping the blocks at the edges to width
+// and height
+func decompressSlice(format ImageFormat, blocks []byte, width int, height int, pixels []byte) []byte {
+
+	channels := decompressedFormats[format].BytesPerPixel()
+	blockSize := imageFormats[format].size
+	blocksWide := (width + 3) / 4
+
+	start := len(pixels)
+	pixels = append(pixels, make([]byte, width*height*channels)...)
+	surface := pixels[start:]
+
+	var block [16][4]byte
+	for y := 0; y < height; y += 4 {
+		for x := 0; x < width; x += 4 {
+
+			offset := ((y/4)*blocksWide + x/4) * blockSize
+			decodeBlock(format, blocks[offset:offset+blockSize], &block)
+
+			for row := 0; row < 4 && y+row < height; row++ {
+				for column := 0; column < 4 && x+column < width; column++ {
+					target := ((y+row)*width + x + column) * channels
+					copy(surface[target:target+channels], block[row*4+column][:channels])
+				}
+			}
+
+		}
+	}
+
+	return pixels
+
+}
+
+func decodeBlock(format ImageFormat, data []byte, block *[16][4]byte) {
+
+	switch format {
+	case ImageDXT1:
+		decodeColourBlock(data, block, true)
+	case ImageDXT3:
+		decodeColourBlock(data[8:], block, false)
+		for i := 0; i < 16; i++ {
+			alpha := data[i/2] >> uint(4*(i%2)) & 0x0f
+			block[i][3] = alpha * 17
+		}
+	case ImageDXT5:
+		decodeColourBlock(data[8:], block, false)
+		decodeAlphaBlock(data, block, 3)
+	case ImageBC4:
+		decodeAlphaBlock(data, block, 0)
+	case ImageBC5:
+		decodeAlphaBlock(data, block, 0)
+		decodeAlphaBlock(data[8:], block, 1)
+	}
+
+}
+
+// decodeColourBlock reads the two 565 end points and 2 bit indices shared by DXT1, DXT3 and DXT5
+func decodeColourBlock(data []byte, block *[16][4]byte, dxt1 bool) {
+
+	palette := colourPalette(binary.LittleEndian.Uint16(data), binary.LittleEndian.Uint16(data[2:]), dxt1)
+
+	indices := binary.LittleEndian.Uint32(data[4:])
+	for i := 0; i < 16; i++ {
+		block[i] = palette[indices>>uint(2*i)&3]
+	}
+
+}
+
+// colourPalette is the 4 colours a colour block's indices choose from. Only DXT1 blocks with the first end point not
+// above the second have 3 colours and transparent black.
+func colourPalette(colour0 uint16, colour1 uint16, dxt1 bool) [4][4]byte {
+
+	var palette [4][4]byte
+	palette[0] = expand565(colour0)
+	palette[1] = expand565(colour1)
+
+	for c := 0; c < 3; c++ {
+
+		a, b := int(palette[0][c]), int(palette[1][c])
+		if !dxt1 || colour0 > colour1 {
+			palette[2][c] = byte((2*a + b + 1) / 3)
+			palette[3][c] = byte((a + 2*b + 1) / 3)
+		} else {
+			palette[2][c] = byte((a + b) / 2)
+		}
+
+	}
+
+	palette[2][3] = 255
+	palette[3][3] = 255
+	if dxt1 && colour0 <= colour1 {
+		palette[3][3] = 0
+	}
+
+	return palette
+
+}
+
+func expand565(colour uint16) [4]byte {
+
+	r, g, b := byte(colour>>11&0x1f), byte(colour>>5&0x3f), byte(colour&0x1f)
+	return [4]byte{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 255}
+
+}
+
+// decodeAlphaBlock reads a DXT5 alpha block, which BC4 and BC5 use for their channels, into channel of each pixel
+func decodeAlphaBlock(data []byte, block *[16][4]byte, channel int) {
+
+	values := alphaPalette(data[0], data[1])
+
+	// 16 indices of 3 bits in the next 6 bytes
+	var indices uint64
+	for i := 7; i >= 2; i-- {
+		indices = indices<<8 | uint64(data[i])
+	}
+
+	for i := 0; i < 16; i++ {
+		block[i][channel] = values[indices>>uint(3*i)&7]
+	}
+
+}
+
+// alphaPalette is the 8 values an alpha block's indices choose from, 6 between the end points and 0 and 255 when the
+// first isn't above the second
+func alphaPalette(alpha0 byte, alpha1 byte) [8]byte {
+
+	var values [8]byte
+	values[0], values[1] = alpha0, alpha1
+	a, b := int(alpha0), int(alpha1)
+
+	if alpha0 > alpha1 {
+		for i := 1; i < 7; i++ {
+			values[i+1] = byte(((7-i)*a + i*b + 3) / 7)
+		}
+	} else {
+		for i := 1; i < 5; i++ {
+			values[i+1] = byte(((5-i)*a + i*b + 2) / 5)
+		}
+		values[6], values[7] = 0, 255
+	}
+
+	return values
+
+}
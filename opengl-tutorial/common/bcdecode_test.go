@@ -0,0 +1,157 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// psnr is the peak signal to noise ratio in decibels between the RGB of an RGBA8 image and an RGB8 one
+func psnr(rgba *Image, rgb *Image) float64 {
+
+	var squaredError float64
+	for i := 0; i < rgb.Width*rgb.Height; i++ {
+		for c := 0; c < 3; c++ {
+			difference := float64(rgba.Pixels[i*4+c]) - float64(rgb.Pixels[i*3+c])
+			squaredError += difference * difference
+		}
+	}
+
+	return 10 * math.Log10(255*255/(squaredError/float64(rgb.Width*rgb.Height*3)))
+
+}
+
+func TestDecompressImageAgainstBmp(t *testing.T) {
+
+	// Each DDS was compressed from the bitmap next to it
+	tests := []struct {
+		path    string
+		minimum float64
+	}{
+		{"../07-model-loading/uvmap", 75},
+		{"../08-basic-shading/uvmap", 50},
+	}
+
+	for _, test := range tests {
+
+		compressed, err := LoadDDSImage(test.path + ".DDS")
+		if err != nil {
+			t.Fatal(err)
+		}
+		source, err := LoadBmp(test.path + ".bmp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		image, err := DecompressImage(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if image.Format != ImageRGBA8 || image.Levels() != compressed.Levels() {
+			t.Fatalf("%s: decompressed to %v with %d levels", test.path, image.Format, image.Levels())
+		}
+		for level := 0; level < image.Levels(); level++ {
+			if data, _, _ := image.Level(level); len(data) != image.LevelDataSize(level) {
+				t.Errorf("%s: level %d holds %d bytes, want %d", test.path, level, len(data),
+					image.LevelDataSize(level))
+			}
+		}
+
+		// DDS rows run top down and bitmap ones bottom up
+		if err := image.FlipVertical(); err != nil {
+			t.Fatal(err)
+		}
+		if ratio := psnr(image, source); ratio < test.minimum {
+			t.Errorf("%s: PSNR %.1f dB, want at least %v", test.path, ratio, test.minimum)
+		}
+
+	}
+
+}
+
+func TestDecompressImageHolstein(t *testing.T) {
+
+	compressed, err := LoadDDSImage("../11-2d-text/Holstein.DDS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := DecompressImage(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There's no source image for the font, so the hash only catches the decoder's output changing
+	hash := sha256.New()
+	for level := 0; level < image.Levels(); level++ {
+		data, _, _ := image.Level(level)
+		hash.Write(data)
+	}
+	want := "cc445195a89a8975d73f86dbd8efad826213d28965516da14eb70626c1c4b685"
+	if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != want {
+		t.Errorf("Decompressed to pixels with hash %s, want %s", sum, want)
+	}
+
+	// DXT3 alpha has 4 bits
+	for i := 3; i < len(image.Pixels); i += 4 {
+		if image.Pixels[i]%17 != 0 {
+			t.Fatalf("Pixel %d has alpha %d", i/4, image.Pixels[i])
+		}
+	}
+
+}
+
+func TestDecompressImageBlocks(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		image  *Image
+		pixels []byte
+	}{
+		{
+			// Black, white, the grey between them and transparent black, cropped to the top left 2x2 pixels
+			name:   "DXT1 with transparency",
+			image:  &Image{Width: 2, Height: 2, Format: ImageDXT1, Pixels: []byte{0, 0, 0xff, 0xff, 0x04, 0x0e, 0, 0}},
+			pixels: []byte{0, 0, 0, 255, 255, 255, 255, 255, 127, 127, 127, 255, 0, 0, 0, 0},
+		},
+		{
+			name:   "BC4",
+			image:  &Image{Width: 2, Height: 1, Format: ImageBC4, Pixels: []byte{200, 100, 0x0a, 0, 0, 0, 0, 0}},
+			pixels: []byte{186, 100},
+		},
+		{
+			// The green end points are at or below each other, so index 6 is 0 and 7 is 255
+			name: "BC5",
+			image: &Image{Width: 2, Height: 1, Format: ImageBC5, Pixels: []byte{200, 100, 0x0a, 0, 0, 0, 0, 0,
+				10, 20, 0x3e, 0, 0, 0, 0, 0}},
+			pixels: []byte{186, 0, 100, 255},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := DecompressImage(test.image)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(image.Pixels, test.pixels) {
+			t.Errorf("%s: decompressed to %v, want %v", test.name, image.Pixels, test.pixels)
+		}
+
+	}
+
+	for _, format := range []ImageFormat{ImageBC4Signed, ImageBC5Signed, ImageBC7, ImageRGBA8} {
+
+		if CanDecompress(format) {
+			t.Errorf("Can decompress %v", format)
+		}
+		image := &Image{Width: 4, Height: 4, Format: format, Pixels: make([]byte, 64)}
+		if _, err := DecompressImage(image); err == nil {
+			t.Errorf("Decompressed %v", format)
+		}
+
+	}
+
+}
@@ -0,0 +1,479 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CompressionQuality picks how hard CompressImage looks for the end points of each block
+type CompressionQuality int
+
+const (
+	// CompressRangeFit takes the end points from the extremes of a block's colours along their principal axis
+	CompressRangeFit CompressionQuality = iota
+
+	// CompressClusterFit orders a block's colours along their principal axis, tries every way of splitting them
+	// between the palette entries and solves for the end points of each split by least squares. It's many times
+	// slower than range fit and noticeably better on gradients.
+	CompressClusterFit
+)
+
+// CompressImage block compresses an RGB8, RGBA8, L8 or LA8 image into DXT1 or DXT5 with all its mipmaps and slices.
+// DXT1 keeps alpha below 128 as transparent black and drops the rest of it. Rows stay in the order they were in, so
+// images meant for a DDS should be flipped to run top down first.
+func CompressImage(image *Image, format ImageFormat, quality CompressionQuality) (*Image, error) {
+
+	if format != ImageDXT1 && format != ImageDXT5 {
+		return nil, fmt.Errorf("Can't compress images into %v", format)
+	}
+	switch image.Format {
+	case ImageRGB8, ImageRGBA8, ImageL8, ImageLA8:
+	default:
+		return nil, fmt.Errorf("Can't compress %v images", image.Format)
+	}
+
+	compressed := *image
+	compressed.Format = format
+	compressed.Mipmaps = make([][]byte, len(image.Mipmaps))
+
+	for level := 0; level < image.Levels(); level++ {
+
+		data, width, height := image.Level(level)
+		if len(data) < image.LevelDataSize(level) {
+			return nil, fmt.Errorf("Image level %d holds %d bytes instead of %d", level, len(data),
+				image.LevelDataSize(level))
+		}
+
+		sliceSize := image.Format.DataSize(width, height)
+		blocks := make([]byte, 0, compressed.LevelDataSize(level))
+		for slice := 0; slice < image.Slices()*image.LevelDepth(level); slice++ {
+			blocks = compressSlice(image.Format, data[slice*sliceSize:(slice+1)*sliceSize], width, height, format,
+				quality, blocks)
+		}
+
+		if level == 0 {
+			compressed.Pixels = blocks
+		} else {
+			compressed.Mipmaps[level-1] = blocks
+		}
+
+	}
+
+	return &compressed, nil
+
+}
+
+// compressSlice appends the blocks of one 2D surface to blocks, repeating the last row and column of pixels to fill the
+// blocks at the edges
+func compressSlice(sourceFormat ImageFormat, pixels []byte, width int, height int, format ImageFormat,
+	quality CompressionQuality, blocks []byte) []byte {
+
+	channels := sourceFormat.BytesPerPixel()
+	blockSize := imageFormats[format].size
+
+	var block [16][4]byte
+	for y := 0; y < height; y += 4 {
+		for x := 0; x < width; x += 4 {
+
+			for i := range block {
+
+				row, column := y+i/4, x+i%4
+				if row >= height {
+					row = height - 1
+				}
+				if column >= width {
+					column = width - 1
+				}
+
+				pixel := pixels[(row*width+column)*channels:]
+				switch sourceFormat {
+				case ImageRGB8:
+					block[i] = [4]byte{pixel[0], pixel[1], pixel[2], 255}
+				case ImageRGBA8:
+					block[i] = [4]byte{pixel[0], pixel[1], pixel[2], pixel[3]}
+				case ImageL8:
+					block[i] = [4]byte{pixel[0], pixel[0], pixel[0], 255}
+				case ImageLA8:
+					block[i] = [4]byte{pixel[0], pixel[0], pixel[0], pixel[1]}
+				}
+
+			}
+
+			start := len(blocks)
+			blocks = append(blocks, make([]byte, blockSize)...)
+			encodeBlock(format, quality, &block, blocks[start:])
+
+		}
+	}
+
+	return blocks
+
+}
+
+func encodeBlock(format ImageFormat, quality CompressionQuality, block *[16][4]byte, data []byte) {
+
+	switch format {
+	case ImageDXT1:
+		encodeColourBlock(block, true, quality, data)
+	case ImageDXT5:
+		var alpha [16]byte
+		for i := range block {
+			alpha[i] = block[i][3]
+		}
+		encodeAlphaBlock(&alpha, data)
+		encodeColourBlock(block, false, quality, data[8:])
+	}
+
+}
+
+// encodeColourBlock writes the end points and indices of a colour block. DXT1 blocks with transparent pixels use the 3
+// colour palette, every other block uses 4 colours.
+func encodeColourBlock(block *[16][4]byte, dxt1 bool, quality CompressionQuality, data []byte) {
+
+	points := make([][3]float32, 0, 16)
+	transparent := false
+	for _, pixel := range block {
+		if dxt1 && pixel[3] < 128 {
+			transparent = true
+		} else {
+			points = append(points, [3]float32{float32(pixel[0]), float32(pixel[1]), float32(pixel[2])})
+		}
+	}
+
+	if len(points) == 0 {
+		// Equal end points choose the 3 colour palette, and index 3 of it is transparent black
+		binary.LittleEndian.PutUint32(data, 0)
+		binary.LittleEndian.PutUint32(data[4:], 0xffffffff)
+		return
+	}
+
+	// 3 or 4 palette entries the opaque pixels can use
+	entries := 4
+	if transparent {
+		entries = 3
+	}
+
+	axis := principalAxis(points)
+	start, end := rangeFit(points, axis)
+	colour0, colour1, indices, bestError := fitColourIndices(block, start, end, dxt1, transparent)
+
+	if quality == CompressClusterFit {
+		start, end = clusterFit(points, axis, entries)
+		if c0, c1, i, fitError := fitColourIndices(block, start, end, dxt1, transparent); fitError < bestError {
+			colour0, colour1, indices = c0, c1, i
+		}
+	}
+
+	binary.LittleEndian.PutUint16(data, colour0)
+	binary.LittleEndian.PutUint16(data[2:], colour1)
+	binary.LittleEndian.PutUint32(data[4:], indices)
+
+}
+
+// fitColourIndices quantizes a pair of end points, orders them for the palette the block needs and picks the closest
+// entry for each pixel. It returns the packed block and its squared error.
+func fitColourIndices(block *[16][4]byte, start [3]float32, end [3]float32, dxt1 bool,
+	transparent bool) (uint16, uint16, uint32, float32) {
+
+	colour0, colour1 := pack565(start), pack565(end)
+
+	// Without transparency the first end point has to be the larger, DXT1 would use 3 colours otherwise
+	if transparent && colour0 > colour1 || !transparent && colour0 < colour1 {
+		colour0, colour1 = colour1, colour0
+	}
+
+	palette := colourPalette(colour0, colour1, dxt1)
+	entries := 4
+	if transparent || dxt1 && colour0 == colour1 {
+		entries = 3
+	}
+
+	var indices uint32
+	var totalError float32
+	for i, pixel := range block {
+
+		if transparent && pixel[3] < 128 {
+			indices |= 3 << uint(2*i)
+			continue
+		}
+
+		best, bestError := 0, float32(math.MaxFloat32)
+		for entry := 0; entry < entries; entry++ {
+			var distance float32
+			for c := 0; c < 3; c++ {
+				d := float32(pixel[c]) - float32(palette[entry][c])
+				distance += d * d
+			}
+			if distance < bestError {
+				best, bestError = entry, distance
+			}
+		}
+
+		indices |= uint32(best) << uint(2*i)
+		totalError += bestError
+
+	}
+
+	return colour0, colour1, indices, totalError
+
+}
+
+// principalAxis is the direction the colours vary the most along, found by power iteration on their covariance
+func principalAxis(points [][3]float32) [3]float32 {
+
+	var mean [3]float32
+	for _, point := range points {
+		for c := range mean {
+			mean[c] += point[c]
+		}
+	}
+	for c := range mean {
+		mean[c] /= float32(len(points))
+	}
+
+	var covariance [3][3]float32
+	for _, point := range points {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				covariance[i][j] += (point[i] - mean[i]) * (point[j] - mean[j])
+			}
+		}
+	}
+
+	// Starting from the row with the largest variance converges quickly and isn't orthogonal to the answer
+	largest := 0
+	for i := 1; i < 3; i++ {
+		if covariance[i][i] > covariance[largest][largest] {
+			largest = i
+		}
+	}
+	axis := covariance[largest]
+
+	for iteration := 0; iteration < 8; iteration++ {
+
+		var next [3]float32
+		for i := 0; i < 3; i++ {
+			next[i] = covariance[i][0]*axis[0] + covariance[i][1]*axis[1] + covariance[i][2]*axis[2]
+		}
+
+		length := float32(math.Sqrt(float64(next[0]*next[0] + next[1]*next[1] + next[2]*next[2])))
+		if length == 0 {
+			// Every colour is the same
+			return [3]float32{1, 1, 1}
+		}
+		for i := range next {
+			axis[i] = next[i] / length
+		}
+
+	}
+
+	return axis
+
+}
+
+func dot3(a [3]float32, b [3]float32) float32 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// rangeFit returns the colours with the lowest and highest projection onto the axis
+func rangeFit(points [][3]float32, axis [3]float32) ([3]float32, [3]float32) {
+
+	start, end := points[0], points[0]
+	minimum, maximum := dot3(points[0], axis), dot3(points[0], axis)
+
+	for _, point := range points[1:] {
+		projection := dot3(point, axis)
+		if projection < minimum {
+			start, minimum = point, projection
+		}
+		if projection > maximum {
+			end, maximum = point, projection
+		}
+	}
+
+	return start, end
+
+}
+
+// clusterFit orders the colours along the axis and gives the first run of them to the start point, the next runs to
+// each interpolated entry and the rest to the end point. The end points of each split come from least squares and are
+// snapped to 565, the split with the least error wins.
+func clusterFit(points [][3]float32, axis [3]float32, entries int) ([3]float32, [3]float32) {
+
+	ordered := make([][3]float32, len(points))
+	copy(ordered, points)
+	sort.Slice(ordered, func(i, j int) bool {
+		return dot3(ordered[i], axis) < dot3(ordered[j], axis)
+	})
+
+	// Running sums make the sums over each run constant time
+	count := len(ordered)
+	sums := make([][3]float32, count+1)
+	var squares float32
+	for i, point := range ordered {
+		for c := 0; c < 3; c++ {
+			sums[i+1][c] = sums[i][c] + point[c]
+		}
+		squares += dot3(point, point)
+	}
+
+	// Weight of the start point in each palette entry from the start to the end
+	weights := []float32{1, 2.0 / 3, 1.0 / 3, 0}
+	if entries == 3 {
+		weights = []float32{1, 0.5, 0}
+	}
+
+	start, end := rangeFit(points, axis)
+	bestError := float32(math.MaxFloat32)
+
+	// Boundaries between the runs of each entry, the last always ends at count
+	bounds := make([]int, len(weights))
+	bounds[len(bounds)-1] = count
+
+	var search func(run int, first int)
+	search = func(run int, first int) {
+
+		if run < len(weights)-1 {
+			for bound := first; bound <= count; bound++ {
+				bounds[run] = bound
+				search(run+1, bound)
+			}
+			return
+		}
+
+		var alpha2, beta2, alphaBeta float32
+		var alphaX, betaX [3]float32
+		previous := 0
+		for entry, bound := range bounds {
+
+			n := float32(bound - previous)
+			alpha, beta := weights[entry], 1-weights[entry]
+			alpha2 += n * alpha * alpha
+			beta2 += n * beta * beta
+			alphaBeta += n * alpha * beta
+			for c := 0; c < 3; c++ {
+				sum := sums[bound][c] - sums[previous][c]
+				alphaX[c] += alpha * sum
+				betaX[c] += beta * sum
+			}
+			previous = bound
+
+		}
+
+		determinant := alpha2*beta2 - alphaBeta*alphaBeta
+		if determinant < 1e-6 {
+			return
+		}
+
+		var a, b [3]float32
+		for c := 0; c < 3; c++ {
+			a[c] = (alphaX[c]*beta2 - betaX[c]*alphaBeta) / determinant
+			b[c] = (betaX[c]*alpha2 - alphaX[c]*alphaBeta) / determinant
+		}
+		a, b = snap565(a), snap565(b)
+
+		// Sum over the points of |alpha a + beta b - x|² expanded so it needs only the sums
+		fitError := dot3(a, a)*alpha2 + dot3(b, b)*beta2 + squares +
+			2*(dot3(a, b)*alphaBeta-dot3(a, alphaX)-dot3(b, betaX))
+
+		if fitError < bestError {
+			start, end, bestError = a, b, fitError
+		}
+
+	}
+	search(0, 0)
+
+	return start, end
+
+}
+
+// pack565 rounds a colour with channels from 0 to 255 to 5 bits of red, 6 of green and 5 of blue
+func pack565(colour [3]float32) uint16 {
+
+	quantize := func(value float32, max float32) uint16 {
+		value = value*max/255 + 0.5
+		if value < 0 {
+			return 0
+		}
+		if value > max {
+			return uint16(max)
+		}
+		return uint16(value)
+	}
+
+	return quantize(colour[0], 31)<<11 | quantize(colour[1], 63)<<5 | quantize(colour[2], 31)
+
+}
+
+// snap565 is the colour a decoder would read back after packing it to 565
+func snap565(colour [3]float32) [3]float32 {
+
+	expanded := expand565(pack565(colour))
+	return [3]float32{float32(expanded[0]), float32(expanded[1]), float32(expanded[2])}
+
+}
+
+// encodeAlphaBlock writes a DXT5 alpha block, trying both the 8 value palette over the whole range and the 6 value one
+// over the values between 0 and 255 and keeping whichever is closer
+func encodeAlphaBlock(values *[16]byte, data []byte) {
+
+	minimum, maximum := byte(255), byte(0)
+	inner0, inner1 := byte(255), byte(0)
+	for _, value := range values {
+		if value < minimum {
+			minimum = value
+		}
+		if value > maximum {
+			maximum = value
+		}
+		if value != 0 && value != 255 {
+			if value < inner0 {
+				inner0 = value
+			}
+			if value > inner1 {
+				inner1 = value
+			}
+		}
+	}
+	if inner0 > inner1 {
+		inner0, inner1 = 0, 255
+	}
+
+	alpha0, alpha1, indices, bestError := fitAlphaIndices(values, maximum, minimum)
+	if a0, a1, i, fitError := fitAlphaIndices(values, inner0, inner1); fitError < bestError {
+		alpha0, alpha1, indices = a0, a1, i
+	}
+
+	data[0], data[1] = alpha0, alpha1
+	for i := 2; i < 8; i++ {
+		data[i] = byte(indices >> uint(8*(i-2)))
+	}
+
+}
+
+func fitAlphaIndices(values *[16]byte, alpha0 byte, alpha1 byte) (byte, byte, uint64, int) {
+
+	palette := alphaPalette(alpha0, alpha1)
+
+	var indices uint64
+	totalError := 0
+	for i, value := range values {
+
+		best, bestError := 0, math.MaxInt32
+		for entry, candidate := range palette {
+			distance := int(value) - int(candidate)
+			if distance*distance < bestError {
+				best, bestError = entry, distance*distance
+			}
+		}
+
+		indices |= uint64(best) << uint(3*i)
+		totalError += bestError
+
+	}
+
+	return alpha0, alpha1, indices, totalError
+
+}
@@ -0,0 +1,176 @@
+package common
+
+import "testing"
+
+// uvtemplateCrop is a 128x128 part of the textured cube's template, with its lines, lettering and flat colours
+func uvtemplateCrop(t *testing.T) *Image {
+
+	source, err := LoadBmp("../05-a-textured-cube/uvtemplate.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crop := &Image{Width: 128, Height: 128, Format: ImageRGB8}
+	for y := 200; y < 328; y++ {
+		row := (y*source.Width + 200) * 3
+		crop.Pixels = append(crop.Pixels, source.Pixels[row:row+128*3]...)
+	}
+
+	return crop
+
+}
+
+// gradientBlock is a single 4x4 block of 16 colours along a curve, which no 4 colour palette on a line matches exactly
+func gradientBlock() *Image {
+
+	block := &Image{Width: 4, Height: 4, Format: ImageRGB8}
+	for i := 0; i < 16; i++ {
+		t := float64(i) / 15
+		block.Pixels = append(block.Pixels, byte(40+200*t), byte(30+200*t*t), byte(200-100*t))
+	}
+
+	return block
+
+}
+
+func TestCompressImageRoundTrip(t *testing.T) {
+
+	crop := uvtemplateCrop(t)
+	gradient := gradientBlock()
+
+	tests := []struct {
+		name    string
+		image   *Image
+		format  ImageFormat
+		quality CompressionQuality
+		minimum float64
+	}{
+		{"template DXT1 range fit", crop, ImageDXT1, CompressRangeFit, 31},
+		{"template DXT1 cluster fit", crop, ImageDXT1, CompressClusterFit, 33.5},
+		{"template DXT5 range fit", crop, ImageDXT5, CompressRangeFit, 31},
+		{"template DXT5 cluster fit", crop, ImageDXT5, CompressClusterFit, 33.5},
+		{"gradient range fit", gradient, ImageDXT1, CompressRangeFit, 20},
+		{"gradient cluster fit", gradient, ImageDXT1, CompressClusterFit, 23.5},
+	}
+
+	for _, test := range tests {
+
+		compressed, err := CompressImage(test.image, test.format, test.quality)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if compressed.Format != test.format || len(compressed.Pixels) != compressed.LevelDataSize(0) {
+			t.Fatalf("%s: compressed into %d bytes of %v", test.name, len(compressed.Pixels), compressed.Format)
+		}
+
+		decompressed, err := DecompressImage(compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if quality := psnr(decompressed, test.image); quality < test.minimum {
+			t.Errorf("%s: PSNR %.2f dB, want at least %v", test.name, quality, test.minimum)
+		}
+
+	}
+
+}
+
+func TestCompressClusterFitBeatsRangeFit(t *testing.T) {
+
+	quality := func(image *Image, compression CompressionQuality) float64 {
+
+		compressed, err := CompressImage(image, ImageDXT1, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := DecompressImage(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return psnr(decompressed, image)
+
+	}
+
+	for name, image := range map[string]*Image{"gradient": gradientBlock(), "template": uvtemplateCrop(t)} {
+
+		rangeFit, clusterFit := quality(image, CompressRangeFit), quality(image, CompressClusterFit)
+		if clusterFit <= rangeFit {
+			t.Errorf("%s: cluster fit PSNR %.2f dB isn't above range fit's %.2f dB", name, clusterFit, rangeFit)
+		}
+
+	}
+
+}
+
+func TestCompressImageAlpha(t *testing.T) {
+
+	// Alpha runs from transparent to opaque across the block over a flat colour. DXT5 has 8 alpha levels between its end
+	// points, 0 and 255 here, so no pixel should be more than half a step of 36 off.
+	image := &Image{Width: 4, Height: 4, Format: ImageRGBA8}
+	for i := 0; i < 16; i++ {
+		image.Pixels = append(image.Pixels, 90, 160, 220, byte(i*17))
+	}
+
+	for _, format := range []ImageFormat{ImageDXT1, ImageDXT5} {
+
+		compressed, err := CompressImage(image, format, CompressClusterFit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := DecompressImage(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 16; i++ {
+
+			alpha, want := int(decompressed.Pixels[i*4+3]), i*17
+			switch {
+			case format == ImageDXT5 && (alpha-want > 19 || want-alpha > 19):
+				t.Errorf("DXT5 pixel %d has alpha %d, want about %d", i, alpha, want)
+			case format == ImageDXT1 && want < 128 && alpha != 0:
+				t.Errorf("DXT1 pixel %d has alpha %d, want transparent for %d", i, alpha, want)
+			case format == ImageDXT1 && want >= 128 && alpha != 255:
+				t.Errorf("DXT1 pixel %d has alpha %d, want opaque for %d", i, alpha, want)
+			}
+
+		}
+
+	}
+
+}
+
+func TestCompressImageLevelsAndSlices(t *testing.T) {
+
+	// A 6x5 cubemap with every level down to 1x1, whose edge blocks are only partly covered by pixels
+	image := &Image{Width: 6, Height: 5, Format: ImageL8, Cubemap: true}
+	for i := 0; i < image.LevelDataSize(0); i++ {
+		image.Pixels = append(image.Pixels, byte(i*7))
+	}
+	mipmapped, err := GenerateMipmaps(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := CompressImage(mipmapped, ImageDXT1, CompressRangeFit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressed.Levels() != 3 || !compressed.Cubemap {
+		t.Fatalf("Compressed into %d levels, cubemap %v", compressed.Levels(), compressed.Cubemap)
+	}
+	for level := 0; level < compressed.Levels(); level++ {
+		if data, _, _ := compressed.Level(level); len(data) != compressed.LevelDataSize(level) {
+			t.Errorf("Level %d holds %d bytes, want %d", level, len(data), compressed.LevelDataSize(level))
+		}
+	}
+
+	if _, err := CompressImage(image, ImageBC7, CompressRangeFit); err == nil {
+		t.Errorf("Compressed into BC7")
+	}
+	if _, err := CompressImage(compressed, ImageDXT5, CompressRangeFit); err == nil {
+		t.Errorf("Compressed a DXT1 image again")
+	}
+
+}
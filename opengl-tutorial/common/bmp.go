@@ -0,0 +1,401 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Compression methods of a BMP's info header
+const (
+	bmpRGB            = 0
+	bmpRLE8           = 1
+	bmpRLE4           = 2
+	bmpBitfields      = 3
+	bmpAlphaBitfields = 6
+)
+
+const (
+	bmpFileHeaderSize = 14
+	bmpCoreHeaderSize = 12
+	bmpInfoHeaderSize = 40
+
+	// Larger images are refused rather than risk allocating whatever a corrupt header asks for
+	bmpMaxPixels = 1 << 28
+)
+
+var (
+	ErrBmpHeader      = errors.New("Invalid BMP header")
+	ErrBmpData        = errors.New("Invalid BMP data")
+	ErrBmpUnsupported = errors.New("Unsupported BMP")
+)
+
+type bmpHeader struct {
+	width       int
+	height      int
+	topDown     bool
+	bitCount    int
+	compression uint32
+
+	// Red, green, blue and alpha masks of 16 and 32 bit pixels
+	masks   [4]uint32
+	palette [][3]byte
+
+	dataOffset int
+}
+
+// LoadBmp decodes a Windows bitmap into an Image without needing a GL context
+func LoadBmp(path string) (*Image, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := LoadBmpFrom(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return image, nil
+
+}
+
+// LoadBmpFrom decodes bitmaps with the core, info and V2 to V5 headers, in 1, 2, 4 and 8 bit paletted, 16, 24 and 32
+// bit formats, RLE4 and RLE8 compressed, stored bottom up or top down. 32 bit images come back as RGBA when they have
+// an alpha mask, everything else as RGB.
+func LoadBmpFrom(reader io.Reader) (*Image, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := readBmpHeader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &Image{Width: header.width, Height: header.height, Format: ImageRGB8}
+	if header.masks[3] != 0 {
+		image.Format = ImageRGBA8
+	}
+	image.Pixels = make([]byte, image.Width*image.Height*image.Format.BytesPerPixel())
+
+	pixels := data[header.dataOffset:]
+	switch header.compression {
+	case bmpRLE8, bmpRLE4:
+		err = decodeBmpRLE(header, pixels, image)
+	default:
+		err = decodeBmpRows(header, pixels, image)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return image, nil
+
+}
+
+func readBmpHeader(data []byte) (*bmpHeader, error) {
+
+	if len(data) < bmpFileHeaderSize+4 {
+		return nil, fmt.Errorf("%w: file is only %d bytes", ErrBmpHeader, len(data))
+	}
+
+	if data[0] != 'B' || data[1] != 'M' {
+		return nil, fmt.Errorf("%w: not a BMP file", ErrBmpHeader)
+	}
+
+	header := &bmpHeader{dataOffset: int(binary.LittleEndian.Uint32(data[10:]))}
+	headerSize := int(binary.LittleEndian.Uint32(data[bmpFileHeaderSize:]))
+	if headerSize < bmpCoreHeaderSize || bmpFileHeaderSize+headerSize > len(data) {
+		return nil, fmt.Errorf("%w: info header of %d bytes in a file of %d", ErrBmpHeader, headerSize, len(data))
+	}
+
+	info := data[bmpFileHeaderSize : bmpFileHeaderSize+headerSize]
+	paletteEntrySize := 4
+	paletteSize := 0
+
+	if headerSize == bmpCoreHeaderSize {
+
+		header.width = int(binary.LittleEndian.Uint16(info[4:]))
+		header.height = int(int16(binary.LittleEndian.Uint16(info[6:])))
+		header.bitCount = int(binary.LittleEndian.Uint16(info[10:]))
+		paletteEntrySize = 3
+
+	} else {
+
+		// OS/2 2.x headers are the info header's fields cut short anywhere after the bit count
+		if headerSize < 16 {
+			return nil, fmt.Errorf("%w: info header of %d bytes", ErrBmpHeader, headerSize)
+		}
+
+		header.width = int(int32(binary.LittleEndian.Uint32(info[4:])))
+		header.height = int(int32(binary.LittleEndian.Uint32(info[8:])))
+		header.bitCount = int(binary.LittleEndian.Uint16(info[14:]))
+		if headerSize >= 20 {
+			header.compression = binary.LittleEndian.Uint32(info[16:])
+		}
+		if headerSize >= 36 {
+			paletteSize = int(binary.LittleEndian.Uint32(info[32:]))
+		}
+
+	}
+
+	if header.height < 0 {
+		header.topDown = true
+		header.height = -header.height
+	}
+
+	if header.width <= 0 || header.height <= 0 {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrBmpHeader, header.width, header.height)
+	}
+	if header.width*header.height > bmpMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels is too large", ErrBmpUnsupported, header.width, header.height)
+	}
+
+	// Masks come after the info header, or in the V2 and later headers that grew to include them
+	end := bmpFileHeaderSize + headerSize
+	switch header.compression {
+	case bmpRGB:
+		switch header.bitCount {
+		case 16:
+			header.masks = [4]uint32{0x7c00, 0x03e0, 0x001f, 0}
+		case 24, 32:
+			header.masks = [4]uint32{0xff0000, 0x00ff00, 0x0000ff, 0}
+		}
+	case bmpBitfields, bmpAlphaBitfields:
+		if header.bitCount != 16 && header.bitCount != 32 {
+			return nil, fmt.Errorf("%w: bit fields with %d bits per pixel", ErrBmpHeader, header.bitCount)
+		}
+		if headerSize != bmpInfoHeaderSize && headerSize < 52 {
+			return nil, fmt.Errorf("%w: bit fields in an OS/2 header", ErrBmpUnsupported)
+		}
+		count := 3
+		if header.compression == bmpAlphaBitfields || headerSize >= 56 {
+			count = 4
+		}
+		masks := info[bmpInfoHeaderSize:]
+		if headerSize == bmpInfoHeaderSize {
+			masks = data[end:]
+			end += count * 4
+		}
+		if len(masks) < count*4 {
+			return nil, fmt.Errorf("%w: file ends in the colour masks", ErrBmpHeader)
+		}
+		for i := 0; i < count; i++ {
+			header.masks[i] = binary.LittleEndian.Uint32(masks[i*4:])
+		}
+		if !validMasks(header.masks, header.bitCount) {
+			return nil, fmt.Errorf("%w: colour masks %#x", ErrBmpHeader, header.masks)
+		}
+	case bmpRLE8, bmpRLE4:
+		rle8, rle4 := header.compression == bmpRLE8, header.compression == bmpRLE4
+		if rle8 && header.bitCount != 8 || rle4 && header.bitCount != 4 {
+			return nil, fmt.Errorf("%w: RLE compression with %d bits per pixel", ErrBmpHeader, header.bitCount)
+		}
+		if header.topDown {
+			return nil, fmt.Errorf("%w: top down RLE images", ErrBmpHeader)
+		}
+	default:
+		return nil, fmt.Errorf("%w: compression method %d", ErrBmpUnsupported, header.compression)
+	}
+
+	switch header.bitCount {
+	case 1, 2, 4, 8:
+		if paletteSize == 0 || paletteSize > 1<<uint(header.bitCount) {
+			paletteSize = 1 << uint(header.bitCount)
+		}
+		if end+paletteSize*paletteEntrySize > len(data) {
+			return nil, fmt.Errorf("%w: file ends in the palette", ErrBmpHeader)
+		}
+		header.palette = make([][3]byte, paletteSize)
+		for i := range header.palette {
+			entry := data[end+i*paletteEntrySize:]
+			header.palette[i] = [3]byte{entry[2], entry[1], entry[0]}
+		}
+		end += paletteSize * paletteEntrySize
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%w: %d bits per pixel", ErrBmpUnsupported, header.bitCount)
+	}
+
+	// Some writers leave the offset out, in which case the pixels follow the palette
+	if header.dataOffset == 0 {
+		header.dataOffset = end
+	}
+	if header.dataOffset < end || header.dataOffset > len(data) {
+		return nil, fmt.Errorf("%w: pixel data offset %d outside of the file", ErrBmpHeader, header.dataOffset)
+	}
+
+	return header, nil
+
+}
+
+// decodeBmpRows reads uncompressed rows, each padded to a multiple of 4 bytes
+func decodeBmpRows(header *bmpHeader, data []byte, image *Image) error {
+
+	// The last row's padding is often left off
+	stride := (header.width*header.bitCount + 31) / 32 * 4
+	needed := stride*(header.height-1) + (header.width*header.bitCount+7)/8
+	if len(data) < needed {
+		return fmt.Errorf("%w: pixel data is %d bytes, %dx%d pixels need %d", ErrBmpData, len(data), header.width,
+			header.height, needed)
+	}
+
+	var channels [4]maskChannel
+	for i, mask := range header.masks {
+		channels[i] = newMaskChannel(mask)
+	}
+
+	pixelSize := image.Format.BytesPerPixel()
+	for row := 0; row < header.height; row++ {
+
+		source := data[row*stride:]
+		y := row
+		if header.topDown {
+			y = header.height - 1 - row
+		}
+		target := image.Pixels[y*header.width*pixelSize:]
+
+		for x := 0; x < header.width; x++ {
+
+			pixel := target[x*pixelSize : x*pixelSize+pixelSize]
+
+			switch header.bitCount {
+			case 1, 2, 4, 8:
+				index := bmpPaletteIndex(source, x, header.bitCount)
+				if index >= len(header.palette) {
+					return fmt.Errorf("%w: palette index %d of %d colours", ErrBmpData, index, len(header.palette))
+				}
+				copy(pixel, header.palette[index][:])
+			case 24:
+				pixel[0], pixel[1], pixel[2] = source[x*3+2], source[x*3+1], source[x*3]
+			default:
+				var value uint32
+				if header.bitCount == 16 {
+					value = uint32(binary.LittleEndian.Uint16(source[x*2:]))
+				} else {
+					value = binary.LittleEndian.Uint32(source[x*4:])
+				}
+				for c := range pixel {
+					pixel[c] = channels[c].value(value)
+				}
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+func bmpPaletteIndex(row []byte, x int, bitCount int) int {
+
+	// The leftmost pixel is in the highest bits of each byte
+	perByte := 8 / bitCount
+	shift := uint(8 - bitCount*(x%perByte+1))
+
+	return int(row[x/perByte]>>shift) & (1<<uint(bitCount) - 1)
+
+}
+
+// decodeBmpRLE expands run length encoded paletted pixels. Pixels the runs skip over are given the first palette
+// colour, runs past the edge of the image are an error.
+func decodeBmpRLE(header *bmpHeader, data []byte, image *Image) error {
+
+	for i := 0; i < len(image.Pixels); i += 3 {
+		copy(image.Pixels[i:i+3], header.palette[0][:])
+	}
+
+	x, y := 0, 0
+	put := func(index int) error {
+
+		if index >= len(header.palette) {
+			return fmt.Errorf("%w: palette index %d of %d colours", ErrBmpData, index, len(header.palette))
+		}
+
+		if x >= header.width || y >= header.height {
+			return fmt.Errorf("%w: RLE run past pixel %d of row %d in a %dx%d image", ErrBmpData, x, y, header.width,
+				header.height)
+		}
+
+		offset := (y*header.width + x) * 3
+		copy(image.Pixels[offset:offset+3], header.palette[index][:])
+		x++
+
+		return nil
+
+	}
+
+	// Each byte holds one index in RLE8 and two in RLE4, high nibble first
+	indexOf := func(value byte, i int) int {
+		if header.compression == bmpRLE8 {
+			return int(value)
+		}
+		if i%2 == 0 {
+			return int(value >> 4)
+		}
+		return int(value & 0x0f)
+	}
+
+	position := 0
+	for {
+
+		if position+2 > len(data) {
+			return fmt.Errorf("%w: RLE data ends at row %d of %d without an end of bitmap", ErrBmpData, y,
+				header.height)
+		}
+
+		count, value := int(data[position]), data[position+1]
+		position += 2
+
+		if count > 0 {
+
+			for i := 0; i < count; i++ {
+				if err := put(indexOf(value, i)); err != nil {
+					return err
+				}
+			}
+			continue
+
+		}
+
+		switch value {
+		case 0:
+			x, y = 0, y+1
+		case 1:
+			return nil
+		case 2:
+			if position+2 > len(data) {
+				return fmt.Errorf("%w: RLE data ends in a delta", ErrBmpData)
+			}
+			x += int(data[position])
+			y += int(data[position+1])
+			position += 2
+		default:
+			// A literal run of value indices, padded to a whole number of 16 bit words
+			length := int(value)
+			if header.compression == bmpRLE4 {
+				length = (length + 1) / 2
+			}
+			if position+length > len(data) {
+				return fmt.Errorf("%w: RLE data ends in a literal run", ErrBmpData)
+			}
+			for i := 0; i < int(value); i++ {
+				if err := put(indexOf(data[position+i*header.bitCount/8], i)); err != nil {
+					return err
+				}
+			}
+			position += (length + 1) &^ 1
+		}
+
+	}
+
+}
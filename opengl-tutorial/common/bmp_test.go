@@ -0,0 +1,172 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// bmpFile builds a bitmap with an info header. extra holds the colour masks or palette, whose colour count is written
+// to the header for paletted images, and a negative height stores the rows top down.
+func bmpFile(width int, height int, bitCount int, compression uint32, extra []byte, pixels []byte) []byte {
+
+	var buffer bytes.Buffer
+	offset := bmpFileHeaderSize + bmpInfoHeaderSize + len(extra)
+	colours := 0
+	if bitCount <= 8 {
+		colours = len(extra) / 4
+	}
+
+	buffer.WriteString("BM")
+	binary.Write(&buffer, binary.LittleEndian, []uint32{uint32(offset + len(pixels)), 0, uint32(offset)})
+	binary.Write(&buffer, binary.LittleEndian, []int32{bmpInfoHeaderSize, int32(width), int32(height)})
+	binary.Write(&buffer, binary.LittleEndian, []uint16{1, uint16(bitCount)})
+	binary.Write(&buffer, binary.LittleEndian, []uint32{compression, uint32(len(pixels)), 0, 0, uint32(colours), 0})
+	buffer.Write(extra)
+	buffer.Write(pixels)
+
+	return buffer.Bytes()
+
+}
+
+func bmpMasks(masks ...uint32) []byte {
+
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, masks)
+
+	return buffer.Bytes()
+
+}
+
+// Blue then red, stored as BGRA
+var bmpTestPalette = []byte{255, 0, 0, 0, 0, 0, 255, 0}
+
+func TestLoadBmp(t *testing.T) {
+
+	image, err := LoadBmp("../07-model-loading/uvmap.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Width != 512 || image.Height != 512 || image.Format != ImageRGB8 {
+		t.Fatalf("Loaded a %dx%d %v image", image.Width, image.Height, image.Format)
+	}
+
+	// The file's rows are bottom up like the image's and its pixels are BGR
+	data, err := ioutil.ReadFile("../07-model-loading/uvmap.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixels := data[54:]
+	for i := 0; i < len(image.Pixels); i += 3 {
+		if image.Pixels[i] != pixels[i+2] || image.Pixels[i+1] != pixels[i+1] || image.Pixels[i+2] != pixels[i] {
+			t.Fatalf("Pixel %d is %v, want the reverse of %v", i/3, image.Pixels[i:i+3], pixels[i:i+3])
+		}
+	}
+
+	if _, err := LoadBmp("doesn't exist.bmp"); err == nil {
+		t.Error("Loaded a bitmap that doesn't exist")
+	}
+
+}
+
+func TestLoadBmpFrom(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format ImageFormat
+		pixels []byte
+	}{
+		{
+			name:   "paletted",
+			data:   bmpFile(2, 2, 8, bmpRGB, bmpTestPalette, []byte{0, 1, 0, 0, 1, 0, 0, 0}),
+			format: ImageRGB8,
+			pixels: []byte{0, 0, 255, 255, 0, 0, 255, 0, 0, 0, 0, 255},
+		},
+		{
+			name:   "top down",
+			data:   bmpFile(1, -2, 24, bmpRGB, nil, []byte{1, 2, 3, 0, 4, 5, 6, 0}),
+			format: ImageRGB8,
+			pixels: []byte{6, 5, 4, 3, 2, 1},
+		},
+		{
+			name: "bit fields with alpha",
+			data: bmpFile(1, 1, 32, bmpAlphaBitfields, bmpMasks(0xff, 0xff00, 0xff0000, 0xff000000),
+				[]byte{10, 20, 30, 40}),
+			format: ImageRGBA8,
+			pixels: []byte{10, 20, 30, 40},
+		},
+		{
+			name:   "565",
+			data:   bmpFile(2, 1, 16, bmpBitfields, bmpMasks(0xf800, 0x07e0, 0x001f), []byte{0x00, 0xf8, 0x1f, 0x00}),
+			format: ImageRGB8,
+			pixels: []byte{255, 0, 0, 0, 0, 255},
+		},
+		{
+			name:   "RLE8",
+			data:   bmpFile(2, 2, 8, bmpRLE8, bmpTestPalette, []byte{2, 1, 0, 0, 0, 2, 1, 0, 0, 1}),
+			format: ImageRGB8,
+			pixels: []byte{255, 0, 0, 255, 0, 0, 0, 0, 255, 0, 0, 255},
+		},
+		{
+			name:   "RLE4 literal",
+			data:   bmpFile(3, 1, 4, bmpRLE4, bmpTestPalette, []byte{0, 3, 0x10, 0x10, 0, 1}),
+			format: ImageRGB8,
+			pixels: []byte{255, 0, 0, 0, 0, 255, 255, 0, 0},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadBmpFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || !bytes.Equal(image.Pixels, test.pixels) {
+			t.Errorf("%s: %v pixels %v, want %v %v", test.name, image.Format, image.Pixels, test.format, test.pixels)
+		}
+
+	}
+
+}
+
+func TestLoadBmpFromInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too short", []byte("BM"), ErrBmpHeader},
+		{"not a bitmap", []byte("PK" + strings.Repeat("\x00", 100)), ErrBmpHeader},
+		{"info header past the end", bmpFile(1, 1, 24, bmpRGB, nil, nil)[:40], ErrBmpHeader},
+		{"no pixels", bmpFile(0, 1, 24, bmpRGB, nil, nil), ErrBmpHeader},
+		{"bit fields with 24 bits", bmpFile(1, 1, 24, bmpBitfields, bmpMasks(0xff, 0xff00, 0xff0000), nil),
+			ErrBmpHeader},
+		{"overlapping masks", bmpFile(1, 1, 16, bmpBitfields, bmpMasks(0xff00, 0x0ff0, 0x000f), nil), ErrBmpHeader},
+		{"split mask", bmpFile(1, 1, 16, bmpBitfields, bmpMasks(0xf00f, 0x0f00, 0x00f0), nil), ErrBmpHeader},
+		{"mask past the pixel", bmpFile(1, 1, 16, bmpBitfields, bmpMasks(0x1f0000, 0x07e0, 0x001f), nil),
+			ErrBmpHeader},
+		{"file ends in the masks", bmpFile(1, 1, 32, bmpBitfields, bmpMasks(0xff, 0xff00), nil), ErrBmpHeader},
+		{"file ends in the palette", bmpFile(1, 1, 8, bmpRGB, nil, nil), ErrBmpHeader},
+		{"JPEG", bmpFile(1, 1, 24, 4, nil, nil), ErrBmpUnsupported},
+		{"short pixel data", bmpFile(2, 2, 24, bmpRGB, nil, make([]byte, 10)), ErrBmpData},
+		{"palette index past the palette", bmpFile(1, 1, 8, bmpRGB, bmpTestPalette, []byte{2}), ErrBmpData},
+		{"RLE run past the row", bmpFile(2, 2, 8, bmpRLE8, bmpTestPalette, []byte{3, 0, 0, 1}), ErrBmpData},
+		{"RLE delta past the top", bmpFile(2, 2, 8, bmpRLE8, bmpTestPalette, []byte{0, 2, 0, 5, 1, 0, 0, 1}),
+			ErrBmpData},
+		{"RLE without an end", bmpFile(2, 2, 8, bmpRLE8, bmpTestPalette, []byte{2, 0}), ErrBmpData},
+		{"RLE literal past the end", bmpFile(2, 2, 8, bmpRLE8, bmpTestPalette, []byte{0, 4, 0, 0}), ErrBmpData},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadBmpFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
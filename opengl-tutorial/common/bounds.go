@@ -0,0 +1,522 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// AABB is an axis aligned bounding box. An empty box has Min above Max so adding any point to it works.
+type AABB struct {
+	Min mgl32.Vec3
+	Max mgl32.Vec3
+}
+
+func EmptyAABB() AABB {
+
+	inf := float32(math.Inf(1))
+	return AABB{Min: mgl32.Vec3{inf, inf, inf}, Max: mgl32.Vec3{-inf, -inf, -inf}}
+
+}
+
+func ComputeAABB(points []mgl32.Vec3) AABB {
+
+	box := EmptyAABB()
+	for _, point := range points {
+		box = box.Extend(point)
+	}
+
+	return box
+
+}
+
+func (box AABB) IsEmpty() bool {
+	return box.Min.X() > box.Max.X() || box.Min.Y() > box.Max.Y() || box.Min.Z() > box.Max.Z()
+}
+
+// Extend grows the box to take in point
+func (box AABB) Extend(point mgl32.Vec3) AABB {
+
+	for c := 0; c < 3; c++ {
+		box.Min[c] = float32(math.Min(float64(box.Min[c]), float64(point[c])))
+		box.Max[c] = float32(math.Max(float64(box.Max[c]), float64(point[c])))
+	}
+
+	return box
+
+}
+
+func (box AABB) Union(other AABB) AABB {
+
+	if other.IsEmpty() {
+		return box
+	}
+
+	return box.Extend(other.Min).Extend(other.Max)
+
+}
+
+func (box AABB) Center() mgl32.Vec3 {
+	return box.Min.Add(box.Max).Mul(0.5)
+}
+
+// Extents is half the size of the box along each axis
+func (box AABB) Extents() mgl32.Vec3 {
+	return box.Max.Sub(box.Min).Mul(0.5)
+}
+
+func (box AABB) Contains(point mgl32.Vec3) bool {
+
+	return point.X() >= box.Min.X() && point.X() <= box.Max.X() &&
+		point.Y() >= box.Min.Y() && point.Y() <= box.Max.Y() &&
+		point.Z() >= box.Min.Z() && point.Z() <= box.Max.Z()
+
+}
+
+// Intersects reports whether two boxes overlap, boxes that only touch count
+func (box AABB) Intersects(other AABB) bool {
+
+	for c := 0; c < 3; c++ {
+		if box.Max[c] < other.Min[c] || other.Max[c] < box.Min[c] {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// Transform returns the box around this one after it's moved by model, which is larger than the box itself when
+// model rotates it
+func (box AABB) Transform(model mgl32.Mat4) AABB {
+
+	if box.IsEmpty() {
+		return box
+	}
+
+	// Each output axis starts at the translation and takes the smaller and larger end of every rotated input axis,
+	// from "Transforming Axis-Aligned Bounding Boxes" by Jim Arvo
+	transformed := AABB{Min: model.Col(3).Vec3(), Max: model.Col(3).Vec3()}
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+
+			a := model.At(row, column) * box.Min[column]
+			b := model.At(row, column) * box.Max[column]
+			transformed.Min[row] += float32(math.Min(float64(a), float64(b)))
+			transformed.Max[row] += float32(math.Max(float64(a), float64(b)))
+
+		}
+	}
+
+	return transformed
+
+}
+
+// IntersectRay returns the distance along direction, in multiples of its length, at which a ray first enters the box.
+// Rays starting inside the box hit at 0.
+func (box AABB) IntersectRay(origin mgl32.Vec3, direction mgl32.Vec3) (float32, bool) {
+
+	near, far := math.Inf(-1), math.Inf(1)
+
+	for c := 0; c < 3; c++ {
+
+		if direction[c] == 0 {
+			// Parallel to the slab, it has to start between its planes
+			if origin[c] < box.Min[c] || origin[c] > box.Max[c] {
+				return 0, false
+			}
+			continue
+		}
+
+		inverse := 1 / float64(direction[c])
+		t1 := (float64(box.Min[c]) - float64(origin[c])) * inverse
+		t2 := (float64(box.Max[c]) - float64(origin[c])) * inverse
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+
+		near = math.Max(near, t1)
+		far = math.Min(far, t2)
+		if near > far {
+			return 0, false
+		}
+
+	}
+
+	if far < 0 {
+		return 0, false
+	}
+
+	return float32(math.Max(near, 0)), true
+
+}
+
+// Corners returns the eight corners of the box
+func (box AABB) Corners() [8]mgl32.Vec3 {
+
+	var corners [8]mgl32.Vec3
+	for i := range corners {
+		for c := 0; c < 3; c++ {
+			if i&(1<<uint(c)) != 0 {
+				corners[i][c] = box.Max[c]
+			} else {
+				corners[i][c] = box.Min[c]
+			}
+		}
+	}
+
+	return corners
+
+}
+
+type BoundingSphere struct {
+	Center mgl32.Vec3
+	Radius float32
+}
+
+// RitterSphere is Jack Ritter's quick bounding sphere, usually within 5-20% of the smallest one
+func RitterSphere(points []mgl32.Vec3) BoundingSphere {
+
+	if len(points) == 0 {
+		return BoundingSphere{}
+	}
+
+	// Start from two far apart points: the one furthest from an arbitrary point, then the one furthest from that
+	furthest := func(from mgl32.Vec3) mgl32.Vec3 {
+		best, bestDistance := from, float32(-1)
+		for _, point := range points {
+			if distance := point.Sub(from).LenSqr(); distance > bestDistance {
+				best, bestDistance = point, distance
+			}
+		}
+		return best
+	}
+
+	a := furthest(points[0])
+	b := furthest(a)
+	sphere := BoundingSphere{Center: a.Add(b).Mul(0.5), Radius: b.Sub(a).Len() / 2}
+
+	// Grow the sphere just enough to take in any point left outside
+	for _, point := range points {
+
+		distance := point.Sub(sphere.Center).Len()
+		if distance <= sphere.Radius {
+			continue
+		}
+
+		radius := (sphere.Radius + distance) / 2
+		sphere.Center = sphere.Center.Add(point.Sub(sphere.Center).Mul((radius - sphere.Radius) / distance))
+		sphere.Radius = radius
+
+	}
+
+	return sphere
+
+}
+
+// MinimalSphere is the smallest sphere around the points, found with Welzl's algorithm. The points are visited in a
+// shuffled order so the expected running time is linear, the shuffle is seeded so the result is repeatable.
+func MinimalSphere(points []mgl32.Vec3) BoundingSphere {
+
+	if len(points) == 0 {
+		return BoundingSphere{}
+	}
+
+	shuffled := make([]mgl32.Vec3, len(points))
+	copy(shuffled, points)
+	random := rand.New(rand.NewSource(1))
+	random.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	// Welzl's recursion unrolled into loops, each level fixing one more point on the boundary
+	sphere := BoundingSphere{Center: shuffled[0]}
+	for i := 1; i < len(shuffled); i++ {
+
+		if sphere.containsApprox(shuffled[i]) {
+			continue
+		}
+
+		sphere = BoundingSphere{Center: shuffled[i]}
+		for j := 0; j < i; j++ {
+
+			if sphere.containsApprox(shuffled[j]) {
+				continue
+			}
+
+			sphere = sphereFromPoints(shuffled[i], shuffled[j])
+			for k := 0; k < j; k++ {
+
+				if sphere.containsApprox(shuffled[k]) {
+					continue
+				}
+
+				sphere = sphereFromPoints(shuffled[i], shuffled[j], shuffled[k])
+				for l := 0; l < k; l++ {
+					if !sphere.containsApprox(shuffled[l]) {
+						sphere = sphereFromPoints(shuffled[i], shuffled[j], shuffled[k], shuffled[l])
+					}
+				}
+
+			}
+
+		}
+
+	}
+
+	return sphere
+
+}
+
+// containsApprox allows for the rounding of the circumspheres MinimalSphere builds
+func (sphere BoundingSphere) containsApprox(point mgl32.Vec3) bool {
+	return point.Sub(sphere.Center).Len() <= sphere.Radius*(1+1e-5)+1e-6
+}
+
+// sphereFromPoints is the smallest sphere with all of two to four points on its surface. Points in a degenerate
+// arrangement fall back to the largest sphere through a pair of them, which holds the rest.
+func sphereFromPoints(points ...mgl32.Vec3) BoundingSphere {
+
+	pairSphere := func() BoundingSphere {
+		var best BoundingSphere
+		for i := range points {
+			for j := i + 1; j < len(points); j++ {
+				if candidate := sphereFromPoints(points[i], points[j]); candidate.Radius > best.Radius {
+					best = candidate
+				}
+			}
+		}
+		return best
+	}
+
+	a := points[0]
+	switch len(points) {
+	case 2:
+		return BoundingSphere{Center: a.Add(points[1]).Mul(0.5), Radius: points[1].Sub(a).Len() / 2}
+
+	case 3:
+		// Circumcircle of the triangle, in its plane
+		ab, ac := points[1].Sub(a), points[2].Sub(a)
+		normal := ab.Cross(ac)
+		denominator := 2 * normal.LenSqr()
+		if denominator < 1e-12 {
+			return pairSphere()
+		}
+
+		offset := normal.Cross(ab).Mul(ac.LenSqr()).Add(ac.Cross(normal).Mul(ab.LenSqr())).Mul(1 / denominator)
+		return BoundingSphere{Center: a.Add(offset), Radius: offset.Len()}
+
+	default:
+		// Circumsphere of the tetrahedron
+		ab, ac, ad := points[1].Sub(a), points[2].Sub(a), points[3].Sub(a)
+		denominator := 2 * ab.Dot(ac.Cross(ad))
+		if float32(math.Abs(float64(denominator))) < 1e-12 {
+			return pairSphere()
+		}
+
+		offset := ac.Cross(ad).Mul(ab.LenSqr()).
+			Add(ad.Cross(ab).Mul(ac.LenSqr())).
+			Add(ab.Cross(ac).Mul(ad.LenSqr())).
+			Mul(1 / denominator)
+
+		return BoundingSphere{Center: a.Add(offset), Radius: offset.Len()}
+	}
+
+}
+
+func (sphere BoundingSphere) Contains(point mgl32.Vec3) bool {
+	return point.Sub(sphere.Center).LenSqr() <= sphere.Radius*sphere.Radius
+}
+
+func (sphere BoundingSphere) Intersects(other BoundingSphere) bool {
+
+	radii := sphere.Radius + other.Radius
+	return sphere.Center.Sub(other.Center).LenSqr() <= radii*radii
+
+}
+
+// Transform moves the sphere by model, scaling its radius by the largest scale of the matrix so it still holds the
+// mesh under non uniform scaling
+func (sphere BoundingSphere) Transform(model mgl32.Mat4) BoundingSphere {
+
+	return BoundingSphere{
+		Center: mgl32.TransformCoordinate(sphere.Center, model),
+		Radius: sphere.Radius * mgl32.ExtractMaxScale(model),
+	}
+
+}
+
+// IntersectsFrustum reports whether any of the sphere might be inside the frustum. Spheres near the corners outside of
+// it can pass, which is fine for culling.
+func (sphere BoundingSphere) IntersectsFrustum(frustum *Frustum) bool {
+	return frustum.ContainsSphere(sphere) != Outside
+}
+
+// OBB is an oriented bounding box, Axes are unit vectors and HalfExtents the distance from the center to the faces
+// along each of them
+type OBB struct {
+	Center      mgl32.Vec3
+	Axes        [3]mgl32.Vec3
+	HalfExtents mgl32.Vec3
+}
+
+// ComputeOBB fits a box along the principal axes of the points, the eigenvectors of their covariance matrix. It's a
+// good fit for elongated meshes but not always the smallest box.
+func ComputeOBB(points []mgl32.Vec3) OBB {
+
+	if len(points) == 0 {
+		return OBB{Axes: [3]mgl32.Vec3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+	}
+
+	var mean [3]float64
+	for _, point := range points {
+		for c := 0; c < 3; c++ {
+			mean[c] += float64(point[c])
+		}
+	}
+	for c := range mean {
+		mean[c] /= float64(len(points))
+	}
+
+	var covariance [3][3]float64
+	for _, point := range points {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				covariance[i][j] += (float64(point[i]) - mean[i]) * (float64(point[j]) - mean[j])
+			}
+		}
+	}
+
+	vectors := symmetricEigenvectors(covariance)
+
+	box := OBB{}
+	var low, high [3]float32
+	for a := 0; a < 3; a++ {
+
+		box.Axes[a] = mgl32.Vec3{float32(vectors[0][a]), float32(vectors[1][a]), float32(vectors[2][a])}.Normalize()
+
+		low[a], high[a] = float32(math.Inf(1)), float32(math.Inf(-1))
+		for _, point := range points {
+			projection := point.Dot(box.Axes[a])
+			low[a] = float32(math.Min(float64(low[a]), float64(projection)))
+			high[a] = float32(math.Max(float64(high[a]), float64(projection)))
+		}
+
+	}
+
+	// Keep the axes right handed so the box can be turned into a rotation matrix
+	if box.Axes[0].Cross(box.Axes[1]).Dot(box.Axes[2]) < 0 {
+		box.Axes[2] = box.Axes[2].Mul(-1)
+		low[2], high[2] = -high[2], -low[2]
+	}
+
+	for a := 0; a < 3; a++ {
+		box.Center = box.Center.Add(box.Axes[a].Mul((low[a] + high[a]) / 2))
+		box.HalfExtents[a] = (high[a] - low[a]) / 2
+	}
+
+	return box
+
+}
+
+// symmetricEigenvectors diagonalizes a symmetric matrix with Jacobi rotations, the eigenvectors are the columns of the
+// result
+func symmetricEigenvectors(matrix [3][3]float64) [3][3]float64 {
+
+	vectors := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	for sweep := 0; sweep < 50; sweep++ {
+
+		offDiagonal := matrix[0][1]*matrix[0][1] + matrix[0][2]*matrix[0][2] + matrix[1][2]*matrix[1][2]
+		if offDiagonal < 1e-24 {
+			break
+		}
+
+		for p := 0; p < 2; p++ {
+			for q := p + 1; q < 3; q++ {
+
+				if matrix[p][q] == 0 {
+					continue
+				}
+
+				// Rotation angle that zeroes matrix[p][q]
+				theta := (matrix[q][q] - matrix[p][p]) / (2 * matrix[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 3; k++ {
+					kp, kq := matrix[k][p], matrix[k][q]
+					matrix[k][p], matrix[k][q] = c*kp-s*kq, s*kp+c*kq
+				}
+				for k := 0; k < 3; k++ {
+					pk, qk := matrix[p][k], matrix[q][k]
+					matrix[p][k], matrix[q][k] = c*pk-s*qk, s*pk+c*qk
+				}
+				for k := 0; k < 3; k++ {
+					kp, kq := vectors[k][p], vectors[k][q]
+					vectors[k][p], vectors[k][q] = c*kp-s*kq, s*kp+c*kq
+				}
+
+			}
+		}
+
+	}
+
+	return vectors
+
+}
+
+// Transform moves the box by model, scaling its extents along with its axes
+func (box OBB) Transform(model mgl32.Mat4) OBB {
+
+	transformed := OBB{Center: mgl32.TransformCoordinate(box.Center, model)}
+	for a := 0; a < 3; a++ {
+
+		axis := model.Mul4x1(box.Axes[a].Vec4(0)).Vec3()
+		length := axis.Len()
+		transformed.HalfExtents[a] = box.HalfExtents[a] * length
+		if length > 0 {
+			axis = axis.Mul(1 / length)
+		}
+		transformed.Axes[a] = axis
+
+	}
+
+	return transformed
+
+}
+
+func (box OBB) Corners() [8]mgl32.Vec3 {
+
+	var corners [8]mgl32.Vec3
+	for i := range corners {
+
+		corner := box.Center
+		for a := 0; a < 3; a++ {
+			offset := box.Axes[a].Mul(box.HalfExtents[a])
+			if i&(1<<uint(a)) != 0 {
+				corner = corner.Add(offset)
+			} else {
+				corner = corner.Sub(offset)
+			}
+		}
+		corners[i] = corner
+
+	}
+
+	return corners
+
+}
+
+// AABB is the axis aligned box around the oriented one
+func (box OBB) AABB() AABB {
+
+	corners := box.Corners()
+	return ComputeAABB(corners[:])
+
+}
@@ -0,0 +1,312 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// boundsTestPoints are point sets the bounding volumes have to hold, including the degenerate ones
+func boundsTestPoints(t *testing.T) map[string][]mgl32.Vec3 {
+
+	suzanne, _, _, err := LoadObj("../08-basic-shading/suzanne.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(1))
+	var cloud, line []mgl32.Vec3
+	for i := 0; i < 1000; i++ {
+		cloud = append(cloud, mgl32.Vec3{random.Float32()*4 - 2, random.Float32() - 3, random.Float32()*10 + 5})
+		line = append(line, mgl32.Vec3{1, 2, 3}.Mul(random.Float32()))
+	}
+
+	return map[string][]mgl32.Vec3{
+		"suzanne":    suzanne,
+		"cloud":      cloud,
+		"line":       line,
+		"one point":  {{1, 2, 3}},
+		"duplicates": {{1, 1, 1}, {1, 1, 1}, {-1, 0, 0}, {-1, 0, 0}},
+		"octahedron": {{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}},
+	}
+
+}
+
+func TestAABBTransform(t *testing.T) {
+
+	box := AABB{Min: mgl32.Vec3{-1, 0, 2}, Max: mgl32.Vec3{3, 1, 4}}
+	models := map[string]mgl32.Mat4{
+		"identity":    mgl32.Ident4(),
+		"translation": mgl32.Translate3D(5, -2, 1),
+		"rotation":    mgl32.HomogRotate3D(1, mgl32.Vec3{1, 2, 3}.Normalize()),
+		"everything": mgl32.Translate3D(5, -2, 1).Mul4(mgl32.HomogRotate3DY(2.5)).Mul4(mgl32.Scale3D(2, -1, 0.5)).
+			Mul4(mgl32.HomogRotate3DX(0.3)),
+	}
+
+	// The transformed box is exactly the box around the transformed corners
+	for name, model := range models {
+
+		var corners []mgl32.Vec3
+		for _, corner := range box.Corners() {
+			corners = append(corners, mgl32.TransformCoordinate(corner, model))
+		}
+
+		want := ComputeAABB(corners)
+		if got := box.Transform(model); !nearVec3(got.Min, want.Min, 1e-5) || !nearVec3(got.Max, want.Max, 1e-5) {
+			t.Errorf("%s: transformed to %v, want %v", name, got, want)
+		}
+
+	}
+
+	// A unit cube turned 45 degrees about Z is sqrt(2) wide
+	cube := AABB{Min: mgl32.Vec3{-0.5, -0.5, -0.5}, Max: mgl32.Vec3{0.5, 0.5, 0.5}}
+	turned := cube.Transform(mgl32.HomogRotate3DZ(math.Pi / 4))
+	half := float32(math.Sqrt2 / 2)
+	if !nearVec3(turned.Min, mgl32.Vec3{-half, -half, -0.5}, 1e-6) ||
+		!nearVec3(turned.Max, mgl32.Vec3{half, half, 0.5}, 1e-6) {
+		t.Errorf("Turned cube is %v", turned)
+	}
+
+	if !EmptyAABB().Transform(mgl32.Translate3D(1, 2, 3)).IsEmpty() {
+		t.Error("Transformed empty box isn't empty")
+	}
+
+}
+
+func TestBoundingSpheres(t *testing.T) {
+
+	for name, points := range boundsTestPoints(t) {
+
+		ritter, minimal := RitterSphere(points), MinimalSphere(points)
+		for _, point := range points {
+			if !ritter.containsApprox(point) {
+				t.Fatalf("%s: Ritter sphere %v doesn't hold %v", name, ritter, point)
+			}
+			if !minimal.containsApprox(point) {
+				t.Fatalf("%s: minimal sphere %v doesn't hold %v", name, minimal, point)
+			}
+		}
+
+		if minimal.Radius > ritter.Radius*(1+1e-5) {
+			t.Errorf("%s: minimal sphere radius %v is larger than Ritter's %v", name, minimal.Radius, ritter.Radius)
+		}
+
+	}
+
+	// The smallest sphere around an octahedron is the unit sphere, and around a segment it's centered on it
+	if sphere := MinimalSphere(boundsTestPoints(t)["octahedron"]); !nearVec3(sphere.Center, mgl32.Vec3{}, 1e-6) ||
+		math.Abs(float64(sphere.Radius-1)) > 1e-6 {
+		t.Errorf("Octahedron sphere is %v", sphere)
+	}
+	segment := []mgl32.Vec3{{0, 0, 0}, {0, 0, 4}, {0, 0, 1}}
+	if sphere := MinimalSphere(segment); !nearVec3(sphere.Center, mgl32.Vec3{0, 0, 2}, 1e-6) ||
+		math.Abs(float64(sphere.Radius-2)) > 1e-6 {
+		t.Errorf("Segment sphere is %v", sphere)
+	}
+
+}
+
+func TestComputeOBB(t *testing.T) {
+
+	orthonormal := func(box OBB) bool {
+		for a := 0; a < 3; a++ {
+			if math.Abs(float64(box.Axes[a].Len()-1)) > 1e-5 ||
+				math.Abs(float64(box.Axes[a].Dot(box.Axes[(a+1)%3]))) > 1e-5 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for name, points := range boundsTestPoints(t) {
+
+		box := ComputeOBB(points)
+		if !orthonormal(box) {
+			t.Errorf("%s: axes %v aren't orthonormal", name, box.Axes)
+		}
+
+		for _, point := range points {
+			offset := point.Sub(box.Center)
+			for a := 0; a < 3; a++ {
+				if distance := offset.Dot(box.Axes[a]); math.Abs(float64(distance)) > float64(box.HalfExtents[a])+1e-4 {
+					t.Fatalf("%s: %v is %v along axis %v, past %v", name, point, distance, a, box.HalfExtents[a])
+				}
+			}
+		}
+
+		// Turning and scaling the box keeps its axes orthonormal
+		model := mgl32.HomogRotate3D(0.7, mgl32.Vec3{1, 1, 0}.Normalize()).Mul4(mgl32.Scale3D(3, 3, 3))
+		if transformed := box.Transform(model); !orthonormal(transformed) {
+			t.Errorf("%s: transformed axes %v aren't orthonormal", name, transformed.Axes)
+		}
+
+	}
+
+	// A long thin box follows the line it's fitted to
+	box := ComputeOBB(boundsTestPoints(t)["line"])
+	direction := mgl32.Vec3{1, 2, 3}.Normalize()
+	aligned := false
+	for _, axis := range box.Axes {
+		aligned = aligned || math.Abs(float64(axis.Dot(direction))) > 0.9999
+	}
+	if !aligned {
+		t.Errorf("No axis of %v follows the line %v", box.Axes, direction)
+	}
+
+}
+
+func TestAABBIntersectRay(t *testing.T) {
+
+	box := AABB{Min: mgl32.Vec3{-1, -1, -1}, Max: mgl32.Vec3{1, 1, 1}}
+
+	tests := []struct {
+		name      string
+		origin    mgl32.Vec3
+		direction mgl32.Vec3
+		hit       bool
+		distance  float32
+	}{
+		{"straight on", mgl32.Vec3{0, 0, 5}, mgl32.Vec3{0, 0, -1}, true, 4},
+		{"direction length counts", mgl32.Vec3{0, 0, 5}, mgl32.Vec3{0, 0, -2}, true, 2},
+		{"diagonal", mgl32.Vec3{-3, -3, -3}, mgl32.Vec3{1, 1, 1}, true, 2},
+		{"grazing an edge", mgl32.Vec3{1, 1, 5}, mgl32.Vec3{0, 0, -1}, true, 4},
+		{"from inside", mgl32.Vec3{0.5, 0, 0}, mgl32.Vec3{1, 0, 0}, true, 0},
+		{"away from the box", mgl32.Vec3{0, 0, 5}, mgl32.Vec3{0, 0, 1}, false, 0},
+		{"past the side", mgl32.Vec3{2, 0, 5}, mgl32.Vec3{0, 0, -1}, false, 0},
+		{"diagonal miss", mgl32.Vec3{-3, 0, 0}, mgl32.Vec3{1, 1, 0}, false, 0},
+		{"parallel outside a slab", mgl32.Vec3{0, 1.5, 5}, mgl32.Vec3{1, 0, -1}, false, 0},
+	}
+
+	for _, test := range tests {
+
+		distance, hit := box.IntersectRay(test.origin, test.direction)
+		if hit != test.hit || math.Abs(float64(distance-test.distance)) > 1e-6 {
+			t.Errorf("%s: hit %v at %v, want %v at %v", test.name, hit, distance, test.hit, test.distance)
+		}
+
+	}
+
+}
+
+func TestAABBIntersects(t *testing.T) {
+
+	box := AABB{Min: mgl32.Vec3{-1, -1, -1}, Max: mgl32.Vec3{1, 1, 1}}
+	at := func(min, max mgl32.Vec3) AABB {
+		return AABB{Min: min, Max: max}
+	}
+
+	tests := []struct {
+		name       string
+		other      AABB
+		intersects bool
+	}{
+		{"same box", box, true},
+		{"inside", at(mgl32.Vec3{-0.5, -0.5, -0.5}, mgl32.Vec3{0.5, 0.5, 0.5}), true},
+		{"around", at(mgl32.Vec3{-2, -2, -2}, mgl32.Vec3{2, 2, 2}), true},
+		{"overlapping a corner", at(mgl32.Vec3{0.5, 0.5, 0.5}, mgl32.Vec3{2, 2, 2}), true},
+		{"crossing through", at(mgl32.Vec3{-3, -0.5, -0.5}, mgl32.Vec3{3, 0.5, 0.5}), true},
+		{"touching a face", at(mgl32.Vec3{1, -1, -1}, mgl32.Vec3{3, 1, 1}), true},
+		{"touching an edge", at(mgl32.Vec3{1, 1, -1}, mgl32.Vec3{2, 2, 1}), true},
+		{"touching a corner", at(mgl32.Vec3{-2, -2, -2}, mgl32.Vec3{-1, -1, -1}), true},
+		{"flat box on a face", at(mgl32.Vec3{-1, 1, -1}, mgl32.Vec3{1, 1, 1}), true},
+		{"just past a face", at(mgl32.Vec3{1.001, -1, -1}, mgl32.Vec3{3, 1, 1}), false},
+		{"just below", at(mgl32.Vec3{-1, -3, -1}, mgl32.Vec3{1, -1.001, 1}), false},
+		{"past on one axis only", at(mgl32.Vec3{-0.5, -0.5, 1.001}, mgl32.Vec3{0.5, 0.5, 2}), false},
+		{"diagonal gap", at(mgl32.Vec3{1.001, 1.001, 1.001}, mgl32.Vec3{2, 2, 2}), false},
+		{"empty box", EmptyAABB(), false},
+	}
+
+	for _, test := range tests {
+
+		// Overlap doesn't depend on which box asks
+		if intersects := box.Intersects(test.other); intersects != test.intersects {
+			t.Errorf("%s: intersects %v, want %v", test.name, intersects, test.intersects)
+		}
+		if intersects := test.other.Intersects(box); intersects != test.intersects {
+			t.Errorf("%s: reversed intersects %v, want %v", test.name, intersects, test.intersects)
+		}
+
+	}
+
+}
+
+func TestBoundingSphereIntersects(t *testing.T) {
+
+	sphere := BoundingSphere{Center: mgl32.Vec3{1, 2, 3}, Radius: 2}
+
+	tests := []struct {
+		name       string
+		other      BoundingSphere
+		intersects bool
+	}{
+		{"same sphere", sphere, true},
+		{"inside", BoundingSphere{Center: mgl32.Vec3{1.5, 2, 3}, Radius: 0.5}, true},
+		{"around", BoundingSphere{Center: mgl32.Vec3{1, 2, 3}, Radius: 10}, true},
+		{"overlapping", BoundingSphere{Center: mgl32.Vec3{4, 2, 3}, Radius: 2}, true},
+		{"touching", BoundingSphere{Center: mgl32.Vec3{1, 2, 6}, Radius: 1}, true},
+		{"touching diagonally", BoundingSphere{Center: mgl32.Vec3{4, 6, 3}, Radius: 3}, true},
+		{"point on the surface", BoundingSphere{Center: mgl32.Vec3{1, 0, 3}}, true},
+		{"just apart", BoundingSphere{Center: mgl32.Vec3{1, 2, 6.001}, Radius: 1}, false},
+		{"just apart diagonally", BoundingSphere{Center: mgl32.Vec3{4, 6, 3}, Radius: 2.999}, false},
+		{"far apart", BoundingSphere{Center: mgl32.Vec3{-10, 2, 3}, Radius: 1}, false},
+	}
+
+	for _, test := range tests {
+
+		if intersects := sphere.Intersects(test.other); intersects != test.intersects {
+			t.Errorf("%s: intersects %v, want %v", test.name, intersects, test.intersects)
+		}
+		if intersects := test.other.Intersects(sphere); intersects != test.intersects {
+			t.Errorf("%s: reversed intersects %v, want %v", test.name, intersects, test.intersects)
+		}
+
+	}
+
+}
+
+func TestBoundingSphereIntersectsFrustum(t *testing.T) {
+
+	// An orthographic projection looking down -Z sees exactly the cube from -1 to 1
+	box := NewFrustum(mgl32.Ortho(-1, 1, -1, 1, -1, 1))
+
+	// A 90 degree perspective camera at the origin, seeing from 1 to 10 units down -Z
+	perspective := NewFrustum(mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 10))
+
+	// Its left plane runs through the origin and (-5, 0, -5), this point is 1 unit out from it
+	leftOfView := mgl32.Vec3{-5 - math.Sqrt2/2, 0, -5 + math.Sqrt2/2}
+
+	tests := []struct {
+		name       string
+		frustum    *Frustum
+		sphere     BoundingSphere
+		intersects bool
+	}{
+		{"inside the box", box, BoundingSphere{Radius: 0.5}, true},
+		{"around the box", box, BoundingSphere{Radius: 5}, true},
+		{"through a face", box, BoundingSphere{Center: mgl32.Vec3{1.5, 0, 0}, Radius: 1}, true},
+		{"touching the right", box, BoundingSphere{Center: mgl32.Vec3{2, 0, 0}, Radius: 1}, true},
+		{"touching the top", box, BoundingSphere{Center: mgl32.Vec3{0, 1.5, 0}, Radius: 0.5}, true},
+		{"touching the far plane", box, BoundingSphere{Center: mgl32.Vec3{0, 0, -1.25}, Radius: 0.25}, true},
+		{"just right of the box", box, BoundingSphere{Center: mgl32.Vec3{2.001, 0, 0}, Radius: 1}, false},
+		{"just below the box", box, BoundingSphere{Center: mgl32.Vec3{0, -1.501, 0}, Radius: 0.5}, false},
+		{"just past the near plane", box, BoundingSphere{Center: mgl32.Vec3{0, 0, 1.251}, Radius: 0.25}, false},
+
+		{"in view", perspective, BoundingSphere{Center: mgl32.Vec3{0, 0, -5}, Radius: 1}, true},
+		{"across the near plane", perspective, BoundingSphere{Center: mgl32.Vec3{0, 0, -0.5}, Radius: 0.6}, true},
+		{"across the far plane", perspective, BoundingSphere{Center: mgl32.Vec3{0, 0, -10.5}, Radius: 0.6}, true},
+		{"short of the near plane", perspective, BoundingSphere{Center: mgl32.Vec3{0, 0, -0.5}, Radius: 0.4}, false},
+		{"behind the camera", perspective, BoundingSphere{Center: mgl32.Vec3{0, 0, 5}, Radius: 1}, false},
+
+		{"touching the left side", perspective, BoundingSphere{Center: leftOfView, Radius: 1.001}, true},
+		{"clear of the left side", perspective, BoundingSphere{Center: leftOfView, Radius: 0.999}, false},
+	}
+
+	for _, test := range tests {
+		if intersects := test.sphere.IntersectsFrustum(test.frustum); intersects != test.intersects {
+			t.Errorf("%s: intersects %v, want %v", test.name, intersects, test.intersects)
+		}
+	}
+
+}
@@ -0,0 +1,370 @@
+package common
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Surface area heuristic settings: the number of buckets split planes are chosen from, the most triangles a leaf may
+// hold, and the cost of visiting a node relative to testing a triangle
+const (
+	bvhBins          = 12
+	bvhMaxLeafSize   = 8
+	bvhTraversalCost = 1.0
+)
+
+// RayHit is where a ray meets a triangle. U and V are the barycentric weights of the triangle's second and third
+// vertices, and Distance is in multiples of the ray direction's length.
+type RayHit struct {
+	Triangle int
+	U, V     float32
+	Distance float32
+}
+
+// BVH is a bounding volume hierarchy over the triangles of a mesh, for casting rays against it
+type BVH struct {
+	indices  []uint32
+	vertices []mgl32.Vec3
+
+	nodes []bvhNode
+
+	// Triangle numbers in the order the leaves refer to them
+	triangles []int
+}
+
+// bvhNode is a leaf holding triangles[first:first+count] when count is above 0, otherwise its children are the nodes
+// at first and first+1
+type bvhNode struct {
+	bounds AABB
+	first  int
+	count  int
+}
+
+// NewBVH builds a hierarchy over an indexed triangle list such as IndexVBO's output, or over the triangles LoadObj
+// returns when indices is nil. Splits are chosen with the surface area heuristic over binned triangle centroids.
+func NewBVH(indices []uint32, vertices []mgl32.Vec3) *BVH {
+
+	if indices == nil {
+		indices = make([]uint32, len(vertices)/3*3)
+		for i := range indices {
+			indices[i] = uint32(i)
+		}
+	}
+
+	triangleCount := len(indices) / 3
+	bvh := &BVH{
+		indices:   indices,
+		vertices:  vertices,
+		triangles: make([]int, triangleCount),
+		nodes:     make([]bvhNode, 1, triangleCount*2+1),
+	}
+
+	bounds := make([]AABB, triangleCount)
+	centroids := make([]mgl32.Vec3, triangleCount)
+	for t := range bvh.triangles {
+
+		bvh.triangles[t] = t
+		a, b, c := bvh.triangle(t)
+		bounds[t] = EmptyAABB().Extend(a).Extend(b).Extend(c)
+		centroids[t] = bounds[t].Center()
+
+	}
+
+	bvh.build(0, 0, triangleCount, bounds, centroids)
+
+	return bvh
+
+}
+
+func (bvh *BVH) triangle(t int) (mgl32.Vec3, mgl32.Vec3, mgl32.Vec3) {
+	return bvh.vertices[bvh.indices[t*3]], bvh.vertices[bvh.indices[t*3+1]], bvh.vertices[bvh.indices[t*3+2]]
+}
+
+func surfaceArea(box AABB) float32 {
+
+	if box.IsEmpty() {
+		return 0
+	}
+
+	size := box.Max.Sub(box.Min)
+	return 2 * (size.X()*size.Y() + size.Y()*size.Z() + size.Z()*size.X())
+
+}
+
+// build fills in node for the triangles between start and end, splitting it if that's cheaper than a leaf
+func (bvh *BVH) build(node int, start int, end int, bounds []AABB, centroids []mgl32.Vec3) {
+
+	nodeBounds := EmptyAABB()
+	centroidBounds := EmptyAABB()
+	for _, t := range bvh.triangles[start:end] {
+		nodeBounds = nodeBounds.Union(bounds[t])
+		centroidBounds = centroidBounds.Extend(centroids[t])
+	}
+
+	count := end - start
+	bvh.nodes[node] = bvhNode{bounds: nodeBounds, first: start, count: count}
+	if count <= 2 {
+		return
+	}
+
+	// Find the cheapest bucket boundary along any axis
+	bestCost := float32(math.Inf(1))
+	bestAxis, bestSplit := -1, 0
+	extent := centroidBounds.Max.Sub(centroidBounds.Min)
+
+	for axis := 0; axis < 3; axis++ {
+
+		if extent[axis] <= 0 {
+			continue
+		}
+
+		var binCounts [bvhBins]int
+		var binBounds [bvhBins]AABB
+		for i := range binBounds {
+			binBounds[i] = EmptyAABB()
+		}
+
+		scale := bvhBins / extent[axis]
+		for _, t := range bvh.triangles[start:end] {
+			bin := bvhBin(centroids[t][axis], centroidBounds.Min[axis], scale)
+			binCounts[bin]++
+			binBounds[bin] = binBounds[bin].Union(bounds[t])
+		}
+
+		// Sweep from the right to get the area and count to the right of each boundary, then from the left
+		var rightAreas [bvhBins]float32
+		var rightCounts [bvhBins]int
+		right := EmptyAABB()
+		rightCount := 0
+		for bin := bvhBins - 1; bin > 0; bin-- {
+			right = right.Union(binBounds[bin])
+			rightCount += binCounts[bin]
+			rightAreas[bin] = surfaceArea(right)
+			rightCounts[bin] = rightCount
+		}
+
+		left := EmptyAABB()
+		leftCount := 0
+		for split := 1; split < bvhBins; split++ {
+
+			left = left.Union(binBounds[split-1])
+			leftCount += binCounts[split-1]
+			if leftCount == 0 || rightCounts[split] == 0 {
+				continue
+			}
+
+			cost := surfaceArea(left)*float32(leftCount) + rightAreas[split]*float32(rightCounts[split])
+			if cost < bestCost {
+				bestCost, bestAxis, bestSplit = cost, axis, split
+			}
+
+		}
+
+	}
+
+	parentArea := surfaceArea(nodeBounds)
+	if bestAxis >= 0 && parentArea > 0 {
+		bestCost = bvhTraversalCost + bestCost/parentArea
+	}
+
+	var middle int
+	switch {
+	case bestAxis >= 0 && (bestCost < float32(count) || count > bvhMaxLeafSize):
+		triangles := bvh.triangles[start:end]
+		scale := bvhBins / extent[bestAxis]
+		middle = start + partitionTriangles(triangles, func(t int) bool {
+			return bvhBin(centroids[t][bestAxis], centroidBounds.Min[bestAxis], scale) < bestSplit
+		})
+	case count > bvhMaxLeafSize:
+		// Every centroid is in the same place, split the list in half to keep the leaves small
+		middle = start + count/2
+	default:
+		return
+	}
+
+	children := len(bvh.nodes)
+	bvh.nodes = append(bvh.nodes, bvhNode{}, bvhNode{})
+	bvh.nodes[node].first = children
+	bvh.nodes[node].count = 0
+
+	bvh.build(children, start, middle, bounds, centroids)
+	bvh.build(children+1, middle, end, bounds, centroids)
+
+}
+
+func bvhBin(value float32, min float32, scale float32) int {
+
+	bin := int((value - min) * scale)
+	if bin >= bvhBins {
+		bin = bvhBins - 1
+	}
+
+	return bin
+
+}
+
+// partitionTriangles moves the triangles matching left to the front and returns how many there are
+func partitionTriangles(triangles []int, left func(t int) bool) int {
+
+	split := 0
+	for i, t := range triangles {
+		if left(t) {
+			triangles[i], triangles[split] = triangles[split], triangles[i]
+			split++
+		}
+	}
+
+	return split
+
+}
+
+// Intersect returns the closest triangle a ray hits within maxDistance, in multiples of the direction's length.
+// Triangles are hit from both sides.
+func (bvh *BVH) Intersect(origin mgl32.Vec3, direction mgl32.Vec3, maxDistance float32) (RayHit, bool) {
+	return bvh.traverse(origin, direction, maxDistance, false)
+}
+
+// IntersectAny returns the first hit found within maxDistance, which is faster than Intersect when it only matters
+// whether something is in the way, such as for line of sight
+func (bvh *BVH) IntersectAny(origin mgl32.Vec3, direction mgl32.Vec3, maxDistance float32) (RayHit, bool) {
+	return bvh.traverse(origin, direction, maxDistance, true)
+}
+
+func (bvh *BVH) traverse(origin mgl32.Vec3, direction mgl32.Vec3, maxDistance float32, any bool) (RayHit, bool) {
+
+	var hit RayHit
+	found := false
+	if len(bvh.triangles) == 0 {
+		return hit, false
+	}
+
+	var inverse mgl32.Vec3
+	for c := range inverse {
+		inverse[c] = 1 / direction[c]
+	}
+
+	// Enough for any tree built from a sensible mesh without allocating, append grows it for the rest
+	stack := make([]int, 1, 64)
+
+	for len(stack) > 0 {
+
+		node := &bvh.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if _, ok := rayBoxDistance(node.bounds, origin, inverse, maxDistance); !ok {
+			continue
+		}
+
+		if node.count > 0 {
+
+			for _, t := range bvh.triangles[node.first : node.first+node.count] {
+
+				a, b, c := bvh.triangle(t)
+				distance, u, v, ok := intersectTriangle(origin, direction, a, b, c)
+				if !ok || distance > maxDistance {
+					continue
+				}
+
+				hit = RayHit{Triangle: t, U: u, V: v, Distance: distance}
+				found = true
+				maxDistance = distance
+				if any {
+					return hit, true
+				}
+
+			}
+
+			continue
+
+		}
+
+		// Visit the nearer child first so the further one can often be skipped
+		near, far := node.first, node.first+1
+		nearDistance, nearHit := rayBoxDistance(bvh.nodes[near].bounds, origin, inverse, maxDistance)
+		farDistance, farHit := rayBoxDistance(bvh.nodes[far].bounds, origin, inverse, maxDistance)
+		if farHit && (!nearHit || farDistance < nearDistance) {
+			near, far = far, near
+			nearHit, farHit = farHit, nearHit
+		}
+
+		if farHit {
+			stack = append(stack, far)
+		}
+		if nearHit {
+			stack = append(stack, near)
+		}
+
+	}
+
+	return hit, found
+
+}
+
+// rayBoxDistance is the slab test with the inverse of the ray direction worked out beforehand
+func rayBoxDistance(box AABB, origin mgl32.Vec3, inverse mgl32.Vec3, maxDistance float32) (float32, bool) {
+
+	near, far := float32(0), maxDistance
+	for c := 0; c < 3; c++ {
+
+		t1 := (box.Min[c] - origin[c]) * inverse[c]
+		t2 := (box.Max[c] - origin[c]) * inverse[c]
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+
+		// NaNs from rays running along a face fail both comparisons and leave the range as it was
+		if t1 > near {
+			near = t1
+		}
+		if t2 < far {
+			far = t2
+		}
+
+	}
+
+	return near, near <= far
+
+}
+
+// intersectTriangle is the Möller-Trumbore ray triangle test
+func intersectTriangle(origin mgl32.Vec3, direction mgl32.Vec3, a, b, c mgl32.Vec3) (float32, float32, float32, bool) {
+
+	edge1, edge2 := b.Sub(a), c.Sub(a)
+	p := direction.Cross(edge2)
+	determinant := edge1.Dot(p)
+	if determinant > -1e-12 && determinant < 1e-12 {
+		return 0, 0, 0, false
+	}
+
+	inverse := 1 / determinant
+	offset := origin.Sub(a)
+	u := offset.Dot(p) * inverse
+	if u < 0 || u > 1 {
+		return 0, 0, 0, false
+	}
+
+	q := offset.Cross(edge1)
+	v := direction.Dot(q) * inverse
+	if v < 0 || u+v > 1 {
+		return 0, 0, 0, false
+	}
+
+	distance := edge2.Dot(q) * inverse
+	if distance < 0 {
+		return 0, 0, 0, false
+	}
+
+	return distance, u, v, true
+
+}
+
+// Bounds is the box around the whole mesh
+func (bvh *BVH) Bounds() AABB {
+
+	if len(bvh.triangles) == 0 {
+		return EmptyAABB()
+	}
+
+	return bvh.nodes[0].bounds
+
+}
@@ -0,0 +1,138 @@
+package common
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type testRay struct {
+	origin    mgl32.Vec3
+	direction mgl32.Vec3
+}
+
+// randomRays starts rays outside of box, half aimed at a point in it and half in any direction
+func randomRays(box AABB, count int) []testRay {
+
+	random := rand.New(rand.NewSource(1))
+	inside := func() mgl32.Vec3 {
+		var point mgl32.Vec3
+		for c := range point {
+			point[c] = box.Min[c] + random.Float32()*(box.Max[c]-box.Min[c])
+		}
+		return point
+	}
+	unit := func() mgl32.Vec3 {
+		return mgl32.Vec3{float32(random.NormFloat64()), float32(random.NormFloat64()),
+			float32(random.NormFloat64())}.Normalize()
+	}
+
+	rays := make([]testRay, count)
+	for i := range rays {
+
+		origin := box.Center().Add(unit().Mul(box.Extents().Len() * 2))
+		if i%2 == 0 {
+			rays[i] = testRay{origin, inside().Sub(origin)}
+		} else {
+			rays[i] = testRay{origin, unit()}
+		}
+
+	}
+
+	return rays
+
+}
+
+// bruteForceIntersect tests the ray against every triangle for the closest hit
+func bruteForceIntersect(indices []uint32, vertices []mgl32.Vec3, ray testRay) (RayHit, bool) {
+
+	var hit RayHit
+	found := false
+	for t := 0; t+2 < len(indices); t += 3 {
+
+		a, b, c := vertices[indices[t]], vertices[indices[t+1]], vertices[indices[t+2]]
+		distance, u, v, ok := intersectTriangle(ray.origin, ray.direction, a, b, c)
+		if ok && (!found || distance < hit.Distance) {
+			hit = RayHit{Triangle: t / 3, U: u, V: v, Distance: distance}
+			found = true
+		}
+
+	}
+
+	return hit, found
+
+}
+
+func TestBVHIntersect(t *testing.T) {
+
+	indices, vertices, _, _ := loadIndexedSuzanne(t)
+	bvh := NewBVH(indices, vertices)
+
+	hits := 0
+	for i, ray := range randomRays(bvh.Bounds(), 2000) {
+
+		want, wantFound := bruteForceIntersect(indices, vertices, ray)
+		hit, found := bvh.Intersect(ray.origin, ray.direction, math.MaxFloat32)
+		if found != wantFound {
+			t.Fatalf("Ray %d hit %v, want %v", i, found, wantFound)
+		}
+		if !found {
+			continue
+		}
+		hits++
+
+		// Rays through an edge can report either triangle, but always at the same distance
+		if math.Abs(float64(hit.Distance-want.Distance)) > 1e-5 {
+			t.Fatalf("Ray %d hit triangle %d at %v, want %d at %v", i, hit.Triangle, hit.Distance, want.Triangle,
+				want.Distance)
+		}
+
+		a, b, c := bvh.triangle(hit.Triangle)
+		point := a.Add(b.Sub(a).Mul(hit.U)).Add(c.Sub(a).Mul(hit.V))
+		if !nearVec3(point, ray.origin.Add(ray.direction.Mul(hit.Distance)), 1e-4) {
+			t.Fatalf("Ray %d hit %v on triangle %d, off the ray", i, point, hit.Triangle)
+		}
+
+		// Something is in the way up to the closest hit but not before it
+		if _, any := bvh.IntersectAny(ray.origin, ray.direction, hit.Distance); !any {
+			t.Fatalf("Ray %d found nothing in the way of its hit", i)
+		}
+		if _, any := bvh.IntersectAny(ray.origin, ray.direction, hit.Distance*0.999); any {
+			t.Fatalf("Ray %d found something in the way before its closest hit", i)
+		}
+
+	}
+
+	if hits < 500 {
+		t.Errorf("Only %d rays hit, too few to test", hits)
+	}
+
+}
+
+func BenchmarkBVHRaycast(b *testing.B) {
+
+	indices, vertices, _, _ := loadIndexedSuzanne(b)
+	bvh := NewBVH(indices, vertices)
+	rays := randomRays(bvh.Bounds(), 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ray := rays[i%len(rays)]
+		bvh.Intersect(ray.origin, ray.direction, math.MaxFloat32)
+	}
+
+}
+
+func BenchmarkBruteForceRaycast(b *testing.B) {
+
+	indices, vertices, _, _ := loadIndexedSuzanne(b)
+	rays := randomRays(ComputeAABB(vertices), 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bruteForceIntersect(indices, vertices, rays[i%len(rays)])
+	}
+
+}
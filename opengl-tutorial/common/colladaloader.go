@@ -0,0 +1,1427 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var (
+	ErrColladaData        = errors.New("Invalid COLLADA data")
+	ErrColladaUnsupported = errors.New("Unsupported COLLADA feature")
+)
+
+// ColladaMesh is a <triangles> or <polylist> of a geometry placed in the scene, as indexed triangles. Uvs are zero and
+// normals are flat when the file doesn't have them.
+type ColladaMesh struct {
+	Name     string
+	Material string
+
+	Indices  []uint32
+	Vertices []mgl32.Vec3
+	Uvs      []mgl32.Vec2
+	Normals  []mgl32.Vec3
+
+	// Transform places a static mesh in the scene. It's the identity for skinned meshes, their skeleton places them.
+	Transform mgl32.Mat4
+
+	// Skin, Joints and Weights are only set on skinned meshes, ready for SkinVertices
+	Skin    *ColladaSkin
+	Joints  [][4]uint16
+	Weights []mgl32.Vec4
+}
+
+// ColladaSkin is a Skin whose skeleton is made of the joints of a skin controller, with the animations of the file
+// converted to clips over that skeleton. The bind shape matrix is folded into the inverse bind matrices.
+type ColladaSkin struct {
+	Skin
+
+	Name  string
+	Clips []*AnimationClip
+}
+
+// ColladaModel is the scene of a COLLADA file converted to Y up and meters, the way the tutorials expect
+type ColladaModel struct {
+	Meshes []*ColladaMesh
+	Skins  []*ColladaSkin
+}
+
+// The parts of the COLLADA 1.4 schema we read
+type colladaDocument struct {
+	Asset struct {
+		Unit struct {
+			Meter float32 `xml:"meter,attr"`
+		} `xml:"unit"`
+		UpAxis string `xml:"up_axis"`
+	} `xml:"asset"`
+
+	Geometries  []colladaGeometry   `xml:"library_geometries>geometry"`
+	Controllers []colladaController `xml:"library_controllers>controller"`
+	Animations  []colladaAnimation  `xml:"library_animations>animation"`
+
+	Clips []struct {
+		ID        string   `xml:"id,attr"`
+		Name      string   `xml:"name,attr"`
+		Start     float32  `xml:"start,attr"`
+		End       *float32 `xml:"end,attr"`
+		Instances []struct {
+			URL string `xml:"url,attr"`
+		} `xml:"instance_animation"`
+	} `xml:"library_animation_clips>animation_clip"`
+
+	VisualScenes []struct {
+		ID    string         `xml:"id,attr"`
+		Nodes []*colladaNode `xml:"node"`
+	} `xml:"library_visual_scenes>visual_scene"`
+	Scene struct {
+		VisualScene struct {
+			URL string `xml:"url,attr"`
+		} `xml:"instance_visual_scene"`
+	} `xml:"scene"`
+}
+
+type colladaSource struct {
+	ID       string `xml:"id,attr"`
+	Floats   string `xml:"float_array"`
+	Names    string `xml:"Name_array"`
+	IDRefs   string `xml:"IDREF_array"`
+	Accessor struct {
+		Count  int `xml:"count,attr"`
+		Stride int `xml:"stride,attr"`
+	} `xml:"technique_common>accessor"`
+}
+
+type colladaInput struct {
+	Semantic string `xml:"semantic,attr"`
+	Source   string `xml:"source,attr"`
+	Offset   int    `xml:"offset,attr"`
+	Set      int    `xml:"set,attr"`
+}
+
+type colladaPrimitives struct {
+	Material string         `xml:"material,attr"`
+	Count    int            `xml:"count,attr"`
+	Inputs   []colladaInput `xml:"input"`
+	VCount   string         `xml:"vcount"`
+	P        string         `xml:"p"`
+}
+
+type colladaGeometry struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+	Mesh *struct {
+		Sources  []colladaSource `xml:"source"`
+		Vertices struct {
+			ID     string         `xml:"id,attr"`
+			Inputs []colladaInput `xml:"input"`
+		} `xml:"vertices"`
+		Triangles []colladaPrimitives `xml:"triangles"`
+		Polylists []colladaPrimitives `xml:"polylist"`
+		Polygons  []struct{}          `xml:"polygons"`
+	} `xml:"mesh"`
+}
+
+type colladaController struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+	Skin *struct {
+		Source          string          `xml:"source,attr"`
+		BindShapeMatrix string          `xml:"bind_shape_matrix"`
+		Sources         []colladaSource `xml:"source"`
+		Joints          struct {
+			Inputs []colladaInput `xml:"input"`
+		} `xml:"joints"`
+		VertexWeights struct {
+			Count  int            `xml:"count,attr"`
+			Inputs []colladaInput `xml:"input"`
+			VCount string         `xml:"vcount"`
+			V      string         `xml:"v"`
+		} `xml:"vertex_weights"`
+	} `xml:"skin"`
+}
+
+type colladaAnimation struct {
+	ID       string          `xml:"id,attr"`
+	Sources  []colladaSource `xml:"source"`
+	Samplers []struct {
+		ID     string         `xml:"id,attr"`
+		Inputs []colladaInput `xml:"input"`
+	} `xml:"sampler"`
+	Channels []struct {
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+	} `xml:"channel"`
+	Animations []colladaAnimation `xml:"animation"`
+}
+
+type colladaNode struct {
+	ID   string `xml:"id,attr"`
+	SID  string `xml:"sid,attr"`
+	Name string `xml:"name,attr"`
+
+	// Elements holds the transform elements in the order they apply, along with anything else we don't read
+	Elements []colladaElement `xml:",any"`
+
+	Children   []*colladaNode `xml:"node"`
+	Geometries []struct {
+		URL string `xml:"url,attr"`
+	} `xml:"instance_geometry"`
+	Controllers []struct {
+		URL       string   `xml:"url,attr"`
+		Skeletons []string `xml:"skeleton"`
+	} `xml:"instance_controller"`
+
+	// Set up once the document is read, transforms are the elements that make up local
+	parent     *colladaNode
+	transforms []colladaElement
+	local      mgl32.Mat4
+}
+
+type colladaElement struct {
+	XMLName xml.Name
+	SID     string `xml:"sid,attr"`
+	Text    string `xml:",chardata"`
+
+	values []float32
+}
+
+// Number of values in each transform element
+var colladaTransformSizes = map[string]int{
+	"matrix":    16,
+	"translate": 3,
+	"rotate":    4,
+	"scale":     3,
+}
+
+// colladaChannel is an animation channel resolved to the transform element it drives. Component is the value it
+// replaces, or -1 when it replaces all of them.
+type colladaChannel struct {
+	node      *colladaNode
+	element   int
+	component int
+
+	// Size values for each time
+	animation AnimationChannel
+	size      int
+}
+
+type colladaLoader struct {
+	document *colladaDocument
+	model    *ColladaModel
+
+	// Root converts the scene to Y up and meters
+	root mgl32.Mat4
+
+	sources     map[string]*colladaSource
+	geometries  map[string]*colladaGeometry
+	controllers map[string]*colladaController
+	animations  map[string]*colladaAnimation
+	nodes       []*colladaNode
+}
+
+func LoadCollada(path string) (*ColladaModel, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	model, err := ReadCollada(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return model, nil
+
+}
+
+// ReadCollada reads the meshes, skins and animations of the default visual scene of a .dae file. Animations are baked
+// into translation, rotation and scale keys at the times of the original keys, with Bezier and Hermite curves
+// followed linearly between them.
+func ReadCollada(reader io.Reader) (*ColladaModel, error) {
+
+	document := &colladaDocument{}
+	if err := xml.NewDecoder(reader).Decode(document); err != nil {
+		return nil, err
+	}
+
+	loader := &colladaLoader{
+		document:    document,
+		model:       &ColladaModel{},
+		sources:     make(map[string]*colladaSource),
+		geometries:  make(map[string]*colladaGeometry),
+		controllers: make(map[string]*colladaController),
+		animations:  make(map[string]*colladaAnimation),
+	}
+
+	meter := document.Asset.Unit.Meter
+	if meter <= 0 {
+		meter = 1
+	}
+	switch strings.TrimSpace(document.Asset.UpAxis) {
+	case "Z_UP":
+		loader.root = mgl32.HomogRotate3DX(-math.Pi / 2)
+	case "X_UP":
+		loader.root = mgl32.HomogRotate3DZ(math.Pi / 2)
+	default:
+		loader.root = mgl32.Ident4()
+	}
+	loader.root = loader.root.Mul4(mgl32.Scale3D(meter, meter, meter))
+
+	for g := range document.Geometries {
+		geometry := &document.Geometries[g]
+		loader.geometries[geometry.ID] = geometry
+		if geometry.Mesh != nil {
+			loader.addSources(geometry.Mesh.Sources)
+		}
+	}
+
+	for c := range document.Controllers {
+		controller := &document.Controllers[c]
+		loader.controllers[controller.ID] = controller
+		if controller.Skin != nil {
+			loader.addSources(controller.Skin.Sources)
+		}
+	}
+
+	var addAnimations func(animations []colladaAnimation)
+	addAnimations = func(animations []colladaAnimation) {
+		for a := range animations {
+			animation := &animations[a]
+			loader.animations[animation.ID] = animation
+			loader.addSources(animation.Sources)
+			addAnimations(animation.Animations)
+		}
+	}
+	addAnimations(document.Animations)
+
+	if len(document.VisualScenes) == 0 {
+		return loader.model, nil
+	}
+
+	scene := &document.VisualScenes[0]
+	if url := document.Scene.VisualScene.URL; url != "" {
+
+		id, err := colladaFragment(url)
+		if err != nil {
+			return nil, err
+		}
+
+		scene = nil
+		for s := range document.VisualScenes {
+			if document.VisualScenes[s].ID == id {
+				scene = &document.VisualScenes[s]
+			}
+		}
+		if scene == nil {
+			return nil, fmt.Errorf("%w: visual scene %s doesn't exist", ErrColladaData, id)
+		}
+
+	}
+
+	var addNodes func(nodes []*colladaNode, parent *colladaNode) error
+	addNodes = func(nodes []*colladaNode, parent *colladaNode) error {
+
+		for _, node := range nodes {
+
+			node.parent = parent
+			if err := node.parseTransforms(); err != nil {
+				return fmt.Errorf("Node %s: %w", node.ID, err)
+			}
+			loader.nodes = append(loader.nodes, node)
+
+			if err := addNodes(node.Children, node); err != nil {
+				return err
+			}
+
+		}
+
+		return nil
+
+	}
+	if err := addNodes(scene.Nodes, nil); err != nil {
+		return nil, err
+	}
+
+	clips, err := loader.clips()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range loader.nodes {
+
+		for _, instance := range node.Geometries {
+
+			id, err := colladaFragment(instance.URL)
+			if err != nil {
+				return nil, err
+			}
+			geometry, ok := loader.geometries[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: geometry %s doesn't exist", ErrColladaData, id)
+			}
+
+			meshes, err := loader.meshes(geometry, nil)
+			if err != nil {
+				return nil, fmt.Errorf("Geometry %s: %w", id, err)
+			}
+			for _, mesh := range meshes {
+				mesh.Transform = loader.worldTransform(node)
+			}
+			loader.model.Meshes = append(loader.model.Meshes, meshes...)
+
+		}
+
+		for _, instance := range node.Controllers {
+
+			id, err := colladaFragment(instance.URL)
+			if err != nil {
+				return nil, err
+			}
+			controller, ok := loader.controllers[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: controller %s doesn't exist", ErrColladaData, id)
+			}
+			if controller.Skin == nil {
+				return nil, fmt.Errorf("%w: controller %s isn't a skin", ErrColladaUnsupported, id)
+			}
+
+			skin, influences, err := loader.skin(controller, instance.Skeletons, clips)
+			if err != nil {
+				return nil, fmt.Errorf("Controller %s: %w", id, err)
+			}
+
+			geometryID, err := colladaFragment(controller.Skin.Source)
+			if err != nil {
+				return nil, err
+			}
+			geometry, ok := loader.geometries[geometryID]
+			if !ok {
+				return nil, fmt.Errorf("%w: geometry %s doesn't exist", ErrColladaData, geometryID)
+			}
+
+			meshes, err := loader.meshes(geometry, influences)
+			if err != nil {
+				return nil, fmt.Errorf("Controller %s: %w", id, err)
+			}
+			for _, mesh := range meshes {
+				mesh.Transform = mgl32.Ident4()
+				mesh.Skin = skin
+			}
+
+			loader.model.Meshes = append(loader.model.Meshes, meshes...)
+			loader.model.Skins = append(loader.model.Skins, skin)
+
+		}
+
+	}
+
+	return loader.model, nil
+
+}
+
+// colladaFragment returns the id a url within the file points at
+func colladaFragment(url string) (string, error) {
+
+	url = strings.TrimSpace(url)
+	if !strings.HasPrefix(url, "#") {
+		return "", fmt.Errorf("%w: reference to %q outside the file", ErrColladaUnsupported, url)
+	}
+
+	return url[1:], nil
+
+}
+
+func parseColladaFloats(text string) ([]float32, error) {
+
+	fields := strings.Fields(text)
+	values := make([]float32, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: number %q", ErrColladaData, field)
+		}
+		values[i] = float32(value)
+	}
+
+	return values, nil
+
+}
+
+func parseColladaInts(text string) ([]int, error) {
+
+	fields := strings.Fields(text)
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: integer %q", ErrColladaData, field)
+		}
+		values[i] = value
+	}
+
+	return values, nil
+
+}
+
+func (loader *colladaLoader) addSources(sources []colladaSource) {
+
+	for s := range sources {
+		loader.sources[sources[s].ID] = &sources[s]
+	}
+
+}
+
+func (loader *colladaLoader) source(url string) (*colladaSource, error) {
+
+	id, err := colladaFragment(url)
+	if err != nil {
+		return nil, err
+	}
+
+	source, ok := loader.sources[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: source %s doesn't exist", ErrColladaData, id)
+	}
+
+	return source, nil
+
+}
+
+// sourceFloats returns the first size values of each element of the float source at url
+func (loader *colladaLoader) sourceFloats(url string, size int) ([]float32, error) {
+
+	source, err := loader.source(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.floats(size)
+
+}
+
+func (source *colladaSource) stride() int {
+
+	if source.Accessor.Stride <= 0 {
+		return 1
+	}
+
+	return source.Accessor.Stride
+
+}
+
+// floats returns the first size values of each element of a float source
+func (source *colladaSource) floats(size int) ([]float32, error) {
+
+	values, err := parseColladaFloats(source.Floats)
+	if err != nil {
+		return nil, err
+	}
+
+	stride := source.stride()
+	count := source.Accessor.Count
+	if stride < size || count < 0 || count > len(values)/stride {
+		return nil, fmt.Errorf("%w: source %s doesn't hold %d elements of %d values", ErrColladaData, source.ID,
+			count, size)
+	}
+
+	result := make([]float32, 0, count*size)
+	for i := 0; i < count; i++ {
+		result = append(result, values[i*stride:i*stride+size]...)
+	}
+
+	return result, nil
+
+}
+
+// names returns the joint names of a Name_array or IDREF_array source
+func (source *colladaSource) names() []string {
+
+	if source.IDRefs != "" {
+		return strings.Fields(source.IDRefs)
+	}
+
+	return strings.Fields(source.Names)
+
+}
+
+// parseTransforms reads the transform elements of a node into its local transform
+func (node *colladaNode) parseTransforms() error {
+
+	node.local = mgl32.Ident4()
+
+	for _, element := range node.Elements {
+
+		kind := element.XMLName.Local
+		size, ok := colladaTransformSizes[kind]
+		if !ok {
+			if kind == "lookat" || kind == "skew" {
+				return fmt.Errorf("%w: %s transform", ErrColladaUnsupported, kind)
+			}
+			continue
+		}
+
+		values, err := parseColladaFloats(element.Text)
+		if err != nil {
+			return err
+		}
+		if len(values) != size {
+			return fmt.Errorf("%w: %s has %d values", ErrColladaData, kind, len(values))
+		}
+
+		element.values = values
+		node.transforms = append(node.transforms, element)
+		node.local = node.local.Mul4(colladaTransform(kind, values))
+
+	}
+
+	return nil
+
+}
+
+// colladaTransform is the matrix of a transform element
+func colladaTransform(kind string, values []float32) mgl32.Mat4 {
+
+	switch kind {
+	case "matrix":
+		// COLLADA matrices are row major
+		var matrix mgl32.Mat4
+		copy(matrix[:], values)
+		return matrix.Transpose()
+	case "translate":
+		return mgl32.Translate3D(values[0], values[1], values[2])
+	case "rotate":
+		axis := mgl32.Vec3{values[0], values[1], values[2]}
+		if axis.Len() == 0 {
+			return mgl32.Ident4()
+		}
+		return mgl32.HomogRotate3D(mgl32.DegToRad(values[3]), axis.Normalize())
+	}
+
+	return mgl32.Scale3D(values[0], values[1], values[2])
+
+}
+
+func (loader *colladaLoader) worldTransform(node *colladaNode) mgl32.Mat4 {
+
+	if node == nil {
+		return loader.root
+	}
+
+	return loader.worldTransform(node.parent).Mul4(node.local)
+
+}
+
+func (loader *colladaLoader) node(id string) *colladaNode {
+
+	for _, node := range loader.nodes {
+		if node.ID == id {
+			return node
+		}
+	}
+
+	return nil
+
+}
+
+// findJoint finds the node a skin joint names, by sid under the skeleton roots or else by sid, id or name anywhere
+func (loader *colladaLoader) findJoint(name string, roots []*colladaNode) *colladaNode {
+
+	for _, root := range roots {
+		for _, node := range loader.nodes {
+			for ancestor := node; ancestor != nil; ancestor = ancestor.parent {
+				if ancestor == root && node.SID == name {
+					return node
+				}
+			}
+		}
+	}
+
+	for _, key := range []func(node *colladaNode) string{
+		func(node *colladaNode) string { return node.SID },
+		func(node *colladaNode) string { return node.ID },
+		func(node *colladaNode) string { return node.Name },
+	} {
+		for _, node := range loader.nodes {
+			if key(node) == name {
+				return node
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// colladaInfluence is the joints and weights of a position, the heaviest four of them
+type colladaInfluence struct {
+	joints  [4]uint16
+	weights mgl32.Vec4
+}
+
+// meshes builds a ColladaMesh out of each <triangles> and <polylist> of a geometry. Influences are the joints and
+// weights of each position for skinned meshes, nil otherwise.
+func (loader *colladaLoader) meshes(geometry *colladaGeometry, influences []colladaInfluence) ([]*ColladaMesh, error) {
+
+	mesh := geometry.Mesh
+	if mesh == nil {
+		return nil, fmt.Errorf("%w: geometry that isn't a mesh", ErrColladaUnsupported)
+	}
+	if len(mesh.Polygons) > 0 {
+		return nil, fmt.Errorf("%w: polygons with holes", ErrColladaUnsupported)
+	}
+
+	// The inputs of <vertices> are indexed along with the positions
+	vertexInputs := make(map[string][]float32)
+	sizes := map[string]int{"POSITION": 3, "NORMAL": 3, "TEXCOORD": 2}
+	for _, input := range mesh.Vertices.Inputs {
+		if size, ok := sizes[input.Semantic]; ok {
+			values, err := loader.sourceFloats(input.Source, size)
+			if err != nil {
+				return nil, err
+			}
+			vertexInputs[input.Semantic] = values
+		}
+	}
+
+	positions := vertexInputs["POSITION"]
+	if positions == nil {
+		return nil, fmt.Errorf("%w: no positions", ErrColladaData)
+	}
+	positionCount := len(positions) / 3
+	for semantic, values := range vertexInputs {
+		if len(values) != positionCount*sizes[semantic] {
+			return nil, fmt.Errorf("%w: %d positions with %d %s values", ErrColladaData, positionCount, len(values),
+				semantic)
+		}
+	}
+	if influences != nil && len(influences) != positionCount {
+		return nil, fmt.Errorf("%w: %d positions with %d weighted vertices", ErrColladaData, positionCount,
+			len(influences))
+	}
+
+	var meshes []*ColladaMesh
+
+	build := func(group colladaPrimitives, polylist bool) error {
+
+		stride := 0
+		vertexOffset, normalOffset, uvOffset := -1, -1, -1
+		uvSet := math.MaxInt32
+		var normals, uvs []float32
+
+		for _, input := range group.Inputs {
+
+			if input.Offset < 0 {
+				return fmt.Errorf("%w: input offset %d", ErrColladaData, input.Offset)
+			}
+			if input.Offset >= stride {
+				stride = input.Offset + 1
+			}
+
+			var err error
+			switch input.Semantic {
+			case "VERTEX":
+				vertexOffset = input.Offset
+			case "NORMAL":
+				normalOffset = input.Offset
+				normals, err = loader.sourceFloats(input.Source, 3)
+			case "TEXCOORD":
+				// The lowest set is the one the tutorials sample
+				if input.Set < uvSet {
+					uvSet = input.Set
+					uvOffset = input.Offset
+					uvs, err = loader.sourceFloats(input.Source, 2)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+		}
+
+		if vertexOffset < 0 {
+			return fmt.Errorf("%w: primitives without vertices", ErrColladaData)
+		}
+
+		indices, err := parseColladaInts(group.P)
+		if err != nil {
+			return err
+		}
+		polygonCorners := len(indices) / stride
+
+		// corners holds the polygon corner at each corner of the triangles, polygons are fanned out from their first
+		var corners []int
+		if polylist {
+
+			counts, err := parseColladaInts(group.VCount)
+			if err != nil {
+				return err
+			}
+			if len(counts) != group.Count {
+				return fmt.Errorf("%w: %d polygons with %d corner counts", ErrColladaData, group.Count, len(counts))
+			}
+
+			first := 0
+			for _, count := range counts {
+				if count < 0 || count > polygonCorners-first {
+					return fmt.Errorf("%w: polygon corners run past the indices", ErrColladaData)
+				}
+				for i := 2; i < count; i++ {
+					corners = append(corners, first, first+i-1, first+i)
+				}
+				first += count
+			}
+
+		} else {
+
+			if group.Count < 0 || group.Count > polygonCorners/3 {
+				return fmt.Errorf("%w: %d triangles run past the indices", ErrColladaData, group.Count)
+			}
+			for i := 0; i < group.Count*3; i++ {
+				corners = append(corners, i)
+			}
+
+		}
+
+		index := func(corner int, offset int, count int) (int, error) {
+			value := indices[corner*stride+offset]
+			if value < 0 || value >= count {
+				return 0, fmt.Errorf("%w: index %d out of range", ErrColladaData, value)
+			}
+			return value, nil
+		}
+
+		vertices := make([]mgl32.Vec3, len(corners))
+		cornerUvs := make([]mgl32.Vec2, len(corners))
+		cornerNormals := make([]mgl32.Vec3, len(corners))
+		joints := VertexAttribute{Size: 4, Data: make([]float32, 0, len(corners)*4)}
+		weights := make([]mgl32.Vec4, len(corners))
+
+		for i, corner := range corners {
+
+			p, err := index(corner, vertexOffset, positionCount)
+			if err != nil {
+				return err
+			}
+			vertices[i] = mgl32.Vec3{positions[p*3], positions[p*3+1], positions[p*3+2]}
+
+			if values := vertexInputs["NORMAL"]; values != nil {
+				cornerNormals[i] = mgl32.Vec3{values[p*3], values[p*3+1], values[p*3+2]}
+			}
+			if values := vertexInputs["TEXCOORD"]; values != nil {
+				cornerUvs[i] = mgl32.Vec2{values[p*2], values[p*2+1]}
+			}
+
+			if normalOffset >= 0 {
+				n, err := index(corner, normalOffset, len(normals)/3)
+				if err != nil {
+					return err
+				}
+				cornerNormals[i] = mgl32.Vec3{normals[n*3], normals[n*3+1], normals[n*3+2]}
+			}
+			if uvOffset >= 0 {
+				t, err := index(corner, uvOffset, len(uvs)/2)
+				if err != nil {
+					return err
+				}
+				cornerUvs[i] = mgl32.Vec2{uvs[t*2], uvs[t*2+1]}
+			}
+
+			if influences != nil {
+				for _, joint := range influences[p].joints {
+					joints.Data = append(joints.Data, float32(joint))
+				}
+				weights[i] = influences[p].weights
+			}
+
+		}
+
+		if normalOffset < 0 && vertexInputs["NORMAL"] == nil {
+			cornerNormals = ComputeFlatNormals(vertices)
+		}
+
+		attributes := []VertexAttribute{
+			Vec3Attribute(vertices, 0),
+			Vec2Attribute(cornerUvs, 0),
+			Vec3Attribute(cornerNormals, 0),
+		}
+		if influences != nil {
+			attributes = append(attributes, joints, Vec4Attribute(weights, 0))
+		}
+
+		indexed, err := IndexAttributes(attributes...)
+		if err != nil {
+			return err
+		}
+
+		loaded := &ColladaMesh{
+			Name:     geometry.Name,
+			Material: group.Material,
+			Indices:  indexed.Indices,
+			Vertices: indexed.Attributes[0].Vec3s(),
+			Uvs:      indexed.Attributes[1].Vec2s(),
+			Normals:  indexed.Attributes[2].Vec3s(),
+		}
+
+		if influences != nil {
+			loaded.Joints = make([][4]uint16, indexed.VertexCount())
+			for i, joint := range indexed.Attributes[3].Vec4s() {
+				for c := range joint {
+					loaded.Joints[i][c] = uint16(joint[c])
+				}
+			}
+			loaded.Weights = indexed.Attributes[4].Vec4s()
+		}
+
+		meshes = append(meshes, loaded)
+		return nil
+
+	}
+
+	for _, group := range mesh.Triangles {
+		if err := build(group, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, group := range mesh.Polylists {
+		if err := build(group, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return meshes, nil
+
+}
+
+// skin builds the skeleton of a skin controller out of its joint nodes and bakes the clips over it. A joint's parent is
+// its closest ancestor in the skin, and the skeleton hangs from the parent of the root joints. Skeletons are the
+// <skeleton> urls of the instance, where the joints are looked for first.
+func (loader *colladaLoader) skin(controller *colladaController, skeletons []string,
+	clips []colladaClip) (*ColladaSkin, []colladaInfluence, error) {
+
+	skin := controller.Skin
+
+	var names []string
+	var inverseBinds []float32
+	for _, input := range skin.Joints.Inputs {
+
+		source, err := loader.source(input.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch input.Semantic {
+		case "JOINT":
+			names = source.names()
+		case "INV_BIND_MATRIX":
+			if inverseBinds, err = source.floats(16); err != nil {
+				return nil, nil, err
+			}
+		}
+
+	}
+
+	if len(names) > math.MaxUint16+1 {
+		return nil, nil, fmt.Errorf("%w: %d joints", ErrColladaUnsupported, len(names))
+	}
+	if len(inverseBinds) != len(names)*16 {
+		return nil, nil, fmt.Errorf("%w: %d joints with %d inverse bind matrix values", ErrColladaData, len(names),
+			len(inverseBinds))
+	}
+
+	bindShape := mgl32.Ident4()
+	if text := strings.TrimSpace(skin.BindShapeMatrix); text != "" {
+		values, err := parseColladaFloats(text)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(values) != 16 {
+			return nil, nil, fmt.Errorf("%w: bind shape matrix has %d values", ErrColladaData, len(values))
+		}
+		bindShape = colladaTransform("matrix", values)
+	}
+
+	var roots []*colladaNode
+	for _, url := range skeletons {
+		id, err := colladaFragment(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		root := loader.node(id)
+		if root == nil {
+			return nil, nil, fmt.Errorf("%w: skeleton %s isn't in the scene", ErrColladaData, id)
+		}
+		roots = append(roots, root)
+	}
+
+	jointNodes := make([]*colladaNode, len(names))
+	nodeJoints := make(map[*colladaNode]int)
+	for i, name := range names {
+		node := loader.findJoint(name, roots)
+		if node == nil {
+			return nil, nil, fmt.Errorf("%w: joint %s isn't in the scene", ErrColladaData, name)
+		}
+		if _, ok := nodeJoints[node]; ok {
+			return nil, nil, fmt.Errorf("%w: joint %s is listed twice", ErrColladaData, name)
+		}
+		jointNodes[i] = node
+		nodeJoints[node] = i
+	}
+
+	skeleton := &Skeleton{Joints: make([]Joint, len(names)), Transform: loader.root}
+	for i, node := range jointNodes {
+
+		joint := Joint{Name: names[i], Parent: -1, Rest: matrixJointPose(node.local)}
+		for parent := node.parent; parent != nil; parent = parent.parent {
+			if p, ok := nodeJoints[parent]; ok {
+				joint.Parent = p
+				break
+			}
+		}
+
+		if joint.Parent < 0 && node.parent != nil {
+			skeleton.Transform = loader.worldTransform(node.parent)
+		}
+
+		skeleton.Joints[i] = joint
+
+	}
+
+	if err := skeleton.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	loaded := &ColladaSkin{Name: controller.Name}
+	loaded.Skeleton = skeleton
+	loaded.InverseBindMatrices = make([]mgl32.Mat4, len(names))
+	for i := range loaded.InverseBindMatrices {
+		loaded.InverseBindMatrices[i] = colladaTransform("matrix", inverseBinds[i*16:i*16+16]).Mul4(bindShape)
+	}
+
+	influences, err := loader.influences(controller, len(names))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, clip := range clips {
+		loaded.Clips = append(loaded.Clips, clip.bake(jointNodes))
+	}
+
+	return loaded, influences, nil
+
+}
+
+// influences reads the joints and weights of each position of a skin, keeping the heaviest four
+func (loader *colladaLoader) influences(controller *colladaController, jointCount int) ([]colladaInfluence, error) {
+
+	vertexWeights := controller.Skin.VertexWeights
+
+	stride := 0
+	jointOffset, weightOffset := -1, -1
+	var weights []float32
+	for _, input := range vertexWeights.Inputs {
+
+		if input.Offset < 0 {
+			return nil, fmt.Errorf("%w: input offset %d", ErrColladaData, input.Offset)
+		}
+		if input.Offset >= stride {
+			stride = input.Offset + 1
+		}
+
+		switch input.Semantic {
+		case "JOINT":
+			jointOffset = input.Offset
+		case "WEIGHT":
+			weightOffset = input.Offset
+			var err error
+			if weights, err = loader.sourceFloats(input.Source, 1); err != nil {
+				return nil, err
+			}
+		}
+
+	}
+
+	if jointOffset < 0 || weightOffset < 0 {
+		return nil, fmt.Errorf("%w: vertex weights without joints or weights", ErrColladaData)
+	}
+
+	counts, err := parseColladaInts(vertexWeights.VCount)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseColladaInts(vertexWeights.V)
+	if err != nil {
+		return nil, err
+	}
+	if len(counts) != vertexWeights.Count {
+		return nil, fmt.Errorf("%w: %d vertices with %d influence counts", ErrColladaData, vertexWeights.Count,
+			len(counts))
+	}
+
+	type influence struct {
+		joint  int
+		weight float32
+	}
+
+	influences := make([]colladaInfluence, len(counts))
+	var sorted []influence
+	first := 0
+
+	for v, count := range counts {
+
+		if count < 0 || count > len(values)/stride-first {
+			return nil, fmt.Errorf("%w: influences run past the end of the list", ErrColladaData)
+		}
+
+		sorted = sorted[:0]
+		for i := first; i < first+count; i++ {
+
+			joint := values[i*stride+jointOffset]
+			weight := values[i*stride+weightOffset]
+			if joint < -1 || joint >= jointCount || weight < 0 || weight >= len(weights) {
+				return nil, fmt.Errorf("%w: influence index out of range", ErrColladaData)
+			}
+
+			// Joint -1 weights the bind shape, which stays where it is
+			if joint >= 0 {
+				sorted = append(sorted, influence{joint, weights[weight]})
+			}
+
+		}
+		first += count
+
+		sort.SliceStable(sorted, func(a int, b int) bool {
+			return sorted[a].weight > sorted[b].weight
+		})
+		for i := 0; i < len(sorted) && i < 4; i++ {
+			influences[v].joints[i] = uint16(sorted[i].joint)
+			influences[v].weights[i] = sorted[i].weight
+		}
+
+	}
+
+	return influences, nil
+
+}
+
+// colladaClip is the channels of an animation clip, or of every animation when the file doesn't split them into clips
+type colladaClip struct {
+	name     string
+	start    float32
+	duration float32
+	channels []colladaChannel
+}
+
+func (loader *colladaLoader) clips() ([]colladaClip, error) {
+
+	document := loader.document
+
+	if len(document.Clips) == 0 {
+
+		clip := colladaClip{}
+		for a := range document.Animations {
+			channels, err := loader.channels(&document.Animations[a])
+			if err != nil {
+				return nil, err
+			}
+			clip.channels = append(clip.channels, channels...)
+		}
+
+		if len(clip.channels) == 0 {
+			return nil, nil
+		}
+		clip.duration = clip.end()
+
+		return []colladaClip{clip}, nil
+
+	}
+
+	var clips []colladaClip
+	for _, clip := range document.Clips {
+
+		loaded := colladaClip{name: clip.Name, start: clip.Start}
+		if loaded.name == "" {
+			loaded.name = clip.ID
+		}
+
+		for _, instance := range clip.Instances {
+
+			id, err := colladaFragment(instance.URL)
+			if err != nil {
+				return nil, err
+			}
+			animation, ok := loader.animations[id]
+			if !ok {
+				return nil, fmt.Errorf("%w: animation %s doesn't exist", ErrColladaData, id)
+			}
+
+			channels, err := loader.channels(animation)
+			if err != nil {
+				return nil, err
+			}
+			loaded.channels = append(loaded.channels, channels...)
+
+		}
+
+		loaded.duration = loaded.end() - loaded.start
+		if clip.End != nil {
+			loaded.duration = *clip.End - clip.Start
+		}
+
+		clips = append(clips, loaded)
+
+	}
+
+	return clips, nil
+
+}
+
+// end is the time of the last key of any channel
+func (clip *colladaClip) end() float32 {
+
+	var end float32
+	for _, channel := range clip.channels {
+		if times := channel.animation.Times; times[len(times)-1] > end {
+			end = times[len(times)-1]
+		}
+	}
+
+	return end
+
+}
+
+// channels resolves the channels of an animation and the animations inside it, skipping ones that target anything but
+// a transform element of a node in the scene
+func (loader *colladaLoader) channels(animation *colladaAnimation) ([]colladaChannel, error) {
+
+	var channels []colladaChannel
+
+	for _, channel := range animation.Channels {
+
+		resolved, ok, err := loader.channel(animation, channel.Source, channel.Target)
+		if err != nil {
+			return nil, fmt.Errorf("Animation %s: %w", animation.ID, err)
+		}
+		if ok {
+			channels = append(channels, resolved)
+		}
+
+	}
+
+	for a := range animation.Animations {
+		children, err := loader.channels(&animation.Animations[a])
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, children...)
+	}
+
+	return channels, nil
+
+}
+
+func (loader *colladaLoader) channel(animation *colladaAnimation, source string,
+	target string) (colladaChannel, bool, error) {
+
+	id, err := colladaFragment(source)
+	if err != nil {
+		return colladaChannel{}, false, err
+	}
+
+	var inputs []colladaInput
+	found := false
+	for _, sampler := range animation.Samplers {
+		if sampler.ID == id {
+			inputs = sampler.Inputs
+			found = true
+		}
+	}
+	if !found {
+		return colladaChannel{}, false, fmt.Errorf("%w: sampler %s doesn't exist", ErrColladaData, id)
+	}
+
+	resolved := colladaChannel{component: -1}
+	for _, input := range inputs {
+
+		source, err := loader.source(input.Source)
+		if err != nil {
+			return colladaChannel{}, false, err
+		}
+
+		switch input.Semantic {
+		case "INPUT":
+			resolved.animation.Times, err = source.floats(1)
+		case "OUTPUT":
+			resolved.size = source.stride()
+			resolved.animation.Values, err = source.floats(resolved.size)
+		case "INTERPOLATION":
+			if names := source.names(); len(names) > 0 && names[0] == "STEP" {
+				resolved.animation.Interpolation = InterpolationStep
+			}
+		}
+		if err != nil {
+			return colladaChannel{}, false, err
+		}
+
+	}
+
+	times := resolved.animation.Times
+	if len(resolved.animation.Values) != len(times)*resolved.size {
+		return colladaChannel{}, false, fmt.Errorf("%w: sampler %s has %d times and %d values", ErrColladaData, id,
+			len(times), len(resolved.animation.Values))
+	}
+	if len(times) == 0 {
+		return colladaChannel{}, false, nil
+	}
+
+	// Targets are a node id, the sid of one of its transform elements and optionally which of its values
+	slash := strings.IndexByte(target, '/')
+	if slash < 0 {
+		return colladaChannel{}, false, nil
+	}
+	if resolved.node = loader.node(target[:slash]); resolved.node == nil {
+		return colladaChannel{}, false, nil
+	}
+
+	sid, member := target[slash+1:], ""
+	if i := strings.IndexAny(sid, ".("); i >= 0 {
+		sid, member = sid[:i], sid[i:]
+	}
+
+	resolved.element = -1
+	for e, transform := range resolved.node.transforms {
+		if transform.SID == sid {
+			resolved.element = e
+		}
+	}
+	if resolved.element < 0 {
+		return colladaChannel{}, false, nil
+	}
+	size := colladaTransformSizes[resolved.node.transforms[resolved.element].XMLName.Local]
+
+	switch {
+	case member == "":
+	case member[0] == '.':
+		members := map[string]int{".X": 0, ".Y": 1, ".Z": 2, ".ANGLE": 3}
+		component, ok := members[member]
+		if !ok {
+			return colladaChannel{}, false, fmt.Errorf("%w: target %s", ErrColladaUnsupported, target)
+		}
+		resolved.component = component
+	default:
+		// (i) picks a value, (row)(column) one of a row major matrix
+		indices, err := parseColladaInts(strings.NewReplacer("(", " ", ")", " ").Replace(member))
+		if err != nil || len(indices) < 1 || len(indices) > 2 {
+			return colladaChannel{}, false, fmt.Errorf("%w: target %s", ErrColladaData, target)
+		}
+		resolved.component = indices[0]
+		if len(indices) == 2 {
+			resolved.component = indices[0]*4 + indices[1]
+		}
+	}
+
+	if resolved.component >= size || resolved.component < 0 && resolved.size != size ||
+		resolved.component >= 0 && resolved.size != 1 {
+		return colladaChannel{}, false, fmt.Errorf("%w: target %s with %d values per key", ErrColladaData, target,
+			resolved.size)
+	}
+
+	return resolved, true, nil
+
+}
+
+// bake turns the channels of a clip that animate the joints of a skeleton into translation, rotation and scale keys.
+// Each joint gets a key at every time any of its channels has one.
+func (clip *colladaClip) bake(jointNodes []*colladaNode) *AnimationClip {
+
+	baked := &AnimationClip{Name: clip.name, Duration: clip.duration}
+
+	for joint, node := range jointNodes {
+
+		var channels []*colladaChannel
+		var times []float32
+		interpolation := InterpolationStep
+		for c := range clip.channels {
+			if channel := &clip.channels[c]; channel.node == node {
+				channels = append(channels, channel)
+				times = append(times, channel.animation.Times...)
+				if channel.animation.Interpolation != InterpolationStep {
+					interpolation = InterpolationLinear
+				}
+			}
+		}
+		if len(channels) == 0 {
+			continue
+		}
+
+		sort.Slice(times, func(a int, b int) bool {
+			return times[a] < times[b]
+		})
+		unique := times[:1]
+		for _, time := range times[1:] {
+			if time != unique[len(unique)-1] {
+				unique = append(unique, time)
+			}
+		}
+		times = unique
+
+		translation := AnimationChannel{Joint: joint, Path: AnimationTranslation, Interpolation: interpolation}
+		rotation := AnimationChannel{Joint: joint, Path: AnimationRotation, Interpolation: interpolation}
+		scale := AnimationChannel{Joint: joint, Path: AnimationScale, Interpolation: interpolation}
+
+		values := make([][]float32, len(node.transforms))
+		var previous mgl32.Quat
+
+		for k, time := range times {
+
+			for e, transform := range node.transforms {
+				values[e] = append(values[e][:0], transform.values...)
+			}
+			for _, channel := range channels {
+				sampled := channel.animation.sample(time, channel.size)
+				if channel.component < 0 {
+					copy(values[channel.element], sampled)
+				} else {
+					values[channel.element][channel.component] = sampled[0]
+				}
+			}
+
+			local := mgl32.Ident4()
+			for e, transform := range node.transforms {
+				local = local.Mul4(colladaTransform(transform.XMLName.Local, values[e]))
+			}
+			pose := matrixJointPose(local)
+
+			// Neighbouring keys stay in the same hemisphere so they blend the short way round
+			if k > 0 && previous.Dot(pose.Rotation) < 0 {
+				pose.Rotation = pose.Rotation.Scale(-1)
+			}
+			previous = pose.Rotation
+
+			key := time - clip.start
+			translation.Times = append(translation.Times, key)
+			translation.Values = append(translation.Values, pose.Translation[:]...)
+			rotation.Times = append(rotation.Times, key)
+			rotation.Values = append(rotation.Values, pose.Rotation.X(), pose.Rotation.Y(), pose.Rotation.Z(),
+				pose.Rotation.W)
+			scale.Times = append(scale.Times, key)
+			scale.Values = append(scale.Values, pose.Scale[:]...)
+
+		}
+
+		baked.Channels = append(baked.Channels, translation, rotation, scale)
+
+	}
+
+	return baked
+
+}
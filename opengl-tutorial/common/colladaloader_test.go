@@ -0,0 +1,385 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// colladaArm is a strip of two quads up the Y axis skinned to an upper and a lower joint, hanging from an armature
+// two units along X, next to a static triangle. The mesh sits a unit back along Z for the bind shape matrix to bring
+// forward. The lower joint bends a quarter turn about Z over a second, and the upper one steps a unit along X at 1.
+const colladaArm = `<?xml version="1.0" encoding="utf-8"?>
+<COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">
+  <asset><unit meter="1"/><up_axis>Y_UP</up_axis></asset>
+  <library_geometries>
+    <geometry id="arm-mesh" name="arm">
+      <mesh>
+        <source id="arm-positions">
+          <float_array count="18">1.5 0 -1  2.5 0 -1  1.5 1 -1  2.5 1 -1  1.5 2 -1  2.5 2 -1</float_array>
+          <technique_common><accessor count="6" stride="3"/></technique_common>
+        </source>
+        <source id="arm-normals">
+          <float_array count="3">0 0 1</float_array>
+          <technique_common><accessor count="1" stride="3"/></technique_common>
+        </source>
+        <source id="arm-uvs">
+          <float_array count="18">0 0 0  1 0 0  0 0.5 0  1 0.5 0  0 1 0  1 1 0</float_array>
+          <technique_common><accessor count="6" stride="3"/></technique_common>
+        </source>
+        <vertices id="arm-vertices"><input semantic="POSITION" source="#arm-positions"/></vertices>
+        <polylist material="skin" count="2">
+          <input semantic="VERTEX" source="#arm-vertices" offset="0"/>
+          <input semantic="NORMAL" source="#arm-normals" offset="1"/>
+          <input semantic="TEXCOORD" source="#arm-uvs" offset="2" set="0"/>
+          <vcount>4 4</vcount>
+          <p>0 0 0  1 0 1  3 0 3  2 0 2  2 0 2  3 0 3  5 0 5  4 0 4</p>
+        </polylist>
+      </mesh>
+    </geometry>
+    <geometry id="box-mesh" name="box">
+      <mesh>
+        <source id="box-positions">
+          <float_array count="9">0 0 0  1 0 0  0 1 0</float_array>
+          <technique_common><accessor count="3" stride="3"/></technique_common>
+        </source>
+        <vertices id="box-vertices"><input semantic="POSITION" source="#box-positions"/></vertices>
+        <triangles count="1">
+          <input semantic="VERTEX" source="#box-vertices" offset="0"/>
+          <p>0 1 2</p>
+        </triangles>
+      </mesh>
+    </geometry>
+  </library_geometries>
+  <library_controllers>
+    <controller id="arm-skin" name="arm skin">
+      <skin source="#arm-mesh">
+        <bind_shape_matrix>1 0 0 0  0 1 0 0  0 0 1 1  0 0 0 1</bind_shape_matrix>
+        <source id="arm-joints">
+          <Name_array count="2">upper lower</Name_array>
+          <technique_common><accessor count="2" stride="1"/></technique_common>
+        </source>
+        <source id="arm-bind-poses">
+          <float_array count="32">
+            1 0 0 -2  0 1 0 0  0 0 1 0  0 0 0 1
+            1 0 0 -2  0 1 0 -1  0 0 1 0  0 0 0 1
+          </float_array>
+          <technique_common><accessor count="2" stride="16"/></technique_common>
+        </source>
+        <source id="arm-weights">
+          <float_array count="2">1 0.5</float_array>
+          <technique_common><accessor count="2" stride="1"/></technique_common>
+        </source>
+        <joints>
+          <input semantic="JOINT" source="#arm-joints"/>
+          <input semantic="INV_BIND_MATRIX" source="#arm-bind-poses"/>
+        </joints>
+        <vertex_weights count="6">
+          <input semantic="JOINT" source="#arm-joints" offset="0"/>
+          <input semantic="WEIGHT" source="#arm-weights" offset="1"/>
+          <vcount>2 1 2 2 1 1</vcount>
+          <v>0 0 -1 1  0 0  0 1 1 1  0 1 1 1  1 0  1 0</v>
+        </vertex_weights>
+      </skin>
+    </controller>
+  </library_controllers>
+  <library_animations>
+    <animation id="upper-move">
+      <source id="upper-times">
+        <float_array count="2">0 1</float_array>
+        <technique_common><accessor count="2" stride="1"/></technique_common>
+      </source>
+      <source id="upper-matrices">
+        <float_array count="32">1 0 0 0  0 1 0 0  0 0 1 0  0 0 0 1  1 0 0 1  0 1 0 0  0 0 1 0  0 0 0 1</float_array>
+        <technique_common><accessor count="2" stride="16"/></technique_common>
+      </source>
+      <source id="upper-interpolations">
+        <Name_array count="2">STEP STEP</Name_array>
+        <technique_common><accessor count="2" stride="1"/></technique_common>
+      </source>
+      <sampler id="upper-sampler">
+        <input semantic="INPUT" source="#upper-times"/>
+        <input semantic="OUTPUT" source="#upper-matrices"/>
+        <input semantic="INTERPOLATION" source="#upper-interpolations"/>
+      </sampler>
+      <channel source="#upper-sampler" target="Armature_upper/transform"/>
+      <animation id="lower-bend">
+        <source id="lower-times">
+          <float_array count="2">0 1</float_array>
+          <technique_common><accessor count="2" stride="1"/></technique_common>
+        </source>
+        <source id="lower-angles">
+          <float_array count="2">0 90</float_array>
+          <technique_common><accessor count="2" stride="1"/></technique_common>
+        </source>
+        <sampler id="lower-sampler">
+          <input semantic="INPUT" source="#lower-times"/>
+          <input semantic="OUTPUT" source="#lower-angles"/>
+        </sampler>
+        <channel source="#lower-sampler" target="Armature_lower/rotationZ.ANGLE"/>
+        <channel source="#lower-sampler" target="Box/visibility"/>
+      </animation>
+    </animation>
+  </library_animations>
+  <library_visual_scenes>
+    <visual_scene id="scene">
+      <node id="Armature" name="Armature">
+        <translate>2 0 0</translate>
+        <node id="Armature_upper" sid="upper" name="upper" type="JOINT">
+          <matrix sid="transform">1 0 0 0  0 1 0 0  0 0 1 0  0 0 0 1</matrix>
+          <node id="Armature_lower" sid="lower" name="lower" type="JOINT">
+            <translate sid="location">0 1 0</translate>
+            <rotate sid="rotationZ">0 0 1 0</rotate>
+            <extra><technique profile="blender"/></extra>
+          </node>
+        </node>
+      </node>
+      <node id="Arm" name="Arm">
+        <instance_controller url="#arm-skin"><skeleton>#Armature_upper</skeleton></instance_controller>
+      </node>
+      <node id="Box" name="Box">
+        <translate>0 0 5</translate>
+        <instance_geometry url="#box-mesh"/>
+      </node>
+    </visual_scene>
+  </library_visual_scenes>
+  <scene><instance_visual_scene url="#scene"/></scene>
+</COLLADA>
+`
+
+func TestReadCollada(t *testing.T) {
+
+	model, err := ReadCollada(strings.NewReader(colladaArm))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.Meshes) != 2 || len(model.Skins) != 1 {
+		t.Fatalf("%d meshes and %d skins, want 2 and 1", len(model.Meshes), len(model.Skins))
+	}
+
+	arm, box := model.Meshes[0], model.Meshes[1]
+	if arm.Name != "arm" || arm.Material != "skin" || arm.Skin != model.Skins[0] || arm.Transform != mgl32.Ident4() {
+		t.Errorf("Arm mesh %q, material %q, transform %v", arm.Name, arm.Material, arm.Transform)
+	}
+	if len(arm.Vertices) != 6 || len(arm.Indices) != 12 {
+		t.Fatalf("Arm has %d vertices and %d indices, want 6 and 12", len(arm.Vertices), len(arm.Indices))
+	}
+
+	// Weights come from the position each vertex was made from
+	for i, vertex := range arm.Vertices {
+
+		var want [4]float32
+		var wantJoints [4]uint16
+		switch vertex.Y() {
+		case 0:
+			want = [4]float32{1}
+		case 1:
+			want = [4]float32{0.5, 0.5}
+			wantJoints = [4]uint16{0, 1}
+		case 2:
+			want = [4]float32{1}
+			wantJoints = [4]uint16{1}
+		}
+
+		if arm.Weights[i] != want || arm.Joints[i] != wantJoints {
+			t.Errorf("Vertex %v has joints %v and weights %v, want %v and %v", vertex, arm.Joints[i], arm.Weights[i],
+				wantJoints, want)
+		}
+		uv := mgl32.Vec2{vertex.X() - 1.5, vertex.Y() / 2}
+		if arm.Uvs[i] != uv || arm.Normals[i] != (mgl32.Vec3{0, 0, 1}) {
+			t.Errorf("Vertex %v has uv %v and normal %v", vertex, arm.Uvs[i], arm.Normals[i])
+		}
+
+	}
+
+	skin := model.Skins[0]
+	skeleton := skin.Skeleton
+	if skin.Name != "arm skin" || len(skeleton.Joints) != 2 || skeleton.Joints[0].Name != "upper" ||
+		skeleton.Joints[0].Parent != -1 || skeleton.Joints[1].Name != "lower" || skeleton.Joints[1].Parent != 0 {
+		t.Fatalf("Skin %q with joints %+v", skin.Name, skeleton.Joints)
+	}
+	if !skeleton.Transform.ApproxEqual(mgl32.Translate3D(2, 0, 0)) {
+		t.Errorf("Skeleton transform %v", skeleton.Transform)
+	}
+
+	skinned := func(pose Pose) map[mgl32.Vec2]mgl32.Vec3 {
+		vertices := make([]mgl32.Vec3, len(arm.Vertices))
+		SkinVertices(arm.Vertices, nil, arm.Joints, arm.Weights, skin.JointMatrices(pose), vertices, nil)
+		moved := make(map[mgl32.Vec2]mgl32.Vec3)
+		for i, vertex := range arm.Vertices {
+			moved[mgl32.Vec2{vertex.X(), vertex.Y()}] = vertices[i]
+		}
+		return moved
+	}
+
+	// The rest pose only applies the bind shape matrix
+	for position, vertex := range skinned(skeleton.RestPose()) {
+		if want := (mgl32.Vec3{position.X(), position.Y(), 0}); !nearVec3(vertex, want, 1e-5) {
+			t.Errorf("Rest pose moves %v to %v, want %v", position, vertex, want)
+		}
+	}
+
+	if len(skin.Clips) != 1 {
+		t.Fatalf("%d clips, want 1", len(skin.Clips))
+	}
+	clip := skin.Clips[0]
+	if clip.Duration != 1 || len(clip.Channels) != 6 {
+		t.Fatalf("Clip lasts %v with %d channels, want 1 and 6", clip.Duration, len(clip.Channels))
+	}
+
+	pose := skeleton.RestPose()
+	clip.Sample(0.5, pose)
+	if want := mgl32.QuatRotate(math.Pi/4, mgl32.Vec3{0, 0, 1}); !pose[1].Rotation.ApproxEqualThreshold(want, 1e-5) {
+		t.Errorf("Lower joint rotation halfway %v, want %v", pose[1].Rotation, want)
+	}
+	if !nearVec3(pose[0].Translation, mgl32.Vec3{}, 1e-6) {
+		t.Errorf("Upper joint stepped to %v early", pose[0].Translation)
+	}
+
+	clip.Sample(1, pose)
+	wantVertices := map[mgl32.Vec2]mgl32.Vec3{
+		{1.5, 0}: {2.5, 0, 0},
+		{2.5, 0}: {3.5, 0, 0},
+		{1.5, 1}: {2.75, 0.75, 0},
+		{2.5, 1}: {3.25, 1.25, 0},
+		{1.5, 2}: {2, 0.5, 0},
+		{2.5, 2}: {2, 1.5, 0},
+	}
+	for position, vertex := range skinned(pose) {
+		if want := wantVertices[position]; !nearVec3(vertex, want, 1e-5) {
+			t.Errorf("Posed at 1 %v moves to %v, want %v", position, vertex, want)
+		}
+	}
+
+	if box.Name != "box" || box.Skin != nil || box.Joints != nil ||
+		!box.Transform.ApproxEqual(mgl32.Translate3D(0, 0, 5)) {
+		t.Errorf("Box mesh %q, transform %v", box.Name, box.Transform)
+	}
+	for i, normal := range box.Normals {
+		if normal != (mgl32.Vec3{0, 0, 1}) || box.Uvs[i] != (mgl32.Vec2{}) {
+			t.Errorf("Box vertex %d has normal %v and uv %v", i, normal, box.Uvs[i])
+		}
+	}
+
+}
+
+func TestReadColladaUnits(t *testing.T) {
+
+	// Z up centimetres turn into Y up metres
+	document := strings.Replace(colladaArm, `<unit meter="1"/><up_axis>Y_UP</up_axis>`,
+		`<unit meter="0.01"/><up_axis>Z_UP</up_axis>`, 1)
+	model, err := ReadCollada(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box := model.Meshes[1]
+	origin := mgl32.TransformCoordinate(mgl32.Vec3{}, box.Transform)
+	if !nearVec3(origin, mgl32.Vec3{0, 0.05, 0}, 1e-6) {
+		t.Errorf("Box origin at %v, want 5cm up", origin)
+	}
+
+	transform := model.Skins[0].Skeleton.Transform
+	origin = mgl32.TransformCoordinate(mgl32.Vec3{}, transform)
+	if !nearVec3(origin, mgl32.Vec3{0.02, 0, 0}, 1e-6) {
+		t.Errorf("Skeleton origin at %v, want 2cm along X", origin)
+	}
+
+}
+
+func TestReadColladaClips(t *testing.T) {
+
+	clips := `<library_animation_clips>
+    <animation_clip id="bend" name="Bend" start="0.5" end="1"><instance_animation url="#lower-bend"/></animation_clip>
+    <animation_clip id="everything"><instance_animation url="#upper-move"/></animation_clip>
+  </library_animation_clips>
+  <library_visual_scenes>`
+	model, err := ReadCollada(strings.NewReader(strings.Replace(colladaArm, "<library_visual_scenes>", clips, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	skin := model.Skins[0]
+	if len(skin.Clips) != 2 {
+		t.Fatalf("%d clips, want 2", len(skin.Clips))
+	}
+
+	// The first clip only bends the lower joint, with its keys moved to start at 0
+	bend := skin.Clips[0]
+	if bend.Name != "Bend" || bend.Duration != 0.5 || len(bend.Channels) != 3 {
+		t.Fatalf("Clip %q lasts %v with %d channels", bend.Name, bend.Duration, len(bend.Channels))
+	}
+	for _, channel := range bend.Channels {
+		if channel.Joint != 1 || channel.Times[0] != -0.5 || channel.Times[1] != 0.5 {
+			t.Errorf("Bend channel for joint %d at %v", channel.Joint, channel.Times)
+		}
+	}
+
+	// Nested animations belong to the clip that instances their parent
+	everything := skin.Clips[1]
+	if everything.Name != "everything" || everything.Duration != 1 || len(everything.Channels) != 6 {
+		t.Errorf("Clip %q lasts %v with %d channels", everything.Name, everything.Duration, len(everything.Channels))
+	}
+	for _, channel := range everything.Channels {
+		if channel.Joint == 0 && channel.Interpolation != InterpolationStep ||
+			channel.Joint == 1 && channel.Interpolation != InterpolationLinear {
+			t.Errorf("Joint %d channel interpolation %v", channel.Joint, channel.Interpolation)
+		}
+	}
+
+}
+
+func TestReadColladaErrors(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		old         string
+		new         string
+		unsupported bool
+	}{
+		{"malformed XML", `</COLLADA>`, ``, false},
+		{"index out of range", `<p>0 1 2</p>`, `<p>0 1 3</p>`, false},
+		{"negative index", `<p>0 1 2</p>`, `<p>0 -1 2</p>`, false},
+		{"too many triangles", `<triangles count="1">`, `<triangles count="2">`, false},
+		{"polygon past the indices", `<vcount>4 4</vcount>`, `<vcount>4 5</vcount>`, false},
+		{"missing corner count", `<vcount>4 4</vcount>`, `<vcount>4</vcount>`, false},
+		{"bad number", `0 0 1</float_array>`, `0 0 one</float_array>`, false},
+		{"short source", `<accessor count="6" stride="3"/>`, `<accessor count="7" stride="3"/>`, false},
+		{"missing source", `source="#box-positions"`, `source="#nothing"`, false},
+		{"missing geometry", `url="#box-mesh"`, `url="#nothing"`, false},
+		{"missing joint", `upper lower</Name_array>`, `upper elbow</Name_array>`, false},
+		{"missing skeleton", `<skeleton>#Armature_upper</skeleton>`, `<skeleton>#Hips</skeleton>`, false},
+		{"influence out of range", `<v>0 0 -1 1`, `<v>2 0 -1 1`, false},
+		{"influences past the end", `<vcount>2 1 2 2 1 1</vcount>`, `<vcount>2 1 2 2 1 2</vcount>`, false},
+		{"inverse bind matrices missing", `<accessor count="2" stride="16"/>`, `<accessor count="1" stride="16"/>`,
+			false},
+		{"bad channel member", `rotationZ.ANGLE`, `rotationZ.W`, true},
+		{"whole rotate from one value", `rotationZ.ANGLE`, `rotationZ`, false},
+		{"transform with too few values", `<translate sid="location">0 1 0</translate>`,
+			`<translate sid="location">0 1</translate>`, false},
+		{"lookat", `<translate>0 0 5</translate>`, `<lookat>0 0 5 0 0 0 0 1 0</lookat>`, true},
+		{"external reference", `url="#box-mesh"`, `url="shapes.dae#box-mesh"`, true},
+		{"polygons", `<triangles count="1">`, `<polygons count="1"><p>0 1 2</p></polygons><triangles count="1">`, true},
+	}
+
+	for _, test := range tests {
+
+		if !strings.Contains(colladaArm, test.old) {
+			t.Fatalf("%s: document doesn't contain %q", test.name, test.old)
+		}
+
+		_, err := ReadCollada(strings.NewReader(strings.Replace(colladaArm, test.old, test.new, 1)))
+		switch {
+		case err == nil:
+			t.Errorf("%s: no error", test.name)
+		case test.unsupported && !errors.Is(err, ErrColladaUnsupported):
+			t.Errorf("%s: error %v isn't ErrColladaUnsupported", test.name, err)
+		}
+
+	}
+
+}
@@ -0,0 +1,406 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	FOURCC_DXT1 = 0x31545844
+	FOURCC_DXT3 = 0x33545844
+	FOURCC_DXT5 = 0x35545844
+)
+
+const (
+	ddsHeaderSize      = 128
+	ddsDX10HeaderSize  = 20
+	ddsDescriptionSize = 124
+	ddsPixelFormatSize = 32
+
+	// Larger than any GPU takes, and keeps sizes worked out from a corrupt header from overflowing
+	ddsMaxSize   = 1 << 16
+	ddsMaxLayers = 1 << 11
+)
+
+// Flags of the surface description, its pixel format and its two sets of capabilities
+const (
+	ddsdCaps        = 0x1
+	ddsdHeight      = 0x2
+	ddsdWidth       = 0x4
+	ddsdPitch       = 0x8
+	ddsdPixelFormat = 0x1000
+	ddsdMipmapCount = 0x20000
+	ddsdLinearSize  = 0x80000
+	ddsdDepth       = 0x800000
+
+	ddpfAlphaPixels = 0x1
+	ddpfFourCC      = 0x4
+	ddpfRGB         = 0x40
+	ddpfLuminance   = 0x20000
+
+	ddsCapsComplex = 0x8
+	ddsCapsTexture = 0x1000
+	ddsCapsMipmap  = 0x400000
+
+	ddsCaps2Cubemap         = 0x200
+	ddsCaps2CubemapAllFaces = 0xfc00
+	ddsCaps2Volume          = 0x200000
+)
+
+// Fields of the DX10 header
+const (
+	ddsDimension1D     = 2
+	ddsDimension2D     = 3
+	ddsDimension3D     = 4
+	ddsMiscTextureCube = 0x4
+)
+
+var (
+	ErrDdsHeader      = errors.New("Invalid DDS header")
+	ErrDdsData        = errors.New("Invalid DDS data")
+	ErrDdsUnsupported = errors.New("Unsupported DDS")
+)
+
+// ddsLayout is how the pixels of a DDS are stored. Layouts no ImageFormat matches give the bits per pixel and the mask
+// of each of format's channels in the file, and are converted while loading.
+type ddsLayout struct {
+	format ImageFormat
+	srgb   bool
+
+	bitCount int
+	masks    [4]uint32
+}
+
+func ddsFourCC(code string) uint32 {
+	return binary.LittleEndian.Uint32([]byte(code))
+}
+
+// Formats of the pixel format's FourCC, including the numbered Direct3D 9 formats some writers store there
+var ddsFourCCs = map[uint32]ddsLayout{
+	FOURCC_DXT1:       {format: ImageDXT1},
+	ddsFourCC("DXT2"): {format: ImageDXT3},
+	FOURCC_DXT3:       {format: ImageDXT3},
+	ddsFourCC("DXT4"): {format: ImageDXT5},
+	FOURCC_DXT5:       {format: ImageDXT5},
+	ddsFourCC("ATI1"): {format: ImageBC4},
+	ddsFourCC("BC4U"): {format: ImageBC4},
+	ddsFourCC("BC4S"): {format: ImageBC4Signed},
+	ddsFourCC("ATI2"): {format: ImageBC5},
+	ddsFourCC("BC5U"): {format: ImageBC5},
+	ddsFourCC("BC5S"): {format: ImageBC5Signed},
+	113:               {format: ImageRGBA16F},
+	116:               {format: ImageRGBA32F},
+}
+
+// Formats of the DX10 header's DXGI_FORMAT
+var ddsDXGIFormats = map[uint32]ddsLayout{
+	2:  {format: ImageRGBA32F},
+	6:  {format: ImageRGB32F},
+	10: {format: ImageRGBA16F},
+	28: {format: ImageRGBA8},
+	29: {format: ImageRGBA8, srgb: true},
+	49: {format: ImageRG8},
+	61: {format: ImageR8},
+	71: {format: ImageDXT1},
+	72: {format: ImageDXT1, srgb: true},
+	74: {format: ImageDXT3},
+	75: {format: ImageDXT3, srgb: true},
+	77: {format: ImageDXT5},
+	78: {format: ImageDXT5, srgb: true},
+	80: {format: ImageBC4},
+	81: {format: ImageBC4Signed},
+	83: {format: ImageBC5},
+	84: {format: ImageBC5Signed},
+	85: {format: ImageRGB8, bitCount: 16, masks: [4]uint32{0xf800, 0x07e0, 0x001f}},
+	86: {format: ImageRGBA8, bitCount: 16, masks: [4]uint32{0x7c00, 0x03e0, 0x001f, 0x8000}},
+	87: {format: ImageRGBA8, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}},
+	88: {format: ImageRGB8, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff}},
+	91: {format: ImageRGBA8, srgb: true, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff, 0xff000000}},
+	93: {format: ImageRGB8, srgb: true, bitCount: 32, masks: [4]uint32{0xff0000, 0xff00, 0xff}},
+	95: {format: ImageBC6H},
+	96: {format: ImageBC6HSigned},
+	98: {format: ImageBC7},
+	99: {format: ImageBC7, srgb: true},
+}
+
+// LoadDDSImage reads a DirectDraw Surface into an Image without needing a GL context
+func LoadDDSImage(path string) (*Image, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := LoadDDSImageFrom(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return image, nil
+
+}
+
+// LoadDDSImageFrom reads a DDS with its mipmaps, as a 2D texture, a cubemap, a volume or with a DX10 header a texture
+// array. Block compressed formats, floating point formats and the common uncompressed layouts are understood, layouts
+// with no matching ImageFormat such as BGRA or 565 are converted to RGB or RGBA. Rows are kept running from the top of
+// the picture down.
+func LoadDDSImageFrom(reader io.Reader) (*Image, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < ddsHeaderSize {
+		return nil, fmt.Errorf("%w: file is only %d bytes", ErrDdsHeader, len(data))
+	}
+
+	// verify the type of file
+	if string(data[0:4]) != "DDS " {
+		return nil, fmt.Errorf("%w: not a DDS file", ErrDdsHeader)
+	}
+
+	if size := intFromByteSlice(data[4:8]); size != ddsDescriptionSize {
+		return nil, fmt.Errorf("%w: surface description of %d bytes", ErrDdsHeader, size)
+	}
+
+	// get the surface desc
+	flags := binary.LittleEndian.Uint32(data[8:])
+	image := &Image{
+		Height: intFromByteSlice(data[12:16]),
+		Width:  intFromByteSlice(data[16:20]),
+	}
+	mipMapCount := intFromByteSlice(data[28:32])
+	if flags&ddsdMipmapCount == 0 || mipMapCount < 1 {
+		mipMapCount = 1
+	}
+
+	pixelFlags := binary.LittleEndian.Uint32(data[80:])
+	fourCC := binary.LittleEndian.Uint32(data[84:])
+	caps2 := binary.LittleEndian.Uint32(data[112:])
+
+	var layout ddsLayout
+	offset := ddsHeaderSize
+
+	switch {
+	case pixelFlags&ddpfFourCC != 0 && fourCC == ddsFourCC("DX10"):
+
+		if len(data) < ddsHeaderSize+ddsDX10HeaderSize {
+			return nil, fmt.Errorf("%w: file ends in the DX10 header", ErrDdsHeader)
+		}
+
+		dx10 := data[ddsHeaderSize:]
+		offset += ddsDX10HeaderSize
+
+		dxgiFormat := binary.LittleEndian.Uint32(dx10)
+		var ok bool
+		if layout, ok = ddsDXGIFormats[dxgiFormat]; !ok {
+			return nil, fmt.Errorf("%w: DXGI format %d", ErrDdsUnsupported, dxgiFormat)
+		}
+
+		switch dimension := binary.LittleEndian.Uint32(dx10[4:]); dimension {
+		case ddsDimension1D, ddsDimension2D:
+			image.Cubemap = binary.LittleEndian.Uint32(dx10[8:])&ddsMiscTextureCube != 0
+		case ddsDimension3D:
+			image.Depth = intFromByteSlice(data[24:28])
+		default:
+			return nil, fmt.Errorf("%w: resource dimension %d", ErrDdsHeader, dimension)
+		}
+
+		arraySize := intFromByteSlice(dx10[12:16])
+		if arraySize < 1 || arraySize > ddsMaxLayers || arraySize > 1 && image.Depth > 0 {
+			return nil, fmt.Errorf("%w: array of %d textures", ErrDdsHeader, arraySize)
+		}
+		if arraySize > 1 {
+			image.Layers = arraySize
+		}
+
+	case pixelFlags&ddpfFourCC != 0:
+
+		var ok bool
+		if layout, ok = ddsFourCCs[fourCC]; !ok {
+			if fourCC < 0x1000000 {
+				return nil, fmt.Errorf("%w: Direct3D format %d", ErrDdsUnsupported, fourCC)
+			}
+			return nil, fmt.Errorf("%w: FourCC %q", ErrDdsUnsupported, data[84:88])
+		}
+
+	default:
+
+		var masks [4]uint32
+		for i := range masks {
+			masks[i] = binary.LittleEndian.Uint32(data[92+i*4:])
+		}
+
+		layout, err = ddsMaskedLayout(pixelFlags, intFromByteSlice(data[88:92]), masks)
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	image.Format = layout.format
+	image.SRGB = layout.srgb
+
+	if caps2&ddsCaps2Cubemap != 0 {
+		if caps2&ddsCaps2CubemapAllFaces != ddsCaps2CubemapAllFaces {
+			return nil, fmt.Errorf("%w: cubemap without all 6 faces", ErrDdsUnsupported)
+		}
+		image.Cubemap = true
+	}
+	if caps2&ddsCaps2Volume != 0 && flags&ddsdDepth != 0 && image.Depth == 0 {
+		image.Depth = intFromByteSlice(data[24:28])
+	}
+
+	if image.Width <= 0 || image.Height <= 0 || image.Width > ddsMaxSize || image.Height > ddsMaxSize ||
+		image.Depth < 0 || image.Depth > ddsMaxSize {
+		return nil, fmt.Errorf("%w: %dx%dx%d pixels", ErrDdsHeader, image.Width, image.Height, image.Depth)
+	}
+	if image.Depth > 0 && image.Cubemap {
+		return nil, fmt.Errorf("%w: volume cubemap", ErrDdsHeader)
+	}
+
+	// Levels below 1x1 aren't stored
+	levels := 1
+	for size := maxInt(image.Width, maxInt(image.Height, image.Depth)); size > 1; size >>= 1 {
+		levels++
+	}
+	if mipMapCount > levels {
+		mipMapCount = levels
+	}
+
+	// The file holds every level of the first face or layer, then every level of the next
+	sliceSizes := make([]int, mipMapCount)
+	payloadSize := 0
+	for level := range sliceSizes {
+
+		width, height := mipmapSize(image.Width, level), mipmapSize(image.Height, level)
+		if layout.bitCount > 0 {
+			sliceSizes[level] = width * height * layout.bitCount / 8
+		} else {
+			sliceSizes[level] = image.Format.DataSize(width, height)
+		}
+		sliceSizes[level] *= image.LevelDepth(level)
+		payloadSize += sliceSizes[level] * image.Slices()
+
+	}
+
+	if payloadSize > len(data)-offset {
+		return nil, fmt.Errorf("%w: %d bytes of pixel data, %dx%d %v with %d levels and %d slices needs %d",
+			ErrDdsData, len(data)-offset, image.Width, image.Height, image.Format, mipMapCount, image.Slices(),
+			payloadSize)
+	}
+
+	levelData := make([][]byte, mipMapCount)
+	for level := range levelData {
+		levelData[level] = make([]byte, 0, image.LevelDataSize(level))
+	}
+
+	for slice := 0; slice < image.Slices(); slice++ {
+		for level, size := range sliceSizes {
+
+			source := data[offset : offset+size]
+			offset += size
+
+			if layout.bitCount > 0 {
+				levelData[level] = convertDDSPixels(layout, source, levelData[level])
+			} else {
+				levelData[level] = append(levelData[level], source...)
+			}
+
+		}
+	}
+
+	image.Pixels = levelData[0]
+	image.Mipmaps = levelData[1:]
+
+	return image, nil
+
+}
+
+// ddsMaskedLayout is the layout of pixel formats described by a bit count and channel masks
+func ddsMaskedLayout(flags uint32, bitCount int, masks [4]uint32) (ddsLayout, error) {
+
+	layout := ddsLayout{bitCount: bitCount}
+	alpha := flags&ddpfAlphaPixels != 0 && masks[3] != 0
+
+	switch {
+	case flags&ddpfRGB != 0 && alpha:
+		layout.format = ImageRGBA8
+		layout.masks = masks
+	case flags&ddpfRGB != 0:
+		layout.format = ImageRGB8
+		layout.masks = [4]uint32{masks[0], masks[1], masks[2]}
+	case flags&ddpfLuminance != 0 && alpha:
+		layout.format = ImageLA8
+		layout.masks = [4]uint32{masks[0], masks[3]}
+	case flags&ddpfLuminance != 0:
+		layout.format = ImageL8
+		layout.masks = [4]uint32{masks[0]}
+	default:
+		return layout, fmt.Errorf("%w: pixel format flags %#x", ErrDdsUnsupported, flags)
+	}
+
+	if bitCount != 8 && bitCount != 16 && bitCount != 24 && bitCount != 32 {
+		return layout, fmt.Errorf("%w: %d bits per pixel", ErrDdsUnsupported, bitCount)
+	}
+	if !validMasks(layout.masks, bitCount) {
+		return layout, fmt.Errorf("%w: channel masks %#x", ErrDdsHeader, layout.masks)
+	}
+
+	// Files already in the order of the format are copied as they are
+	channels := layout.format.BytesPerPixel()
+	if bitCount == channels*8 {
+		identity := true
+		for c := 0; c < channels; c++ {
+			identity = identity && layout.masks[c] == 0xff<<uint(c*8)
+		}
+		if identity {
+			layout.bitCount = 0
+		}
+	}
+
+	return layout, nil
+
+}
+
+func convertDDSPixels(layout ddsLayout, source []byte, target []byte) []byte {
+
+	var channels [4]maskChannel
+	for c, mask := range layout.masks {
+		channels[c] = newMaskChannel(mask)
+	}
+
+	channelCount := layout.format.BytesPerPixel()
+	pixelSize := layout.bitCount / 8
+
+	var word [4]byte
+	for i := 0; i+pixelSize <= len(source); i += pixelSize {
+
+		copy(word[:], source[i:i+pixelSize])
+		value := binary.LittleEndian.Uint32(word[:])
+
+		for c := 0; c < channelCount; c++ {
+			target = append(target, channels[c].value(value))
+		}
+
+	}
+
+	return target
+
+}
+
+func maxInt(a int, b int) int {
+
+	if a > b {
+		return a
+	}
+
+	return b
+
+}
@@ -0,0 +1,427 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// ddsHeader is the header of a 1x1 image with the given pixel format flags, FourCC, bit count and masks
+func ddsHeader(pixelFlags uint32, fourCC string, bitCount int, masks ...uint32) []byte {
+
+	header := make([]byte, ddsHeaderSize)
+	copy(header, "DDS ")
+	binary.LittleEndian.PutUint32(header[4:], ddsDescriptionSize)
+	binary.LittleEndian.PutUint32(header[8:], ddsdCaps|ddsdHeight|ddsdWidth|ddsdPixelFormat)
+	binary.LittleEndian.PutUint32(header[12:], 1)
+	binary.LittleEndian.PutUint32(header[16:], 1)
+	binary.LittleEndian.PutUint32(header[76:], ddsPixelFormatSize)
+	binary.LittleEndian.PutUint32(header[80:], pixelFlags)
+	copy(header[84:88], fourCC)
+	binary.LittleEndian.PutUint32(header[88:], uint32(bitCount))
+	for i, mask := range masks {
+		binary.LittleEndian.PutUint32(header[92+i*4:], mask)
+	}
+	binary.LittleEndian.PutUint32(header[108:], ddsCapsTexture)
+
+	return header
+
+}
+
+// ddsDX10Header is the header of a 1x1 image in a DXGI format
+func ddsDX10Header(dxgiFormat uint32, dimension uint32, arraySize uint32) []byte {
+
+	dx10 := make([]byte, ddsDX10HeaderSize)
+	binary.LittleEndian.PutUint32(dx10, dxgiFormat)
+	binary.LittleEndian.PutUint32(dx10[4:], dimension)
+	binary.LittleEndian.PutUint32(dx10[12:], arraySize)
+
+	return append(ddsHeader(ddpfFourCC, "DX10", 0), dx10...)
+
+}
+
+func TestLoadDDSImage(t *testing.T) {
+
+	image, err := LoadDDSImage("../07-model-loading/uvmap.DDS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Width != 512 || image.Height != 512 || image.Format != ImageDXT3 || image.Levels() != 10 {
+		t.Fatalf("Loaded a %dx%d %v image with %d levels", image.Width, image.Height, image.Format, image.Levels())
+	}
+
+	// The blocks of every level follow the header as they are
+	data, err := ioutil.ReadFile("../07-model-loading/uvmap.DDS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := ddsHeaderSize
+	for level := 0; level < image.Levels(); level++ {
+
+		pixels, width, height := image.Level(level)
+		if width != 512>>uint(level) || height != 512>>uint(level) {
+			t.Errorf("Level %d is %dx%d", level, width, height)
+		}
+		if !bytes.Equal(pixels, data[offset:offset+len(pixels)]) {
+			t.Errorf("Level %d doesn't match the file", level)
+		}
+		offset += len(pixels)
+
+	}
+	if offset != len(data) {
+		t.Errorf("Levels end at %d of %d bytes", offset, len(data))
+	}
+
+	if _, err := LoadDDSImage("doesn't exist.DDS"); err == nil {
+		t.Error("Loaded a DDS that doesn't exist")
+	}
+
+}
+
+func TestLoadDDSImageFrom(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format ImageFormat
+		pixels []byte
+	}{
+		{
+			name:   "BGRA",
+			data:   append(ddsHeader(ddpfRGB|ddpfAlphaPixels, "", 32, 0xff0000, 0xff00, 0xff, 0xff000000), 1, 2, 3, 4),
+			format: ImageRGBA8,
+			pixels: []byte{3, 2, 1, 4},
+		},
+		{
+			name:   "565",
+			data:   append(ddsHeader(ddpfRGB, "", 16, 0xf800, 0x07e0, 0x001f), 0x1f, 0x00),
+			format: ImageRGB8,
+			pixels: []byte{0, 0, 255},
+		},
+		{
+			name:   "luminance",
+			data:   append(ddsHeader(ddpfLuminance, "", 8, 0xff), 9),
+			format: ImageL8,
+			pixels: []byte{9},
+		},
+		{
+			name:   "DX10 R8",
+			data:   append(ddsDX10Header(61, ddsDimension2D, 1), 7),
+			format: ImageR8,
+			pixels: []byte{7},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadDDSImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || !bytes.Equal(image.Pixels, test.pixels) {
+			t.Errorf("%s: %v pixels %v, want %v %v", test.name, image.Format, image.Pixels, test.format, test.pixels)
+		}
+
+	}
+
+}
+
+func TestLoadDDSImageFromInvalid(t *testing.T) {
+
+	uvmap, err := ioutil.ReadFile("../07-model-loading/uvmap.DDS")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// patched is uvmap.DDS with a 32 bit field of its header changed
+	patched := func(offset int, value uint32) []byte {
+		data := append([]byte(nil), uvmap...)
+		binary.LittleEndian.PutUint32(data[offset:], value)
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too short", uvmap[:ddsHeaderSize-1], ErrDdsHeader},
+		{"not a DDS", append([]byte("PNG "), uvmap[4:]...), ErrDdsHeader},
+		{"description size", patched(4, 100), ErrDdsHeader},
+		{"no width", patched(16, 0), ErrDdsHeader},
+		{"too wide", patched(16, ddsMaxSize*2), ErrDdsHeader},
+		{"truncated pixels", uvmap[:len(uvmap)-1], ErrDdsData},
+		{"unknown FourCC", patched(84, ddsFourCC("ABCD")), ErrDdsUnsupported},
+		{"numbered Direct3D format", patched(84, 50), ErrDdsUnsupported},
+		{"cubemap missing faces", patched(112, ddsCaps2Cubemap|0x400), ErrDdsUnsupported},
+		{"truncated DX10 header", ddsDX10Header(61, ddsDimension2D, 1)[:ddsHeaderSize+10], ErrDdsHeader},
+		{"unknown DXGI format", append(ddsDX10Header(1000, ddsDimension2D, 1), 0), ErrDdsUnsupported},
+		{"DXGI format 0", append(ddsDX10Header(0, ddsDimension2D, 1), 0), ErrDdsUnsupported},
+		{"buffer resource", append(ddsDX10Header(61, 1, 1), 0), ErrDdsHeader},
+		{"empty array", append(ddsDX10Header(61, ddsDimension2D, 0), 0), ErrDdsHeader},
+		{"array too large", append(ddsDX10Header(61, ddsDimension2D, ddsMaxLayers+1), 0), ErrDdsHeader},
+		{"overlapping masks", append(ddsHeader(ddpfRGB, "", 16, 0xff00, 0x0ff0, 0x000f), 0, 0), ErrDdsHeader},
+		{"split mask", append(ddsHeader(ddpfRGB, "", 16, 0xf00f, 0x0f00, 0x00f0), 0, 0), ErrDdsHeader},
+		{"mask past the pixel", append(ddsHeader(ddpfRGB, "", 16, 0x1f0000, 0x07e0, 0x001f), 0, 0), ErrDdsHeader},
+		{"12 bit pixels", append(ddsHeader(ddpfRGB, "", 12, 0xf00, 0xf0, 0xf), 0, 0), ErrDdsUnsupported},
+		{"no pixel format", append(ddsHeader(0, "", 8, 0xff), 0), ErrDdsUnsupported},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadDDSImageFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
+
+// ddsResize is a copy of a header from ddsHeader or ddsDX10Header describing a larger image, with depth slices and
+// mipmap levels when they're above 0 and 1
+func ddsResize(header []byte, width int, height int, depth int, levels int, caps2 uint32) []byte {
+
+	header = append([]byte(nil), header...)
+
+	flags := binary.LittleEndian.Uint32(header[8:])
+	if depth > 0 {
+		flags |= ddsdDepth
+	}
+	if levels > 1 {
+		flags |= ddsdMipmapCount
+	}
+	binary.LittleEndian.PutUint32(header[8:], flags)
+
+	binary.LittleEndian.PutUint32(header[12:], uint32(height))
+	binary.LittleEndian.PutUint32(header[16:], uint32(width))
+	binary.LittleEndian.PutUint32(header[24:], uint32(depth))
+	binary.LittleEndian.PutUint32(header[28:], uint32(levels))
+	binary.LittleEndian.PutUint32(header[112:], caps2)
+
+	return header
+
+}
+
+// ddsSlices lays out slices of distinct bytes the way a DDS stores them, every level of one slice before the next
+// slice, and returns that payload with what each level of the loaded image should hold
+func ddsSlices(slices int, levelSizes ...int) ([]byte, [][]byte) {
+
+	var payload []byte
+	levels := make([][]byte, len(levelSizes))
+
+	for slice := 0; slice < slices; slice++ {
+		for level, size := range levelSizes {
+
+			data := make([]byte, size)
+			for i := range data {
+				data[i] = byte((len(payload) + i) % 251)
+			}
+
+			payload = append(payload, data...)
+			levels[level] = append(levels[level], data...)
+
+		}
+	}
+
+	return payload, levels
+
+}
+
+func TestLoadDDSImageFromLayouts(t *testing.T) {
+
+	type layout struct {
+		format  ImageFormat
+		depth   int
+		layers  int
+		cubemap bool
+		srgb    bool
+	}
+
+	dx10 := func(dxgiFormat uint32, dimension uint32, arraySize uint32, misc uint32) []byte {
+		header := ddsDX10Header(dxgiFormat, dimension, arraySize)
+		binary.LittleEndian.PutUint32(header[ddsHeaderSize+8:], misc)
+		return header
+	}
+
+	// A 4x4 DXT1 cubemap with 2 levels, one block each
+	cubePayload, cubeLevels := ddsSlices(6, 8, 8)
+	cubeHeader := ddsResize(ddsHeader(ddpfFourCC, "DXT1", 0), 4, 4, 0, 2, ddsCaps2Cubemap|ddsCaps2CubemapAllFaces)
+
+	// An array of 2 8x4 R8 cubemaps with 3 levels, 8x4, 4x2 and 2x1
+	cubeArrayPayload, cubeArrayLevels := ddsSlices(12, 32, 8, 2)
+	cubeArrayHeader := ddsResize(dx10(61, ddsDimension2D, 2, ddsMiscTextureCube), 8, 4, 0, 3, 0)
+
+	// A 4x4x4 R8 volume with every level down to 1x1x1
+	volumePayload, volumeLevels := ddsSlices(1, 64, 8, 1)
+	volumeHeader := ddsResize(dx10(61, ddsDimension3D, 1, 0), 4, 4, 4, 3, 0)
+
+	// A 4x4x2 DXT5 volume described by the capabilities rather than a DX10 header
+	legacyVolumePayload, legacyVolumeLevels := ddsSlices(1, 32)
+	legacyVolumeHeader := ddsResize(ddsHeader(ddpfFourCC, "DXT5", 0), 4, 4, 2, 1, ddsCaps2Volume)
+
+	// An array of 3 2x2 RG8 images with 2 levels
+	arrayPayload, arrayLevels := ddsSlices(3, 8, 2)
+	arrayHeader := ddsResize(dx10(49, ddsDimension2D, 3, 0), 2, 2, 0, 2, 0)
+
+	// A 1D array of 2 textures 4 pixels wide
+	linePayload, lineLevels := ddsSlices(2, 4)
+	lineHeader := ddsResize(dx10(61, ddsDimension1D, 2, 0), 4, 1, 0, 1, 0)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		want   layout
+		levels [][]byte
+	}{
+		{"cubemap", append(cubeHeader, cubePayload...), layout{format: ImageDXT1, cubemap: true}, cubeLevels},
+		{"cubemap array", append(cubeArrayHeader, cubeArrayPayload...),
+			layout{format: ImageR8, layers: 2, cubemap: true}, cubeArrayLevels},
+		{"volume", append(volumeHeader, volumePayload...), layout{format: ImageR8, depth: 4}, volumeLevels},
+		{"volume without DX10", append(legacyVolumeHeader, legacyVolumePayload...),
+			layout{format: ImageDXT5, depth: 2}, legacyVolumeLevels},
+		{"texture array", append(arrayHeader, arrayPayload...), layout{format: ImageRG8, layers: 3}, arrayLevels},
+		{"1D texture array", append(lineHeader, linePayload...), layout{format: ImageR8, layers: 2}, lineLevels},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadDDSImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		got := layout{image.Format, image.Depth, image.Layers, image.Cubemap, image.SRGB}
+		if got != test.want || image.Levels() != len(test.levels) {
+			t.Errorf("%s: loaded %+v with %d levels, want %+v with %d", test.name, got, image.Levels(), test.want,
+				len(test.levels))
+			continue
+		}
+
+		// Slices are gathered level by level, the first face or layer of each level coming first
+		for level, want := range test.levels {
+			data, _, _ := image.Level(level)
+			if !bytes.Equal(data, want) || len(data) != image.LevelDataSize(level) {
+				t.Errorf("%s: level %d is %v, want %v", test.name, level, data, want)
+			}
+		}
+
+	}
+
+}
+
+func TestLoadDDSImageFromCompressed(t *testing.T) {
+
+	// A 4x4 image is one block, which is kept as it is in the file
+	block8, _ := ddsSlices(1, 8)
+	block16, _ := ddsSlices(1, 16)
+	resize := func(header []byte) []byte {
+		return ddsResize(header, 4, 4, 0, 1, 0)
+	}
+
+	tests := []struct {
+		name   string
+		header []byte
+		block  []byte
+		format ImageFormat
+	}{
+		{"ATI1", resize(ddsHeader(ddpfFourCC, "ATI1", 0)), block8, ImageBC4},
+		{"BC4U", resize(ddsHeader(ddpfFourCC, "BC4U", 0)), block8, ImageBC4},
+		{"BC4S", resize(ddsHeader(ddpfFourCC, "BC4S", 0)), block8, ImageBC4Signed},
+		{"ATI2", resize(ddsHeader(ddpfFourCC, "ATI2", 0)), block16, ImageBC5},
+		{"BC5S", resize(ddsHeader(ddpfFourCC, "BC5S", 0)), block16, ImageBC5Signed},
+		{"DXGI BC4", resize(ddsDX10Header(80, ddsDimension2D, 1)), block8, ImageBC4},
+		{"DXGI BC4 signed", resize(ddsDX10Header(81, ddsDimension2D, 1)), block8, ImageBC4Signed},
+		{"DXGI BC5", resize(ddsDX10Header(83, ddsDimension2D, 1)), block16, ImageBC5},
+		{"DXGI BC5 signed", resize(ddsDX10Header(84, ddsDimension2D, 1)), block16, ImageBC5Signed},
+		{"DXGI BC6H", resize(ddsDX10Header(95, ddsDimension2D, 1)), block16, ImageBC6H},
+		{"DXGI BC6H signed", resize(ddsDX10Header(96, ddsDimension2D, 1)), block16, ImageBC6HSigned},
+		{"DXGI BC7", resize(ddsDX10Header(98, ddsDimension2D, 1)), block16, ImageBC7},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadDDSImageFrom(bytes.NewReader(append(test.header, test.block...)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || image.SRGB || image.Width != 4 || image.Height != 4 ||
+			!bytes.Equal(image.Pixels, test.block) {
+			t.Errorf("%s: loaded a %dx%d %v image, sRGB %v, holding %v", test.name, image.Width, image.Height,
+				image.Format, image.SRGB, image.Pixels)
+		}
+
+	}
+
+	// The RGTC blocks loaded from a file decode like ones built in memory
+	bc4 := []byte{200, 100, 0, 0, 0, 0, 0, 0}
+	bc5 := append(append([]byte(nil), bc4...), 50, 10, 0, 0, 0, 0, 0, 0)
+	decodeTests := []struct {
+		name  string
+		data  []byte
+		pixel []byte
+	}{
+		{"BC4", append(resize(ddsDX10Header(80, ddsDimension2D, 1)), bc4...), []byte{200}},
+		{"BC5", append(resize(ddsHeader(ddpfFourCC, "ATI2", 0)), bc5...), []byte{200, 50}},
+	}
+
+	for _, test := range decodeTests {
+
+		image, err := LoadDDSImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		decompressed, err := DecompressImage(image)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if want := bytes.Repeat(test.pixel, 16); !bytes.Equal(decompressed.Pixels, want) {
+			t.Errorf("%s: decompressed to %v, want %v", test.name, decompressed.Pixels, want)
+		}
+
+	}
+
+}
+
+func TestLoadDDSImageFromSRGB(t *testing.T) {
+
+	block, _ := ddsSlices(1, 8)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format ImageFormat
+		srgb   bool
+		pixels []byte
+	}{
+		{"RGBA8 sRGB", append(ddsDX10Header(29, ddsDimension2D, 1), 1, 2, 3, 4), ImageRGBA8, true,
+			[]byte{1, 2, 3, 4}},
+		{"RGBA8 linear", append(ddsDX10Header(28, ddsDimension2D, 1), 1, 2, 3, 4), ImageRGBA8, false,
+			[]byte{1, 2, 3, 4}},
+		{"BGRA8 sRGB", append(ddsDX10Header(91, ddsDimension2D, 1), 1, 2, 3, 4), ImageRGBA8, true,
+			[]byte{3, 2, 1, 4}},
+		{"BGRX8 sRGB", append(ddsDX10Header(93, ddsDimension2D, 1), 1, 2, 3, 4), ImageRGB8, true,
+			[]byte{3, 2, 1}},
+		{"BC1 sRGB", append(ddsDX10Header(72, ddsDimension2D, 1), block...), ImageDXT1, true, block},
+		{"BC7 sRGB", append(ddsDX10Header(99, ddsDimension2D, 1), append(block, block...)...), ImageBC7, true,
+			append(block, block...)},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadDDSImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || image.SRGB != test.srgb || !bytes.Equal(image.Pixels, test.pixels) {
+			t.Errorf("%s: %v, sRGB %v, pixels %v, want %v, %v, %v", test.name, image.Format, image.SRGB,
+				image.Pixels, test.format, test.srgb, test.pixels)
+		}
+
+	}
+
+}
@@ -0,0 +1,192 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SaveDDS writes an image to a DDS file with WriteDDS
+func SaveDDS(path string, image *Image) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteDDS(file, image); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
+
+// WriteDDS writes an image with its mipmaps as a DirectDraw Surface LoadDDSImageFrom reads back unchanged, so rows
+// should already run from the top down. S3TC, RGB8, RGBA8, L8 and LA8 images that aren't sRGB or arrays get the
+// original header every DDS reader understands, the rest need the DX10 header.
+func WriteDDS(writer io.Writer, image *Image) error {
+
+	if image.Width <= 0 || image.Height <= 0 || image.Width > ddsMaxSize || image.Height > ddsMaxSize ||
+		image.Depth < 0 || image.Depth > ddsMaxSize || image.Layers > ddsMaxLayers {
+		return fmt.Errorf("%w: %dx%dx%d pixels in %d layers", ErrDdsUnsupported, image.Width, image.Height,
+			image.Depth, image.Layers)
+	}
+	if image.Depth > 0 && (image.Cubemap || image.Layers > 0) {
+		return fmt.Errorf("%w: volume cubemap or array", ErrDdsUnsupported)
+	}
+
+	for level := 0; level < image.Levels(); level++ {
+		if data, _, _ := image.Level(level); len(data) < image.LevelDataSize(level) {
+			return fmt.Errorf("Image level %d holds %d bytes instead of %d", level, len(data),
+				image.LevelDataSize(level))
+		}
+	}
+
+	header := make([]byte, ddsHeaderSize, ddsHeaderSize+ddsDX10HeaderSize)
+	copy(header, "DDS ")
+
+	flags := uint32(ddsdCaps | ddsdHeight | ddsdWidth | ddsdPixelFormat)
+	if image.Format.Compressed() {
+		flags |= ddsdLinearSize
+		binary.LittleEndian.PutUint32(header[20:], uint32(image.Format.DataSize(image.Width, image.Height)))
+	} else {
+		flags |= ddsdPitch
+		binary.LittleEndian.PutUint32(header[20:], uint32(image.Width*image.Format.BytesPerPixel()))
+	}
+
+	caps := uint32(ddsCapsTexture)
+	var caps2 uint32
+	if image.Levels() > 1 {
+		flags |= ddsdMipmapCount
+		caps |= ddsCapsComplex | ddsCapsMipmap
+	}
+	if image.Depth > 0 {
+		flags |= ddsdDepth
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Volume
+	}
+	if image.Cubemap {
+		caps |= ddsCapsComplex
+		caps2 |= ddsCaps2Cubemap | ddsCaps2CubemapAllFaces
+	}
+
+	binary.LittleEndian.PutUint32(header[4:], ddsDescriptionSize)
+	binary.LittleEndian.PutUint32(header[8:], flags)
+	binary.LittleEndian.PutUint32(header[12:], uint32(image.Height))
+	binary.LittleEndian.PutUint32(header[16:], uint32(image.Width))
+	binary.LittleEndian.PutUint32(header[24:], uint32(image.Depth))
+	binary.LittleEndian.PutUint32(header[28:], uint32(image.Levels()))
+	binary.LittleEndian.PutUint32(header[76:], ddsPixelFormatSize)
+	binary.LittleEndian.PutUint32(header[108:], caps)
+	binary.LittleEndian.PutUint32(header[112:], caps2)
+
+	if !writeDDSPixelFormat(header[80:108], image) {
+
+		dxgiFormat, ok := ddsDXGIFormat(image)
+		if !ok {
+			return fmt.Errorf("%w: no DXGI format for %v images", ErrDdsUnsupported, image.Format)
+		}
+
+		dimension, misc, arraySize := uint32(ddsDimension2D), uint32(0), uint32(1)
+		if image.Depth > 0 {
+			dimension = ddsDimension3D
+		}
+		if image.Cubemap {
+			misc = ddsMiscTextureCube
+		}
+		if image.Layers > 0 {
+			arraySize = uint32(image.Layers)
+		}
+
+		binary.LittleEndian.PutUint32(header[80:], ddpfFourCC)
+		binary.LittleEndian.PutUint32(header[84:], ddsFourCC("DX10"))
+
+		dx10 := make([]byte, ddsDX10HeaderSize)
+		binary.LittleEndian.PutUint32(dx10, dxgiFormat)
+		binary.LittleEndian.PutUint32(dx10[4:], dimension)
+		binary.LittleEndian.PutUint32(dx10[8:], misc)
+		binary.LittleEndian.PutUint32(dx10[12:], arraySize)
+		header = append(header, dx10...)
+
+	}
+
+	buffered := bufio.NewWriter(writer)
+	if _, err := buffered.Write(header); err != nil {
+		return err
+	}
+
+	// The file holds every level of the first face or layer, then every level of the next
+	for slice := 0; slice < image.Slices(); slice++ {
+		for level := 0; level < image.Levels(); level++ {
+
+			data, width, height := image.Level(level)
+			size := image.Format.DataSize(width, height) * image.LevelDepth(level)
+			if _, err := buffered.Write(data[slice*size : (slice+1)*size]); err != nil {
+				return err
+			}
+
+		}
+	}
+
+	return buffered.Flush()
+
+}
+
+// writeDDSPixelFormat fills in the flags, FourCC, bit count and masks of the original pixel format, and returns false
+// when the image needs the DX10 header instead
+func writeDDSPixelFormat(pixelFormat []byte, image *Image) bool {
+
+	if image.SRGB || image.Layers > 0 {
+		return false
+	}
+
+	var flags, fourCC uint32
+	var bitCount int
+	var masks [4]uint32
+
+	switch image.Format {
+	case ImageDXT1:
+		flags, fourCC = ddpfFourCC, FOURCC_DXT1
+	case ImageDXT3:
+		flags, fourCC = ddpfFourCC, FOURCC_DXT3
+	case ImageDXT5:
+		flags, fourCC = ddpfFourCC, FOURCC_DXT5
+	case ImageRGB8:
+		flags, bitCount, masks = ddpfRGB, 24, [4]uint32{0xff, 0xff00, 0xff0000}
+	case ImageRGBA8:
+		flags, bitCount, masks = ddpfRGB|ddpfAlphaPixels, 32, [4]uint32{0xff, 0xff00, 0xff0000, 0xff000000}
+	case ImageL8:
+		flags, bitCount, masks = ddpfLuminance, 8, [4]uint32{0xff}
+	case ImageLA8:
+		flags, bitCount, masks = ddpfLuminance|ddpfAlphaPixels, 16, [4]uint32{0xff, 0, 0, 0xff00}
+	default:
+		return false
+	}
+
+	binary.LittleEndian.PutUint32(pixelFormat, flags)
+	binary.LittleEndian.PutUint32(pixelFormat[4:], fourCC)
+	binary.LittleEndian.PutUint32(pixelFormat[8:], uint32(bitCount))
+	for i, mask := range masks {
+		binary.LittleEndian.PutUint32(pixelFormat[12+i*4:], mask)
+	}
+
+	return true
+
+}
+
+// ddsDXGIFormat finds the DXGI format LoadDDSImageFrom reads as the image's format without converting it
+func ddsDXGIFormat(image *Image) (uint32, bool) {
+
+	for dxgiFormat, layout := range ddsDXGIFormats {
+		if layout.format == image.Format && layout.srgb == image.SRGB && layout.bitCount == 0 {
+			return dxgiFormat, true
+		}
+	}
+
+	return 0, false
+
+}
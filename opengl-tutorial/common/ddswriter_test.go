@@ -0,0 +1,136 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// countingImage fills every level of an image with bytes counting up, so data written to the wrong level or slice
+// reads back different
+func countingImage(image *Image, levels int) *Image {
+
+	next := byte(0)
+	fill := func(size int) []byte {
+
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = next
+			next += 7
+		}
+
+		return data
+
+	}
+
+	image.Pixels = fill(image.LevelDataSize(0))
+	for level := 1; level < levels; level++ {
+		image.Mipmaps = append(image.Mipmaps, fill(image.LevelDataSize(level)))
+	}
+
+	return image
+
+}
+
+func TestWriteDDSRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		image *Image
+		dx10  bool
+	}{
+		{"DXT1 with mipmaps", countingImage(&Image{Width: 8, Height: 4, Format: ImageDXT1}, 4), false},
+		{"DXT3", countingImage(&Image{Width: 4, Height: 4, Format: ImageDXT3}, 1), false},
+		{"DXT5 non power of two", countingImage(&Image{Width: 6, Height: 5, Format: ImageDXT5}, 3), false},
+		{"RGB8", countingImage(&Image{Width: 3, Height: 2, Format: ImageRGB8}, 2), false},
+		{"RGBA8", countingImage(&Image{Width: 5, Height: 3, Format: ImageRGBA8}, 3), false},
+		{"L8", countingImage(&Image{Width: 7, Height: 1, Format: ImageL8}, 3), false},
+		{"LA8", countingImage(&Image{Width: 2, Height: 2, Format: ImageLA8}, 2), false},
+		{"sRGB RGBA8", countingImage(&Image{Width: 4, Height: 2, Format: ImageRGBA8, SRGB: true}, 3), true},
+		{"sRGB DXT1", countingImage(&Image{Width: 4, Height: 4, Format: ImageDXT1, SRGB: true}, 1), true},
+		{"RG8", countingImage(&Image{Width: 3, Height: 3, Format: ImageRG8}, 2), true},
+		{"BC7", countingImage(&Image{Width: 8, Height: 8, Format: ImageBC7}, 4), true},
+		{"RGBA16F", countingImage(&Image{Width: 2, Height: 1, Format: ImageRGBA16F}, 2), true},
+		{"cubemap", countingImage(&Image{Width: 4, Height: 4, Format: ImageRGBA8, Cubemap: true}, 3), false},
+		{"array", countingImage(&Image{Width: 4, Height: 2, Format: ImageDXT5, Layers: 3}, 2), true},
+		{"cubemap array", countingImage(&Image{Width: 2, Height: 2, Format: ImageR8, Cubemap: true, Layers: 2}, 2),
+			true},
+		{"volume", countingImage(&Image{Width: 4, Height: 2, Depth: 3, Format: ImageRGB8}, 3), false},
+	}
+
+	for _, test := range tests {
+
+		var file bytes.Buffer
+		if err := WriteDDS(&file, test.image); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if dx10 := bytes.Equal(file.Bytes()[84:88], []byte("DX10")); dx10 != test.dx10 {
+			t.Errorf("%s: DX10 header %v, want %v", test.name, dx10, test.dx10)
+		}
+
+		image, err := LoadDDSImageFrom(&file)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if image.Width != test.image.Width || image.Height != test.image.Height || image.Depth != test.image.Depth ||
+			image.Layers != test.image.Layers || image.Cubemap != test.image.Cubemap ||
+			image.Format != test.image.Format || image.SRGB != test.image.SRGB {
+			t.Errorf("%s: read back %dx%dx%d %v sRGB %v with %d layers and cubemap %v", test.name, image.Width,
+				image.Height, image.Depth, image.Format, image.SRGB, image.Layers, image.Cubemap)
+			continue
+		}
+		if image.Levels() != test.image.Levels() {
+			t.Errorf("%s: read back %d levels, want %d", test.name, image.Levels(), test.image.Levels())
+			continue
+		}
+
+		for level := 0; level < image.Levels(); level++ {
+
+			data, _, _ := image.Level(level)
+			want, _, _ := test.image.Level(level)
+			if !bytes.Equal(data, want) {
+				t.Errorf("%s: level %d read back as %v, want %v", test.name, level, data, want)
+			}
+
+		}
+
+	}
+
+}
+
+func TestWriteDDSInvalid(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		image       *Image
+		unsupported bool
+	}{
+		{"empty", &Image{Format: ImageRGBA8}, true},
+		{"too wide", &Image{Width: ddsMaxSize + 1, Height: 1, Format: ImageL8}, true},
+		{"volume cubemap", countingImage(&Image{Width: 2, Height: 2, Depth: 2, Cubemap: true, Format: ImageL8}, 1),
+			true},
+		{"volume array", countingImage(&Image{Width: 2, Height: 2, Depth: 2, Layers: 2, Format: ImageL8}, 1), true},
+		{"sRGB RGB8", countingImage(&Image{Width: 2, Height: 2, Format: ImageRGB8, SRGB: true}, 1), true},
+		{"short pixels", &Image{Width: 4, Height: 4, Format: ImageRGBA8, Pixels: make([]byte, 63)}, false},
+		{"short mipmap", &Image{Width: 4, Height: 4, Format: ImageL8, Pixels: make([]byte, 16),
+			Mipmaps: [][]byte{make([]byte, 3)}}, false},
+	}
+
+	for _, test := range tests {
+
+		var file bytes.Buffer
+		err := WriteDDS(&file, test.image)
+		if err == nil {
+			t.Errorf("%s: wrote %d bytes", test.name, file.Len())
+			continue
+		}
+
+		if unsupported := errors.Is(err, ErrDdsUnsupported); unsupported != test.unsupported {
+			t.Errorf("%s: error %q is ErrDdsUnsupported %v, want %v", test.name, err, unsupported, test.unsupported)
+		}
+
+	}
+
+}
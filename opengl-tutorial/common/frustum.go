@@ -0,0 +1,167 @@
+package common
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Containment is how much of a volume is inside a frustum
+type Containment int
+
+const (
+	Outside Containment = iota
+	Intersecting
+	Inside
+)
+
+// Order of the planes of a Frustum
+const (
+	FrustumLeft = iota
+	FrustumRight
+	FrustumBottom
+	FrustumTop
+	FrustumNear
+	FrustumFar
+)
+
+// Plane holds the points where Normal.Dot(point)+D is 0, Normal is a unit vector
+type Plane struct {
+	Normal mgl32.Vec3
+	D      float32
+}
+
+// Distance is the signed distance from the plane to point, positive on the side the normal points to
+func (plane Plane) Distance(point mgl32.Vec3) float32 {
+	return plane.Normal.Dot(point) + plane.D
+}
+
+// Frustum is the volume a camera sees, bounded by planes whose normals point inside
+type Frustum struct {
+	Planes [6]Plane
+}
+
+// NewFrustum extracts the world space frustum of a projection*view matrix, or the model space one of a
+// projection*view*model matrix, with the method of Gribb and Hartmann
+func NewFrustum(viewProjection mgl32.Mat4) *Frustum {
+
+	frustum := &Frustum{}
+	w := viewProjection.Row(3)
+
+	for i := 0; i < 3; i++ {
+
+		row := viewProjection.Row(i)
+		frustum.Planes[i*2] = planeFromVec4(w.Add(row))
+		frustum.Planes[i*2+1] = planeFromVec4(w.Sub(row))
+
+	}
+
+	return frustum
+
+}
+
+// GetFrustum is the frustum of the matrices from the last call to ComputeMatricesFromInputs
+func GetFrustum() *Frustum {
+	return NewFrustum(projectionMatrix.Mul4(viewMatrix))
+}
+
+func planeFromVec4(v mgl32.Vec4) Plane {
+
+	plane := Plane{Normal: v.Vec3(), D: v.W()}
+	if length := plane.Normal.Len(); length > 0 {
+		plane.Normal = plane.Normal.Mul(1 / length)
+		plane.D /= length
+	}
+
+	return plane
+
+}
+
+func (frustum *Frustum) ContainsPoint(point mgl32.Vec3) bool {
+
+	for _, plane := range frustum.Planes {
+		if plane.Distance(point) < 0 {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+func (frustum *Frustum) ContainsSphere(sphere BoundingSphere) Containment {
+
+	result := Inside
+	for _, plane := range frustum.Planes {
+
+		distance := plane.Distance(sphere.Center)
+		if distance < -sphere.Radius {
+			return Outside
+		}
+		if distance < sphere.Radius {
+			result = Intersecting
+		}
+
+	}
+
+	return result
+
+}
+
+// ContainsAABB tests the corner of the box furthest along each plane's normal, and the one furthest against it. Boxes
+// near the frustum's edges but outside of it can come back as Intersecting.
+func (frustum *Frustum) ContainsAABB(box AABB) Containment {
+
+	if box.IsEmpty() {
+		return Outside
+	}
+
+	result := Inside
+	for _, plane := range frustum.Planes {
+
+		positive, negative := box.Max, box.Min
+		for c := 0; c < 3; c++ {
+			if plane.Normal[c] < 0 {
+				positive[c], negative[c] = box.Min[c], box.Max[c]
+			}
+		}
+
+		if plane.Distance(positive) < 0 {
+			return Outside
+		}
+		if plane.Distance(negative) < 0 {
+			result = Intersecting
+		}
+
+	}
+
+	return result
+
+}
+
+// CullAABBs returns the indices of the world space boxes that are at least partly visible, stored in visible so its
+// memory can be reused from frame to frame. Boxes in model space can be moved into world space with AABB.Transform.
+func (frustum *Frustum) CullAABBs(boxes []AABB, visible []int) []int {
+
+	visible = visible[:0]
+	for i, box := range boxes {
+		if frustum.ContainsAABB(box) != Outside {
+			visible = append(visible, i)
+		}
+	}
+
+	return visible
+
+}
+
+// CullSpheres is CullAABBs for bounding spheres
+func (frustum *Frustum) CullSpheres(spheres []BoundingSphere, visible []int) []int {
+
+	visible = visible[:0]
+	for i, sphere := range spheres {
+		if frustum.ContainsSphere(sphere) != Outside {
+			visible = append(visible, i)
+		}
+	}
+
+	return visible
+
+}
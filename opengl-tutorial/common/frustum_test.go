@@ -0,0 +1,220 @@
+package common
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// testFrustum is a 90 degree camera at the origin looking down -Z, seeing from 1 to 10 units away
+func testFrustum() *Frustum {
+	return NewFrustum(mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 10))
+}
+
+// frustumFacePoints is a point in the middle of each face of testFrustum, in plane order
+var frustumFacePoints = [6]mgl32.Vec3{
+	FrustumLeft:   {-5, 0, -5},
+	FrustumRight:  {5, 0, -5},
+	FrustumBottom: {0, -5, -5},
+	FrustumTop:    {0, 5, -5},
+	FrustumNear:   {0, 0, -1},
+	FrustumFar:    {0, 0, -10},
+}
+
+func nearPlane(a, b Plane) bool {
+	return nearVec3(a.Normal, b.Normal, 1e-5) && math.Abs(float64(a.D-b.D)) < 1e-4
+}
+
+func TestNewFrustum(t *testing.T) {
+
+	half := float32(math.Sqrt2 / 2)
+
+	tests := []struct {
+		name   string
+		matrix mgl32.Mat4
+		planes [6]Plane
+	}{
+		{
+			"perspective",
+			mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 10),
+			[6]Plane{
+				FrustumLeft:   {Normal: mgl32.Vec3{half, 0, -half}},
+				FrustumRight:  {Normal: mgl32.Vec3{-half, 0, -half}},
+				FrustumBottom: {Normal: mgl32.Vec3{0, half, -half}},
+				FrustumTop:    {Normal: mgl32.Vec3{0, -half, -half}},
+				FrustumNear:   {Normal: mgl32.Vec3{0, 0, -1}, D: -1},
+				FrustumFar:    {Normal: mgl32.Vec3{0, 0, 1}, D: 10},
+			},
+		},
+		{
+			// The camera at z=5 sees from z=4 down to z=-5
+			"perspective and view",
+			mgl32.Perspective(mgl32.DegToRad(90), 1, 1, 10).Mul4(mgl32.LookAt(0, 0, 5, 0, 0, 0, 0, 1, 0)),
+			[6]Plane{
+				FrustumLeft:   {Normal: mgl32.Vec3{half, 0, -half}, D: 5 * half},
+				FrustumRight:  {Normal: mgl32.Vec3{-half, 0, -half}, D: 5 * half},
+				FrustumBottom: {Normal: mgl32.Vec3{0, half, -half}, D: 5 * half},
+				FrustumTop:    {Normal: mgl32.Vec3{0, -half, -half}, D: 5 * half},
+				FrustumNear:   {Normal: mgl32.Vec3{0, 0, -1}, D: 4},
+				FrustumFar:    {Normal: mgl32.Vec3{0, 0, 1}, D: 5},
+			},
+		},
+		{
+			"orthographic",
+			mgl32.Ortho(-2, 2, -1, 1, 0, 4),
+			[6]Plane{
+				FrustumLeft:   {Normal: mgl32.Vec3{1, 0, 0}, D: 2},
+				FrustumRight:  {Normal: mgl32.Vec3{-1, 0, 0}, D: 2},
+				FrustumBottom: {Normal: mgl32.Vec3{0, 1, 0}, D: 1},
+				FrustumTop:    {Normal: mgl32.Vec3{0, -1, 0}, D: 1},
+				FrustumNear:   {Normal: mgl32.Vec3{0, 0, -1}},
+				FrustumFar:    {Normal: mgl32.Vec3{0, 0, 1}, D: 4},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		frustum := NewFrustum(test.matrix)
+		for p, plane := range frustum.Planes {
+
+			if length := plane.Normal.Len(); math.Abs(float64(length)-1) > 1e-5 {
+				t.Errorf("%s: plane %d has a normal of length %v", test.name, p, length)
+			}
+			if !nearPlane(plane, test.planes[p]) {
+				t.Errorf("%s: plane %d is %+v, want %+v", test.name, p, plane, test.planes[p])
+			}
+
+		}
+
+	}
+
+}
+
+func TestGetFrustum(t *testing.T) {
+
+	defer func(projection, view mgl32.Mat4) {
+		projectionMatrix, viewMatrix = projection, view
+	}(projectionMatrix, viewMatrix)
+
+	projectionMatrix = mgl32.Perspective(mgl32.DegToRad(60), 4.0/3.0, 0.1, 100)
+	viewMatrix = mgl32.LookAt(3, 2, 1, 0, 0, 0, 0, 1, 0)
+
+	want := NewFrustum(projectionMatrix.Mul4(viewMatrix))
+	frustum := GetFrustum()
+	for p := range frustum.Planes {
+		if !nearPlane(frustum.Planes[p], want.Planes[p]) {
+			t.Errorf("Plane %d is %+v, want %+v", p, frustum.Planes[p], want.Planes[p])
+		}
+	}
+
+	// The camera looks at the origin from in front of the near plane
+	if !frustum.ContainsPoint(mgl32.Vec3{}) || frustum.ContainsPoint(mgl32.Vec3{3, 2, 1}) {
+		t.Errorf("Frustum %+v doesn't hold the origin or holds the camera", frustum.Planes)
+	}
+
+}
+
+func TestFrustumContains(t *testing.T) {
+
+	frustum := testFrustum()
+
+	// Move a volume on each face point a unit in, a unit out, or leave it across the face
+	tests := []struct {
+		name   string
+		offset float32
+		want   Containment
+	}{
+		{"inside", 1, Inside},
+		{"straddling", 0, Intersecting},
+		{"outside", -1, Outside},
+	}
+
+	for p, point := range frustumFacePoints {
+		for _, test := range tests {
+
+			center := point.Add(frustum.Planes[p].Normal.Mul(test.offset))
+
+			sphere := BoundingSphere{Center: center, Radius: 0.5}
+			if containment := frustum.ContainsSphere(sphere); containment != test.want {
+				t.Errorf("Plane %d: %s sphere at %v is %v, want %v", p, test.name, center, containment, test.want)
+			}
+
+			extents := mgl32.Vec3{0.25, 0.25, 0.25}
+			box := AABB{Min: center.Sub(extents), Max: center.Add(extents)}
+			if containment := frustum.ContainsAABB(box); containment != test.want {
+				t.Errorf("Plane %d: %s box at %v is %v, want %v", p, test.name, center, containment, test.want)
+			}
+
+			if contains := frustum.ContainsPoint(center); contains != (test.offset >= 0) {
+				t.Errorf("Plane %d: %s point %v contained %v", p, test.name, center, contains)
+			}
+
+		}
+	}
+
+	if containment := frustum.ContainsAABB(EmptyAABB()); containment != Outside {
+		t.Errorf("Empty box is %v, want %v", containment, Outside)
+	}
+
+	// Volumes around the whole frustum are across every plane
+	if containment := frustum.ContainsSphere(BoundingSphere{Radius: 100}); containment != Intersecting {
+		t.Errorf("Sphere around the frustum is %v, want %v", containment, Intersecting)
+	}
+	huge := AABB{Min: mgl32.Vec3{-100, -100, -100}, Max: mgl32.Vec3{100, 100, 100}}
+	if containment := frustum.ContainsAABB(huge); containment != Intersecting {
+		t.Errorf("Box around the frustum is %v, want %v", containment, Intersecting)
+	}
+
+}
+
+func TestFrustumCull(t *testing.T) {
+
+	frustum := testFrustum()
+
+	at := func(center mgl32.Vec3) AABB {
+		return AABB{Min: center.Sub(mgl32.Vec3{0.5, 0.5, 0.5}), Max: center.Add(mgl32.Vec3{0.5, 0.5, 0.5})}
+	}
+	centers := []mgl32.Vec3{
+		{0, 0, -5},   // in view
+		{0, 0, 5},    // behind the camera
+		{5, 0, -5},   // across the right side
+		{0, 0, -20},  // past the far plane
+		{-2, 1, -3},  // in view
+		{0, 0, -0.7}, // across the near plane
+		{-9, 0, -5},  // left of the view
+	}
+	want := []int{0, 2, 4, 5}
+
+	boxes := make([]AABB, len(centers))
+	spheres := make([]BoundingSphere, len(centers))
+	for i, center := range centers {
+		boxes[i] = at(center)
+		spheres[i] = BoundingSphere{Center: center, Radius: 0.5}
+	}
+
+	// The results go in the slice passed in, whatever it held before
+	visible := make([]int, 3, 16)
+	visible = frustum.CullAABBs(boxes, visible)
+	if !reflect.DeepEqual(visible, want) {
+		t.Errorf("Visible boxes %v, want %v", visible, want)
+	}
+	if cap(visible) != 16 {
+		t.Errorf("Culling boxes reallocated the visible slice")
+	}
+
+	visible = frustum.CullSpheres(spheres, visible)
+	if !reflect.DeepEqual(visible, want) {
+		t.Errorf("Visible spheres %v, want %v", visible, want)
+	}
+	if cap(visible) != 16 {
+		t.Errorf("Culling spheres reallocated the visible slice")
+	}
+
+	if visible := frustum.CullAABBs(nil, nil); len(visible) != 0 {
+		t.Errorf("Visible boxes %v of none", visible)
+	}
+
+}
@@ -0,0 +1,1465 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\0"
+)
+
+// Primitive modes we can turn into triangles
+const (
+	gltfModeTriangles     = 4
+	gltfModeTriangleStrip = 5
+	gltfModeTriangleFan   = 6
+)
+
+var ErrGltfUnsupported = errors.New("Unsupported glTF feature")
+
+type GltfImage struct {
+	Name     string
+	MimeType string
+
+	// Path of an external image file, or the image itself when it's embedded in a buffer or data URI
+	Path string
+	Data []byte
+}
+
+// GltfTextureRef is a texture used by a material, with the sampler state converted to GL enums
+type GltfTextureRef struct {
+	Image *GltfImage
+
+	MagFilter int32
+	MinFilter int32
+	WrapS     int32
+	WrapT     int32
+
+	// Index of the TEXCOORD_n set to sample with, and the normal map scale or occlusion strength
+	TexCoord int
+	Scale    float32
+
+	// UvTransform maps uvs to texture coordinates as (UvTransform * vec3(uv, 1)).xy. It comes from the
+	// KHR_texture_transform extension and is the identity without it.
+	UvTransform mgl32.Mat3
+}
+
+// GltfMaterial is a PBR metallic-roughness material
+type GltfMaterial struct {
+	Name string
+
+	BaseColorFactor          mgl32.Vec4
+	BaseColorTexture         *GltfTextureRef
+	MetallicFactor           float32
+	RoughnessFactor          float32
+	MetallicRoughnessTexture *GltfTextureRef
+
+	NormalTexture    *GltfTextureRef
+	OcclusionTexture *GltfTextureRef
+	EmissiveTexture  *GltfTextureRef
+	EmissiveFactor   mgl32.Vec3
+
+	AlphaMode   string // OPAQUE, MASK or BLEND
+	AlphaCutoff float32
+	DoubleSided bool
+}
+
+// GltfPrimitive is a piece of a mesh as indexed triangles in the mesh's own space. Uvs are zero and normals are flat
+// when the file doesn't have them.
+type GltfPrimitive struct {
+	Indices  []uint32
+	Vertices []mgl32.Vec3
+	Uvs      []mgl32.Vec2
+	Normals  []mgl32.Vec3
+	Material *GltfMaterial
+
+	// Joints and Weights are only set on skinned primitives, ready for SkinVertices
+	Joints  [][4]uint16
+	Weights []mgl32.Vec4
+}
+
+type GltfMesh struct {
+	Name       string
+	Primitives []*GltfPrimitive
+}
+
+type GltfNode struct {
+	Name string
+
+	Translation mgl32.Vec3
+	Rotation    mgl32.Quat
+	Scale       mgl32.Vec3
+
+	// Nodes can give their transform as a matrix instead of translation, rotation and scale
+	Matrix    mgl32.Mat4
+	HasMatrix bool
+
+	Mesh     *GltfMesh
+	Skin     *GltfSkin
+	Parent   *GltfNode
+	Children []*GltfNode
+}
+
+func (node *GltfNode) LocalTransform() mgl32.Mat4 {
+
+	if node.HasMatrix {
+		return node.Matrix
+	}
+
+	return mgl32.Translate3D(node.Translation.X(), node.Translation.Y(), node.Translation.Z()).
+		Mul4(node.Rotation.Mat4()).
+		Mul4(mgl32.Scale3D(node.Scale.X(), node.Scale.Y(), node.Scale.Z()))
+
+}
+
+func (node *GltfNode) WorldTransform() mgl32.Mat4 {
+
+	if node.Parent == nil {
+		return node.LocalTransform()
+	}
+
+	return node.Parent.WorldTransform().Mul4(node.LocalTransform())
+
+}
+
+// GltfSkin is a Skin whose skeleton is made of the Joints nodes, with the model's animations converted to clips over
+// that skeleton
+type GltfSkin struct {
+	Skin
+
+	Name   string
+	Joints []*GltfNode
+	Clips  []*AnimationClip
+}
+
+type GltfModel struct {
+	Nodes     []*GltfNode
+	Meshes    []*GltfMesh
+	Materials []*GltfMaterial
+	Images    []*GltfImage
+	Skins     []*GltfSkin
+
+	// Roots are the top level nodes of the default scene
+	Roots []*GltfNode
+
+	document *gltfDocument
+	buffers  [][]byte
+}
+
+// Flatten bakes every mesh instance in the scene into world space and merges them into one set of buffers, ready for
+// the same draw call tutorial 09 uses for IndexVBO's output
+func (model *GltfModel) Flatten() ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	var indices []uint32
+	var vertices []mgl32.Vec3
+	var uvs []mgl32.Vec2
+	var normals []mgl32.Vec3
+
+	var visit func(node *GltfNode, parent mgl32.Mat4)
+	visit = func(node *GltfNode, parent mgl32.Mat4) {
+
+		world := parent.Mul4(node.LocalTransform())
+		normalMatrix := world.Mat3().Inv().Transpose()
+
+		if node.Mesh != nil {
+			for _, primitive := range node.Mesh.Primitives {
+
+				base := uint32(len(vertices))
+				for _, index := range primitive.Indices {
+					indices = append(indices, base+index)
+				}
+
+				for i, vertex := range primitive.Vertices {
+
+					vertices = append(vertices, mgl32.TransformCoordinate(vertex, world))
+					uvs = append(uvs, primitive.Uvs[i])
+
+					normal := normalMatrix.Mul3x1(primitive.Normals[i])
+					if normal.Len() > 0 {
+						normal = normal.Normalize()
+					}
+					normals = append(normals, normal)
+
+				}
+
+			}
+		}
+
+		for _, child := range node.Children {
+			visit(child, world)
+		}
+
+	}
+
+	for _, root := range model.Roots {
+		visit(root, mgl32.Ident4())
+	}
+
+	return indices, vertices, uvs, normals
+
+}
+
+// The parts of the glTF JSON schema we read
+type gltfDocument struct {
+	Asset struct {
+		Version    string `json:"version"`
+		MinVersion string `json:"minVersion"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+
+	Nodes []struct {
+		Name        string    `json:"name"`
+		Children    []int     `json:"children"`
+		Mesh        *int      `json:"mesh"`
+		Skin        *int      `json:"skin"`
+		Matrix      []float32 `json:"matrix"`
+		Translation []float32 `json:"translation"`
+		Rotation    []float32 `json:"rotation"`
+		Scale       []float32 `json:"scale"`
+	} `json:"nodes"`
+
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Material   *int           `json:"material"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+
+	Skins []struct {
+		Name                string `json:"name"`
+		InverseBindMatrices *int   `json:"inverseBindMatrices"`
+		Joints              []int  `json:"joints"`
+	} `json:"skins"`
+
+	Animations []struct {
+		Name     string `json:"name"`
+		Channels []struct {
+			Sampler int `json:"sampler"`
+			Target  struct {
+				Node *int   `json:"node"`
+				Path string `json:"path"`
+			} `json:"target"`
+		} `json:"channels"`
+		Samplers []struct {
+			Input         int    `json:"input"`
+			Output        int    `json:"output"`
+			Interpolation string `json:"interpolation"`
+		} `json:"samplers"`
+	} `json:"animations"`
+
+	Accessors   []gltfAccessor `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+
+	Materials []struct {
+		Name                 string `json:"name"`
+		PbrMetallicRoughness *struct {
+			BaseColorFactor          []float32        `json:"baseColorFactor"`
+			BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+			MetallicFactor           *float32         `json:"metallicFactor"`
+			RoughnessFactor          *float32         `json:"roughnessFactor"`
+			MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture    *gltfTextureInfo `json:"normalTexture"`
+		OcclusionTexture *gltfTextureInfo `json:"occlusionTexture"`
+		EmissiveTexture  *gltfTextureInfo `json:"emissiveTexture"`
+		EmissiveFactor   []float32        `json:"emissiveFactor"`
+		AlphaMode        string           `json:"alphaMode"`
+		AlphaCutoff      *float32         `json:"alphaCutoff"`
+		DoubleSided      bool             `json:"doubleSided"`
+	} `json:"materials"`
+
+	Textures []struct {
+		Sampler *int `json:"sampler"`
+		Source  *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		Name       string `json:"name"`
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Samplers []struct {
+		MagFilter int32 `json:"magFilter"`
+		MinFilter int32 `json:"minFilter"`
+		WrapS     int32 `json:"wrapS"`
+		WrapT     int32 `json:"wrapT"`
+	} `json:"samplers"`
+}
+
+type gltfTextureInfo struct {
+	Index      int      `json:"index"`
+	TexCoord   int      `json:"texCoord"`
+	Scale      *float32 `json:"scale"`
+	Strength   *float32 `json:"strength"`
+	Extensions struct {
+		TextureTransform *struct {
+			Offset   []float32 `json:"offset"`
+			Rotation float32   `json:"rotation"`
+			Scale    []float32 `json:"scale"`
+			TexCoord *int      `json:"texCoord"`
+		} `json:"KHR_texture_transform"`
+	} `json:"extensions"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int   `json:"bufferView"`
+	ByteOffset    int    `json:"byteOffset"`
+	ComponentType int    `json:"componentType"`
+	Normalized    bool   `json:"normalized"`
+	Count         int    `json:"count"`
+	Type          string `json:"type"`
+	Sparse        *struct {
+		Count   int `json:"count"`
+		Indices struct {
+			BufferView    int `json:"bufferView"`
+			ByteOffset    int `json:"byteOffset"`
+			ComponentType int `json:"componentType"`
+		} `json:"indices"`
+		Values struct {
+			BufferView int `json:"bufferView"`
+			ByteOffset int `json:"byteOffset"`
+		} `json:"values"`
+	} `json:"sparse"`
+}
+
+func LoadGltf(path string) (*GltfModel, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	model, err := ReadGltf(file, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return model, nil
+
+}
+
+// ReadGltf reads a .gltf or .glb model, external buffers and images are resolved relative to dir
+func ReadGltf(reader io.Reader, dir string) (*GltfModel, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonChunk := data
+	var binChunk []byte
+
+	if len(data) >= 12 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if jsonChunk, binChunk, err = splitGlb(data); err != nil {
+			return nil, err
+		}
+	}
+
+	document := &gltfDocument{}
+	if err := json.Unmarshal(jsonChunk, document); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(document.Asset.Version, "2.") {
+		return nil, fmt.Errorf("%w: version %q", ErrGltfUnsupported, document.Asset.Version)
+	}
+
+	for _, extension := range document.ExtensionsRequired {
+		if extension != "KHR_materials_unlit" && extension != "KHR_texture_transform" {
+			return nil, fmt.Errorf("%w: required extension %s", ErrGltfUnsupported, extension)
+		}
+	}
+
+	model := &GltfModel{document: document}
+
+	for i, buffer := range document.Buffers {
+
+		var data []byte
+		if buffer.URI == "" {
+			// Only the first buffer of a GLB may leave out its uri, it's the BIN chunk
+			if i != 0 || binChunk == nil {
+				return nil, fmt.Errorf("Buffer %d has no data", i)
+			}
+			data = binChunk
+		} else if data, err = readGltfURI(buffer.URI, dir); err != nil {
+			return nil, err
+		}
+
+		if len(data) < buffer.ByteLength {
+			return nil, fmt.Errorf("Buffer %d is %d bytes, expected %d", i, len(data), buffer.ByteLength)
+		}
+		model.buffers = append(model.buffers, data[:buffer.ByteLength])
+
+	}
+
+	if err := model.loadMaterials(dir); err != nil {
+		return nil, err
+	}
+
+	if err := model.loadMeshes(); err != nil {
+		return nil, err
+	}
+
+	if err := model.loadNodes(); err != nil {
+		return nil, err
+	}
+
+	if err := model.loadSkins(); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+
+}
+
+// splitGlb returns the JSON and BIN chunks of a binary glTF container
+func splitGlb(data []byte) ([]byte, []byte, error) {
+
+	version := binary.LittleEndian.Uint32(data[4:])
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if version != 2 {
+		return nil, nil, fmt.Errorf("%w: GLB version %d", ErrGltfUnsupported, version)
+	}
+	if length > len(data) {
+		return nil, nil, errors.New("GLB file is truncated")
+	}
+
+	var jsonChunk, binChunk []byte
+	for offset := 12; offset+8 <= length; {
+
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+
+		if chunkLength < 0 || offset+chunkLength > length {
+			return nil, nil, errors.New("GLB chunk runs past the end of the file")
+		}
+
+		switch chunkType {
+		case glbChunkJSON:
+			jsonChunk = data[offset : offset+chunkLength]
+		case glbChunkBIN:
+			if binChunk == nil {
+				binChunk = data[offset : offset+chunkLength]
+			}
+		}
+
+		// Chunks are padded to 4 bytes
+		offset += (chunkLength + 3) &^ 3
+
+	}
+
+	if jsonChunk == nil {
+		return nil, nil, errors.New("GLB file has no JSON chunk")
+	}
+
+	return jsonChunk, binChunk, nil
+
+}
+
+// readGltfURI returns the contents of a base64 data URI or of a file relative to dir
+func readGltfURI(uri string, dir string) ([]byte, error) {
+
+	if strings.HasPrefix(uri, "data:") {
+
+		comma := strings.IndexByte(uri, ',')
+		if comma < 0 || !strings.HasSuffix(uri[:comma], ";base64") {
+			return nil, fmt.Errorf("%w: data URI encoding", ErrGltfUnsupported)
+		}
+
+		return base64.StdEncoding.DecodeString(uri[comma+1:])
+
+	}
+
+	path, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+
+}
+
+func (model *GltfModel) loadMaterials(dir string) error {
+
+	document := model.document
+
+	for _, image := range document.Images {
+
+		loaded := &GltfImage{Name: image.Name, MimeType: image.MimeType}
+
+		switch {
+		case image.BufferView != nil:
+			data, _, err := model.bufferView(*image.BufferView)
+			if err != nil {
+				return err
+			}
+			loaded.Data = data
+		case strings.HasPrefix(image.URI, "data:"):
+			data, err := readGltfURI(image.URI, dir)
+			if err != nil {
+				return err
+			}
+			loaded.Data = data
+		default:
+			path, err := url.PathUnescape(image.URI)
+			if err != nil {
+				return err
+			}
+			loaded.Path = filepath.Join(dir, filepath.FromSlash(path))
+		}
+
+		model.Images = append(model.Images, loaded)
+
+	}
+
+	textureRef := func(info *gltfTextureInfo) (*GltfTextureRef, error) {
+
+		if info == nil {
+			return nil, nil
+		}
+
+		if info.Index < 0 || info.Index >= len(document.Textures) {
+			return nil, fmt.Errorf("Texture %d doesn't exist", info.Index)
+		}
+		texture := document.Textures[info.Index]
+
+		// Sampler defaults when the file leaves them out
+		ref := &GltfTextureRef{
+			MagFilter:   gl.LINEAR,
+			MinFilter:   gl.LINEAR_MIPMAP_LINEAR,
+			WrapS:       gl.REPEAT,
+			WrapT:       gl.REPEAT,
+			TexCoord:    info.TexCoord,
+			Scale:       1,
+			UvTransform: mgl32.Ident3(),
+		}
+
+		if texture.Source != nil {
+			if *texture.Source < 0 || *texture.Source >= len(model.Images) {
+				return nil, fmt.Errorf("Image %d doesn't exist", *texture.Source)
+			}
+			ref.Image = model.Images[*texture.Source]
+		}
+
+		if texture.Sampler != nil {
+			if *texture.Sampler < 0 || *texture.Sampler >= len(document.Samplers) {
+				return nil, fmt.Errorf("Sampler %d doesn't exist", *texture.Sampler)
+			}
+			sampler := document.Samplers[*texture.Sampler]
+			if sampler.MagFilter != 0 {
+				ref.MagFilter = sampler.MagFilter
+			}
+			if sampler.MinFilter != 0 {
+				ref.MinFilter = sampler.MinFilter
+			}
+			if sampler.WrapS != 0 {
+				ref.WrapS = sampler.WrapS
+			}
+			if sampler.WrapT != 0 {
+				ref.WrapT = sampler.WrapT
+			}
+		}
+
+		if info.Scale != nil {
+			ref.Scale = *info.Scale
+		}
+		if info.Strength != nil {
+			ref.Scale = *info.Strength
+		}
+
+		// The transform is scale, then rotation, then offset. The rotation is counter-clockwise in uv space, where v
+		// points down, so it's clockwise to HomogRotate2D.
+		if transform := info.Extensions.TextureTransform; transform != nil {
+
+			offset := mgl32.Vec2{}
+			scale := mgl32.Vec2{1, 1}
+			copy(offset[:], transform.Offset)
+			copy(scale[:], transform.Scale)
+
+			translation := mgl32.Translate2D(offset.X(), offset.Y())
+			rotation := mgl32.HomogRotate2D(-transform.Rotation)
+			ref.UvTransform = translation.Mul3(rotation).Mul3(mgl32.Scale2D(scale.X(), scale.Y()))
+
+			if transform.TexCoord != nil {
+				ref.TexCoord = *transform.TexCoord
+			}
+
+		}
+
+		return ref, nil
+
+	}
+
+	for _, material := range document.Materials {
+
+		loaded := &GltfMaterial{
+			Name:            material.Name,
+			BaseColorFactor: mgl32.Vec4{1, 1, 1, 1},
+			MetallicFactor:  1,
+			RoughnessFactor: 1,
+			AlphaMode:       "OPAQUE",
+			AlphaCutoff:     0.5,
+			DoubleSided:     material.DoubleSided,
+		}
+
+		var err error
+		refs := []struct {
+			info   *gltfTextureInfo
+			target **GltfTextureRef
+		}{
+			{material.NormalTexture, &loaded.NormalTexture},
+			{material.OcclusionTexture, &loaded.OcclusionTexture},
+			{material.EmissiveTexture, &loaded.EmissiveTexture},
+		}
+
+		if pbr := material.PbrMetallicRoughness; pbr != nil {
+
+			copy(loaded.BaseColorFactor[:], pbr.BaseColorFactor)
+			if pbr.MetallicFactor != nil {
+				loaded.MetallicFactor = *pbr.MetallicFactor
+			}
+			if pbr.RoughnessFactor != nil {
+				loaded.RoughnessFactor = *pbr.RoughnessFactor
+			}
+
+			refs = append(refs, []struct {
+				info   *gltfTextureInfo
+				target **GltfTextureRef
+			}{
+				{pbr.BaseColorTexture, &loaded.BaseColorTexture},
+				{pbr.MetallicRoughnessTexture, &loaded.MetallicRoughnessTexture},
+			}...)
+
+		}
+
+		for _, ref := range refs {
+			if *ref.target, err = textureRef(ref.info); err != nil {
+				return err
+			}
+		}
+
+		copy(loaded.EmissiveFactor[:], material.EmissiveFactor)
+		if material.AlphaMode != "" {
+			loaded.AlphaMode = material.AlphaMode
+		}
+		if material.AlphaCutoff != nil {
+			loaded.AlphaCutoff = *material.AlphaCutoff
+		}
+
+		model.Materials = append(model.Materials, loaded)
+
+	}
+
+	return nil
+
+}
+
+func (model *GltfModel) loadMeshes() error {
+
+	for m, mesh := range model.document.Meshes {
+
+		loaded := &GltfMesh{Name: mesh.Name}
+
+		for p, primitive := range mesh.Primitives {
+
+			mode := gltfModeTriangles
+			if primitive.Mode != nil {
+				mode = *primitive.Mode
+			}
+
+			// Points and lines have nothing to shade
+			if mode != gltfModeTriangles && mode != gltfModeTriangleStrip && mode != gltfModeTriangleFan {
+				continue
+			}
+
+			position, ok := primitive.Attributes["POSITION"]
+			if !ok {
+				continue
+			}
+
+			loadedPrimitive := &GltfPrimitive{}
+
+			var err error
+			if loadedPrimitive.Vertices, err = model.readVec3(position); err != nil {
+				return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+			}
+
+			if primitive.Indices != nil {
+				if loadedPrimitive.Indices, err = model.readIndices(*primitive.Indices); err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+			} else {
+				loadedPrimitive.Indices = make([]uint32, len(loadedPrimitive.Vertices))
+				for i := range loadedPrimitive.Indices {
+					loadedPrimitive.Indices[i] = uint32(i)
+				}
+			}
+
+			for _, index := range loadedPrimitive.Indices {
+				if int(index) >= len(loadedPrimitive.Vertices) {
+					return fmt.Errorf("Mesh %d primitive %d: index %d out of range", m, p, index)
+				}
+			}
+
+			loadedPrimitive.Indices = triangulateGltf(loadedPrimitive.Indices, mode)
+
+			if uv, ok := primitive.Attributes["TEXCOORD_0"]; ok {
+				if loadedPrimitive.Uvs, err = model.readVec2(uv); err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+			} else {
+				loadedPrimitive.Uvs = make([]mgl32.Vec2, len(loadedPrimitive.Vertices))
+			}
+
+			joints, hasJoints := primitive.Attributes["JOINTS_0"]
+			weights, hasWeights := primitive.Attributes["WEIGHTS_0"]
+			if hasJoints && hasWeights {
+
+				if loadedPrimitive.Weights, err = model.readVec4(weights); err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+
+				jointIndices, err := model.readVec4(joints)
+				if err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+
+				loadedPrimitive.Joints = make([][4]uint16, len(jointIndices))
+				for i, joint := range jointIndices {
+					for c := range joint {
+						loadedPrimitive.Joints[i][c] = uint16(joint[c])
+					}
+				}
+
+				if len(loadedPrimitive.Joints) != len(loadedPrimitive.Vertices) ||
+					len(loadedPrimitive.Weights) != len(loadedPrimitive.Vertices) {
+					return fmt.Errorf("Mesh %d primitive %d: attribute counts differ", m, p)
+				}
+
+			}
+
+			if len(loadedPrimitive.Uvs) != len(loadedPrimitive.Vertices) {
+				return fmt.Errorf("Mesh %d primitive %d: attribute counts differ", m, p)
+			}
+
+			if normal, ok := primitive.Attributes["NORMAL"]; ok {
+				if loadedPrimitive.Normals, err = model.readVec3(normal); err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+				if len(loadedPrimitive.Normals) != len(loadedPrimitive.Vertices) {
+					return fmt.Errorf("Mesh %d primitive %d: attribute counts differ", m, p)
+				}
+			} else {
+				if err := loadedPrimitive.flattenNormals(); err != nil {
+					return fmt.Errorf("Mesh %d primitive %d: %w", m, p, err)
+				}
+			}
+
+			if primitive.Material != nil {
+				if *primitive.Material < 0 || *primitive.Material >= len(model.Materials) {
+					return fmt.Errorf("Mesh %d primitive %d: material %d doesn't exist", m, p, *primitive.Material)
+				}
+				loadedPrimitive.Material = model.Materials[*primitive.Material]
+			}
+
+			loaded.Primitives = append(loaded.Primitives, loadedPrimitive)
+
+		}
+
+		model.Meshes = append(model.Meshes, loaded)
+
+	}
+
+	return nil
+
+}
+
+// triangulateGltf turns the indices of a strip or fan into a triangle list
+func triangulateGltf(indices []uint32, mode int) []uint32 {
+
+	if mode == gltfModeTriangles {
+		return indices[:len(indices)/3*3]
+	}
+
+	var triangles []uint32
+	for i := 2; i < len(indices); i++ {
+
+		if mode == gltfModeTriangleFan {
+			triangles = append(triangles, indices[0], indices[i-1], indices[i])
+		} else if i%2 == 0 {
+			triangles = append(triangles, indices[i-2], indices[i-1], indices[i])
+		} else {
+			// Every other triangle of a strip is flipped to keep the winding
+			triangles = append(triangles, indices[i-1], indices[i-2], indices[i])
+		}
+
+	}
+
+	return triangles
+
+}
+
+// flattenNormals gives a primitive without normals flat ones as the spec asks, which means splitting its vertices
+func (primitive *GltfPrimitive) flattenNormals() error {
+
+	vertices := make([]mgl32.Vec3, len(primitive.Indices))
+	uvs := make([]mgl32.Vec2, len(primitive.Indices))
+	for i, index := range primitive.Indices {
+		vertices[i] = primitive.Vertices[index]
+		uvs[i] = primitive.Uvs[index]
+	}
+
+	attributes := []VertexAttribute{
+		Vec3Attribute(vertices, 0),
+		Vec2Attribute(uvs, 0),
+		Vec3Attribute(ComputeFlatNormals(vertices), 0),
+	}
+
+	if primitive.Joints != nil {
+
+		joints := VertexAttribute{Size: 4, Data: make([]float32, 0, len(primitive.Indices)*4)}
+		weights := make([]mgl32.Vec4, len(primitive.Indices))
+		for i, index := range primitive.Indices {
+			for _, joint := range primitive.Joints[index] {
+				joints.Data = append(joints.Data, float32(joint))
+			}
+			weights[i] = primitive.Weights[index]
+		}
+
+		attributes = append(attributes, joints, Vec4Attribute(weights, 0))
+
+	}
+
+	mesh, err := IndexAttributes(attributes...)
+	if err != nil {
+		return err
+	}
+
+	primitive.Indices = mesh.Indices
+	primitive.Vertices = mesh.Attributes[0].Vec3s()
+	primitive.Uvs = mesh.Attributes[1].Vec2s()
+	primitive.Normals = mesh.Attributes[2].Vec3s()
+
+	if primitive.Joints != nil {
+
+		primitive.Joints = make([][4]uint16, mesh.VertexCount())
+		for i, joint := range mesh.Attributes[3].Vec4s() {
+			for c := range joint {
+				primitive.Joints[i][c] = uint16(joint[c])
+			}
+		}
+		primitive.Weights = mesh.Attributes[4].Vec4s()
+
+	}
+
+	return nil
+
+}
+
+func (model *GltfModel) loadNodes() error {
+
+	document := model.document
+
+	for _, node := range document.Nodes {
+
+		loaded := &GltfNode{
+			Name:     node.Name,
+			Rotation: mgl32.QuatIdent(),
+			Scale:    mgl32.Vec3{1, 1, 1},
+		}
+
+		if len(node.Matrix) == 16 {
+			copy(loaded.Matrix[:], node.Matrix)
+			loaded.HasMatrix = true
+		}
+		copy(loaded.Translation[:], node.Translation)
+		copy(loaded.Scale[:], node.Scale)
+		if len(node.Rotation) == 4 {
+			loaded.Rotation = mgl32.Quat{W: node.Rotation[3], V: mgl32.Vec3{node.Rotation[0], node.Rotation[1], node.Rotation[2]}}
+		}
+
+		if node.Mesh != nil {
+			if *node.Mesh < 0 || *node.Mesh >= len(model.Meshes) {
+				return fmt.Errorf("Mesh %d doesn't exist", *node.Mesh)
+			}
+			loaded.Mesh = model.Meshes[*node.Mesh]
+		}
+
+		model.Nodes = append(model.Nodes, loaded)
+
+	}
+
+	for n, node := range document.Nodes {
+		for _, child := range node.Children {
+
+			if child < 0 || child >= len(model.Nodes) || model.Nodes[child].Parent != nil || child == n {
+				return fmt.Errorf("Node %d has an invalid child %d", n, child)
+			}
+
+			model.Nodes[child].Parent = model.Nodes[n]
+			model.Nodes[n].Children = append(model.Nodes[n].Children, model.Nodes[child])
+
+		}
+	}
+
+	// No node has two parents, so the ones that can't be reached from a node without a parent are in a cycle
+	reached := make(map[*GltfNode]bool, len(model.Nodes))
+	var stack []*GltfNode
+	for _, node := range model.Nodes {
+		if node.Parent == nil {
+			stack = append(stack, node)
+		}
+	}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		reached[node] = true
+		stack = append(stack, node.Children...)
+	}
+	for n, node := range model.Nodes {
+		if !reached[node] {
+			return fmt.Errorf("Node %d is in a cycle of children", n)
+		}
+	}
+
+	// The default scene, or every node without a parent if there are no scenes
+	if len(document.Scenes) > 0 {
+
+		scene := 0
+		if document.Scene != nil {
+			scene = *document.Scene
+		}
+		if scene < 0 || scene >= len(document.Scenes) {
+			return fmt.Errorf("Scene %d doesn't exist", scene)
+		}
+
+		for _, n := range document.Scenes[scene].Nodes {
+			if n < 0 || n >= len(model.Nodes) {
+				return fmt.Errorf("Node %d doesn't exist", n)
+			}
+			model.Roots = append(model.Roots, model.Nodes[n])
+		}
+
+	} else {
+
+		for _, node := range model.Nodes {
+			if node.Parent == nil {
+				model.Roots = append(model.Roots, node)
+			}
+		}
+
+	}
+
+	return nil
+
+}
+
+// loadSkins builds a skeleton out of the joint nodes of each skin and converts the animations to clips over it. A
+// joint's parent is its closest ancestor in the skin, and the skeleton hangs from the parent of the root joints.
+func (model *GltfModel) loadSkins() error {
+
+	document := model.document
+
+	for s, skin := range document.Skins {
+
+		loaded := &GltfSkin{Name: skin.Name}
+		nodeJoints := make(map[*GltfNode]int)
+
+		for i, n := range skin.Joints {
+			if n < 0 || n >= len(model.Nodes) {
+				return fmt.Errorf("Skin %d: node %d doesn't exist", s, n)
+			}
+			loaded.Joints = append(loaded.Joints, model.Nodes[n])
+			nodeJoints[model.Nodes[n]] = i
+		}
+
+		skeleton := &Skeleton{Joints: make([]Joint, len(loaded.Joints)), Transform: mgl32.Ident4()}
+		for i, node := range loaded.Joints {
+
+			joint := Joint{Name: node.Name, Parent: -1, Rest: node.jointPose()}
+			for parent := node.Parent; parent != nil; parent = parent.Parent {
+				if p, ok := nodeJoints[parent]; ok {
+					joint.Parent = p
+					break
+				}
+			}
+
+			if joint.Parent < 0 && node.Parent != nil {
+				skeleton.Transform = node.Parent.WorldTransform()
+			}
+
+			skeleton.Joints[i] = joint
+
+		}
+
+		if err := skeleton.Validate(); err != nil {
+			return fmt.Errorf("Skin %d: %w", s, err)
+		}
+		loaded.Skeleton = skeleton
+		loaded.InverseBindMatrices = make([]mgl32.Mat4, len(loaded.Joints))
+		for i := range loaded.InverseBindMatrices {
+			loaded.InverseBindMatrices[i] = mgl32.Ident4()
+		}
+
+		if skin.InverseBindMatrices != nil {
+
+			values, components, err := model.readAccessor(*skin.InverseBindMatrices)
+			if err != nil {
+				return fmt.Errorf("Skin %d: %w", s, err)
+			}
+			if components != 16 || len(values) < len(loaded.Joints)*16 {
+				return fmt.Errorf("Skin %d: not enough inverse bind matrices", s)
+			}
+
+			for i := range loaded.InverseBindMatrices {
+				copy(loaded.InverseBindMatrices[i][:], values[i*16:])
+			}
+
+		}
+
+		for a := range document.Animations {
+
+			clip, err := model.animationClip(a, nodeJoints)
+			if err != nil {
+				return err
+			}
+			loaded.Clips = append(loaded.Clips, clip)
+
+		}
+
+		model.Skins = append(model.Skins, loaded)
+
+	}
+
+	for n, node := range document.Nodes {
+		if node.Skin != nil {
+			if *node.Skin < 0 || *node.Skin >= len(model.Skins) {
+				return fmt.Errorf("Skin %d doesn't exist", *node.Skin)
+			}
+			model.Nodes[n].Skin = model.Skins[*node.Skin]
+		}
+	}
+
+	return nil
+
+}
+
+// jointPose splits a node's transform into the translation, rotation and scale animations work with
+func (node *GltfNode) jointPose() JointPose {
+
+	if !node.HasMatrix {
+		return JointPose{Translation: node.Translation, Rotation: node.Rotation, Scale: node.Scale}
+	}
+
+	return matrixJointPose(node.Matrix)
+
+}
+
+// animationClip converts the channels of an animation that target the joints of a skin. The duration covers every
+// channel so the clips of different skins stay in step.
+func (model *GltfModel) animationClip(index int, nodeJoints map[*GltfNode]int) (*AnimationClip, error) {
+
+	animation := model.document.Animations[index]
+	clip := &AnimationClip{Name: animation.Name}
+
+	for c, channel := range animation.Channels {
+
+		if channel.Sampler < 0 || channel.Sampler >= len(animation.Samplers) {
+			return nil, fmt.Errorf("Animation %d channel %d: sampler %d doesn't exist", index, c, channel.Sampler)
+		}
+		sampler := animation.Samplers[channel.Sampler]
+
+		times, _, err := model.readAccessor(sampler.Input)
+		if err != nil {
+			return nil, fmt.Errorf("Animation %d channel %d: %w", index, c, err)
+		}
+		if len(times) > 0 && times[len(times)-1] > clip.Duration {
+			clip.Duration = times[len(times)-1]
+		}
+
+		if channel.Target.Node == nil || *channel.Target.Node < 0 || *channel.Target.Node >= len(model.Nodes) {
+			continue
+		}
+		joint, ok := nodeJoints[model.Nodes[*channel.Target.Node]]
+		if !ok {
+			continue
+		}
+
+		converted := AnimationChannel{Joint: joint, Times: times}
+
+		components := 3
+		switch channel.Target.Path {
+		case "translation":
+			converted.Path = AnimationTranslation
+		case "rotation":
+			converted.Path = AnimationRotation
+			components = 4
+		case "scale":
+			converted.Path = AnimationScale
+		default:
+			// Morph target weights
+			continue
+		}
+
+		keys := 1
+		switch sampler.Interpolation {
+		case "", "LINEAR":
+			converted.Interpolation = InterpolationLinear
+		case "STEP":
+			converted.Interpolation = InterpolationStep
+		case "CUBICSPLINE":
+			converted.Interpolation = InterpolationCubicSpline
+			keys = 3
+		default:
+			return nil, fmt.Errorf("Animation %d channel %d: unknown interpolation %q", index, c,
+				sampler.Interpolation)
+		}
+
+		if converted.Values, _, err = model.readAccessor(sampler.Output); err != nil {
+			return nil, fmt.Errorf("Animation %d channel %d: %w", index, c, err)
+		}
+		if len(converted.Values) != len(times)*components*keys {
+			return nil, fmt.Errorf("Animation %d channel %d: expected %d values, got %d", index, c,
+				len(times)*components*keys, len(converted.Values))
+		}
+
+		clip.Channels = append(clip.Channels, converted)
+
+	}
+
+	return clip, nil
+
+}
+
+// bufferView returns the bytes of a buffer view and its stride, 0 if the data is tightly packed
+func (model *GltfModel) bufferView(index int) ([]byte, int, error) {
+
+	if index < 0 || index >= len(model.document.BufferViews) {
+		return nil, 0, fmt.Errorf("Buffer view %d doesn't exist", index)
+	}
+
+	view := model.document.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(model.buffers) {
+		return nil, 0, fmt.Errorf("Buffer %d doesn't exist", view.Buffer)
+	}
+
+	buffer := model.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(buffer) {
+		return nil, 0, fmt.Errorf("Buffer view %d runs past the end of its buffer", index)
+	}
+
+	return buffer[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+
+}
+
+// Accessors without a buffer view aren't backed by any data in the file, so their size is capped instead
+const gltfMaxZeroValues = 1 << 24
+
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+func gltfComponentSize(componentType int) int {
+
+	switch componentType {
+	case gl.BYTE, gl.UNSIGNED_BYTE:
+		return 1
+	case gl.SHORT, gl.UNSIGNED_SHORT:
+		return 2
+	case gl.UNSIGNED_INT, gl.FLOAT:
+		return 4
+	}
+
+	return 0
+
+}
+
+// readGltfComponent decodes one component, scaling normalized integers to [0, 1] or [-1, 1]
+func readGltfComponent(data []byte, componentType int, normalized bool) float32 {
+
+	switch componentType {
+	case gl.BYTE:
+		value := float32(int8(data[0]))
+		if normalized {
+			return float32(math.Max(float64(value/127), -1))
+		}
+		return value
+	case gl.UNSIGNED_BYTE:
+		if normalized {
+			return float32(data[0]) / 255
+		}
+		return float32(data[0])
+	case gl.SHORT:
+		value := float32(int16(binary.LittleEndian.Uint16(data)))
+		if normalized {
+			return float32(math.Max(float64(value/32767), -1))
+		}
+		return value
+	case gl.UNSIGNED_SHORT:
+		value := float32(binary.LittleEndian.Uint16(data))
+		if normalized {
+			return value / 65535
+		}
+		return value
+	case gl.UNSIGNED_INT:
+		return float32(binary.LittleEndian.Uint32(data))
+	}
+
+	return math.Float32frombits(binary.LittleEndian.Uint32(data))
+
+}
+
+// readElements reads count elements of components values each from a buffer view, starting at offset. Matrix columns
+// of 1 and 2 byte components are padded to 4 bytes as the spec requires.
+func (model *GltfModel) readElements(view int, offset int, count int, components int, componentType int,
+	normalized bool, matrix bool) ([]float32, error) {
+
+	componentSize := gltfComponentSize(componentType)
+	if componentSize == 0 {
+		return nil, fmt.Errorf("%w: component type %d", ErrGltfUnsupported, componentType)
+	}
+
+	rows, columns := components, 1
+	if matrix {
+		rows = int(math.Sqrt(float64(components)))
+		columns = rows
+	}
+
+	columnSize := rows * componentSize
+	if matrix && columnSize%4 != 0 {
+		columnSize = (columnSize + 3) &^ 3
+	}
+	elementSize := columnSize * columns
+
+	data, stride, err := model.bufferView(view)
+	if err != nil {
+		return nil, err
+	}
+	if stride == 0 {
+		stride = elementSize
+	}
+	if stride < 0 || count < 0 {
+		return nil, fmt.Errorf("Accessor on buffer view %d has a negative stride or count", view)
+	}
+
+	// The count is checked against what fits in the view before it's multiplied, so a corrupt one can't overflow
+	if count > 0 && (offset < 0 || offset > len(data)-elementSize || count-1 > (len(data)-offset-elementSize)/stride) {
+		return nil, fmt.Errorf("Accessor runs past the end of buffer view %d", view)
+	}
+
+	values := make([]float32, 0, count*components)
+	for i := 0; i < count; i++ {
+		for column := 0; column < columns; column++ {
+			for row := 0; row < rows; row++ {
+				start := offset + i*stride + column*columnSize + row*componentSize
+				values = append(values, readGltfComponent(data[start:], componentType, normalized))
+			}
+		}
+	}
+
+	return values, nil
+
+}
+
+// readAccessor returns the values of an accessor as floats along with the number of components per element
+func (model *GltfModel) readAccessor(index int) ([]float32, int, error) {
+
+	if index < 0 || index >= len(model.document.Accessors) {
+		return nil, 0, fmt.Errorf("Accessor %d doesn't exist", index)
+	}
+	accessor := model.document.Accessors[index]
+
+	components, ok := gltfTypeComponents[accessor.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("Accessor %d has unknown type %q", index, accessor.Type)
+	}
+	matrix := strings.HasPrefix(accessor.Type, "MAT")
+
+	if accessor.Count < 0 {
+		return nil, 0, fmt.Errorf("Accessor %d has a negative count", index)
+	}
+	if accessor.BufferView == nil && accessor.Count > gltfMaxZeroValues/components {
+		return nil, 0, fmt.Errorf("Accessor %d has %d elements and no buffer view", index, accessor.Count)
+	}
+
+	// Accessors without a buffer view are all zeros, unless sparse values are applied on top
+	var values []float32
+	if accessor.BufferView != nil {
+		var err error
+		values, err = model.readElements(*accessor.BufferView, accessor.ByteOffset, accessor.Count, components,
+			accessor.ComponentType, accessor.Normalized, matrix)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Accessor %d: %w", index, err)
+		}
+	} else {
+		values = make([]float32, accessor.Count*components)
+	}
+
+	if sparse := accessor.Sparse; sparse != nil {
+
+		switch sparse.Indices.ComponentType {
+		case gl.UNSIGNED_BYTE, gl.UNSIGNED_SHORT, gl.UNSIGNED_INT:
+		default:
+			return nil, 0, fmt.Errorf("Accessor %d sparse indices have component type %d", index,
+				sparse.Indices.ComponentType)
+		}
+
+		indices, err := model.readElements(sparse.Indices.BufferView, sparse.Indices.ByteOffset, sparse.Count, 1,
+			sparse.Indices.ComponentType, false, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Accessor %d sparse indices: %w", index, err)
+		}
+
+		replacements, err := model.readElements(sparse.Values.BufferView, sparse.Values.ByteOffset, sparse.Count,
+			components, accessor.ComponentType, accessor.Normalized, matrix)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Accessor %d sparse values: %w", index, err)
+		}
+
+		for i, element := range indices {
+			if element < 0 || int(element) >= accessor.Count {
+				return nil, 0, fmt.Errorf("Accessor %d sparse index %d out of range", index, int(element))
+			}
+			copy(values[int(element)*components:], replacements[i*components:(i+1)*components])
+		}
+
+	}
+
+	return values, components, nil
+
+}
+
+func (model *GltfModel) readVec2(index int) ([]mgl32.Vec2, error) {
+
+	values, components, err := model.readAccessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if components != 2 {
+		return nil, fmt.Errorf("Accessor %d isn't a VEC2", index)
+	}
+
+	return VertexAttribute{Size: 2, Data: values}.Vec2s(), nil
+
+}
+
+func (model *GltfModel) readVec3(index int) ([]mgl32.Vec3, error) {
+
+	values, components, err := model.readAccessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if components != 3 {
+		return nil, fmt.Errorf("Accessor %d isn't a VEC3", index)
+	}
+
+	return VertexAttribute{Size: 3, Data: values}.Vec3s(), nil
+
+}
+
+func (model *GltfModel) readVec4(index int) ([]mgl32.Vec4, error) {
+
+	values, components, err := model.readAccessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if components != 4 {
+		return nil, fmt.Errorf("Accessor %d isn't a VEC4", index)
+	}
+
+	return VertexAttribute{Size: 4, Data: values}.Vec4s(), nil
+
+}
+
+func (model *GltfModel) readIndices(index int) ([]uint32, error) {
+
+	values, components, err := model.readAccessor(index)
+	if err != nil {
+		return nil, err
+	}
+	if components != 1 {
+		return nil, fmt.Errorf("Accessor %d isn't a SCALAR", index)
+	}
+
+	// Unsigned int indices above 2^24 lose precision as floats, read them straight from the buffer instead
+	accessor := model.document.Accessors[index]
+	if accessor.ComponentType == gl.UNSIGNED_INT && accessor.BufferView != nil && accessor.Sparse == nil {
+
+		data, stride, err := model.bufferView(*accessor.BufferView)
+		if err != nil {
+			return nil, err
+		}
+		if stride == 0 {
+			stride = 4
+		}
+
+		indices := make([]uint32, accessor.Count)
+		for i := range indices {
+			indices[i] = binary.LittleEndian.Uint32(data[accessor.ByteOffset+i*stride:])
+		}
+
+		return indices, nil
+
+	}
+
+	indices := make([]uint32, len(values))
+	for i, value := range values {
+		indices[i] = uint32(value)
+	}
+
+	return indices, nil
+
+}
+
+// Reader opens the image for image.Decode, whether it was embedded in the model or sits next to it. Close it when done.
+func (image *GltfImage) Reader() (io.ReadCloser, error) {
+
+	if image.Data != nil {
+		return ioutil.NopCloser(bytes.NewReader(image.Data)), nil
+	}
+
+	return os.Open(image.Path)
+
+}
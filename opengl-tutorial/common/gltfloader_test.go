@@ -0,0 +1,689 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func readGltfString(document string) (*GltfModel, error) {
+	return ReadGltf(strings.NewReader(document), "")
+}
+
+func TestReadGltfNodeHierarchy(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		nodes string
+
+		// Parent of each node, -1 for roots, or nil when the hierarchy is invalid
+		parents []int
+	}{
+		{"tree", `[{"children": [1, 2]}, {}, {"children": [3]}, {}]`, []int{-1, 0, 0, 2}},
+		{"forest", `[{}, {"children": [0]}, {}]`, []int{1, -1, -1}},
+		{"own child", `[{"children": [0]}]`, nil},
+		{"two parents", `[{"children": [2]}, {"children": [2]}, {}]`, nil},
+		{"child that doesn't exist", `[{"children": [1]}]`, nil},
+		{"cycle of two", `[{"children": [1]}, {"children": [0]}]`, nil},
+		{"cycle under a root", `[{"children": [1]}, {"children": [2]}, {"children": [3]}, {"children": [1]}]`, nil},
+		{"separate cycle", `[{"children": [1]}, {}, {"children": [3]}, {"children": [4]}, {"children": [2]}]`, nil},
+	}
+
+	for _, test := range tests {
+
+		model, err := readGltfString(`{"asset": {"version": "2.0"}, "nodes": ` + test.nodes + `}`)
+		if (err == nil) != (test.parents != nil) {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		// Without scenes every node without a parent is a root, in file order
+		var roots []*GltfNode
+		for n, node := range model.Nodes {
+
+			parent := test.parents[n]
+			if parent < 0 {
+				roots = append(roots, node)
+				if node.Parent != nil {
+					t.Errorf("%s: root %d has a parent", test.name, n)
+				}
+				continue
+			}
+
+			if node.Parent != model.Nodes[parent] {
+				t.Errorf("%s: node %d has the wrong parent", test.name, n)
+			}
+			children := 0
+			for _, child := range model.Nodes[parent].Children {
+				if child == node {
+					children++
+				}
+			}
+			if children != 1 {
+				t.Errorf("%s: node %d is %d children of node %d", test.name, n, children, parent)
+			}
+
+		}
+
+		if len(model.Roots) != len(roots) {
+			t.Fatalf("%s: %d roots, want %d", test.name, len(model.Roots), len(roots))
+		}
+		for i, root := range roots {
+			if model.Roots[i] != root {
+				t.Errorf("%s: root %d is the wrong node", test.name, i)
+			}
+		}
+
+	}
+
+}
+
+func TestReadGltfUnsupported(t *testing.T) {
+
+	documents := []string{
+		`{"asset": {"version": "1.0"}}`,
+		`{"asset": {"version": "2.0"}, "extensionsRequired": ["KHR_draco_mesh_compression"]}`,
+		`{"asset": {"version": "2.0"}, "buffers": [{"byteLength": 4, "uri": "data:application/octet-stream,abcd"}]}`,
+	}
+
+	for _, document := range documents {
+		if _, err := readGltfString(document); !errors.Is(err, ErrGltfUnsupported) {
+			t.Errorf("%s: error %v isn't ErrGltfUnsupported", document, err)
+		}
+	}
+
+}
+
+// sparseGltf is a triangle whose positions are all zero but for sparse values replacing one of them. The buffer holds
+// the sparse index at the start in indexType and three floats after it.
+func sparseGltf(indexType int, index interface{}) string {
+
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, index)
+	buffer.Write(make([]byte, 4-buffer.Len()))
+	binary.Write(&buffer, binary.LittleEndian, [3]float32{1, 2, 3})
+
+	return fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": %d, "uri": "data:application/octet-stream;base64,%s"}],
+		"bufferViews": [{"buffer": 0, "byteLength": 4}, {"buffer": 0, "byteOffset": 4, "byteLength": 12}],
+		"accessors": [{"componentType": 5126, "count": 3, "type": "VEC3", "sparse": {
+			"count": 1,
+			"indices": {"bufferView": 0, "componentType": %d},
+			"values": {"bufferView": 1}
+		}}],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}]
+	}`, buffer.Len(), base64.StdEncoding.EncodeToString(buffer.Bytes()), indexType)
+
+}
+
+func TestReadGltfSparse(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		indexType int
+		index     interface{}
+
+		// Vertex the sparse values replace, -1 when the accessor is invalid
+		replaced int
+	}{
+		{"unsigned byte", 5121, uint8(1), 1},
+		{"unsigned short", 5123, uint16(2), 2},
+		{"unsigned int", 5125, uint32(0), 0},
+		{"unsigned byte past the end", 5121, uint8(3), -1},
+		{"unsigned int past the end", 5125, uint32(math.MaxUint32), -1},
+		{"negative float", 5126, float32(-1), -1},
+		{"fractional float", 5126, float32(0.5), -1},
+		{"signed short", 5122, int16(-1), -1},
+	}
+
+	for _, test := range tests {
+
+		model, err := readGltfString(sparseGltf(test.indexType, test.index))
+		if (err == nil) != (test.replaced >= 0) {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		primitive := model.Meshes[0].Primitives[0]
+		for i, index := range primitive.Indices {
+			want := mgl32.Vec3{}
+			if i == test.replaced {
+				want = mgl32.Vec3{1, 2, 3}
+			}
+			if vertex := primitive.Vertices[index]; vertex != want {
+				t.Errorf("%s: corner %d is %v, want %v", test.name, i, vertex, want)
+			}
+		}
+
+	}
+
+}
+
+func TestGltfImageReader(t *testing.T) {
+
+	image := &GltfImage{Data: []byte("picture")}
+	reader, err := image.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil || string(data) != "picture" {
+		t.Errorf("Read %q, %v", data, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Error(err)
+	}
+
+	image = &GltfImage{Path: "doesn't exist.png"}
+	if _, err := image.Reader(); err == nil {
+		t.Error("Opened an image that doesn't exist")
+	}
+
+}
+
+// gltfDataURI packs values with binary.Write into a base64 data URI, returned with its length in bytes
+func gltfDataURI(values ...interface{}) (string, int) {
+
+	var buffer bytes.Buffer
+	for _, value := range values {
+		binary.Write(&buffer, binary.LittleEndian, value)
+	}
+
+	return "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), buffer.Len()
+
+}
+
+type glbChunk struct {
+	kind uint32
+	data []byte
+}
+
+// glbFile packs chunks into a binary glTF container, padding JSON with spaces and everything else with zeros
+func glbFile(chunks ...glbChunk) []byte {
+
+	var body bytes.Buffer
+	for _, chunk := range chunks {
+
+		padding := byte(0)
+		if chunk.kind == glbChunkJSON {
+			padding = ' '
+		}
+
+		data := append([]byte(nil), chunk.data...)
+		for len(data)%4 != 0 {
+			data = append(data, padding)
+		}
+
+		binary.Write(&body, binary.LittleEndian, [2]uint32{uint32(len(data)), chunk.kind})
+		body.Write(data)
+
+	}
+
+	var file bytes.Buffer
+	binary.Write(&file, binary.LittleEndian, [3]uint32{glbMagic, 2, uint32(12 + body.Len())})
+	file.Write(body.Bytes())
+
+	return file.Bytes()
+
+}
+
+func TestReadGlb(t *testing.T) {
+
+	triangle := []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}
+	document := []byte(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": 36}],
+		"bufferViews": [{"buffer": 0, "byteLength": 36}],
+		"accessors": [{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}]
+	}`)
+
+	var bin bytes.Buffer
+	binary.Write(&bin, binary.LittleEndian, triangle)
+
+	valid := glbFile(glbChunk{glbChunkJSON, document}, glbChunk{glbChunkBIN, bin.Bytes()})
+	edit := func(offset int, value uint32) []byte {
+		data := append([]byte(nil), valid...)
+		binary.LittleEndian.PutUint32(data[offset:], value)
+		return data
+	}
+
+	// The JSON chunk header is at 12 and the BIN chunk header follows the padded document
+	binOffset := 20 + (len(document)+3)&^3
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{"valid", valid, true},
+		{"unknown chunk skipped", glbFile(glbChunk{glbChunkJSON, document}, glbChunk{0x12345678, []byte{1, 2, 3}},
+			glbChunk{glbChunkBIN, bin.Bytes()}), true},
+		{"bad magic", edit(0, 0x46546C68), false},
+		{"version 1", edit(4, 1), false},
+		{"length past the end", edit(8, uint32(len(valid)+4)), false},
+		{"JSON chunk past the end", edit(12, uint32(len(valid))), false},
+		{"BIN chunk past the end", edit(binOffset, uint32(len(bin.Bytes())+4)), false},
+		{"huge chunk length", edit(binOffset, math.MaxUint32), false},
+		{"BIN chunk too short", edit(binOffset, 32), false},
+		{"truncated", valid[:len(valid)-4], false},
+		{"no JSON chunk", glbFile(glbChunk{glbChunkBIN, bin.Bytes()}), false},
+		{"no BIN chunk", glbFile(glbChunk{glbChunkJSON, document}), false},
+	}
+
+	for _, test := range tests {
+
+		model, err := ReadGltf(bytes.NewReader(test.data), "")
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		vertices := model.Meshes[0].Primitives[0].Vertices
+		for i, vertex := range vertices {
+			if want := (mgl32.Vec3{triangle[i*3], triangle[i*3+1], triangle[i*3+2]}); vertex != want {
+				t.Errorf("%s: vertex %d is %v, want %v", test.name, i, vertex, want)
+			}
+		}
+
+	}
+
+	if _, _, err := splitGlb(edit(4, 1)); !errors.Is(err, ErrGltfUnsupported) {
+		t.Errorf("GLB version 1 gave error %v", err)
+	}
+
+	jsonChunk, binChunk, err := splitGlb(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jsonChunk) != (len(document)+3)&^3 || !bytes.Equal(binChunk, bin.Bytes()) {
+		t.Errorf("Split into %d bytes of JSON and %d of BIN, want %d and %d", len(jsonChunk), len(binChunk),
+			(len(document)+3)&^3, bin.Len())
+	}
+
+}
+
+func TestGltfNodeTransforms(t *testing.T) {
+
+	half := float32(math.Sqrt2 / 2)
+	rotation := mgl32.HomogRotate3DY(math.Pi / 2)
+	near := func(a float32, b float32) bool {
+		return math.Abs(float64(a-b)) <= 1e-6
+	}
+
+	tests := []struct {
+		name string
+		node string
+		want mgl32.Mat4
+	}{
+		{"default", `{}`, mgl32.Ident4()},
+		{"translation", `{"translation": [1, 2, 3]}`, mgl32.Translate3D(1, 2, 3)},
+		{"rotation", fmt.Sprintf(`{"rotation": [0, %v, 0, %v]}`, half, half), rotation},
+		{"scale", `{"scale": [2, 3, 4]}`, mgl32.Scale3D(2, 3, 4)},
+		{"translation, rotation and scale",
+			fmt.Sprintf(`{"translation": [1, 2, 3], "rotation": [0, %v, 0, %v], "scale": [2, 3, 4]}`, half, half),
+			mgl32.Translate3D(1, 2, 3).Mul4(rotation).Mul4(mgl32.Scale3D(2, 3, 4))},
+		{"matrix", `{"matrix": [2, 0, 0, 0, 0, 3, 0, 0, 0, 0, 4, 0, 1, 2, 3, 1]}`,
+			mgl32.Translate3D(1, 2, 3).Mul4(mgl32.Scale3D(2, 3, 4))},
+		{"matrix over translation",
+			`{"matrix": [1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 5, 6, 7, 1], "translation": [1, 2, 3]}`,
+			mgl32.Translate3D(5, 6, 7)},
+		{"short matrix ignored", `{"matrix": [2, 0, 0, 0], "translation": [1, 2, 3]}`, mgl32.Translate3D(1, 2, 3)},
+	}
+
+	for _, test := range tests {
+
+		// The node hangs under a parent translated along x, which its world transform has to include
+		model, err := readGltfString(`{"asset": {"version": "2.0"}, "nodes": [` +
+			`{"translation": [10, 0, 0], "children": [1]}, ` + test.node + `]}`)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		node := model.Nodes[1]
+		if local := node.LocalTransform(); !local.ApproxFuncEqual(test.want, near) {
+			t.Errorf("%s: local transform %v, want %v", test.name, local, test.want)
+		}
+		want := mgl32.Translate3D(10, 0, 0).Mul4(test.want)
+		if world := node.WorldTransform(); !world.ApproxFuncEqual(want, near) {
+			t.Errorf("%s: world transform %v, want %v", test.name, world, want)
+		}
+
+	}
+
+}
+
+func TestTriangulateGltf(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		mode    int
+		indices []uint32
+		want    []uint32
+	}{
+		{"triangles", gltfModeTriangles, []uint32{0, 1, 2, 2, 1, 3}, []uint32{0, 1, 2, 2, 1, 3}},
+		{"triangles with leftovers", gltfModeTriangles, []uint32{0, 1, 2, 3, 4}, []uint32{0, 1, 2}},
+		{"strip", gltfModeTriangleStrip, []uint32{0, 1, 2, 3, 4}, []uint32{0, 1, 2, 2, 1, 3, 2, 3, 4}},
+		{"short strip", gltfModeTriangleStrip, []uint32{0, 1}, nil},
+		{"fan", gltfModeTriangleFan, []uint32{0, 1, 2, 3, 4}, []uint32{0, 1, 2, 0, 2, 3, 0, 3, 4}},
+		{"short fan", gltfModeTriangleFan, []uint32{0}, nil},
+	}
+
+	for _, test := range tests {
+		if triangles := triangulateGltf(test.indices, test.mode); fmt.Sprint(triangles) != fmt.Sprint(test.want) {
+			t.Errorf("%s: %v, want %v", test.name, triangles, test.want)
+		}
+	}
+
+}
+
+func TestReadGltfStripsAndFans(t *testing.T) {
+
+	// A unit square in the XY plane facing +Z, as a strip zigzagging across it and as a fan around a corner
+	tests := []struct {
+		name     string
+		mode     int
+		vertices []float32
+	}{
+		{"strip", gltfModeTriangleStrip, []float32{0, 0, 0, 1, 0, 0, 0, 1, 0, 1, 1, 0}},
+		{"fan", gltfModeTriangleFan, []float32{0, 0, 0, 1, 0, 0, 1, 1, 0, 0, 1, 0}},
+	}
+
+	for _, test := range tests {
+
+		uri, length := gltfDataURI(test.vertices)
+		model, err := readGltfString(fmt.Sprintf(`{
+			"asset": {"version": "2.0"},
+			"buffers": [{"byteLength": %d, "uri": "%s"}],
+			"bufferViews": [{"buffer": 0, "byteLength": %d}],
+			"accessors": [{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"}],
+			"meshes": [{"primitives": [{"attributes": {"POSITION": 0}, "mode": %d}]}]
+		}`, length, uri, length, test.mode))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		// Both triangles get flat normals, which only agree if the winding was kept
+		primitive := model.Meshes[0].Primitives[0]
+		if len(primitive.Indices) != 6 {
+			t.Errorf("%s: %d indices, want 6", test.name, len(primitive.Indices))
+		}
+		for _, index := range primitive.Indices {
+			if normal := primitive.Normals[index]; !normal.ApproxEqual(mgl32.Vec3{0, 0, 1}) {
+				t.Errorf("%s: normal %v, want +Z", test.name, normal)
+			}
+		}
+
+	}
+
+}
+
+func TestReadGltfComponent(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		componentType int
+		normalized    bool
+		value         interface{}
+		want          float32
+	}{
+		{"byte", 5120, false, int8(-128), -128},
+		{"normalized byte max", 5120, true, int8(127), 1},
+		{"normalized byte min", 5120, true, int8(-128), -1},
+		{"normalized byte min + 1", 5120, true, int8(-127), -1},
+		{"unsigned byte", 5121, false, uint8(200), 200},
+		{"normalized unsigned byte", 5121, true, uint8(255), 1},
+		{"normalized unsigned byte half", 5121, true, uint8(51), 0.2},
+		{"short", 5122, false, int16(-300), -300},
+		{"normalized short max", 5122, true, int16(32767), 1},
+		{"normalized short min", 5122, true, int16(-32768), -1},
+		{"unsigned short", 5123, false, uint16(60000), 60000},
+		{"normalized unsigned short", 5123, true, uint16(65535), 1},
+		{"unsigned int", 5125, false, uint32(70000), 70000},
+		{"float", 5126, false, float32(-2.5), -2.5},
+	}
+
+	for _, test := range tests {
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, test.value)
+		buffer.Write(make([]byte, 4))
+
+		value := readGltfComponent(buffer.Bytes(), test.componentType, test.normalized)
+		if math.Abs(float64(value-test.want)) > 1e-6 {
+			t.Errorf("%s: %v, want %v", test.name, value, test.want)
+		}
+
+	}
+
+}
+
+func TestReadGltfNormalizedAttributes(t *testing.T) {
+
+	// Uvs as normalized unsigned bytes and normals as normalized bytes, each padded to a 4 byte stride
+	positions := []float32{0, 0, 0, 1, 0, 0, 0, 1, 0}
+	uvs := [][4]uint8{{0, 255, 0, 0}, {255, 255, 0, 0}, {0, 51, 0, 0}}
+	normals := [][4]int8{{0, 0, 127, 0}, {0, -128, 0, 0}, {127, 0, 0, 0}}
+	uri, length := gltfDataURI(positions, uvs, normals)
+
+	model, err := readGltfString(fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": %d, "uri": "%s"}],
+		"bufferViews": [
+			{"buffer": 0, "byteLength": 36},
+			{"buffer": 0, "byteOffset": 36, "byteLength": 12, "byteStride": 4},
+			{"buffer": 0, "byteOffset": 48, "byteLength": 12, "byteStride": 4}
+		],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			{"bufferView": 1, "componentType": 5121, "normalized": true, "count": 3, "type": "VEC2"},
+			{"bufferView": 2, "componentType": 5120, "normalized": true, "count": 3, "type": "VEC3"}
+		],
+		"meshes": [{"primitives": [{"attributes": {"POSITION": 0, "TEXCOORD_0": 1, "NORMAL": 2}}]}]
+	}`, length, uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primitive := model.Meshes[0].Primitives[0]
+	wantUvs := []mgl32.Vec2{{0, 1}, {1, 1}, {0, 0.2}}
+	wantNormals := []mgl32.Vec3{{0, 0, 1}, {0, -1, 0}, {1, 0, 0}}
+	for i := range wantUvs {
+		if !primitive.Uvs[i].ApproxEqual(wantUvs[i]) {
+			t.Errorf("Uv %d is %v, want %v", i, primitive.Uvs[i], wantUvs[i])
+		}
+		if !primitive.Normals[i].ApproxEqual(wantNormals[i]) {
+			t.Errorf("Normal %d is %v, want %v", i, primitive.Normals[i], wantNormals[i])
+		}
+	}
+
+}
+
+func TestReadGltfAccessorBounds(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		view     string
+		accessor string
+	}{
+		{"count past the view", `{"buffer": 0, "byteLength": 36}`,
+			`{"bufferView": 0, "componentType": 5126, "count": 4, "type": "VEC3"}`},
+		{"offset past the view", `{"buffer": 0, "byteLength": 36}`,
+			`{"bufferView": 0, "byteOffset": 40, "componentType": 5126, "count": 1, "type": "VEC3"}`},
+		{"negative offset", `{"buffer": 0, "byteLength": 36}`,
+			`{"bufferView": 0, "byteOffset": -12, "componentType": 5126, "count": 3, "type": "VEC3"}`},
+		{"count that overflows the stride", `{"buffer": 0, "byteLength": 36}`,
+			`{"bufferView": 0, "componentType": 5126, "count": 1537228672809129302, "type": "VEC3"}`},
+		{"huge count", `{"buffer": 0, "byteLength": 36}`,
+			`{"bufferView": 0, "componentType": 5126, "count": 9223372036854775807, "type": "VEC3"}`},
+		{"negative stride", `{"buffer": 0, "byteLength": 36, "byteStride": -12}`,
+			`{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"}`},
+		{"huge accessor without a view", `{"buffer": 0, "byteLength": 36}`,
+			`{"componentType": 5126, "count": 1099511627776, "type": "VEC3"}`},
+		{"huge sparse accessor", `{"buffer": 0, "byteLength": 36}`,
+			`{"componentType": 5126, "count": 1099511627776, "type": "VEC3", "sparse": {
+				"count": 1, "indices": {"bufferView": 0, "componentType": 5125}, "values": {"bufferView": 0}
+			}}`},
+		{"negative sparse count", `{"buffer": 0, "byteLength": 36}`,
+			`{"componentType": 5126, "count": 3, "type": "VEC3", "sparse": {
+				"count": -1, "indices": {"bufferView": 0, "componentType": 5125}, "values": {"bufferView": 0}
+			}}`},
+	}
+
+	uri, length := gltfDataURI(make([]float32, 9))
+
+	for _, test := range tests {
+
+		_, err := readGltfString(fmt.Sprintf(`{
+			"asset": {"version": "2.0"},
+			"buffers": [{"byteLength": %d, "uri": "%s"}],
+			"bufferViews": [%s],
+			"accessors": [%s],
+			"meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}]
+		}`, length, uri, test.view, test.accessor))
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+
+	}
+
+}
+
+func TestReadGltfMaterials(t *testing.T) {
+
+	uri, length := gltfDataURI([]byte("embedded"))
+	document := fmt.Sprintf(`{
+		"asset": {"version": "2.0"},
+		"extensionsRequired": ["KHR_texture_transform"],
+		"buffers": [{"byteLength": %d, "uri": "%s"}],
+		"bufferViews": [{"buffer": 0, "byteLength": %d}],
+		"images": [
+			{"uri": "textures/base%%20color.png"},
+			{"bufferView": 0, "mimeType": "image/png", "name": "packed"},
+			{"uri": "data:image/png;base64,%s"}
+		],
+		"samplers": [{"magFilter": 9728, "minFilter": 9984, "wrapS": 33071, "wrapT": 33648}, {}],
+		"textures": [{"source": 0, "sampler": 0}, {"source": 1, "sampler": 1}, {"source": 2}],
+		"materials": [
+			{
+				"name": "painted",
+				"pbrMetallicRoughness": {
+					"baseColorFactor": [0.5, 0.25, 1, 0.75],
+					"baseColorTexture": {"index": 0, "extensions": {"KHR_texture_transform": {
+						"offset": [0.5, 0], "rotation": 1.5707964, "scale": [2, 2], "texCoord": 1
+					}}},
+					"metallicFactor": 0,
+					"roughnessFactor": 0.5,
+					"metallicRoughnessTexture": {"index": 1, "texCoord": 1}
+				},
+				"normalTexture": {"index": 2, "scale": 0.5},
+				"occlusionTexture": {"index": 1, "strength": 0.25},
+				"emissiveFactor": [1, 0.5, 0],
+				"alphaMode": "MASK",
+				"alphaCutoff": 0.25,
+				"doubleSided": true
+			},
+			{}
+		]
+	}`, length, uri, length, base64.StdEncoding.EncodeToString([]byte("inline")))
+
+	model, err := ReadGltf(strings.NewReader(document), "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.Images) != 3 {
+		t.Fatalf("%d images, want 3", len(model.Images))
+	}
+	if path := model.Images[0].Path; path != filepath.Join("model", "textures", "base color.png") {
+		t.Errorf("Image 0 path %q", path)
+	}
+	if image := model.Images[1]; string(image.Data) != "embedded" || image.MimeType != "image/png" ||
+		image.Name != "packed" {
+		t.Errorf("Image 1 is %+v", image)
+	}
+	if data := model.Images[2].Data; string(data) != "inline" {
+		t.Errorf("Image 2 data %q", data)
+	}
+
+	painted := model.Materials[0]
+	if painted.Name != "painted" || painted.BaseColorFactor != (mgl32.Vec4{0.5, 0.25, 1, 0.75}) ||
+		painted.MetallicFactor != 0 || painted.RoughnessFactor != 0.5 ||
+		painted.EmissiveFactor != (mgl32.Vec3{1, 0.5, 0}) || painted.AlphaMode != "MASK" ||
+		painted.AlphaCutoff != 0.25 || !painted.DoubleSided {
+		t.Errorf("Material factors %+v", painted)
+	}
+
+	base := painted.BaseColorTexture
+	if base.Image != model.Images[0] || base.MagFilter != 9728 || base.MinFilter != 9984 || base.WrapS != 33071 ||
+		base.WrapT != 33648 || base.TexCoord != 1 {
+		t.Errorf("Base color texture %+v", base)
+	}
+
+	// Scaled by 2, turned a quarter counter-clockwise with v pointing down, then moved half along u
+	uv := base.UvTransform.Mul3x1(mgl32.Vec3{1, 0, 1})
+	if want := (mgl32.Vec3{0.5, -2, 1}); !nearVec3(uv, want, 1e-6) {
+		t.Errorf("Texture transform moves (1, 0) to %v, want %v", uv, want)
+	}
+
+	// The sampler without settings and the texture without a sampler both get the defaults
+	for _, ref := range []*GltfTextureRef{painted.MetallicRoughnessTexture, painted.NormalTexture} {
+		if ref.MagFilter != 9729 || ref.MinFilter != 9987 || ref.WrapS != 10497 || ref.WrapT != 10497 ||
+			ref.UvTransform != mgl32.Ident3() {
+			t.Errorf("Default sampler %+v", ref)
+		}
+	}
+	if ref := painted.MetallicRoughnessTexture; ref.Image != model.Images[1] || ref.TexCoord != 1 || ref.Scale != 1 {
+		t.Errorf("Metallic roughness texture %+v", ref)
+	}
+	if ref := painted.NormalTexture; ref.Image != model.Images[2] || ref.Scale != 0.5 {
+		t.Errorf("Normal texture %+v", ref)
+	}
+	if ref := painted.OcclusionTexture; ref.Image != model.Images[1] || ref.Scale != 0.25 {
+		t.Errorf("Occlusion texture %+v", ref)
+	}
+	if painted.EmissiveTexture != nil {
+		t.Errorf("Emissive texture %+v", painted.EmissiveTexture)
+	}
+
+	plain := model.Materials[1]
+	if plain.BaseColorFactor != (mgl32.Vec4{1, 1, 1, 1}) || plain.MetallicFactor != 1 || plain.RoughnessFactor != 1 ||
+		plain.AlphaMode != "OPAQUE" || plain.AlphaCutoff != 0.5 || plain.DoubleSided || plain.BaseColorTexture != nil {
+		t.Errorf("Default material %+v", plain)
+	}
+
+	invalid := []string{
+		`{"materials": [{"normalTexture": {"index": 0}}]}`,
+		`{"textures": [{"source": 0}], "materials": [{"normalTexture": {"index": 0}}]}`,
+		`{"images": [{"uri": "a.png"}], "textures": [{"source": 0, "sampler": 0}],
+			"materials": [{"normalTexture": {"index": 0}}]}`,
+	}
+	for _, document := range invalid {
+		if _, err := readGltfString(`{"asset": {"version": "2.0"}, ` + document[1:]); err == nil {
+			t.Errorf("%s: no error", document)
+		}
+	}
+
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"image"
+	"image/color"
+)
+
+// ImageFromGoImage copies a picture decoded by the image package into an Image, flipping it so the rows run from the
+// bottom up. Grey pictures become L8, opaque ones RGB8 and the rest RGBA8 with the alpha not premultiplied.
+func ImageFromGoImage(picture image.Image) *Image {
+
+	bounds := picture.Bounds()
+	converted := &Image{Width: bounds.Dx(), Height: bounds.Dy(), Format: ImageRGBA8}
+
+	switch {
+	case picture.ColorModel() == color.GrayModel:
+		converted.Format = ImageL8
+	case isOpaque(picture):
+		converted.Format = ImageRGB8
+	}
+
+	channels := converted.Format.BytesPerPixel()
+	converted.Pixels = make([]byte, 0, converted.Width*converted.Height*channels)
+
+	for y := bounds.Max.Y - 1; y >= bounds.Min.Y; y-- {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+
+			pixel := color.NRGBAModel.Convert(picture.At(x, y)).(color.NRGBA)
+			switch converted.Format {
+			case ImageL8:
+				converted.Pixels = append(converted.Pixels, pixel.R)
+			case ImageRGB8:
+				converted.Pixels = append(converted.Pixels, pixel.R, pixel.G, pixel.B)
+			default:
+				converted.Pixels = append(converted.Pixels, pixel.R, pixel.G, pixel.B, pixel.A)
+			}
+
+		}
+	}
+
+	return converted
+
+}
+
+// isOpaque is whether every pixel of the picture has full alpha, asking the picture when it can tell
+func isOpaque(picture image.Image) bool {
+
+	if opaque, ok := picture.(interface {
+		Opaque() bool
+	}); ok {
+		return opaque.Opaque()
+	}
+
+	bounds := picture.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, alpha := picture.At(x, y).RGBA(); alpha != 0xffff {
+				return false
+			}
+		}
+	}
+
+	return true
+
+}
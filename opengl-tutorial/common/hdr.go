@@ -0,0 +1,247 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	// Scanlines outside these widths can't use the per channel run length encoding
+	hdrMinRLEWidth = 8
+	hdrMaxRLEWidth = 0x7fff
+
+	hdrMaxPixels = 1 << 28
+)
+
+var (
+	ErrHdrHeader      = errors.New("Invalid Radiance HDR header")
+	ErrHdrData        = errors.New("Invalid Radiance HDR data")
+	ErrHdrUnsupported = errors.New("Unsupported Radiance HDR")
+)
+
+// LoadHdr decodes a Radiance RGBE picture into an Image without needing a GL context
+func LoadHdr(path string) (*Image, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := LoadHdrFrom(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return image, nil
+
+}
+
+// LoadHdrFrom decodes Radiance pictures in the 32 bit RGBE format, flat, run length encoded or with the old style runs,
+// into RGB32F. The pixel values are kept as the file has them, an EXPOSURE in the header isn't divided out. Rows come
+// back bottom up like every other loader but LoadDDSImage.
+func LoadHdrFrom(reader io.Reader) (*Image, error) {
+
+	buffered := bufio.NewReader(reader)
+
+	magic, err := buffered.ReadString('\n')
+	if err != nil || magic != "#?RADIANCE\n" && magic != "#?RGBE\n" {
+		return nil, fmt.Errorf("%w: not a Radiance HDR file", ErrHdrHeader)
+	}
+
+	// Variables until an empty line, of which only the format matters
+	for {
+
+		line, err := buffered.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: file ends in the header", ErrHdrHeader)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("%w: %s", ErrHdrUnsupported, line)
+		}
+
+	}
+
+	resolution, err := buffered.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: file ends in the resolution", ErrHdrHeader)
+	}
+
+	var yAxis, xAxis string
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "%s %d %s %d", &yAxis, &height, &xAxis, &width); err != nil {
+		return nil, fmt.Errorf("%w: resolution %q", ErrHdrHeader, strings.TrimSpace(resolution))
+	}
+	if yAxis != "-Y" && yAxis != "+Y" || xAxis != "+X" && xAxis != "-X" {
+		return nil, fmt.Errorf("%w: scanlines along %s %s", ErrHdrUnsupported, yAxis, xAxis)
+	}
+	if width <= 0 || height <= 0 || width*height > hdrMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrHdrHeader, width, height)
+	}
+
+	image := &Image{Width: width, Height: height, Format: ImageRGB32F}
+	image.Pixels = make([]byte, width*height*image.Format.BytesPerPixel())
+	scanline := make([]byte, width*4)
+
+	for y := 0; y < height; y++ {
+
+		if err := readHdrScanline(buffered, scanline); err != nil {
+			return nil, fmt.Errorf("%w: scanline %d: %v", ErrHdrData, y, err)
+		}
+
+		// -Y is the usual top down order
+		row := y
+		if yAxis == "-Y" {
+			row = height - 1 - y
+		}
+
+		for x := 0; x < width; x++ {
+
+			column := x
+			if xAxis == "-X" {
+				column = width - 1 - x
+			}
+
+			pixel := scanline[x*4 : x*4+4]
+			target := image.Pixels[(row*width+column)*12:]
+			for c := 0; c < 3; c++ {
+				binary.LittleEndian.PutUint32(target[c*4:], math.Float32bits(rgbeChannel(pixel[c], pixel[3])))
+			}
+
+		}
+
+	}
+
+	return image, nil
+
+}
+
+// rgbeChannel is the value of a mantissa with the shared exponent. Radiance itself adds half a step, which turns dark
+// channels next to bright ones grey, so like most readers this doesn't.
+func rgbeChannel(mantissa byte, exponent byte) float32 {
+
+	if exponent == 0 {
+		return 0
+	}
+
+	return float32(math.Ldexp(float64(mantissa), int(exponent)-136))
+
+}
+
+// readHdrScanline reads one row of RGBE pixels. Rows starting with 2, 2 and their width hold each channel run length
+// encoded in turn, anything else is flat pixels where 1, 1, 1 repeats the pixel before.
+func readHdrScanline(reader *bufio.Reader, scanline []byte) error {
+
+	width := len(scanline) / 4
+
+	start, err := reader.Peek(4)
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+
+	if width < hdrMinRLEWidth || width > hdrMaxRLEWidth || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		return readHdrFlatScanline(reader, scanline)
+	}
+
+	if int(start[2])<<8|int(start[3]) != width {
+		return fmt.Errorf("run length encoded as %d pixels wide", int(start[2])<<8|int(start[3]))
+	}
+	reader.Discard(4)
+
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+
+			count, err := reader.ReadByte()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+
+			if count > 128 {
+
+				// A run of one value
+				count -= 128
+				value, err := reader.ReadByte()
+				if err != nil {
+					return io.ErrUnexpectedEOF
+				}
+				if x+int(count) > width {
+					return fmt.Errorf("run past the end")
+				}
+				for i := 0; i < int(count); i++ {
+					scanline[(x+i)*4+channel] = value
+				}
+				x += int(count)
+
+			} else {
+
+				if count == 0 || x+int(count) > width {
+					return fmt.Errorf("%d values at %d", count, x)
+				}
+				for i := 0; i < int(count); i++ {
+					if scanline[(x+i)*4+channel], err = reader.ReadByte(); err != nil {
+						return io.ErrUnexpectedEOF
+					}
+				}
+				x += int(count)
+
+			}
+
+		}
+	}
+
+	return nil
+
+}
+
+func readHdrFlatScanline(reader *bufio.Reader, scanline []byte) error {
+
+	width := len(scanline) / 4
+
+	// Each old style run straight after another counts 256 times more, so long runs take a few
+	shift := uint(0)
+	for x := 0; x < width; {
+
+		pixel := scanline[x*4 : x*4+4]
+		if _, err := io.ReadFull(reader, pixel); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		if pixel[0] == 1 && pixel[1] == 1 && pixel[2] == 1 {
+
+			if x == 0 {
+				return fmt.Errorf("run before the first pixel")
+			}
+
+			count := int(pixel[3]) << shift
+			if x+count > width {
+				return fmt.Errorf("run past the end")
+			}
+			for i := 0; i < count; i++ {
+				copy(scanline[(x+i)*4:(x+i)*4+4], scanline[(x-1)*4:x*4])
+			}
+			x += count
+			shift += 8
+
+		} else {
+
+			x++
+			shift = 0
+
+		}
+
+	}
+
+	return nil
+
+}
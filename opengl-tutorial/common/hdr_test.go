@@ -0,0 +1,190 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// hdrFile builds a Radiance picture with a header of one variable or none, the resolution and the scanlines
+func hdrFile(variable string, resolution string, scanlines ...[]byte) []byte {
+
+	header := "#?RADIANCE\n"
+	if variable != "" {
+		header += variable + "\n"
+	}
+
+	data := []byte(header + "\n" + resolution + "\n")
+	for _, scanline := range scanlines {
+		data = append(data, scanline...)
+	}
+
+	return data
+
+}
+
+// hdrFloats reads an RGB32F image's pixels back as floats
+func hdrFloats(image *Image) []float32 {
+
+	values := make([]float32, len(image.Pixels)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(image.Pixels[i*4:]))
+	}
+
+	return values
+
+}
+
+func TestLoadHdrFrom(t *testing.T) {
+
+	// Mantissas of 128 with exponent 129 are 1, and halve with each step down. An exponent of 0 is black.
+	white, grey, black := []byte{128, 128, 128, 129}, []byte{64, 32, 16, 129}, []byte{200, 200, 200, 0}
+
+	// 8 pixels of 1 in red, a ramp from 0 to 7/128 in green and 0.5 in blue, with green as raw values and the rest runs
+	ramp := make([]float32, 0, 24)
+	for x := 0; x < 8; x++ {
+		ramp = append(ramp, 1, float32(x)/128, 0.5)
+	}
+	rle := []byte{2, 2, 0, 8, 0x88, 128, 8, 0, 1, 2, 3, 4, 5, 6, 7, 0x84, 64, 0x84, 64, 0x88, 129}
+
+	// A flat pixel then old style runs of 43 and 1 << 8 copies of it, 300 in all
+	oldRuns := bytes.Join([][]byte{grey, {1, 1, 1, 43}, {1, 1, 1, 1}}, nil)
+	manyGrey := make([]float32, 0, 900)
+	for x := 0; x < 300; x++ {
+		manyGrey = append(manyGrey, 0.5, 0.25, 0.125)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+		pixels        []float32
+	}{
+		{
+			// Scanlines run from the top, so come back in the opposite order
+			name:   "top down",
+			data:   hdrFile("FORMAT=32-bit_rle_rgbe", "-Y 2 +X 1", white, grey),
+			width:  1,
+			height: 2,
+			pixels: []float32{0.5, 0.25, 0.125, 1, 1, 1},
+		},
+		{
+			name:   "bottom up",
+			data:   hdrFile("", "+Y 2 +X 1", white, grey),
+			width:  1,
+			height: 2,
+			pixels: []float32{1, 1, 1, 0.5, 0.25, 0.125},
+		},
+		{
+			name:   "right to left",
+			data:   hdrFile("EXPOSURE=2.0", "-Y 1 -X 3", white, grey, black),
+			width:  3,
+			height: 1,
+			pixels: []float32{0, 0, 0, 0.5, 0.25, 0.125, 1, 1, 1},
+		},
+		{
+			name:   "old style runs",
+			data:   hdrFile("", "-Y 1 +X 300", oldRuns),
+			width:  300,
+			height: 1,
+			pixels: manyGrey,
+		},
+		{
+			name:   "run length encoded",
+			data:   hdrFile("FORMAT=32-bit_rle_rgbe", "-Y 1 +X 8", rle),
+			width:  8,
+			height: 1,
+			pixels: ramp,
+		},
+		{
+			// The second scanline is run length encoded as one run per channel
+			name:   "run length encoded rows",
+			data:   hdrFile("", "-Y 2 +X 8", rle, []byte{2, 2, 0, 8, 0x88, 0, 0x88, 0, 0x88, 0, 0x88, 0}),
+			width:  8,
+			height: 2,
+			pixels: append(make([]float32, 24), ramp...),
+		},
+		{
+			// Scanlines narrower than 8 pixels are always flat, even starting 2, 2
+			name:   "narrow scanline starting 2, 2",
+			data:   hdrFile("", "-Y 1 +X 1", []byte{2, 2, 0, 137}),
+			width:  1,
+			height: 1,
+			pixels: []float32{4, 4, 0},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadHdrFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Width != test.width || image.Height != test.height || image.Format != ImageRGB32F {
+			t.Errorf("%s: loaded a %dx%d %v image", test.name, image.Width, image.Height, image.Format)
+			continue
+		}
+
+		if pixels := hdrFloats(image); len(pixels) != len(test.pixels) {
+			t.Errorf("%s: %d values, want %d", test.name, len(pixels), len(test.pixels))
+		} else {
+			for i := range pixels {
+				if pixels[i] != test.pixels[i] {
+					t.Errorf("%s: value %d is %v, want %v", test.name, i, pixels[i], test.pixels[i])
+					break
+				}
+			}
+		}
+
+	}
+
+	// The shorter magic number some writers use
+	data := append([]byte("#?RGBE"), hdrFile("", "-Y 1 +X 1", white)[len("#?RADIANCE"):]...)
+	if _, err := LoadHdrFrom(bytes.NewReader(data)); err != nil {
+		t.Errorf("#?RGBE file: %v", err)
+	}
+
+}
+
+func TestLoadHdrFromInvalid(t *testing.T) {
+
+	pixel := []byte{128, 128, 128, 129}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not a Radiance file", []byte("P6\n1 1\n255\n"), ErrHdrHeader},
+		{"file ends in the header", []byte("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n"), ErrHdrHeader},
+		{"XYZE", hdrFile("FORMAT=32-bit_rle_xyze", "-Y 1 +X 1", pixel), ErrHdrUnsupported},
+		{"file ends in the resolution", []byte("#?RADIANCE\n\n-Y 1 +X 1"), ErrHdrHeader},
+		{"resolution without a width", hdrFile("", "-Y 1 +X", pixel), ErrHdrHeader},
+		{"columns first", hdrFile("", "+X 1 -Y 1", pixel), ErrHdrUnsupported},
+		{"no pixels", hdrFile("", "-Y 0 +X 1"), ErrHdrHeader},
+		{"short scanline", hdrFile("", "-Y 1 +X 2", pixel), ErrHdrData},
+		{"missing scanline", hdrFile("", "-Y 2 +X 1", pixel), ErrHdrData},
+		{"old style run first", hdrFile("", "-Y 1 +X 2", []byte{1, 1, 1, 2}), ErrHdrData},
+		{"old style run past the end", hdrFile("", "-Y 1 +X 2", pixel, []byte{1, 1, 1, 2}), ErrHdrData},
+		{"encoded with the wrong width", hdrFile("", "-Y 1 +X 8", []byte{2, 2, 0, 9}), ErrHdrData},
+		{"run past the end", hdrFile("", "-Y 1 +X 8", []byte{2, 2, 0, 8, 0x89, 0}), ErrHdrData},
+		{"empty raw values", hdrFile("", "-Y 1 +X 8", []byte{2, 2, 0, 8, 0}), ErrHdrData},
+		{"file ends in raw values", hdrFile("", "-Y 1 +X 8", []byte{2, 2, 0, 8, 8, 1, 2}), ErrHdrData},
+		{"file ends in a channel", hdrFile("", "-Y 1 +X 8", []byte{2, 2, 0, 8, 0x88, 0}), ErrHdrData},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadHdrFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	if _, err := LoadHdrFrom(strings.NewReader("")); !errors.Is(err, ErrHdrHeader) {
+		t.Errorf("Empty file: error %v, want %v", err, ErrHdrHeader)
+	}
+
+}
@@ -0,0 +1,322 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// ImageFormat is the layout of an Image's pixels
+type ImageFormat int
+
+const (
+	ImageRGB8 ImageFormat = iota
+	ImageRGBA8
+
+	// S3TC block compressed formats, each 4x4 block of pixels takes 8 bytes in DXT1 and 16 in the others. Direct3D 10
+	// calls them BC1, BC2 and BC3.
+	ImageDXT1
+	ImageDXT3
+	ImageDXT5
+
+	// Single and two channel formats, luminance ones are read back as grey in every colour channel
+	ImageR8
+	ImageRG8
+	ImageL8
+	ImageLA8
+
+	// Floating point formats for high dynamic range pictures
+	ImageRGBA16F
+	ImageRGB32F
+	ImageRGBA32F
+
+	// RGTC compressed single and two channel formats, 8 and 16 bytes per block
+	ImageBC4
+	ImageBC4Signed
+	ImageBC5
+	ImageBC5Signed
+
+	// BPTC compressed formats, 16 bytes per block. BC6H holds half floats and BC7 RGBA.
+	ImageBC6H
+	ImageBC6HSigned
+	ImageBC7
+)
+
+type imageFormatInfo struct {
+	name string
+
+	// Bytes per pixel of uncompressed formats, or per 4x4 block of compressed ones
+	size       int
+	compressed bool
+}
+
+var imageFormats = map[ImageFormat]imageFormatInfo{
+	ImageRGB8:  {"RGB8", 3, false},
+	ImageRGBA8: {"RGBA8", 4, false},
+	ImageDXT1:  {"DXT1", 8, true},
+	ImageDXT3:  {"DXT3", 16, true},
+	ImageDXT5:  {"DXT5", 16, true},
+
+	ImageR8:  {"R8", 1, false},
+	ImageRG8: {"RG8", 2, false},
+	ImageL8:  {"L8", 1, false},
+	ImageLA8: {"LA8", 2, false},
+
+	ImageRGBA16F: {"RGBA16F", 8, false},
+	ImageRGB32F:  {"RGB32F", 12, false},
+	ImageRGBA32F: {"RGBA32F", 16, false},
+
+	ImageBC4:        {"BC4", 8, true},
+	ImageBC4Signed:  {"BC4 signed", 8, true},
+	ImageBC5:        {"BC5", 16, true},
+	ImageBC5Signed:  {"BC5 signed", 16, true},
+	ImageBC6H:       {"BC6H", 16, true},
+	ImageBC6HSigned: {"BC6H signed", 16, true},
+	ImageBC7:        {"BC7", 16, true},
+}
+
+func (format ImageFormat) String() string {
+
+	if info, ok := imageFormats[format]; ok {
+		return info.name
+	}
+
+	return "unknown"
+
+}
+
+// Compressed is whether the format stores 4x4 blocks of pixels rather than single pixels
+func (format ImageFormat) Compressed() bool {
+	return imageFormats[format].compressed
+}
+
+// BytesPerPixel is the size of one pixel in an uncompressed format, and 0 for compressed ones
+func (format ImageFormat) BytesPerPixel() int {
+
+	if format.Compressed() {
+		return 0
+	}
+
+	return imageFormats[format].size
+
+}
+
+// DataSize is how many bytes a picture of the given size takes in the format, compressed formats round the size up to
+// whole blocks
+func (format ImageFormat) DataSize(width int, height int) int {
+
+	info := imageFormats[format]
+	if info.compressed {
+		return ((width + 3) / 4) * ((height + 3) / 4) * info.size
+	}
+
+	return width * height * info.size
+
+}
+
+// Image is a decoded picture held in memory. Rows run from the bottom of the picture up with no padding between them,
+// which is the order gl.TexImage2D expects. DDS and KTX images are the exception, they keep the order of the file, top
+// down for DDS, and are drawn with the V coordinate flipped. Compressed images hold their blocks as they were in the file.
+//
+// Each mipmap level holds every 2D slice of the image one after the other, all the depth slices of a volume, or for
+// each layer of an array the 6 faces of a cubemap in the order +X, -X, +Y, -Y, +Z, -Z, or the one image otherwise.
+type Image struct {
+	Width  int
+	Height int
+	Format ImageFormat
+	Pixels []byte
+
+	// Mipmaps are the levels after the first, each half the size of the one before and at least 1x1
+	Mipmaps [][]byte
+
+	// Depth is the number of slices of a volume texture and 0 for flat ones, it halves at each level like the width
+	Depth int
+
+	// Layers is the number of images in a texture array and 0 when the image isn't an array
+	Layers int
+
+	Cubemap bool
+
+	// SRGB is whether colours are stored sRGB encoded rather than linear
+	SRGB bool
+}
+
+// Levels is the number of mipmap levels including the full size one
+func (image *Image) Levels() int {
+	return 1 + len(image.Mipmaps)
+}
+
+// Level returns the data of a mipmap level and its size, level 0 being the full size image
+func (image *Image) Level(level int) ([]byte, int, int) {
+
+	width, height := mipmapSize(image.Width, level), mipmapSize(image.Height, level)
+	if level == 0 {
+		return image.Pixels, width, height
+	}
+
+	return image.Mipmaps[level-1], width, height
+
+}
+
+// LevelDepth is the number of depth slices at a mipmap level, 1 for images that aren't volumes
+func (image *Image) LevelDepth(level int) int {
+	return mipmapSize(image.Depth, level)
+}
+
+// Slices is the number of 2D images at each mipmap level not counting depth slices, layers times faces
+func (image *Image) Slices() int {
+
+	slices := 1
+	if image.Layers > 0 {
+		slices = image.Layers
+	}
+	if image.Cubemap {
+		slices *= 6
+	}
+
+	return slices
+
+}
+
+// LevelDataSize is how many bytes a mipmap level should hold
+func (image *Image) LevelDataSize(level int) int {
+
+	width, height := mipmapSize(image.Width, level), mipmapSize(image.Height, level)
+	return image.Format.DataSize(width, height) * image.LevelDepth(level) * image.Slices()
+
+}
+
+// FlipVertical reverses the order of the rows of every slice at every level of an uncompressed image, between the
+// bottom up order of OpenGL and the top down order of DDS and most other files
+func (image *Image) FlipVertical() error {
+
+	if image.Format.Compressed() {
+		return fmt.Errorf("Can't flip %v images", image.Format)
+	}
+
+	for level := 0; level < image.Levels(); level++ {
+
+		data, width, height := image.Level(level)
+		if len(data) < image.LevelDataSize(level) {
+			return fmt.Errorf("Image level %d holds %d bytes instead of %d", level, len(data),
+				image.LevelDataSize(level))
+		}
+
+		rowSize := width * image.Format.BytesPerPixel()
+		row := make([]byte, rowSize)
+		for slice := 0; slice < image.Slices()*image.LevelDepth(level); slice++ {
+
+			surface := data[slice*rowSize*height:]
+			for top, bottom := 0, height-1; top < bottom; top, bottom = top+1, bottom-1 {
+				copy(row, surface[top*rowSize:(top+1)*rowSize])
+				copy(surface[top*rowSize:(top+1)*rowSize], surface[bottom*rowSize:(bottom+1)*rowSize])
+				copy(surface[bottom*rowSize:(bottom+1)*rowSize], row)
+			}
+
+		}
+
+	}
+
+	return nil
+
+}
+
+// PSNR is the peak signal to noise ratio in decibels between the full size levels of two images of the same size in the
+// same 8 bit uncompressed format, over every slice and channel. Identical images give +Inf.
+func PSNR(a *Image, b *Image) (float64, error) {
+
+	if a.Format != b.Format || a.Width != b.Width || a.Height != b.Height || a.Slices() != b.Slices() ||
+		a.LevelDepth(0) != b.LevelDepth(0) {
+		return 0, fmt.Errorf("Can't compare a %dx%d %v image with a %dx%d %v one", a.Width, a.Height, a.Format,
+			b.Width, b.Height, b.Format)
+	}
+
+	switch a.Format {
+	case ImageRGB8, ImageRGBA8, ImageR8, ImageRG8, ImageL8, ImageLA8:
+	default:
+		return 0, fmt.Errorf("Can't compare %v images", a.Format)
+	}
+
+	size := a.LevelDataSize(0)
+	if len(a.Pixels) < size || len(b.Pixels) < size {
+		return 0, fmt.Errorf("Images hold %d and %d bytes instead of %d", len(a.Pixels), len(b.Pixels), size)
+	}
+
+	var squaredError float64
+	for i := 0; i < size; i++ {
+		difference := float64(a.Pixels[i]) - float64(b.Pixels[i])
+		squaredError += difference * difference
+	}
+
+	if squaredError == 0 {
+		return math.Inf(1), nil
+	}
+
+	return 10 * math.Log10(255*255/(squaredError/float64(size))), nil
+
+}
+
+func mipmapSize(size int, level int) int {
+
+	size >>= uint(level)
+	if size < 1 {
+		return 1
+	}
+
+	return size
+
+}
+
+// maskChannel scales a field of a packed pixel, such as the 5 bits of red in a 565 pixel, to 8 bits
+type maskChannel struct {
+	mask  uint32
+	shift uint
+	max   uint32
+}
+
+func newMaskChannel(mask uint32) maskChannel {
+
+	if mask == 0 {
+		return maskChannel{}
+	}
+
+	shift := uint(0)
+	for mask>>shift&1 == 0 {
+		shift++
+	}
+
+	return maskChannel{mask: mask, shift: shift, max: mask >> shift}
+
+}
+
+// validMasks reports whether the channel masks of a packed pixel fit in bitCount bits, are each a single run of bits
+// and don't overlap
+func validMasks(masks [4]uint32, bitCount int) bool {
+
+	var used uint32
+	for _, mask := range masks {
+
+		if mask == 0 {
+			continue
+		}
+
+		// Adding the lowest bit of a single run carries through all of it and leaves none of its bits set
+		if bitCount < 32 && mask>>uint(bitCount) != 0 || mask&used != 0 || (mask+mask&-mask)&mask != 0 {
+			return false
+		}
+		used |= mask
+
+	}
+
+	return true
+
+}
+
+func (channel maskChannel) value(pixel uint32) byte {
+
+	if channel.mask == 0 {
+		return 0
+	}
+
+	return byte((uint64(pixel&channel.mask>>channel.shift)*255 + uint64(channel.max)/2) / uint64(channel.max))
+
+}
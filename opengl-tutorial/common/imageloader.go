@@ -0,0 +1,142 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+)
+
+// ImageDecoder decodes one picture format into an Image. Rows should run from the bottom up, unless like DDS the format
+// can only keep the order of the file.
+type ImageDecoder func(reader io.Reader) (*Image, error)
+
+type imageFormatDecoder struct {
+	name   string
+	match  func(header []byte) bool
+	decode ImageDecoder
+}
+
+// How many bytes of a file the formats' match functions are given
+const imageHeaderSize = 32
+
+var ErrImageFormat = errors.New("Unknown image format")
+
+// Decoders by format, tried from the last registered to the first
+var imageDecoders []imageFormatDecoder
+
+func init() {
+
+	// TGA has no magic number and goes first so it's tried last
+	RegisterImageFormat("tga", tgaHeaderValid, LoadTgaFrom)
+	RegisterImageFormat("bmp", MatchMagic("BM"), LoadBmpFrom)
+	RegisterImageFormat("dds", MatchMagic("DDS "), LoadDDSImageFrom)
+	RegisterImageFormat("ktx", MatchMagic(ktxIdentifier), LoadKTXImageFrom)
+	RegisterImageFormat("ktx", MatchMagic(ktx2Identifier), LoadKTXImageFrom)
+	RegisterImageFormat("hdr", MatchMagic("#?RADIANCE\n"), LoadHdrFrom)
+	RegisterImageFormat("hdr", MatchMagic("#?RGBE\n"), LoadHdrFrom)
+	RegisterImageFormat("png", MatchMagic("\x89PNG\r\n\x1a\n"), decodeGoImage(png.Decode))
+	RegisterImageFormat("jpeg", MatchMagic("\xff\xd8"), decodeGoImage(jpeg.Decode))
+	RegisterImageFormat("gif", MatchMagic("GIF8?a"), decodeGoImage(gif.Decode))
+
+}
+
+// RegisterImageFormat makes LoadImage decode files whose first bytes satisfy match with decode. Formats registered
+// later are tried first, so they can take over from the built in ones.
+func RegisterImageFormat(name string, match func(header []byte) bool, decode ImageDecoder) {
+	imageDecoders = append(imageDecoders, imageFormatDecoder{name, match, decode})
+}
+
+// MatchMagic matches files starting with magic, in which '?' stands for any byte
+func MatchMagic(magic string) func(header []byte) bool {
+
+	return func(header []byte) bool {
+
+		if len(header) < len(magic) {
+			return false
+		}
+
+		for i := 0; i < len(magic); i++ {
+			if magic[i] != '?' && magic[i] != header[i] {
+				return false
+			}
+		}
+
+		return true
+
+	}
+
+}
+
+// LoadImage decodes a picture in any registered format into an Image without needing a GL context, and returns the
+// name of its format
+func LoadImage(path string) (*Image, string, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	decoded, format, err := LoadImageFrom(file)
+	if err != nil {
+		return nil, format, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return decoded, format, nil
+
+}
+
+// LoadImageFrom picks the decoder by the first bytes of the picture rather than a file extension. PNG, JPEG and GIF
+// come from the standard library as RGB8, RGBA8 or L8, and BMP, TGA, Radiance HDR, DDS and KTX from the loaders here.
+// Every format but DDS and KTX comes back with its rows bottom up like LoadBmpFrom gives them.
+func LoadImageFrom(reader io.Reader) (*Image, string, error) {
+
+	buffered := bufio.NewReader(reader)
+
+	// Short files have fewer bytes to match against, and the decoders report them
+	header, err := buffered.Peek(imageHeaderSize)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	for i := len(imageDecoders) - 1; i >= 0; i-- {
+
+		decoder := imageDecoders[i]
+		if !decoder.match(header) {
+			continue
+		}
+
+		decoded, err := decoder.decode(buffered)
+		return decoded, decoder.name, err
+
+	}
+
+	if len(header) > 4 {
+		header = header[:4]
+	}
+
+	return nil, "", fmt.Errorf("%w: starts with %q", ErrImageFormat, header)
+
+}
+
+// decodeGoImage wraps a decoder of the image package to flip the picture bottom up with ImageFromGoImage
+func decodeGoImage(decode func(io.Reader) (image.Image, error)) ImageDecoder {
+
+	return func(reader io.Reader) (*Image, error) {
+
+		picture, err := decode(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return ImageFromGoImage(picture), nil
+
+	}
+
+}
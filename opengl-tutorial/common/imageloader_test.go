@@ -0,0 +1,196 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// goImageFile encodes a 1x2 picture, red over blue, with one of the image package's encoders
+func goImageFile(t *testing.T, encode func(io.Writer, image.Image) error) []byte {
+
+	picture := image.NewRGBA(image.Rect(0, 0, 1, 2))
+	picture.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	picture.Set(0, 1, color.RGBA{0, 0, 255, 255})
+
+	var buffer bytes.Buffer
+	if err := encode(&buffer, picture); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+
+}
+
+func TestLoadImageFrom(t *testing.T) {
+
+	var dds bytes.Buffer
+	if err := WriteDDS(&dds, &Image{Width: 1, Height: 2, Format: ImageL8, Pixels: []byte{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		format        string
+		width, height int
+	}{
+		{"png", goImageFile(t, png.Encode), "png", 1, 2},
+		{"jpeg", goImageFile(t, func(writer io.Writer, picture image.Image) error {
+			return jpeg.Encode(writer, picture, nil)
+		}), "jpeg", 1, 2},
+		{"gif", goImageFile(t, func(writer io.Writer, picture image.Image) error {
+			return gif.Encode(writer, picture, nil)
+		}), "gif", 1, 2},
+		{"bmp", bmpFile(1, 2, 24, bmpRGB, nil, make([]byte, 8)), "bmp", 1, 2},
+		{"tga", tgaFile(tgaTrueColour, 1, 2, 24, 0, 0, nil, make([]byte, 6)), "tga", 1, 2},
+		{"dds", dds.Bytes(), "dds", 1, 2},
+		{"ktx", ktx1File(binary.LittleEndian, ktx1RGBA, make([]byte, 16), make([]byte, 4)), "ktx", 2, 2},
+		{"ktx2", ktx2File(ktx2R8, []int{4, 1}, make([]byte, 4), make([]byte, 1)), "ktx", 2, 2},
+		{"hdr", hdrFile("", "-Y 2 +X 1", make([]byte, 8)), "hdr", 1, 2},
+	}
+
+	for _, test := range tests {
+
+		image, format, err := LoadImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if format != test.format || image.Width != test.width || image.Height != test.height {
+			t.Errorf("%s: loaded a %dx%d %s image, want %dx%d %s", test.name, image.Width, image.Height, format,
+				test.width, test.height, test.format)
+		}
+
+	}
+
+	// The image package's pictures are flipped bottom up like every loader's, so the blue row comes first
+	image, _, err := LoadImageFrom(bytes.NewReader(goImageFile(t, png.Encode)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 255, 255, 0, 0}; image.Format != ImageRGB8 || !bytes.Equal(image.Pixels, want) {
+		t.Errorf("PNG loaded as %v %v, want %v %v", image.Format, image.Pixels, ImageRGB8, want)
+	}
+
+}
+
+func TestLoadImageFromInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrImageFormat},
+		{"unknown magic", []byte("PK\x03\x04 not a picture at all"), ErrImageFormat},
+
+		// Files matching a format's magic number get that decoder's errors
+		{"broken bmp", []byte("BM short"), ErrBmpHeader},
+		{"broken dds", []byte("DDS short"), ErrDdsHeader},
+		{"broken hdr", []byte("#?RADIANCE\n"), ErrHdrHeader},
+		{"broken tga", tgaFile(tgaTrueColour, 2, 2, 24, 0, 0, nil, make([]byte, 3)), ErrTgaData},
+	}
+
+	for _, test := range tests {
+		if _, _, err := LoadImageFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
+
+func TestLoadImage(t *testing.T) {
+
+	image, format, err := LoadImage("../07-model-loading/uvmap.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "bmp" || image.Width != 512 || image.Height != 512 {
+		t.Errorf("Loaded a %dx%d %s image", image.Width, image.Height, format)
+	}
+
+	// Errors keep the decoder's sentinel behind the path
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"unknown.bin", []byte("nothing to see here"), ErrImageFormat},
+		{"short.tga", tgaFile(tgaGrey, 4, 4, 8, 0, 0, nil, make([]byte, 15)), ErrTgaData},
+		{"xyze.hdr", hdrFile("FORMAT=32-bit_rle_xyze", "-Y 1 +X 1", make([]byte, 4)), ErrHdrUnsupported},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(path, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := LoadImage(path); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+
+	}
+
+	if _, _, err := LoadImage(filepath.Join(dir, "missing.png")); err == nil {
+		t.Errorf("Loaded a missing file")
+	}
+
+}
+
+func TestRegisterImageFormat(t *testing.T) {
+
+	defer func(decoders []imageFormatDecoder) {
+		imageDecoders = decoders
+	}(imageDecoders)
+
+	decoded := func(width int) ImageDecoder {
+		return func(reader io.Reader) (*Image, error) {
+			return &Image{Width: width, Height: 1, Format: ImageL8, Pixels: make([]byte, width)}, nil
+		}
+	}
+
+	// A new format is found by its own magic number
+	RegisterImageFormat("first", MatchMagic("FMT?1"), decoded(1))
+	image, format, err := LoadImageFrom(bytes.NewReader([]byte("FMTx1 data")))
+	if err != nil || format != "first" || image.Width != 1 {
+		t.Errorf("Loaded %v as %q with error %v, want the first format", image, format, err)
+	}
+
+	// Formats registered later are tried first, over both earlier ones and the built in PNG decoder
+	RegisterImageFormat("second", MatchMagic("FMT"), decoded(2))
+	RegisterImageFormat("png override", MatchMagic("\x89PNG"), decoded(3))
+
+	tests := []struct {
+		data   []byte
+		format string
+		width  int
+	}{
+		{[]byte("FMTx1 data"), "second", 2},
+		{[]byte("FMT other"), "second", 2},
+		{goImageFile(t, png.Encode), "png override", 3},
+		{bmpFile(1, 1, 24, bmpRGB, nil, make([]byte, 4)), "bmp", 1},
+	}
+
+	for _, test := range tests {
+
+		image, format, err := LoadImageFrom(bytes.NewReader(test.data))
+		if err != nil || format != test.format || image.Width != test.width {
+			t.Errorf("%q: loaded as %q with error %v, want %q", test.data[:4], format, err, test.format)
+		}
+
+	}
+
+}
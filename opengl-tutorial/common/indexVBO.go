@@ -1,6 +1,14 @@
 package common
 
-import "github.com/go-gl/mathgl/mgl32"
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var ErrVertexAttribute = errors.New("Invalid vertex attribute")
 
 type PackedVertex struct {
 	position mgl32.Vec3
@@ -8,46 +16,371 @@ type PackedVertex struct {
 	normal   mgl32.Vec3
 }
 
-func IndexVBO(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+// VertexAttribute is one stream of per vertex data such as positions, colors or a uv channel, stored as Size floats
+// per vertex
+type VertexAttribute struct {
+	Size int
+	Data []float32
+
+	// Vertices whose components are all within Epsilon of each other are welded together, 0 only welds identical ones
+	Epsilon float32
+}
+
+func Vec2Attribute(data []mgl32.Vec2, epsilon float32) VertexAttribute {
+
+	attribute := VertexAttribute{Size: 2, Data: make([]float32, 0, len(data)*2), Epsilon: epsilon}
+	for _, v := range data {
+		attribute.Data = append(attribute.Data, v[:]...)
+	}
+
+	return attribute
+
+}
+
+func Vec3Attribute(data []mgl32.Vec3, epsilon float32) VertexAttribute {
+
+	attribute := VertexAttribute{Size: 3, Data: make([]float32, 0, len(data)*3), Epsilon: epsilon}
+	for _, v := range data {
+		attribute.Data = append(attribute.Data, v[:]...)
+	}
+
+	return attribute
+
+}
+
+func Vec4Attribute(data []mgl32.Vec4, epsilon float32) VertexAttribute {
+
+	attribute := VertexAttribute{Size: 4, Data: make([]float32, 0, len(data)*4), Epsilon: epsilon}
+	for _, v := range data {
+		attribute.Data = append(attribute.Data, v[:]...)
+	}
+
+	return attribute
+
+}
+
+// Len is the number of vertices the attribute holds, 0 when it has no valid Size
+func (attribute VertexAttribute) Len() int {
+
+	if attribute.Size <= 0 {
+		return 0
+	}
+
+	return len(attribute.Data) / attribute.Size
+
+}
+
+// Vec2s copies the data of an attribute of Size 2 out as vectors
+func (attribute VertexAttribute) Vec2s() []mgl32.Vec2 {
+
+	data := make([]mgl32.Vec2, attribute.Len())
+	for i := range data {
+		copy(data[i][:], attribute.Data[i*2:])
+	}
+
+	return data
+
+}
+
+// Vec3s copies the data of an attribute of Size 3 out as vectors
+func (attribute VertexAttribute) Vec3s() []mgl32.Vec3 {
+
+	data := make([]mgl32.Vec3, attribute.Len())
+	for i := range data {
+		copy(data[i][:], attribute.Data[i*3:])
+	}
 
-	var indices []uint32
-	var indexedVertices []mgl32.Vec3
-	var indexedUvs []mgl32.Vec2
-	var indexedNormals []mgl32.Vec3
+	return data
 
-	vertexToOutIndex := make(map[PackedVertex]uint32, 0)
+}
+
+// Vec4s copies the data of an attribute of Size 4 out as vectors
+func (attribute VertexAttribute) Vec4s() []mgl32.Vec4 {
+
+	data := make([]mgl32.Vec4, attribute.Len())
+	for i := range data {
+		copy(data[i][:], attribute.Data[i*4:])
+	}
+
+	return data
+
+}
+
+type IndexedMesh struct {
+	Indices    []uint32
+	Attributes []VertexAttribute
+}
+
+func (mesh *IndexedMesh) VertexCount() int {
+
+	if len(mesh.Attributes) == 0 {
+		return 0
+	}
+
+	return mesh.Attributes[0].Len()
+
+}
+
+// ShortIndices returns the indices as uint16 for a gl.UNSIGNED_SHORT element buffer, or nil if there are too many
+// vertices to address with them
+func (mesh *IndexedMesh) ShortIndices() []uint16 {
+
+	if mesh.VertexCount() > math.MaxUint16+1 {
+		return nil
+	}
+
+	indices := make([]uint16, len(mesh.Indices))
+	for i, index := range mesh.Indices {
+		indices[i] = uint16(index)
+	}
+
+	return indices
+
+}
+
+// IndexAttributes welds the vertices of a triangle list described by parallel attributes into an indexed mesh. Vertices
+// are looked up in a spatial hash of the first attribute, normally the position, so the cost stays linear with the
+// size of the mesh. Each vertex is welded to the first earlier vertex whose attributes are all within their Epsilon.
+// Every attribute needs a positive Size, an Epsilon that isn't negative and the same number of vertices.
+func IndexAttributes(attributes ...VertexAttribute) (*IndexedMesh, error) {
 
-	for i := 0; i < len(vertices); i++ {
+	mesh := &IndexedMesh{
+		Attributes: make([]VertexAttribute, len(attributes)),
+	}
+
+	if len(attributes) == 0 {
+		return mesh, nil
+	}
 
-		packed := &PackedVertex{
-			position: vertices[i],
-			uv:       uvs[i],
-			normal:   normals[i],
+	vertexCount := attributes[0].Len()
+	for i, attribute := range attributes {
+		if attribute.Size <= 0 || len(attribute.Data)%attribute.Size != 0 || attribute.Len() != vertexCount {
+			return nil, fmt.Errorf("%w: attribute %d has %d values of size %d for %d vertices", ErrVertexAttribute, i,
+				len(attribute.Data), attribute.Size, vertexCount)
 		}
+		if !(attribute.Epsilon >= 0) {
+			return nil, fmt.Errorf("%w: attribute %d has epsilon %v", ErrVertexAttribute, i, attribute.Epsilon)
+		}
+	}
 
-		if index, ok := vertexToOutIndex[*packed]; ok {
+	mesh.Indices = make([]uint32, vertexCount)
 
-			indices = append(indices, index)
+	for i, attribute := range attributes {
+		mesh.Attributes[i] = VertexAttribute{
+			Size:    attribute.Size,
+			Data:    make([]float32, 0, len(attribute.Data)),
+			Epsilon: attribute.Epsilon,
+		}
+	}
+
+	grid := newWeldGrid(attributes[0].Size, attributes[0].Epsilon, vertexCount)
 
-		} else {
+	for i := 0; i < vertexCount; i++ {
 
-			indexedVertices = append(indexedVertices, vertices[i])
-			indexedUvs = append(indexedUvs, uvs[i])
-			indexedNormals = append(indexedNormals, normals[i])
+		key := attributes[0].Data[i*attributes[0].Size : (i+1)*attributes[0].Size]
 
-			var newIndex uint32
-			if len(indices) > 0 {
-				newIndex = uint32(len(indexedVertices) - 1)
-			} else {
-				newIndex = 0
+		match := -1
+		grid.visitNeighbours(key, func(candidate int) bool {
+			if weldable(attributes, i, mesh.Attributes, candidate) {
+				match = candidate
+				return false
 			}
-			indices = append(indices, newIndex)
-			vertexToOutIndex[*packed] = newIndex
+			return true
+		})
+
+		if match < 0 {
+
+			match = mesh.VertexCount()
+			for a, attribute := range attributes {
+				mesh.Attributes[a].Data = append(mesh.Attributes[a].Data,
+					attribute.Data[i*attribute.Size:(i+1)*attribute.Size]...)
+			}
+			grid.insert(key, match)
 
 		}
 
+		mesh.Indices[i] = uint32(match)
+
+	}
+
+	return mesh, nil
+
+}
+
+// weldable reports whether vertex i of in is within epsilon of vertex j of out for every attribute
+func weldable(in []VertexAttribute, i int, out []VertexAttribute, j int) bool {
+
+	for a, attribute := range in {
+
+		size := attribute.Size
+		for c := 0; c < size; c++ {
+
+			delta := attribute.Data[i*size+c] - out[a].Data[j*size+c]
+			if delta > attribute.Epsilon || delta < -attribute.Epsilon {
+				return false
+			}
+
+		}
+
+	}
+
+	return true
+
+}
+
+// weldGrid is a spatial hash of vertices. Cells are larger than the welding distance so a vertex only has to look in
+// the neighbouring cells it's within epsilon of, with an epsilon of 0 every distinct value gets its own cell.
+type weldGrid struct {
+	cellSize float32
+
+	// Hash table of singly linked lists of vertices, lists store index+1 so 0 ends them. Cells that hash to the
+	// same slot share a list, the candidates are compared anyway.
+	heads []uint32
+	next  []uint32
+	mask  uint64
+
+	low, high, cell []int64
+}
+
+func newWeldGrid(size int, epsilon float32, capacity int) *weldGrid {
+
+	// Keep the table at most half full
+	slots := 16
+	for slots < capacity*2 {
+		slots *= 2
+	}
+
+	return &weldGrid{
+		cellSize: epsilon * 4,
+		heads:    make([]uint32, slots),
+		next:     make([]uint32, 0, capacity),
+		mask:     uint64(slots - 1),
+		low:      make([]int64, size),
+		high:     make([]int64, size),
+		cell:     make([]int64, size),
+	}
+
+}
+
+func (grid *weldGrid) cellOf(value float32) int64 {
+
+	if grid.cellSize == 0 {
+		// Treat -0 and 0 as the same value
+		if value == 0 {
+			return 0
+		}
+		return int64(math.Float32bits(value))
+	}
+
+	return int64(math.Floor(float64(value / grid.cellSize)))
+
+}
+
+func (grid *weldGrid) hash(cell []int64) uint64 {
+
+	hash := uint64(14695981039346656037)
+	for _, c := range cell {
+		hash ^= uint64(c)
+		hash *= 1099511628211
+		hash ^= hash >> 29
+	}
+
+	return hash ^ hash>>32
+
+}
+
+func (grid *weldGrid) insert(key []float32, vertex int) {
+
+	for c, value := range key {
+		grid.cell[c] = grid.cellOf(value)
+	}
+
+	slot := grid.hash(grid.cell) & grid.mask
+	grid.next = append(grid.next, grid.heads[slot])
+	grid.heads[slot] = uint32(vertex + 1)
+
+}
+
+// visitNeighbours calls visit with every vertex in a cell within epsilon of key until it returns false
+func (grid *weldGrid) visitNeighbours(key []float32, visit func(vertex int) bool) {
+
+	epsilon := grid.cellSize / 4
+	for c, value := range key {
+		grid.low[c] = grid.cellOf(value - epsilon)
+		grid.high[c] = grid.cellOf(value + epsilon)
+		grid.cell[c] = grid.low[c]
+	}
+
+	for {
+
+		for head := grid.heads[grid.hash(grid.cell)&grid.mask]; head != 0; head = grid.next[head-1] {
+			if !visit(int(head - 1)) {
+				return
+			}
+		}
+
+		// Step to the next cell in the range, odometer style
+		c := 0
+		for ; c < len(grid.cell); c++ {
+			if grid.cell[c] < grid.high[c] {
+				grid.cell[c]++
+				break
+			}
+			grid.cell[c] = grid.low[c]
+		}
+
+		if c == len(grid.cell) {
+			return
+		}
+
+	}
+
+}
+
+// IndexVBO welds identical vertices of a triangle list into an indexed mesh. It panics when the slices differ in
+// length, IndexVBOEpsilon returns an error instead.
+func IndexVBO(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	indices, indexedVertices, indexedUvs, indexedNormals, err := IndexVBOEpsilon(vertices, uvs, normals, 0)
+	if err != nil {
+		panic(err)
 	}
 
 	return indices, indexedVertices, indexedUvs, indexedNormals
 
 }
+
+// IndexVBOEpsilon is IndexVBO welding vertices whose attributes differ by no more than epsilon, which can't be
+// negative
+func IndexVBOEpsilon(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3, epsilon float32) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	mesh, err := IndexAttributes(
+		Vec3Attribute(vertices, epsilon),
+		Vec2Attribute(uvs, epsilon),
+		Vec3Attribute(normals, epsilon))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return mesh.Indices, mesh.Attributes[0].Vec3s(), mesh.Attributes[1].Vec2s(), mesh.Attributes[2].Vec3s(), nil
+
+}
+
+// IndexVBOTBN is IndexVBO for meshes with the tangents and bitangents from ComputeTangentBasis
+func IndexVBOTBN(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3, tangents []mgl32.Vec3,
+	bitangents []mgl32.Vec3) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, []mgl32.Vec3, []mgl32.Vec3, error) {
+
+	mesh, err := IndexAttributes(
+		Vec3Attribute(vertices, 0),
+		Vec2Attribute(uvs, 0),
+		Vec3Attribute(normals, 0),
+		Vec3Attribute(tangents, 0),
+		Vec3Attribute(bitangents, 0))
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+
+	return mesh.Indices, mesh.Attributes[0].Vec3s(), mesh.Attributes[1].Vec2s(), mesh.Attributes[2].Vec3s(),
+		mesh.Attributes[3].Vec3s(), mesh.Attributes[4].Vec3s(), nil
+
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// gridTriangles is a triangle list of a square grid in the XY plane with at least count triangles, as LoadObj would
+// return it. Each copy of a shared vertex is moved by up to noise in every component.
+func gridTriangles(count int, noise float32) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	side := int(math.Ceil(math.Sqrt(float64(count) / 2)))
+	random := rand.New(rand.NewSource(1))
+	jitter := func() float32 {
+		return (random.Float32()*2 - 1) * noise
+	}
+
+	var vertices []mgl32.Vec3
+	var uvs []mgl32.Vec2
+	var normals []mgl32.Vec3
+
+	corner := func(x int, y int) {
+		vertices = append(vertices, mgl32.Vec3{float32(x) + jitter(), float32(y) + jitter(), jitter()})
+		uvs = append(uvs, mgl32.Vec2{float32(x)/float32(side) + jitter(), float32(y)/float32(side) + jitter()})
+		normals = append(normals, mgl32.Vec3{jitter(), jitter(), 1 + jitter()})
+	}
+
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			corner(x, y)
+			corner(x+1, y)
+			corner(x+1, y+1)
+			corner(x, y)
+			corner(x+1, y+1)
+			corner(x, y+1)
+		}
+	}
+
+	return vertices, uvs, normals
+
+}
+
+func TestIndexVBOEpsilon(t *testing.T) {
+
+	vertices, uvs, normals := gridTriangles(200, 1e-4)
+	side := int(math.Sqrt(float64(len(vertices) / 6)))
+
+	// Without welding only the exact duplicates within a triangle list could merge, and the noise leaves none
+	indices, indexedVertices, _, _ := IndexVBO(vertices, uvs, normals)
+	if len(indices) != len(vertices) || len(indexedVertices) != len(vertices) {
+		t.Errorf("IndexVBO kept %d of %d noisy vertices", len(indexedVertices), len(vertices))
+	}
+
+	indices, indexedVertices, indexedUvs, indexedNormals, err := IndexVBOEpsilon(vertices, uvs, normals, 1e-3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexedVertices) != (side+1)*(side+1) {
+		t.Errorf("IndexVBOEpsilon kept %d vertices, want %d", len(indexedVertices), (side+1)*(side+1))
+	}
+	if len(indexedUvs) != len(indexedVertices) || len(indexedNormals) != len(indexedVertices) {
+		t.Errorf("%d vertices with %d uvs and %d normals", len(indexedVertices), len(indexedUvs), len(indexedNormals))
+	}
+
+	for i, index := range indices {
+		if delta := vertices[i].Sub(indexedVertices[index]); math.Abs(float64(delta.X())) > 1e-3 ||
+			math.Abs(float64(delta.Y())) > 1e-3 || math.Abs(float64(delta.Z())) > 1e-3 {
+			t.Fatalf("Vertex %d %v welded to %v", i, vertices[i], indexedVertices[index])
+		}
+	}
+
+	// Vertices further apart than epsilon in any attribute stay apart
+	uvs[1] = uvs[1].Add(mgl32.Vec2{0.01, 0})
+	_, indexedVertices, _, _, err = IndexVBOEpsilon(vertices, uvs, normals, 1e-3)
+	if err != nil || len(indexedVertices) != (side+1)*(side+1)+1 {
+		t.Errorf("IndexVBOEpsilon kept %d vertices with one uv moved, want %d: %v", len(indexedVertices),
+			(side+1)*(side+1)+1, err)
+	}
+
+	if _, _, _, _, err := IndexVBOEpsilon(vertices, uvs[1:], normals, 1e-3); !errors.Is(err, ErrVertexAttribute) {
+		t.Errorf("Missing uv gave error %v", err)
+	}
+	if _, _, _, _, err := IndexVBOEpsilon(vertices, uvs, normals, -1e-3); !errors.Is(err, ErrVertexAttribute) {
+		t.Errorf("Negative epsilon gave error %v", err)
+	}
+
+}
+
+func TestShortIndices(t *testing.T) {
+
+	// A grid of 256x256 squares has 257x257 vertices, past what uint16 can address
+	vertices, uvs, normals := gridTriangles(256*256*2, 0)
+	mesh, err := IndexAttributes(Vec3Attribute(vertices, 0), Vec2Attribute(uvs, 0), Vec3Attribute(normals, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mesh.VertexCount() <= math.MaxUint16+1 {
+		t.Fatalf("%d vertices aren't enough to test", mesh.VertexCount())
+	}
+	if indices := mesh.ShortIndices(); indices != nil {
+		t.Errorf("ShortIndices gave %d indices for %d vertices", len(indices), mesh.VertexCount())
+	}
+
+	vertices, uvs, normals = gridTriangles(128*128*2, 0)
+	mesh, err = IndexAttributes(Vec3Attribute(vertices, 0), Vec2Attribute(uvs, 0), Vec3Attribute(normals, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indices := mesh.ShortIndices()
+	if len(indices) != len(mesh.Indices) {
+		t.Fatalf("ShortIndices gave %d indices for %d vertices, want %d", len(indices), mesh.VertexCount(),
+			len(mesh.Indices))
+	}
+	for i, index := range indices {
+		if uint32(index) != mesh.Indices[i] {
+			t.Fatalf("Short index %d is %d, want %d", i, index, mesh.Indices[i])
+		}
+	}
+
+}
+
+func TestIndexAttributesInvalid(t *testing.T) {
+
+	positions := Vec3Attribute([]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}, 0)
+
+	tests := []struct {
+		name      string
+		attribute VertexAttribute
+	}{
+		{"zero size", VertexAttribute{Data: []float32{0, 0, 0}}},
+		{"negative size", VertexAttribute{Size: -1, Data: []float32{0, 0, 0}}},
+		{"partial vertex", VertexAttribute{Size: 2, Data: []float32{0, 0, 0, 0, 0, 0, 0}}},
+		{"fewer vertices", VertexAttribute{Size: 2, Data: []float32{0, 0, 0, 0}}},
+		{"negative epsilon", VertexAttribute{Size: 1, Data: []float32{0, 0, 0}, Epsilon: -1}},
+		{"NaN epsilon", VertexAttribute{Size: 1, Data: []float32{0, 0, 0}, Epsilon: float32(math.NaN())}},
+	}
+
+	for _, test := range tests {
+
+		if _, err := IndexAttributes(positions, test.attribute); !errors.Is(err, ErrVertexAttribute) {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if _, err := IndexAttributes(test.attribute); (test.attribute.Size <= 0 || !(test.attribute.Epsilon >= 0)) &&
+			!errors.Is(err, ErrVertexAttribute) {
+			t.Errorf("%s first: error %v", test.name, err)
+		}
+
+	}
+
+}
+
+func BenchmarkIndexVBO(b *testing.B) {
+
+	for _, count := range []int{10000, 100000, 1000000} {
+
+		vertices, uvs, normals := gridTriangles(count, 1e-5)
+
+		b.Run(fmt.Sprintf("%dk", count/1000), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				IndexVBOEpsilon(vertices, uvs, normals, 1e-4)
+			}
+		})
+
+	}
+
+}
@@ -0,0 +1,500 @@
+package common
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	ktxIdentifier  = "\xabKTX 11\xbb\r\n\x1a\n"
+	ktx2Identifier = "\xabKTX 20\xbb\r\n\x1a\n"
+
+	ktxHeaderSize  = 64
+	ktx2HeaderSize = 80
+
+	ktxEndianness = 0x04030201
+
+	// Like DDS, larger than any GPU takes and small enough that sizes from a corrupt header can't overflow
+	ktxMaxSize   = 1 << 16
+	ktxMaxLayers = 1 << 11
+)
+
+// Supercompression schemes of a KTX2 file. Zstandard and zlib are decoded, BasisLZ and vendor schemes aren't
+// supported.
+const (
+	KTX2SupercompressionNone    = 0
+	KTX2SupercompressionBasisLZ = 1
+	KTX2SupercompressionZstd    = 2
+	KTX2SupercompressionZlib    = 3
+)
+
+// Schemes from here up to the vendor ones are reserved
+const (
+	ktx2SupercompressionReserved = 4
+	ktx2SupercompressionVendor   = 0x10000
+)
+
+var (
+	ErrKtxHeader      = errors.New("Invalid KTX header")
+	ErrKtxData        = errors.New("Invalid KTX data")
+	ErrKtxUnsupported = errors.New("Unsupported KTX")
+)
+
+// ktxLayout is the ImageFormat a KTX format is read as. Uncompressed KTX 1 formats also give the glFormat and glType
+// the file has to use with them, and BGR orders are swapped to RGB while loading.
+type ktxLayout struct {
+	format ImageFormat
+	srgb   bool
+	bgr    bool
+
+	glFormat uint32
+	glType   uint32
+}
+
+// OpenGL enums of KTX 1 headers
+const (
+	ktxGLUnsignedByte   = 0x1401
+	ktxGLFloat          = 0x1406
+	ktxGLHalfFloat      = 0x140b
+	ktxGLRed            = 0x1903
+	ktxGLRGB            = 0x1907
+	ktxGLRGBA           = 0x1908
+	ktxGLLuminance      = 0x1909
+	ktxGLLuminanceAlpha = 0x190a
+	ktxGLBGR            = 0x80e0
+	ktxGLBGRA           = 0x80e1
+	ktxGLRG             = 0x8227
+)
+
+// Formats of a KTX 1 glInternalFormat, unsized ones only with unsigned bytes
+var ktxInternalFormats = map[uint32]ktxLayout{
+	0x8051: {format: ImageRGB8, glFormat: ktxGLRGB, glType: ktxGLUnsignedByte},
+	0x8c41: {format: ImageRGB8, srgb: true, glFormat: ktxGLRGB, glType: ktxGLUnsignedByte},
+	0x8058: {format: ImageRGBA8, glFormat: ktxGLRGBA, glType: ktxGLUnsignedByte},
+	0x8c43: {format: ImageRGBA8, srgb: true, glFormat: ktxGLRGBA, glType: ktxGLUnsignedByte},
+	0x8229: {format: ImageR8, glFormat: ktxGLRed, glType: ktxGLUnsignedByte},
+	0x822b: {format: ImageRG8, glFormat: ktxGLRG, glType: ktxGLUnsignedByte},
+	0x8040: {format: ImageL8, glFormat: ktxGLLuminance, glType: ktxGLUnsignedByte},
+	0x8045: {format: ImageLA8, glFormat: ktxGLLuminanceAlpha, glType: ktxGLUnsignedByte},
+	0x881a: {format: ImageRGBA16F, glFormat: ktxGLRGBA, glType: ktxGLHalfFloat},
+	0x8815: {format: ImageRGB32F, glFormat: ktxGLRGB, glType: ktxGLFloat},
+	0x8814: {format: ImageRGBA32F, glFormat: ktxGLRGBA, glType: ktxGLFloat},
+
+	ktxGLRed:            {format: ImageR8, glFormat: ktxGLRed, glType: ktxGLUnsignedByte},
+	ktxGLRG:             {format: ImageRG8, glFormat: ktxGLRG, glType: ktxGLUnsignedByte},
+	ktxGLRGB:            {format: ImageRGB8, glFormat: ktxGLRGB, glType: ktxGLUnsignedByte},
+	ktxGLRGBA:           {format: ImageRGBA8, glFormat: ktxGLRGBA, glType: ktxGLUnsignedByte},
+	ktxGLLuminance:      {format: ImageL8, glFormat: ktxGLLuminance, glType: ktxGLUnsignedByte},
+	ktxGLLuminanceAlpha: {format: ImageLA8, glFormat: ktxGLLuminanceAlpha, glType: ktxGLUnsignedByte},
+
+	0x83f0: {format: ImageDXT1},
+	0x83f1: {format: ImageDXT1},
+	0x83f2: {format: ImageDXT3},
+	0x83f3: {format: ImageDXT5},
+	0x8c4c: {format: ImageDXT1, srgb: true},
+	0x8c4d: {format: ImageDXT1, srgb: true},
+	0x8c4e: {format: ImageDXT3, srgb: true},
+	0x8c4f: {format: ImageDXT5, srgb: true},
+	0x8dbb: {format: ImageBC4},
+	0x8dbc: {format: ImageBC4Signed},
+	0x8dbd: {format: ImageBC5},
+	0x8dbe: {format: ImageBC5Signed},
+	0x8e8c: {format: ImageBC7},
+	0x8e8d: {format: ImageBC7, srgb: true},
+	0x8e8e: {format: ImageBC6HSigned},
+	0x8e8f: {format: ImageBC6H},
+}
+
+// Formats of a KTX2 vkFormat
+var ktx2VkFormats = map[uint32]ktxLayout{
+	9:   {format: ImageR8},
+	16:  {format: ImageRG8},
+	23:  {format: ImageRGB8},
+	29:  {format: ImageRGB8, srgb: true},
+	30:  {format: ImageRGB8, bgr: true},
+	36:  {format: ImageRGB8, srgb: true, bgr: true},
+	37:  {format: ImageRGBA8},
+	43:  {format: ImageRGBA8, srgb: true},
+	44:  {format: ImageRGBA8, bgr: true},
+	50:  {format: ImageRGBA8, srgb: true, bgr: true},
+	97:  {format: ImageRGBA16F},
+	106: {format: ImageRGB32F},
+	109: {format: ImageRGBA32F},
+	131: {format: ImageDXT1},
+	132: {format: ImageDXT1, srgb: true},
+	133: {format: ImageDXT1},
+	134: {format: ImageDXT1, srgb: true},
+	135: {format: ImageDXT3},
+	136: {format: ImageDXT3, srgb: true},
+	137: {format: ImageDXT5},
+	138: {format: ImageDXT5, srgb: true},
+	139: {format: ImageBC4},
+	140: {format: ImageBC4Signed},
+	141: {format: ImageBC5},
+	142: {format: ImageBC5Signed},
+	143: {format: ImageBC6H},
+	144: {format: ImageBC6HSigned},
+	145: {format: ImageBC7},
+	146: {format: ImageBC7, srgb: true},
+}
+
+// LoadKTXImage reads a Khronos KTX 1 or KTX2 texture into an Image without needing a GL context
+func LoadKTXImage(path string) (*Image, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := LoadKTXImageFrom(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return image, nil
+
+}
+
+// LoadKTXImageFrom reads KTX 1.1 and KTX2 files with their mipmaps, as 2D textures, cubemaps, volumes or arrays of 2D
+// textures and cubemaps. Like DDS the rows are kept in the order of the file, which for KTX2 and most KTX 1 writers is
+// from the top of the picture down. Files without mipmap levels of their own get them generated by UploadImage.
+func LoadKTXImageFrom(reader io.Reader) (*Image, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte(ktxIdentifier)):
+		return loadKTX1(data)
+	case bytes.HasPrefix(data, []byte(ktx2Identifier)):
+		return loadKTX2(data)
+	}
+
+	return nil, fmt.Errorf("%w: not a KTX file", ErrKtxHeader)
+
+}
+
+func loadKTX1(data []byte) (*Image, error) {
+
+	if len(data) < ktxHeaderSize {
+		return nil, fmt.Errorf("%w: file is only %d bytes", ErrKtxHeader, len(data))
+	}
+
+	// Files are written in the byte order of the machine that made them
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(data[12:]) {
+	case ktxEndianness:
+		order = binary.LittleEndian
+	case 0x01020304:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%w: endianness %#x", ErrKtxHeader, binary.LittleEndian.Uint32(data[12:]))
+	}
+
+	var fields [13]uint32
+	for i := range fields {
+		fields[i] = order.Uint32(data[12+i*4:])
+	}
+	glType, glTypeSize, glFormat, glInternalFormat := fields[1], fields[2], fields[3], fields[4]
+	width, height, depth := fields[6], fields[7], fields[8]
+	arrayElements, faces, levels, keyValueBytes := fields[9], fields[10], fields[11], fields[12]
+
+	layout, ok := ktxInternalFormats[glInternalFormat]
+	if !ok {
+		return nil, fmt.Errorf("%w: glInternalFormat %#x", ErrKtxUnsupported, glInternalFormat)
+	}
+
+	if layout.format.Compressed() {
+		if glType != 0 || glFormat != 0 || glTypeSize != 1 {
+			return nil, fmt.Errorf("%w: compressed format with glType %#x, glFormat %#x and glTypeSize %d",
+				ErrKtxHeader, glType, glFormat, glTypeSize)
+		}
+	} else {
+
+		switch {
+		case glFormat == ktxGLBGR && layout.glFormat == ktxGLRGB, glFormat == ktxGLBGRA && layout.glFormat == ktxGLRGBA:
+			layout.bgr = true
+		case glFormat != layout.glFormat:
+			return nil, fmt.Errorf("%w: glFormat %#x for glInternalFormat %#x", ErrKtxHeader, glFormat,
+				glInternalFormat)
+		}
+
+		typeSize := uint32(1)
+		switch layout.glType {
+		case ktxGLHalfFloat:
+			typeSize = 2
+		case ktxGLFloat:
+			typeSize = 4
+		}
+		if glType != layout.glType || glTypeSize != typeSize {
+			return nil, fmt.Errorf("%w: glType %#x of %d bytes for glInternalFormat %#x", ErrKtxUnsupported, glType,
+				glTypeSize, glInternalFormat)
+		}
+
+	}
+
+	image, err := newKTXImage(layout, width, height, depth, arrayElements, faces, levels)
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(keyValueBytes) > uint64(len(data)-ktxHeaderSize) {
+		return nil, fmt.Errorf("%w: %d bytes of key and value data", ErrKtxHeader, keyValueBytes)
+	}
+	offset := ktxHeaderSize + int(keyValueBytes)
+
+	// Uncompressed rows are padded to 4 bytes, like the default GL_UNPACK_ALIGNMENT
+	levelData := make([][]byte, image.Levels())
+	for level := range levelData {
+
+		if offset+4 > len(data) {
+			return nil, fmt.Errorf("%w: file ends before mipmap level %d", ErrKtxData, level)
+		}
+		imageSize := int(order.Uint32(data[offset:]))
+		offset += 4
+
+		_, width, height := image.Level(level)
+		rowSize, rows := image.Format.DataSize(width, 1), height
+		if image.Format.Compressed() {
+			rowSize, rows = image.Format.DataSize(width, height), 1
+		}
+		paddedRowSize := (rowSize + 3) &^ 3
+		sliceCount := image.Slices() * image.LevelDepth(level)
+
+		// The size of non array cubemaps is of each face rather than the whole level
+		expected := paddedRowSize * rows * sliceCount
+		if image.Cubemap && image.Layers == 0 {
+			expected /= 6
+			if imageSize < expected || offset+imageSize*6 > len(data) {
+				return nil, fmt.Errorf("%w: mipmap level %d faces of %d bytes, %d needed in %d left", ErrKtxData,
+					level, imageSize, expected, len(data)-offset)
+			}
+			imageSize *= 6
+		} else if imageSize < expected || offset+imageSize > len(data) {
+			return nil, fmt.Errorf("%w: mipmap level %d of %d bytes, %d needed in %d left", ErrKtxData, level,
+				imageSize, expected, len(data)-offset)
+		}
+
+		levelData[level] = make([]byte, 0, image.LevelDataSize(level))
+		for row := 0; row < rows*sliceCount; row++ {
+			start := offset + row*paddedRowSize
+			levelData[level] = append(levelData[level], data[start:start+rowSize]...)
+		}
+
+		offset += (imageSize + 3) &^ 3
+
+	}
+
+	for _, level := range levelData {
+		if order == binary.BigEndian && glTypeSize > 1 {
+			swapKTXBytes(level, int(glTypeSize))
+		}
+		if layout.bgr {
+			swapRedBlue(level, image.Format.BytesPerPixel())
+		}
+	}
+
+	image.Pixels = levelData[0]
+	image.Mipmaps = levelData[1:]
+
+	return image, nil
+
+}
+
+func loadKTX2(data []byte) (*Image, error) {
+
+	if len(data) < ktx2HeaderSize {
+		return nil, fmt.Errorf("%w: file is only %d bytes", ErrKtxHeader, len(data))
+	}
+
+	var fields [9]uint32
+	for i := range fields {
+		fields[i] = binary.LittleEndian.Uint32(data[12+i*4:])
+	}
+	vkFormat, typeSize, width, height, depth := fields[0], fields[1], fields[2], fields[3], fields[4]
+	layers, faces, levels, scheme := fields[5], fields[6], fields[7], fields[8]
+
+	layout, ok := ktx2VkFormats[vkFormat]
+	if !ok {
+		if vkFormat == 0 {
+			return nil, fmt.Errorf("%w: Basis Universal texture", ErrKtxUnsupported)
+		}
+		return nil, fmt.Errorf("%w: vkFormat %d", ErrKtxUnsupported, vkFormat)
+	}
+
+	// Block compressed formats have a type size of 1, the rest the size of one channel
+	expectedTypeSize := uint32(1)
+	switch layout.format {
+	case ImageRGBA16F:
+		expectedTypeSize = 2
+	case ImageRGB32F, ImageRGBA32F:
+		expectedTypeSize = 4
+	}
+	if typeSize != expectedTypeSize {
+		return nil, fmt.Errorf("%w: typeSize %d for vkFormat %d", ErrKtxHeader, typeSize, vkFormat)
+	}
+
+	// decompress expands one supercompressed mipmap level into the size bytes it holds uncompressed
+	var decompress func(data []byte, size int) ([]byte, error)
+	switch {
+	case scheme == KTX2SupercompressionNone:
+	case scheme == KTX2SupercompressionZstd:
+		decompress = DecompressZstd
+	case scheme == KTX2SupercompressionZlib:
+		decompress = inflateKTX2Level
+	case scheme == KTX2SupercompressionBasisLZ:
+		return nil, fmt.Errorf("%w: BasisLZ supercompression", ErrKtxUnsupported)
+	case scheme >= ktx2SupercompressionReserved && scheme < ktx2SupercompressionVendor:
+		return nil, fmt.Errorf("%w: supercompression scheme %d", ErrKtxHeader, scheme)
+	default:
+		return nil, fmt.Errorf("%w: vendor supercompression scheme %d", ErrKtxUnsupported, scheme)
+	}
+
+	image, err := newKTXImage(layout, width, height, depth, layers, faces, levels)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every level has an entry in the index, starting with the full size one, however the file orders the data
+	if len(data) < ktx2HeaderSize+image.Levels()*24 {
+		return nil, fmt.Errorf("%w: file ends in the level index", ErrKtxHeader)
+	}
+
+	levelData := make([][]byte, image.Levels())
+	for level := range levelData {
+
+		entry := data[ktx2HeaderSize+level*24:]
+		byteOffset := binary.LittleEndian.Uint64(entry)
+		byteLength := binary.LittleEndian.Uint64(entry[8:])
+		uncompressedLength := binary.LittleEndian.Uint64(entry[16:])
+
+		if byteOffset > uint64(len(data)) || byteLength > uint64(len(data))-byteOffset {
+			return nil, fmt.Errorf("%w: mipmap level %d of %d bytes at %d in a file of %d", ErrKtxHeader, level,
+				byteLength, byteOffset, len(data))
+		}
+
+		expected := uint64(image.LevelDataSize(level))
+		if decompress == nil && byteLength != expected {
+			uncompressedLength = byteLength
+		}
+		if uncompressedLength != expected {
+			return nil, fmt.Errorf("%w: mipmap level %d of %d bytes instead of %d", ErrKtxData, level,
+				uncompressedLength, expected)
+		}
+
+		levelData[level] = data[byteOffset : byteOffset+byteLength]
+		if decompress != nil {
+			if levelData[level], err = decompress(levelData[level], int(expected)); err != nil {
+				return nil, fmt.Errorf("%w: mipmap level %d: %v", ErrKtxData, level, err)
+			}
+			if uint64(len(levelData[level])) != expected {
+				return nil, fmt.Errorf("%w: mipmap level %d decompressed to %d bytes instead of %d", ErrKtxData,
+					level, len(levelData[level]), expected)
+			}
+		} else if layout.bgr {
+			// Swapping works in place, so the file's bytes are copied first
+			levelData[level] = append([]byte(nil), levelData[level]...)
+		}
+
+		if layout.bgr {
+			swapRedBlue(levelData[level], image.Format.BytesPerPixel())
+		}
+
+	}
+
+	image.Pixels = levelData[0]
+	image.Mipmaps = levelData[1:]
+
+	return image, nil
+
+}
+
+// newKTXImage checks the size and shape shared by both versions' headers, where a height or depth of 0 is a 1D or 2D
+// texture, 0 array elements isn't an array and 0 levels asks for mipmaps to be generated
+func newKTXImage(layout ktxLayout, width uint32, height uint32, depth uint32, layers uint32, faces uint32,
+	levels uint32) (*Image, error) {
+
+	if width == 0 || width > ktxMaxSize || height > ktxMaxSize || depth > ktxMaxSize || layers > ktxMaxLayers {
+		return nil, fmt.Errorf("%w: %dx%dx%d pixels in %d layers", ErrKtxHeader, width, height, depth, layers)
+	}
+	if height == 0 && depth > 0 {
+		return nil, fmt.Errorf("%w: volume without a height", ErrKtxHeader)
+	}
+	if faces != 1 && faces != 6 || faces == 6 && (width != height || depth > 0) {
+		return nil, fmt.Errorf("%w: %d faces of %dx%dx%d pixels", ErrKtxHeader, faces, width, height, depth)
+	}
+	if depth > 0 && layers > 0 {
+		return nil, fmt.Errorf("%w: array of volumes", ErrKtxUnsupported)
+	}
+
+	image := &Image{
+		Width:   int(width),
+		Height:  maxInt(int(height), 1),
+		Format:  layout.format,
+		Depth:   int(depth),
+		Layers:  int(layers),
+		Cubemap: faces == 6,
+		SRGB:    layout.srgb,
+	}
+
+	// Levels below 1x1 aren't stored
+	maxLevels := 1
+	for size := maxInt(image.Width, maxInt(image.Height, image.Depth)); size > 1; size >>= 1 {
+		maxLevels++
+	}
+	if int(levels) > maxLevels {
+		return nil, fmt.Errorf("%w: %d mipmap levels of a %dx%dx%d texture", ErrKtxHeader, levels, width, height,
+			depth)
+	}
+	if levels > 1 {
+		image.Mipmaps = make([][]byte, levels-1)
+	}
+
+	return image, nil
+
+}
+
+func inflateKTX2Level(data []byte, size int) ([]byte, error) {
+
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	level := make([]byte, size)
+	if _, err := io.ReadFull(reader, level); err != nil {
+		return nil, err
+	}
+
+	return level, nil
+
+}
+
+// swapKTXBytes reverses each value of a big endian file's pixels
+func swapKTXBytes(data []byte, size int) {
+
+	for i := 0; i+size <= len(data); i += size {
+		for a, b := i, i+size-1; a < b; a, b = a+1, b-1 {
+			data[a], data[b] = data[b], data[a]
+		}
+	}
+
+}
+
+func swapRedBlue(data []byte, pixelSize int) {
+
+	for i := 0; i+pixelSize <= len(data); i += pixelSize {
+		data[i], data[i+2] = data[i+2], data[i]
+	}
+
+}
@@ -0,0 +1,267 @@
+package common
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// ktx1File builds a KTX 1 file in order from the header fields after the identifier, starting with the endianness,
+// and the data of each mipmap level
+func ktx1File(order binary.ByteOrder, fields [13]uint32, levels ...[]byte) []byte {
+
+	var buffer bytes.Buffer
+	buffer.WriteString(ktxIdentifier)
+	binary.Write(&buffer, order, fields)
+	for _, level := range levels {
+		binary.Write(&buffer, order, uint32(len(level)))
+		buffer.Write(level)
+		buffer.Write(make([]byte, (4-len(level)%4)%4))
+	}
+
+	return buffer.Bytes()
+
+}
+
+// ktx1RGBA is the header of a 2x2 RGBA8 texture with both its mipmap levels
+var ktx1RGBA = [13]uint32{ktxEndianness, ktxGLUnsignedByte, 1, ktxGLRGBA, 0x8058, ktxGLRGBA, 2, 2, 0, 0, 1, 2, 0}
+
+// ktx2File builds a KTX2 file from the header fields after the identifier, from vkFormat to the supercompression
+// scheme, and the data and uncompressed size of each mipmap level
+func ktx2File(fields [9]uint32, sizes []int, levels ...[]byte) []byte {
+
+	var buffer bytes.Buffer
+	buffer.WriteString(ktx2Identifier)
+	binary.Write(&buffer, binary.LittleEndian, fields)
+
+	// No data format descriptor, key and value data or supercompression global data
+	buffer.Write(make([]byte, ktx2HeaderSize-buffer.Len()))
+
+	offset := ktx2HeaderSize + len(levels)*24
+	for i, level := range levels {
+		binary.Write(&buffer, binary.LittleEndian, []uint64{uint64(offset), uint64(len(level)), uint64(sizes[i])})
+		offset += len(level)
+	}
+	for _, level := range levels {
+		buffer.Write(level)
+	}
+
+	return buffer.Bytes()
+
+}
+
+// ktx2R8 is the header of a 2x2 R8 texture with both its mipmap levels
+var ktx2R8 = [9]uint32{9, 1, 2, 2, 0, 0, 1, 2, KTX2SupercompressionNone}
+
+func deflate(data []byte) []byte {
+
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	writer.Write(data)
+	writer.Close()
+
+	return buffer.Bytes()
+
+}
+
+func TestLoadKTXImageFrom(t *testing.T) {
+
+	rgba := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	bgra := ktx1RGBA
+	bgra[3], bgra[6], bgra[7], bgra[11] = ktxGLBGRA, 1, 1, 1
+	zlibR8, zstdR8 := ktx2R8, ktx2R8
+	zlibR8[8], zstdR8[8] = KTX2SupercompressionZlib, KTX2SupercompressionZstd
+
+	// A non array KTX 1 cubemap gives the size of one face, here 1x1 RGBA, ahead of all six
+	cube, faces := ktx1RGBA, make([]byte, 24)
+	cube[6], cube[7], cube[10], cube[11] = 1, 1, 6, 1
+	for i := range faces {
+		faces[i] = byte(i)
+	}
+
+	array := ktx1RGBA
+	array[6], array[7], array[9], array[11] = 1, 1, 3, 1
+
+	// 2x2 R8 in 3 layers with both levels, and a 1x1 R8 cubemap array of 2 cubes
+	arrayR8, cubeArrayR8 := ktx2R8, ktx2R8
+	arrayR8[5] = 3
+	cubeArrayR8[2], cubeArrayR8[3], cubeArrayR8[5], cubeArrayR8[6], cubeArrayR8[7] = 1, 1, 2, 6, 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		format  ImageFormat
+		layers  int
+		cubemap bool
+		levels  [][]byte
+	}{
+		{
+			name:   "KTX 1 little endian",
+			data:   ktx1File(binary.LittleEndian, ktx1RGBA, rgba, []byte{17, 18, 19, 20}),
+			format: ImageRGBA8,
+			levels: [][]byte{rgba, {17, 18, 19, 20}},
+		},
+		{
+			name:   "KTX 1 big endian",
+			data:   ktx1File(binary.BigEndian, ktx1RGBA, rgba, []byte{17, 18, 19, 20}),
+			format: ImageRGBA8,
+			levels: [][]byte{rgba, {17, 18, 19, 20}},
+		},
+		{
+			name:   "KTX 1 BGRA",
+			data:   ktx1File(binary.LittleEndian, bgra, []byte{1, 2, 3, 4}),
+			format: ImageRGBA8,
+			levels: [][]byte{{3, 2, 1, 4}},
+		},
+		{
+			name:   "KTX2",
+			data:   ktx2File(ktx2R8, []int{4, 1}, []byte{1, 2, 3, 4}, []byte{5}),
+			format: ImageR8,
+			levels: [][]byte{{1, 2, 3, 4}, {5}},
+		},
+		{
+			name:   "KTX2 zlib",
+			data:   ktx2File(zlibR8, []int{4, 1}, deflate([]byte{1, 2, 3, 4}), deflate([]byte{5})),
+			format: ImageR8,
+			levels: [][]byte{{1, 2, 3, 4}, {5}},
+		},
+		{
+			name: "KTX2 Zstandard",
+			data: ktx2File(zstdR8, []int{4, 1}, zstdTestFrame(4, zstdTestBlock(zstdRawBlock, []byte{1, 2, 3, 4}, 4)),
+				zstdTestFrame(1, zstdTestBlock(zstdRLEBlock, []byte{5}, 1))),
+			format: ImageR8,
+			levels: [][]byte{{1, 2, 3, 4}, {5}},
+		},
+		{
+			name:    "KTX 1 cubemap",
+			data:    append(ktx1File(binary.LittleEndian, cube), append([]byte{4, 0, 0, 0}, faces...)...),
+			format:  ImageRGBA8,
+			cubemap: true,
+			levels:  [][]byte{faces},
+		},
+		{
+			name:   "KTX 1 array",
+			data:   ktx1File(binary.LittleEndian, array, faces[:12]),
+			format: ImageRGBA8,
+			layers: 3,
+			levels: [][]byte{faces[:12]},
+		},
+		{
+			name:   "KTX2 array",
+			data:   ktx2File(arrayR8, []int{12, 3}, faces[:12], faces[12:15]),
+			format: ImageR8,
+			layers: 3,
+			levels: [][]byte{faces[:12], faces[12:15]},
+		},
+		{
+			name:    "KTX2 cubemap array",
+			data:    ktx2File(cubeArrayR8, []int{12}, faces[:12]),
+			format:  ImageR8,
+			layers:  2,
+			cubemap: true,
+			levels:  [][]byte{faces[:12]},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadKTXImageFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || image.Levels() != len(test.levels) {
+			t.Errorf("%s: %v image with %d levels, want %v with %d", test.name, image.Format, image.Levels(),
+				test.format, len(test.levels))
+			continue
+		}
+		if image.Layers != test.layers || image.Cubemap != test.cubemap {
+			t.Errorf("%s: %d layers and cubemap %v, want %d and %v", test.name, image.Layers, image.Cubemap,
+				test.layers, test.cubemap)
+		}
+		for level, want := range test.levels {
+			if data, _, _ := image.Level(level); !bytes.Equal(data, want) {
+				t.Errorf("%s: level %d is %v, want %v", test.name, level, data, want)
+			}
+		}
+
+	}
+
+}
+
+func TestLoadKTXImageFromInvalid(t *testing.T) {
+
+	ktx1 := ktx1File(binary.LittleEndian, ktx1RGBA, make([]byte, 16), make([]byte, 4))
+	ktx2 := ktx2File(ktx2R8, []int{4, 1}, make([]byte, 4), make([]byte, 1))
+
+	// patched is a copy of data with the 32 bit field at offset changed
+	patched := func(data []byte, offset int, value uint32) []byte {
+		data = append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(data[offset:], value)
+		return data
+	}
+
+	// Offsets of the header fields the cases change
+	const (
+		ktx1Endianness     = 12
+		ktx1GLType         = 16
+		ktx1InternalFormat = 28
+		ktx1Height         = 40
+		ktx1Faces          = 52
+		ktx1Levels         = 56
+		ktx1KeyValueBytes  = 60
+
+		ktx2VkFormat  = 12
+		ktx2TypeSize  = 16
+		ktx2Faces     = 36
+		ktx2Levels    = 40
+		ktx2Scheme    = 44
+		ktx2LevelZero = ktx2HeaderSize
+	)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad identifier", append([]byte("\xabKTX 12\xbb\r\n\x1a\n"), ktx1[12:]...), ErrKtxHeader},
+		{"not a KTX", []byte("DDS "), ErrKtxHeader},
+
+		{"KTX 1 truncated header", ktx1[:ktxHeaderSize-1], ErrKtxHeader},
+		{"KTX 1 bad endianness", patched(ktx1, ktx1Endianness, 0x01020403), ErrKtxHeader},
+		{"KTX 1 unknown internal format", patched(ktx1, ktx1InternalFormat, 0x1234), ErrKtxUnsupported},
+		{"KTX 1 wrong glType", patched(ktx1, ktx1GLType, ktxGLFloat), ErrKtxUnsupported},
+		{"KTX 1 no faces", patched(ktx1, ktx1Faces, 0), ErrKtxHeader},
+		{"KTX 1 two faces", patched(ktx1, ktx1Faces, 2), ErrKtxHeader},
+		{"KTX 1 cube faces that aren't square", patched(patched(ktx1, ktx1Faces, 6), ktx1Height, 1), ErrKtxHeader},
+		{"KTX 1 too many levels", patched(ktx1, ktx1Levels, 3), ErrKtxHeader},
+		{"KTX 1 key and value data past the end", patched(ktx1, ktx1KeyValueBytes, 1000), ErrKtxHeader},
+		{"KTX 1 truncated level", ktx1[:len(ktx1)-1], ErrKtxData},
+		{"KTX 1 missing level", ktx1[:len(ktx1)-8], ErrKtxData},
+
+		{"KTX2 truncated header", ktx2[:ktx2HeaderSize-1], ErrKtxHeader},
+		{"KTX2 Basis Universal", patched(ktx2, ktx2VkFormat, 0), ErrKtxUnsupported},
+		{"KTX2 unknown vkFormat", patched(ktx2, ktx2VkFormat, 1000), ErrKtxUnsupported},
+		{"KTX2 wrong typeSize", patched(ktx2, ktx2TypeSize, 4), ErrKtxHeader},
+		{"KTX2 two faces", patched(ktx2, ktx2Faces, 2), ErrKtxHeader},
+		{"KTX2 too many levels", patched(ktx2, ktx2Levels, 3), ErrKtxHeader},
+		{"KTX2 BasisLZ", patched(ktx2, ktx2Scheme, KTX2SupercompressionBasisLZ), ErrKtxUnsupported},
+		{"KTX2 reserved scheme", patched(ktx2, ktx2Scheme, 4), ErrKtxHeader},
+		{"KTX2 vendor scheme", patched(ktx2, ktx2Scheme, 0x10000), ErrKtxUnsupported},
+		{"KTX2 file ends in the level index", ktx2[:ktx2HeaderSize+30], ErrKtxHeader},
+		{"KTX2 level outside the file", patched(ktx2, ktx2LevelZero, 1000), ErrKtxHeader},
+		{"KTX2 level past the end", patched(ktx2, ktx2LevelZero+8, 1000), ErrKtxHeader},
+		{"KTX2 level of the wrong size", patched(ktx2, ktx2LevelZero+8, 3), ErrKtxData},
+		{"KTX2 zlib level that isn't zlib", patched(ktx2, ktx2Scheme, KTX2SupercompressionZlib), ErrKtxData},
+		{"KTX2 Zstandard level that isn't Zstandard", patched(ktx2, ktx2Scheme, KTX2SupercompressionZstd), ErrKtxData},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadKTXImageFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
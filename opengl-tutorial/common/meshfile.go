@@ -0,0 +1,294 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Binary mesh files hold an IndexedMesh ready to upload, so big models don't have to be parsed as OBJ at every launch.
+// Everything is little endian:
+//
+//	magic "GLMS", version, attribute count, vertex count, index count, index width in bytes (2 or 4)
+//	bounds min and max of the first attribute (6 float32), payload size in bytes, CRC-32 of the payload
+//	component count of each attribute
+//	payload: each attribute's float32 data in turn, then the indices, padded to 4 bytes
+const (
+	meshFileMagic   = "GLMS"
+	MeshFileVersion = 1
+)
+
+var (
+	ErrMeshMagic    = errors.New("Not a binary mesh file")
+	ErrMeshVersion  = errors.New("Unsupported binary mesh version")
+	ErrMeshChecksum = errors.New("Binary mesh checksum mismatch")
+	ErrMeshLayout   = errors.New("Invalid binary mesh layout")
+)
+
+type MeshHeader struct {
+	Version        uint32
+	AttributeSizes []int
+	VertexCount    int
+	IndexCount     int
+	IndexWidth     int
+	BoundsMin      mgl32.Vec3
+	BoundsMax      mgl32.Vec3
+	PayloadSize    int
+	Checksum       uint32
+}
+
+// meshHeaderFields is the fixed size part of the header as laid out on disk
+type meshHeaderFields struct {
+	Magic          [4]byte
+	Version        uint32
+	AttributeCount uint32
+	VertexCount    uint32
+	IndexCount     uint32
+	IndexWidth     uint32
+	BoundsMin      [3]float32
+	BoundsMax      [3]float32
+	PayloadSize    uint32
+	Checksum       uint32
+}
+
+func SaveMesh(path string, mesh *IndexedMesh) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteMesh(file, mesh); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
+
+func WriteMesh(writer io.Writer, mesh *IndexedMesh) error {
+
+	vertexCount := mesh.VertexCount()
+	for _, attribute := range mesh.Attributes {
+		if attribute.Size <= 0 || attribute.Len() != vertexCount {
+			return ErrMeshLayout
+		}
+	}
+
+	indexWidth := 4
+	shortIndices := mesh.ShortIndices()
+	if shortIndices != nil {
+		indexWidth = 2
+	}
+
+	payloadSize := len(mesh.Indices) * indexWidth
+	for _, attribute := range mesh.Attributes {
+		payloadSize += len(attribute.Data) * 4
+	}
+	payloadSize = (payloadSize + 3) &^ 3
+
+	payload := make([]byte, payloadSize)
+	offset := 0
+
+	for _, attribute := range mesh.Attributes {
+		for _, value := range attribute.Data {
+			binary.LittleEndian.PutUint32(payload[offset:], math.Float32bits(value))
+			offset += 4
+		}
+	}
+
+	if shortIndices != nil {
+		for _, index := range shortIndices {
+			binary.LittleEndian.PutUint16(payload[offset:], index)
+			offset += 2
+		}
+	} else {
+		for _, index := range mesh.Indices {
+			binary.LittleEndian.PutUint32(payload[offset:], index)
+			offset += 4
+		}
+	}
+
+	header := meshHeaderFields{
+		Version:        MeshFileVersion,
+		AttributeCount: uint32(len(mesh.Attributes)),
+		VertexCount:    uint32(vertexCount),
+		IndexCount:     uint32(len(mesh.Indices)),
+		IndexWidth:     uint32(indexWidth),
+		PayloadSize:    uint32(payloadSize),
+		Checksum:       crc32.ChecksumIEEE(payload),
+	}
+	copy(header.Magic[:], meshFileMagic)
+
+	if len(mesh.Attributes) > 0 {
+		header.BoundsMin, header.BoundsMax = attributeBounds(mesh.Attributes[0])
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	for _, attribute := range mesh.Attributes {
+		if err := binary.Write(writer, binary.LittleEndian, uint32(attribute.Size)); err != nil {
+			return err
+		}
+	}
+
+	_, err := writer.Write(payload)
+	return err
+
+}
+
+// attributeBounds is the box around the first three components of an attribute
+func attributeBounds(attribute VertexAttribute) ([3]float32, [3]float32) {
+
+	var min, max [3]float32
+	for c := 0; c < 3; c++ {
+		min[c] = float32(math.Inf(1))
+		max[c] = float32(math.Inf(-1))
+	}
+
+	for v := 0; v < attribute.Len(); v++ {
+		for c := 0; c < 3 && c < attribute.Size; c++ {
+			value := attribute.Data[v*attribute.Size+c]
+			min[c] = float32(math.Min(float64(min[c]), float64(value)))
+			max[c] = float32(math.Max(float64(max[c]), float64(value)))
+		}
+	}
+
+	// Empty meshes and missing components get an empty box at the origin
+	for c := 0; c < 3; c++ {
+		if min[c] > max[c] {
+			min[c], max[c] = 0, 0
+		}
+	}
+
+	return min, max
+
+}
+
+func LoadMesh(path string) (*IndexedMesh, *MeshHeader, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	mesh, header, err := ReadMesh(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return mesh, header, nil
+
+}
+
+// ReadMesh reads a mesh written by WriteMesh. The header is validated before the payload is read and checked against
+// its checksum, and nothing is allocated from the counts in the header until the payload has been read.
+func ReadMesh(reader io.Reader) (*IndexedMesh, *MeshHeader, error) {
+
+	var fields meshHeaderFields
+	if err := binary.Read(reader, binary.LittleEndian, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	if string(fields.Magic[:]) != meshFileMagic {
+		return nil, nil, ErrMeshMagic
+	}
+
+	if fields.Version != MeshFileVersion {
+		return nil, nil, ErrMeshVersion
+	}
+
+	if (fields.IndexWidth != 2 && fields.IndexWidth != 4) || fields.AttributeCount > 64 {
+		return nil, nil, ErrMeshLayout
+	}
+
+	header := &MeshHeader{
+		Version:        fields.Version,
+		AttributeSizes: make([]int, fields.AttributeCount),
+		VertexCount:    int(fields.VertexCount),
+		IndexCount:     int(fields.IndexCount),
+		IndexWidth:     int(fields.IndexWidth),
+		BoundsMin:      fields.BoundsMin,
+		BoundsMax:      fields.BoundsMax,
+		PayloadSize:    int(fields.PayloadSize),
+		Checksum:       fields.Checksum,
+	}
+
+	sizes := make([]uint32, fields.AttributeCount)
+	if err := binary.Read(reader, binary.LittleEndian, sizes); err != nil {
+		return nil, nil, err
+	}
+
+	// Work out the payload size in 64 bits so corrupt counts can't overflow it
+	expectedSize := uint64(fields.IndexCount) * uint64(fields.IndexWidth)
+	for i, size := range sizes {
+		if size == 0 || size > 16 {
+			return nil, nil, ErrMeshLayout
+		}
+		header.AttributeSizes[i] = int(size)
+		expectedSize += uint64(fields.VertexCount) * uint64(size) * 4
+	}
+
+	if (expectedSize+3)&^3 != uint64(fields.PayloadSize) {
+		return nil, nil, ErrMeshLayout
+	}
+
+	// The buffer grows as the payload is read, so a truncated file can't ask for gigabytes up front
+	payload, err := ioutil.ReadAll(io.LimitReader(reader, int64(fields.PayloadSize)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(payload) != int(fields.PayloadSize) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	if crc32.ChecksumIEEE(payload) != fields.Checksum {
+		return nil, nil, ErrMeshChecksum
+	}
+
+	mesh := &IndexedMesh{
+		Attributes: make([]VertexAttribute, len(sizes)),
+		Indices:    make([]uint32, fields.IndexCount),
+	}
+
+	offset := 0
+	for a, size := range header.AttributeSizes {
+
+		data := make([]float32, header.VertexCount*size)
+		for i := range data {
+			data[i] = math.Float32frombits(binary.LittleEndian.Uint32(payload[offset:]))
+			offset += 4
+		}
+		mesh.Attributes[a] = VertexAttribute{Size: size, Data: data}
+
+	}
+
+	for i := range mesh.Indices {
+
+		if header.IndexWidth == 2 {
+			mesh.Indices[i] = uint32(binary.LittleEndian.Uint16(payload[offset:]))
+		} else {
+			mesh.Indices[i] = binary.LittleEndian.Uint32(payload[offset:])
+		}
+		offset += header.IndexWidth
+
+		if mesh.Indices[i] >= fields.VertexCount {
+			return nil, nil, ErrMeshLayout
+		}
+
+	}
+
+	return mesh, header, nil
+
+}
@@ -0,0 +1,207 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// suzanneMesh is suzanne.obj welded into positions, uvs and normals as obj2mesh writes it
+func suzanneMesh(t testing.TB) *IndexedMesh {
+
+	vertices, uvs, normals, err := LoadObj("../08-basic-shading/suzanne.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mesh, err := IndexAttributes(Vec3Attribute(vertices, 0), Vec2Attribute(uvs, 0), Vec3Attribute(normals, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mesh
+
+}
+
+func TestWriteMeshRoundTrip(t *testing.T) {
+
+	suzanne := suzanneMesh(t)
+
+	// A grid of 256x256 squares needs 32-bit indices
+	vertices, uvs, normals := gridTriangles(256*256*2, 0)
+	grid, err := IndexAttributes(Vec3Attribute(vertices, 0), Vec2Attribute(uvs, 0), Vec3Attribute(normals, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mesh       *IndexedMesh
+		indexWidth int
+	}{
+		{"16-bit indices", suzanne, 2},
+		{"32-bit indices", grid, 4},
+	}
+
+	for _, test := range tests {
+
+		var buffer bytes.Buffer
+		if err := WriteMesh(&buffer, test.mesh); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		mesh, header, err := ReadMesh(&buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if header.IndexWidth != test.indexWidth || header.VertexCount != test.mesh.VertexCount() ||
+			header.IndexCount != len(test.mesh.Indices) {
+			t.Errorf("%s: header %+v", test.name, header)
+		}
+
+		min, max := attributeBounds(test.mesh.Attributes[0])
+		if header.BoundsMin != min || header.BoundsMax != max {
+			t.Errorf("%s: bounds %v %v, want %v %v", test.name, header.BoundsMin, header.BoundsMax, min, max)
+		}
+
+		if len(mesh.Attributes) != len(test.mesh.Attributes) {
+			t.Fatalf("%s: %d attributes, want %d", test.name, len(mesh.Attributes), len(test.mesh.Attributes))
+		}
+		for a, attribute := range mesh.Attributes {
+			want := test.mesh.Attributes[a]
+			if attribute.Size != want.Size || len(attribute.Data) != len(want.Data) {
+				t.Fatalf("%s: attribute %d has size %d and %d values, want %d and %d", test.name, a,
+					attribute.Size, len(attribute.Data), want.Size, len(want.Data))
+			}
+			for i, value := range attribute.Data {
+				if value != want.Data[i] {
+					t.Fatalf("%s: attribute %d value %d is %v, want %v", test.name, a, i, value, want.Data[i])
+				}
+			}
+		}
+
+		if len(mesh.Indices) != len(test.mesh.Indices) {
+			t.Fatalf("%s: %d indices, want %d", test.name, len(mesh.Indices), len(test.mesh.Indices))
+		}
+		for i, index := range mesh.Indices {
+			if index != test.mesh.Indices[i] {
+				t.Fatalf("%s: index %d is %d, want %d", test.name, i, index, test.mesh.Indices[i])
+			}
+		}
+
+	}
+
+}
+
+func TestReadMeshErrors(t *testing.T) {
+
+	var buffer bytes.Buffer
+	if err := WriteMesh(&buffer, suzanneMesh(t)); err != nil {
+		t.Fatal(err)
+	}
+	file := buffer.Bytes()
+
+	// The fixed header is 56 bytes followed by one size per attribute
+	payloadOffset := 56 + 4*3
+
+	edit := func(change func(data []byte)) []byte {
+		data := append([]byte(nil), file...)
+		change(data)
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"magic", edit(func(data []byte) { copy(data, "OBJ ") }), ErrMeshMagic},
+		{"version", edit(func(data []byte) { binary.LittleEndian.PutUint32(data[4:], MeshFileVersion+1) }),
+			ErrMeshVersion},
+		{"index width", edit(func(data []byte) { binary.LittleEndian.PutUint32(data[20:], 3) }), ErrMeshLayout},
+		{"attribute size", edit(func(data []byte) { binary.LittleEndian.PutUint32(data[56:], 0) }), ErrMeshLayout},
+		{"vertex count", edit(func(data []byte) {
+			binary.LittleEndian.PutUint32(data[12:], binary.LittleEndian.Uint32(data[12:])+1)
+		}), ErrMeshLayout},
+		{"flipped payload byte", edit(func(data []byte) { data[payloadOffset+100] ^= 0x10 }), ErrMeshChecksum},
+		{"flipped checksum byte", edit(func(data []byte) { data[52] ^= 0x01 }), ErrMeshChecksum},
+		{"truncated header", file[:30], io.ErrUnexpectedEOF},
+		{"truncated sizes", file[:58], io.ErrUnexpectedEOF},
+		{"truncated payload", file[:len(file)-1], io.ErrUnexpectedEOF},
+		{"empty", nil, io.EOF},
+	}
+
+	for _, test := range tests {
+		if _, _, err := ReadMesh(bytes.NewReader(test.data)); !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+	}
+
+}
+
+func TestReadMeshHugeCounts(t *testing.T) {
+
+	// A header claiming 3 GB of positions in a file of a few bytes fails on the short payload rather than allocating
+	header := meshHeaderFields{
+		Version:        MeshFileVersion,
+		AttributeCount: 1,
+		VertexCount:    1 << 28,
+		IndexWidth:     4,
+		PayloadSize:    (1 << 28) * 3 * 4,
+	}
+	copy(header.Magic[:], meshFileMagic)
+
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, &header)
+	binary.Write(&buffer, binary.LittleEndian, uint32(3))
+	buffer.Write(make([]byte, 64))
+
+	if _, _, err := ReadMesh(&buffer); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Error %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+}
+
+func TestLoadMesh(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "meshfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	suzanne := suzanneMesh(t)
+	path := filepath.Join(dir, "suzanne.mesh")
+	if err := SaveMesh(path, suzanne); err != nil {
+		t.Fatal(err)
+	}
+
+	mesh, _, err := LoadMesh(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mesh.VertexCount() != suzanne.VertexCount() || len(mesh.Indices) != len(suzanne.Indices) {
+		t.Errorf("Loaded %d vertices and %d indices, want %d and %d", mesh.VertexCount(), len(mesh.Indices),
+			suzanne.VertexCount(), len(suzanne.Indices))
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-8] ^= 0xff
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := LoadMesh(path); !errors.Is(err, ErrMeshChecksum) {
+		t.Errorf("Corrupt file gave error %v, want %v", err, ErrMeshChecksum)
+	}
+
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// GenerateMipmaps returns a copy of an RGB8, RGBA8, R8, RG8, L8 or LA8 image with every mipmap level down to 1x1,
+// replacing any it had. Each level is a box filter of the one before, so sizes that don't halve evenly blend the
+// pixels that straddle two of the smaller level's pixels by how much of each they cover. Volumes halve in depth too.
+// Colours of sRGB images are averaged in linear space, alpha always is linear.
+func GenerateMipmaps(image *Image) (*Image, error) {
+
+	// Channels that hold colour rather than alpha
+	var colourChannels int
+	switch image.Format {
+	case ImageRGB8, ImageRGBA8:
+		colourChannels = 3
+	case ImageR8, ImageRG8:
+		colourChannels = image.Format.BytesPerPixel()
+	case ImageL8, ImageLA8:
+		colourChannels = 1
+	default:
+		return nil, fmt.Errorf("Can't generate mipmaps of %v images", image.Format)
+	}
+	if len(image.Pixels) < image.LevelDataSize(0) {
+		return nil, fmt.Errorf("Image level 0 holds %d bytes instead of %d", len(image.Pixels),
+			image.LevelDataSize(0))
+	}
+
+	channels := image.Format.BytesPerPixel()
+
+	// Red and red green formats have no sRGB variant in OpenGL, so they're always linear
+	srgb := image.SRGB && image.Format != ImageR8 && image.Format != ImageRG8
+
+	toLinear := func(channel int, value byte) float32 {
+		if srgb && channel < colourChannels {
+			return srgbToLinear[value]
+		}
+		return float32(value) / 255
+	}
+	fromLinear := func(channel int, value float32) byte {
+		if srgb && channel < colourChannels {
+			value = linearToSRGB(value)
+		}
+		return byte(math.Min(math.Max(float64(value)*255+0.5, 0), 255))
+	}
+
+	levels := 1
+	for size := maxInt(image.Width, maxInt(image.Height, image.Depth)); size > 1; size >>= 1 {
+		levels++
+	}
+
+	mipmapped := *image
+	mipmapped.Pixels = image.Pixels[:image.LevelDataSize(0)]
+	mipmapped.Mipmaps = make([][]byte, levels-1)
+
+	// Levels are filtered from the one before kept in linear floats, so rounding doesn't build up
+	source := make([]float32, len(mipmapped.Pixels))
+	for i, value := range mipmapped.Pixels {
+		source[i] = toLinear(i%channels, value)
+	}
+
+	for level := 1; level < levels; level++ {
+
+		sourceWidth, sourceHeight := mipmapSize(image.Width, level-1), mipmapSize(image.Height, level-1)
+		sourceDepth := image.LevelDepth(level - 1)
+		width, height := mipmapSize(image.Width, level), mipmapSize(image.Height, level)
+		depth := image.LevelDepth(level)
+
+		columns := boxFilterWeights(sourceWidth, width)
+		rows := boxFilterWeights(sourceHeight, height)
+		slices := boxFilterWeights(sourceDepth, depth)
+
+		target := make([]float32, width*height*depth*image.Slices()*channels)
+		sourceSlice := sourceWidth * sourceHeight * sourceDepth * channels
+		targetSlice := width * height * depth * channels
+
+		for slice := 0; slice < image.Slices(); slice++ {
+			for z := 0; z < depth; z++ {
+				for y := 0; y < height; y++ {
+					for x := 0; x < width; x++ {
+
+						pixel := target[slice*targetSlice+((z*height+y)*width+x)*channels:]
+						for _, sz := range slices[z] {
+							for _, sy := range rows[y] {
+								for _, sx := range columns[x] {
+
+									weight := sz.weight * sy.weight * sx.weight
+									offset := slice*sourceSlice +
+										((sz.index*sourceHeight+sy.index)*sourceWidth+sx.index)*channels
+									for c := 0; c < channels; c++ {
+										pixel[c] += source[offset+c] * weight
+									}
+
+								}
+							}
+						}
+
+					}
+				}
+			}
+		}
+
+		pixels := make([]byte, len(target))
+		for i, value := range target {
+			pixels[i] = fromLinear(i%channels, value)
+		}
+		mipmapped.Mipmaps[level-1] = pixels
+		source = target
+
+	}
+
+	return &mipmapped, nil
+
+}
+
+type filterWeight struct {
+	index  int
+	weight float32
+}
+
+// boxFilterWeights is, for each pixel of a row target pixels long, the pixels of a row source pixels long it covers and
+// how much of it each one makes up
+func boxFilterWeights(source int, target int) [][]filterWeight {
+
+	weights := make([][]filterWeight, target)
+	scale := float64(source) / float64(target)
+
+	for i := range weights {
+
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for pixel := int(start); float64(pixel) < end && pixel < source; pixel++ {
+			covered := math.Min(end, float64(pixel+1)) - math.Max(start, float64(pixel))
+			if covered > 1e-6 {
+				weights[i] = append(weights[i], filterWeight{pixel, float32(covered / scale)})
+			}
+		}
+
+	}
+
+	return weights
+
+}
+
+// srgbToLinear decodes each 8 bit sRGB value
+var srgbToLinear = func() [256]float32 {
+
+	var table [256]float32
+	for i := range table {
+
+		value := float64(i) / 255
+		if value <= 0.04045 {
+			table[i] = float32(value / 12.92)
+		} else {
+			table[i] = float32(math.Pow((value+0.055)/1.055, 2.4))
+		}
+
+	}
+
+	return table
+
+}()
+
+func linearToSRGB(value float32) float32 {
+
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+
+	return float32(1.055*math.Pow(float64(value), 1/2.4) - 0.055)
+
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateMipmapsSizes(t *testing.T) {
+
+	// Each size is the width, height and depth of every level, ending at 1x1
+	tests := []struct {
+		name  string
+		image *Image
+		sizes [][3]int
+	}{
+		{"5x3", &Image{Width: 5, Height: 3, Format: ImageRGB8}, [][3]int{{5, 3, 1}, {2, 1, 1}, {1, 1, 1}}},
+		{"7x1", &Image{Width: 7, Height: 1, Format: ImageL8}, [][3]int{{7, 1, 1}, {3, 1, 1}, {1, 1, 1}}},
+		{"1x9", &Image{Width: 1, Height: 9, Format: ImageRGBA8},
+			[][3]int{{1, 9, 1}, {1, 4, 1}, {1, 2, 1}, {1, 1, 1}}},
+		{"3x3x5 volume", &Image{Width: 3, Height: 3, Depth: 5, Format: ImageLA8},
+			[][3]int{{3, 3, 5}, {1, 1, 2}, {1, 1, 1}}},
+		{"13x6 cubemap array", &Image{Width: 13, Height: 6, Format: ImageRG8, Cubemap: true, Layers: 2},
+			[][3]int{{13, 6, 1}, {6, 3, 1}, {3, 1, 1}, {1, 1, 1}}},
+		{"1x1", &Image{Width: 1, Height: 1, Format: ImageR8}, [][3]int{{1, 1, 1}}},
+	}
+
+	for _, test := range tests {
+
+		test.image.Pixels = make([]byte, test.image.LevelDataSize(0))
+
+		// Any mipmaps the image had are replaced
+		test.image.Mipmaps = [][]byte{{1, 2, 3}}
+
+		mipmapped, err := GenerateMipmaps(test.image)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if mipmapped.Levels() != len(test.sizes) {
+			t.Fatalf("%s: %d levels, want %d", test.name, mipmapped.Levels(), len(test.sizes))
+		}
+
+		for level, size := range test.sizes {
+
+			data, width, height := mipmapped.Level(level)
+			if width != size[0] || height != size[1] || mipmapped.LevelDepth(level) != size[2] {
+				t.Errorf("%s: level %d is %dx%dx%d, want %v", test.name, level, width, height,
+					mipmapped.LevelDepth(level), size)
+			}
+			if len(data) != mipmapped.LevelDataSize(level) {
+				t.Errorf("%s: level %d holds %d bytes, want %d", test.name, level, len(data),
+					mipmapped.LevelDataSize(level))
+			}
+
+		}
+
+	}
+
+}
+
+func TestGenerateMipmapsFilter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		image  *Image
+		levels [][]byte
+	}{
+		{
+			// Every source pixel makes up a third of the smaller one
+			name:   "3 to 1",
+			image:  &Image{Width: 3, Height: 1, Format: ImageL8, Pixels: []byte{0, 90, 180}},
+			levels: [][]byte{{0, 90, 180}, {90}},
+		},
+		{
+			// The middle pixel is split between both halves
+			name:   "5 to 2 to 1",
+			image:  &Image{Width: 5, Height: 1, Format: ImageL8, Pixels: []byte{0, 0, 0, 0, 250}},
+			levels: [][]byte{{0, 0, 0, 0, 250}, {0, 100}, {50}},
+		},
+		{
+			name:  "flat colour",
+			image: &Image{Width: 3, Height: 5, Format: ImageRGB8, Pixels: bytes.Repeat([]byte{10, 200, 77}, 15)},
+			levels: [][]byte{bytes.Repeat([]byte{10, 200, 77}, 15), bytes.Repeat([]byte{10, 200, 77}, 2),
+				{10, 200, 77}},
+		},
+		{
+			// Half black and half white is 0.5 in linear light, which is 188 encoded as sRGB
+			name: "sRGB",
+			image: &Image{Width: 2, Height: 1, Format: ImageRGBA8, SRGB: true,
+				Pixels: []byte{0, 0, 0, 0, 255, 255, 255, 255}},
+			levels: [][]byte{{0, 0, 0, 0, 255, 255, 255, 255}, {188, 188, 188, 128}},
+		},
+		{
+			name:   "linear",
+			image:  &Image{Width: 2, Height: 1, Format: ImageRGBA8, Pixels: []byte{0, 0, 0, 0, 255, 255, 255, 255}},
+			levels: [][]byte{{0, 0, 0, 0, 255, 255, 255, 255}, {128, 128, 128, 128}},
+		},
+		{
+			// Red green images have no sRGB variant so the flag is ignored
+			name:   "sRGB red green",
+			image:  &Image{Width: 2, Height: 1, Format: ImageRG8, SRGB: true, Pixels: []byte{0, 0, 255, 255}},
+			levels: [][]byte{{0, 0, 255, 255}, {128, 128}},
+		},
+		{
+			// Depth slices are averaged like rows and columns, and each face on its own
+			name:   "volume",
+			image:  &Image{Width: 1, Height: 1, Depth: 2, Format: ImageL8, Pixels: []byte{20, 40}},
+			levels: [][]byte{{20, 40}, {30}},
+		},
+		{
+			name: "cubemap",
+			image: &Image{Width: 2, Height: 1, Format: ImageL8, Cubemap: true,
+				Pixels: []byte{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110}},
+			levels: [][]byte{{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110}, {5, 25, 45, 65, 85, 105}},
+		},
+	}
+
+	for _, test := range tests {
+
+		mipmapped, err := GenerateMipmaps(test.image)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if mipmapped.Levels() != len(test.levels) {
+			t.Fatalf("%s: %d levels, want %d", test.name, mipmapped.Levels(), len(test.levels))
+		}
+
+		for level, want := range test.levels {
+			if data, _, _ := mipmapped.Level(level); !bytes.Equal(data, want) {
+				t.Errorf("%s: level %d is %v, want %v", test.name, level, data, want)
+			}
+		}
+
+	}
+
+}
+
+func TestGenerateMipmapsInvalid(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		image *Image
+	}{
+		{"compressed", &Image{Width: 4, Height: 4, Format: ImageDXT1, Pixels: make([]byte, 8)}},
+		{"floating point", &Image{Width: 1, Height: 1, Format: ImageRGBA32F, Pixels: make([]byte, 16)}},
+		{"short pixels", &Image{Width: 4, Height: 4, Format: ImageRGB8, Pixels: make([]byte, 47)}},
+	}
+
+	for _, test := range tests {
+		if _, err := GenerateMipmaps(test.image); err == nil {
+			t.Errorf("%s: generated mipmaps", test.name)
+		}
+	}
+
+}
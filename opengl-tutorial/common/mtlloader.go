@@ -0,0 +1,230 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Material is a single newmtl entry of a Wavefront .mtl file. Texture paths are resolved relative to the .mtl file.
+type Material struct {
+	Name string
+
+	Ambient   mgl32.Vec3 // Ka
+	Diffuse   mgl32.Vec3 // Kd
+	Specular  mgl32.Vec3 // Ks
+	Shininess float32    // Ns
+	Dissolve  float32    // d, 1 is fully opaque
+	Illum     int        // illum
+
+	DiffuseMap  string // map_Kd
+	BumpMap     string // map_Bump or bump
+	SpecularMap string // map_Ks
+}
+
+func NewMaterial(name string) *Material {
+
+	return &Material{
+		Name:     name,
+		Ambient:  mgl32.Vec3{0.2, 0.2, 0.2},
+		Diffuse:  mgl32.Vec3{0.8, 0.8, 0.8},
+		Specular: mgl32.Vec3{1.0, 1.0, 1.0},
+		Dissolve: 1.0,
+	}
+
+}
+
+func LoadMtl(path string) (map[string]*Material, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseMtl(file, path, filepath.Dir(path))
+
+}
+
+// LoadMtlFrom is LoadMtl for material libraries that don't live on disk, texture paths are left as the library gives
+// them
+func LoadMtlFrom(reader io.Reader) (map[string]*Material, error) {
+	return parseMtl(reader, "", "")
+}
+
+// parseMtl parses a material library read from reader, name is only used for error reporting and texture paths are
+// resolved relative to dir
+func parseMtl(reader io.Reader, name string, dir string) (map[string]*Material, error) {
+
+	materials := make(map[string]*Material)
+	var material *Material
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 1
+	for ; scanner.Scan(); lineNumber++ {
+
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if fields[0] == "newmtl" {
+			material = NewMaterial(strings.Join(fields[1:], " "))
+			materials[material.Name] = material
+			continue
+		}
+
+		// Anything else describes the current material
+		if material == nil {
+			continue
+		}
+
+		if err := material.parseStatement(fields, dir); err != nil {
+			return nil, objErrorAt(err, name, lineNumber)
+		}
+
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, objErrorAt(&ObjError{Err: err}, name, lineNumber)
+	}
+
+	return materials, nil
+
+}
+
+func (material *Material) parseStatement(fields []string, dir string) error {
+
+	var err error
+
+	switch fields[0] {
+	case "Ka":
+		material.Ambient, err = parseMtlColor(fields)
+	case "Kd":
+		material.Diffuse, err = parseMtlColor(fields)
+	case "Ks":
+		material.Specular, err = parseMtlColor(fields)
+	case "Ns":
+		material.Shininess, err = parseMtlFloat(fields)
+	case "d":
+		// Some exporters write "d -halo 0.5"
+		if len(fields) > 1 && fields[1] == "-halo" {
+			fields = append([]string{fields[0]}, fields[2:]...)
+		}
+		material.Dissolve, err = parseMtlFloat(fields)
+	case "Tr":
+		var transparency float32
+		transparency, err = parseMtlFloat(fields)
+		material.Dissolve = 1 - transparency
+	case "illum":
+		var illum float32
+		illum, err = parseMtlFloat(fields)
+		material.Illum = int(illum)
+	case "map_Kd":
+		material.DiffuseMap = mtlTexturePath(fields[1:], dir)
+	case "map_Bump", "map_bump", "bump":
+		material.BumpMap = mtlTexturePath(fields[1:], dir)
+	case "map_Ks":
+		material.SpecularMap = mtlTexturePath(fields[1:], dir)
+	}
+
+	return err
+
+}
+
+// parseMtlColor parses the rgb triple following the statement keyword, a single value is used for all three channels
+func parseMtlColor(fields []string) (mgl32.Vec3, error) {
+
+	if len(fields) > 1 && (fields[1] == "spectral" || fields[1] == "xyz") {
+		return mgl32.Vec3{}, &ObjError{Token: fields[1], Err: ErrObjSyntax}
+	}
+
+	values, err := parseObjFloats(fields, 1, 3)
+	if err != nil {
+		return mgl32.Vec3{}, err
+	}
+
+	if len(fields) < 4 {
+		return mgl32.Vec3{values[0], values[0], values[0]}, nil
+	}
+
+	return mgl32.Vec3{values[0], values[1], values[2]}, nil
+
+}
+
+func parseMtlFloat(fields []string) (float32, error) {
+
+	values, err := parseObjFloats(fields, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return values[0], nil
+
+}
+
+// Number of arguments each texture map option takes, -o, -s and -t take up to 3
+var mtlTextureOptions = map[string]int{
+	"-blendu":  1,
+	"-blendv":  1,
+	"-bm":      1,
+	"-boost":   1,
+	"-cc":      1,
+	"-clamp":   1,
+	"-imfchan": 1,
+	"-mm":      2,
+	"-o":       3,
+	"-s":       3,
+	"-t":       3,
+	"-texres":  1,
+	"-type":    1,
+}
+
+// mtlTexturePath skips any texture map options and returns the remaining file name relative to dir
+func mtlTexturePath(fields []string, dir string) string {
+
+	for len(fields) > 0 {
+
+		count, ok := mtlTextureOptions[fields[0]]
+		if !ok {
+			break
+		}
+		fields = fields[1:]
+
+		// Always leave the last field for the file name
+		for i := 0; i < count && len(fields) > 1; i++ {
+
+			// The second and third components of -o, -s and -t are optional, they're only present when numeric
+			if i > 0 && count == 3 {
+				if _, err := strconv.ParseFloat(fields[0], 32); err != nil {
+					break
+				}
+			}
+			fields = fields[1:]
+
+		}
+
+	}
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	name := filepath.FromSlash(strings.Replace(strings.Join(fields, " "), "\\", "/", -1))
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(dir, name)
+
+}
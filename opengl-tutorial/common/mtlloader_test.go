@@ -0,0 +1,189 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// writeTestFiles writes each named file into a new temporary directory and returns the directory
+func writeTestFiles(t *testing.T, files map[string]string) string {
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+
+}
+
+func TestLoadMtl(t *testing.T) {
+
+	dir := writeTestFiles(t, map[string]string{"test.mtl": `# Two materials
+newmtl painted metal
+Ka 0.1 0.2 0.3
+Kd 0.5
+Ks 1 0.5 0.25
+Ns 96.5
+d 0.75
+illum 2
+map_Kd -bm 0.5 -o 0.5 0.25 diffuse map.png
+map_Bump -bm 0.5 normals.png
+map_Ks -s 2 -clamp on textures\specular.png
+
+newmtl glass
+Tr 0.25
+d -halo 0.5
+bump /absolute/bump.png
+`})
+
+	materials, err := LoadMtl(filepath.Join(dir, "test.mtl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(materials) != 2 {
+		t.Fatalf("Loaded %d materials, want 2", len(materials))
+	}
+
+	metal := materials["painted metal"]
+	want := &Material{
+		Name:        "painted metal",
+		Ambient:     mgl32.Vec3{0.1, 0.2, 0.3},
+		Diffuse:     mgl32.Vec3{0.5, 0.5, 0.5},
+		Specular:    mgl32.Vec3{1, 0.5, 0.25},
+		Shininess:   96.5,
+		Dissolve:    0.75,
+		Illum:       2,
+		DiffuseMap:  filepath.Join(dir, "diffuse map.png"),
+		BumpMap:     filepath.Join(dir, "normals.png"),
+		SpecularMap: filepath.Join(dir, "textures", "specular.png"),
+	}
+	if metal == nil || *metal != *want {
+		t.Errorf("Loaded %+v, want %+v", metal, want)
+	}
+
+	// Statements the glass doesn't have keep their defaults, and the later of Tr and d wins
+	glass := materials["glass"]
+	want = NewMaterial("glass")
+	want.Dissolve = 0.5
+	want.BumpMap = filepath.FromSlash("/absolute/bump.png")
+	if glass == nil || *glass != *want {
+		t.Errorf("Loaded %+v, want %+v", glass, want)
+	}
+
+}
+
+func TestLoadMtlErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		source string
+		err    error
+		line   int
+	}{
+		{"colour that isn't a number", "newmtl a\nKd 1 x 1\n", ErrObjNumber, 2},
+		{"spectral colour", "newmtl a\n\nKa spectral file.rfl\n", ErrObjSyntax, 3},
+		{"shininess without a value", "newmtl a\nNs\n", ErrObjNotEnoughData, 2},
+		{"line too long", "newmtl a\n# " + strings.Repeat("x", bufio.MaxScanTokenSize) + "\n", bufio.ErrTooLong, 2},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(writeTestFiles(t, map[string]string{"test.mtl": test.source}), "test.mtl")
+		_, err := LoadMtl(path)
+
+		var objErr *ObjError
+		if !errors.As(err, &objErr) {
+			t.Errorf("%s: error %v isn't an *ObjError", test.name, err)
+			continue
+		}
+		if !errors.Is(err, test.err) || objErr.File != path || objErr.Line != test.line {
+			t.Errorf("%s: %v in %s at line %d, want %v at line %d", test.name, objErr.Err, objErr.File, objErr.Line,
+				test.err, test.line)
+		}
+
+	}
+
+}
+
+func TestLoadObjModel(t *testing.T) {
+
+	dir := writeTestFiles(t, map[string]string{
+		"test.mtl": "newmtl red\nKd 1 0 0\nnewmtl green\nKd 0 1 0\n",
+		"test.obj": objSquare + `mtllib test.mtl missing.mtl
+f 1 2 3
+o box
+usemtl red
+f 1 2 3 4
+g lid
+f 1 3 4
+usemtl green
+f 2 3 4
+usemtl red
+f 1 2 4
+usemtl blue
+f 1 2 3
+`,
+	})
+
+	model, err := LoadObjModel(filepath.Join(dir, "test.obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A missing library is skipped, and a material it would have held gets the defaults
+	if len(model.Materials) != 3 || model.Materials["red"].Diffuse != (mgl32.Vec3{1, 0, 0}) ||
+		model.Materials["blue"].Diffuse != NewMaterial("blue").Diffuse {
+		t.Errorf("Loaded materials %v", model.Materials)
+	}
+
+	tests := []struct {
+		object   string
+		group    string
+		material string
+		vertices []mgl32.Vec3
+	}{
+		{"", "", "", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+		{"box", "", "red", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 0, 0}, {1, 1, 0}, {0, 1, 0}}},
+		{"box", "lid", "red", []mgl32.Vec3{{0, 0, 0}, {1, 1, 0}, {0, 1, 0}}},
+		{"box", "lid", "green", []mgl32.Vec3{{1, 0, 0}, {1, 1, 0}, {0, 1, 0}}},
+		{"box", "lid", "red", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}},
+		{"box", "lid", "blue", []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}},
+	}
+
+	if len(model.Meshes) != len(tests) {
+		t.Fatalf("Split into %d meshes, want %d", len(model.Meshes), len(tests))
+	}
+
+	for i, test := range tests {
+
+		mesh := model.Meshes[i]
+		material := ""
+		if mesh.Material != nil {
+			material = mesh.Material.Name
+		}
+		if mesh.Object != test.object || mesh.Group != test.group || material != test.material {
+			t.Errorf("Mesh %d is %q/%q with material %q, want %q/%q with %q", i, mesh.Object, mesh.Group, material,
+				test.object, test.group, test.material)
+		}
+		if !equalVec3s(mesh.Vertices, test.vertices) || len(mesh.Uvs) != len(test.vertices) ||
+			len(mesh.Normals) != len(test.vertices) {
+			t.Errorf("Mesh %d has vertices %v, want %v", i, mesh.Vertices, test.vertices)
+		}
+
+	}
+
+	// Meshes using the same material share it
+	if model.Meshes[1].Material != model.Meshes[4].Material {
+		t.Error("The red meshes have different materials")
+	}
+
+}
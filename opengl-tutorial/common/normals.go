@@ -0,0 +1,131 @@
+package common
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Angle between two faces above which ComputeSmoothNormals keeps the edge between them sharp. At 180 degrees only the
+// smoothing groups decide.
+const NoCrease = float32(math.Pi)
+
+// DefaultCreaseAngle keeps edges sharper than 60 degrees hard when smoothing formats that carry no smoothing groups,
+// so box corners and flat-shaded cuts in a scan don't get smeared into their neighbours
+const DefaultCreaseAngle = float32(math.Pi / 3)
+
+// ComputeFlatNormals returns the face normal of each triangle for all three of its vertices. vertices is a triangle
+// list as returned by LoadObj.
+func ComputeFlatNormals(vertices []mgl32.Vec3) []mgl32.Vec3 {
+
+	normals := make([]mgl32.Vec3, len(vertices))
+
+	for i := 0; i+2 < len(vertices); i += 3 {
+		faceNormal := triangleNormal(vertices[i], vertices[i+1], vertices[i+2])
+		normals[i], normals[i+1], normals[i+2] = faceNormal, faceNormal, faceNormal
+	}
+
+	return normals
+
+}
+
+// ComputeSmoothNormals averages the normals of the faces around each vertex, weighted by the angle of each face at that
+// vertex. smoothingGroups holds the OBJ smoothing group of every triangle, faces are only averaged with faces of the
+// same group and group 0 is always flat. A nil smoothingGroups puts every triangle in one group. Faces meeting at more
+// than creaseAngle radians are never averaged together.
+func ComputeSmoothNormals(vertices []mgl32.Vec3, smoothingGroups []uint32, creaseAngle float32) []mgl32.Vec3 {
+
+	triangleCount := len(vertices) / 3
+	normals := make([]mgl32.Vec3, len(vertices))
+
+	faceNormals := make([]mgl32.Vec3, triangleCount)
+	for i := range faceNormals {
+		faceNormals[i] = triangleNormal(vertices[i*3], vertices[i*3+1], vertices[i*3+2])
+	}
+
+	group := func(triangle int) uint32 {
+		if smoothingGroups == nil {
+			return 1
+		}
+		return smoothingGroups[triangle]
+	}
+
+	// Gather the corners sharing a position within a smoothing group
+	type cornerKey struct {
+		position mgl32.Vec3
+		group    uint32
+	}
+	corners := make(map[cornerKey][]int)
+
+	for i := 0; i < triangleCount*3; i++ {
+		if g := group(i / 3); g != 0 {
+			key := cornerKey{vertices[i], g}
+			corners[key] = append(corners[key], i)
+		}
+	}
+
+	minCos := float32(math.Cos(float64(creaseAngle)))
+
+	for i := 0; i < triangleCount*3; i++ {
+
+		faceNormal := faceNormals[i/3]
+
+		g := group(i / 3)
+		if g == 0 {
+			normals[i] = faceNormal
+			continue
+		}
+
+		var sum mgl32.Vec3
+		for _, corner := range corners[cornerKey{vertices[i], g}] {
+
+			neighbour := faceNormals[corner/3]
+			if corner/3 != i/3 && faceNormal.Dot(neighbour) < minCos {
+				continue
+			}
+
+			sum = sum.Add(neighbour.Mul(cornerAngle(vertices, corner)))
+
+		}
+
+		if sum.Len() > 0 {
+			normals[i] = sum.Normalize()
+		} else {
+			normals[i] = faceNormal
+		}
+
+	}
+
+	return normals
+
+}
+
+// triangleNormal is the unit normal of a counter clockwise triangle, or the zero vector if it's degenerate
+func triangleNormal(a, b, c mgl32.Vec3) mgl32.Vec3 {
+
+	normal := b.Sub(a).Cross(c.Sub(a))
+	if normal.Len() > 0 {
+		return normal.Normalize()
+	}
+
+	return normal
+
+}
+
+// cornerAngle is the angle in radians of a triangle at one of its corners, corner being an index into vertices
+func cornerAngle(vertices []mgl32.Vec3, corner int) float32 {
+
+	first := corner - corner%3
+	position := vertices[corner]
+
+	edgeA := vertices[first+(corner+1)%3].Sub(position)
+	edgeB := vertices[first+(corner+2)%3].Sub(position)
+
+	if edgeA.Len() == 0 || edgeB.Len() == 0 {
+		return 0
+	}
+
+	cos := edgeA.Normalize().Dot(edgeB.Normalize())
+	return float32(math.Acos(float64(mgl32.Clamp(cos, -1, 1))))
+
+}
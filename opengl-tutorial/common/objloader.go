@@ -2,98 +2,552 @@ package common
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"bufio"
 
-	"bytes"
-
-	"fmt"
-
+	log "github.com/Sirupsen/logrus"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
+var (
+	ErrObjSyntax        = errors.New("Malformed statement")
+	ErrObjNumber        = errors.New("Invalid number")
+	ErrObjIndex         = errors.New("Invalid face index")
+	ErrObjIndexRange    = errors.New("Face index out of range")
+	ErrObjNotEnoughData = errors.New("Not enough values")
+)
+
+// ObjError reports where parsing an OBJ or MTL file failed. File is empty when loading from a reader without a name,
+// and Token is empty when the line couldn't be read at all.
+type ObjError struct {
+	File  string
+	Line  int
+	Token string
+	Err   error
+}
+
+func (e *ObjError) Error() string {
+
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.File != "" {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+
+	if e.Token == "" {
+		return fmt.Sprintf("%s: %v", location, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %v: %q", location, e.Err, e.Token)
+
+}
+
+func (e *ObjError) Unwrap() error {
+	return e.Err
+}
+
+// ObjMesh is a run of triangles sharing the same object, group and material. Its slices share their backing arrays
+// with the rest of the model.
+type ObjMesh struct {
+	Object string
+	Group  string
+
+	// Material is nil for faces that come before any usemtl statement
+	Material *Material
+
+	Vertices []mgl32.Vec3
+	Uvs      []mgl32.Vec2
+	Normals  []mgl32.Vec3
+}
+
+type ObjModel struct {
+	Meshes    []*ObjMesh
+	Materials map[string]*Material
+}
+
+type ObjLoadOptions struct {
+	// CreaseAngle is the angle in radians between faces above which normals generated for faces without vn keep the
+	// edge between them sharp. 0 leaves it to the smoothing groups like NoCrease.
+	CreaseAngle float32
+}
+
+// objCorner is a single corner of an OBJ face resolved to zero based indices into the position, uv and normal pools.
+// A uv or normal index of -1 means the face didn't reference one.
+type objCorner struct {
+	v, vt, vn int
+}
+
+// objParser accumulates the indexed pools of an OBJ file and the denormalized triangles built from its faces
+type objParser struct {
+
+	// Used for parsing the normalized obj file
+	tmpVertices []mgl32.Vec3
+	tmpUvs      []mgl32.Vec2
+	tmpNormals  []mgl32.Vec3
+
+	// Denormalized vectors to be returned
+	vertices []mgl32.Vec3
+	uvs      []mgl32.Vec2
+	normals  []mgl32.Vec3
+
+	// State set by o, g and usemtl, faces are split into a new mesh whenever it changes
+	state  objMeshState
+	meshes []objMeshRange
+
+	materialLibraries []string
+
+	// Smoothing group set by s for every triangle, and which vertices need a normal generated from them
+	smoothingGroup  uint32
+	smoothingGroups []uint32
+	missingNormals  []bool
+	creaseAngle     float32
+}
+
+type objMeshState struct {
+	object   string
+	group    string
+	material string
+}
+
+// objMeshRange marks where a mesh starts in the denormalized vectors, it ends where the next one starts
+type objMeshRange struct {
+	objMeshState
+	start int
+}
+
 func LoadObj(path string) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+	return LoadObjWithOptions(path, nil)
+}
+
+// LoadObjWithOptions is LoadObj with control over how missing normals are generated, options may be nil
+func LoadObjWithOptions(path string, options *ObjLoadOptions) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	obj, err := parseObjFile(path, options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return obj.vertices, obj.uvs, obj.normals, nil
+
+}
+
+// LoadObjFrom is LoadObj for models that don't live on disk, such as embedded assets or files inside an archive
+func LoadObjFrom(reader io.Reader) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+	return LoadObjFromWithOptions(reader, nil)
+}
+
+// LoadObjFromWithOptions is LoadObjFrom with control over how missing normals are generated, options may be nil
+func LoadObjFromWithOptions(reader io.Reader, options *ObjLoadOptions) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	obj, err := parseObj(reader, "", options)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return obj.vertices, obj.uvs, obj.normals, nil
+
+}
+
+// LoadObjModel loads an OBJ file split into meshes by object, group and material, along with the materials of any
+// referenced material libraries
+func LoadObjModel(path string) (*ObjModel, error) {
+	return LoadObjModelWithOptions(path, nil)
+}
+
+// LoadObjModelWithOptions is LoadObjModel with control over how missing normals are generated, options may be nil
+func LoadObjModelWithOptions(path string, options *ObjLoadOptions) (*ObjModel, error) {
+
+	obj, err := parseObjFile(path, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj.model(func(library string) (map[string]*Material, error) {
+		return LoadMtl(filepath.Join(filepath.Dir(path), library))
+	}), nil
+
+}
+
+// LoadObjModelFrom is LoadObjModel for models that don't live on disk. The material libraries the model references
+// are opened by name with openLibrary, a nil openLibrary leaves every material at its defaults. options may be nil.
+func LoadObjModelFrom(reader io.Reader, openLibrary func(name string) (io.ReadCloser, error),
+	options *ObjLoadOptions) (*ObjModel, error) {
+
+	obj, err := parseObj(reader, "", options)
+	if err != nil {
+		return nil, err
+	}
+
+	if openLibrary == nil {
+		return obj.model(nil), nil
+	}
+
+	return obj.model(func(library string) (map[string]*Material, error) {
+
+		file, err := openLibrary(library)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return LoadMtlFrom(file)
+
+	}), nil
+
+}
+
+// model splits the parsed triangles into meshes with the materials loadLibrary loads, which may be nil
+func (obj *objParser) model(loadLibrary func(library string) (map[string]*Material, error)) *ObjModel {
+
+	model := &ObjModel{
+		Materials: make(map[string]*Material),
+	}
+
+	var libraries []string
+	if loadLibrary != nil {
+		libraries = obj.materialLibraries
+	}
+
+	for _, library := range libraries {
+
+		materials, err := loadLibrary(library)
+		if err != nil {
+			// Exporters often reference libraries that weren't shipped alongside the model, fall back to defaults
+			log.Warnf("Couldn't load material library %s: %v", library, err)
+			continue
+		}
+
+		for name, material := range materials {
+			model.Materials[name] = material
+		}
+
+	}
+
+	for i, meshRange := range obj.meshes {
+
+		end := len(obj.vertices)
+		if i+1 < len(obj.meshes) {
+			end = obj.meshes[i+1].start
+		}
+
+		mesh := &ObjMesh{
+			Object:   meshRange.object,
+			Group:    meshRange.group,
+			Vertices: obj.vertices[meshRange.start:end:end],
+			Uvs:      obj.uvs[meshRange.start:end:end],
+			Normals:  obj.normals[meshRange.start:end:end],
+		}
+
+		if meshRange.material != "" {
+			mesh.Material = model.Materials[meshRange.material]
+			if mesh.Material == nil {
+				mesh.Material = NewMaterial(meshRange.material)
+				model.Materials[meshRange.material] = mesh.Material
+			}
+		}
+
+		model.Meshes = append(model.Meshes, mesh)
+
+	}
+
+	return model
+
+}
+
+func parseObjFile(path string, options *ObjLoadOptions) (*objParser, error) {
 
 	file, err := os.Open(path)
 	if err != nil {
-		return nil, nil, nil, errors.New("Impossible to open the file!")
+		return nil, err
 	}
+	defer file.Close()
 
-	// Used in this method for parsing the normalized obj file
-	tmpVertices := make([]mgl32.Vec3, 0)
-	tmpUvs := make([]mgl32.Vec2, 0)
-	tmpNormals := make([]mgl32.Vec3, 0)
+	return parseObj(file, path, options)
 
-	// Denormalized vectors to be returned
-	vertices := make([]mgl32.Vec3, 0)
-	uvs := make([]mgl32.Vec2, 0)
-	normals := make([]mgl32.Vec3, 0)
+}
 
-	scanner := bufio.NewScanner(file)
+// parseObj parses an OBJ file read from reader, name is only used for error reporting
+func parseObj(reader io.Reader, name string, options *ObjLoadOptions) (*objParser, error) {
+
+	obj := &objParser{creaseAngle: NoCrease}
+	if options != nil && options.CreaseAngle > 0 {
+		obj.creaseAngle = options.CreaseAngle
+	}
+
+	var line string
+	var lineNumber, statementLine int
+
+	scanner := bufio.NewScanner(reader)
 	for scanner.Scan() {
 
-		buffer := bytes.NewBuffer(scanner.Bytes())
+		lineNumber++
+		if line == "" {
+			statementLine = lineNumber
+		}
 
-		lineHeader, err := buffer.ReadString(' ')
-		if err != nil {
-			// EOF, continue
+		// A trailing backslash continues the statement on the next line
+		text := scanner.Text()
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
 			continue
 		}
+		line += text
+
+		if err := obj.parseLine(line); err != nil {
+			return nil, objErrorAt(err, name, statementLine)
+		}
+		line = ""
+
+	}
+
+	// The line that couldn't be read, such as one longer than the scanner's buffer
+	if err := scanner.Err(); err != nil {
+		return nil, objErrorAt(&ObjError{Err: err}, name, lineNumber+1)
+	}
+
+	if err := obj.parseLine(line); err != nil {
+		return nil, objErrorAt(err, name, statementLine)
+	}
 
-		// Parse vertex
-		if lineHeader == "v " {
+	obj.generateMissingNormals()
 
-			var vertex mgl32.Vec3
-			fmt.Fscanf(buffer, "%g %g %g\n", &vertex[0], &vertex[1], &vertex[2])
-			tmpVertices = append(tmpVertices, vertex)
+	return obj, nil
 
-		} else if lineHeader == "vt " { // Parse UV
+}
+
+// objErrorAt fills in the location of an *ObjError returned by the line parsers
+func objErrorAt(err error, name string, line int) error {
+
+	if objErr, ok := err.(*ObjError); ok {
+		objErr.File = name
+		objErr.Line = line
+	}
+
+	return err
+
+}
 
-			var uv mgl32.Vec2
-			fmt.Fscanf(buffer, "%g %g\n", &uv[0], &uv[1])
-			tmpUvs = append(tmpUvs, uv)
+func (obj *objParser) parseLine(line string) error {
 
-		} else if lineHeader == "vn " { // Parse vector normal
+	// Strip comments
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
 
-			var normal mgl32.Vec3
-			fmt.Fscanf(buffer, "%g %g %g\n", &normal[0], &normal[1], &normal[2])
-			tmpNormals = append(tmpNormals, normal)
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
 
-		} else if lineHeader == "f " { // Parse faces
+	switch fields[0] {
 
-			vertexIndices := make([]int, 3)
-			uvIndices := make([]int, 3)
-			normalIndices := make([]int, 3)
+	case "v": // Parse vertex, the optional w component is ignored
 
-			matches, err := fmt.Fscanf(buffer, "%d/%d/%d %d/%d/%d %d/%d/%d\n",
-				&vertexIndices[0], &uvIndices[0], &normalIndices[0],
-				&vertexIndices[1], &uvIndices[1], &normalIndices[1],
-				&vertexIndices[2], &uvIndices[2], &normalIndices[2])
+		vertex, err := parseObjFloats(fields, 3, 3)
+		if err != nil {
+			return err
+		}
+		obj.tmpVertices = append(obj.tmpVertices, mgl32.Vec3{vertex[0], vertex[1], vertex[2]})
 
-			if matches != 9 || err != nil {
-				return nil, nil, nil, errors.New("File can't be read by our simple parser : ( Try exporting with other options\n")
+	case "vt": // Parse UV, v defaults to 0 and the optional w component is ignored
+
+		uv, err := parseObjFloats(fields, 1, 2)
+		if err != nil {
+			return err
+		}
+		obj.tmpUvs = append(obj.tmpUvs, mgl32.Vec2{uv[0], uv[1]})
+
+	case "vn": // Parse vector normal
+
+		normal, err := parseObjFloats(fields, 3, 3)
+		if err != nil {
+			return err
+		}
+		obj.tmpNormals = append(obj.tmpNormals, mgl32.Vec3{normal[0], normal[1], normal[2]})
+
+	case "o":
+
+		obj.state.object = strings.Join(fields[1:], " ")
+
+	case "g":
+
+		obj.state.group = strings.Join(fields[1:], " ")
+
+	case "usemtl":
+
+		obj.state.material = strings.Join(fields[1:], " ")
+
+	case "s":
+
+		if len(fields) < 2 {
+			return &ObjError{Token: line, Err: ErrObjNotEnoughData}
+		}
+
+		if fields[1] == "off" {
+			obj.smoothingGroup = 0
+		} else {
+			group, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return &ObjError{Token: fields[1], Err: ErrObjNumber}
 			}
+			obj.smoothingGroup = uint32(group)
+		}
+
+	case "mtllib":
+
+		obj.materialLibraries = append(obj.materialLibraries, fields[1:]...)
+
+	case "f": // Parse faces
+
+		if len(fields) < 4 {
+			return &ObjError{Token: strings.Join(fields, " "), Err: ErrObjNotEnoughData}
+		}
+
+		corners := make([]objCorner, len(fields)-1)
+		for i, field := range fields[1:] {
+			corner, err := obj.parseCorner(field)
+			if err != nil {
+				return err
+			}
+			corners[i] = corner
+		}
+
+		// Triangulate polygons as a fan around the first corner
+		for i := 1; i < len(corners)-1; i++ {
+			obj.addTriangle(corners[0], corners[i], corners[i+1])
+		}
+
+	}
 
-			vertices = append(vertices,
-				tmpVertices[vertexIndices[0]-1],
-				tmpVertices[vertexIndices[1]-1],
-				tmpVertices[vertexIndices[2]-1])
+	return nil
 
-			uvs = append(uvs,
-				tmpUvs[uvIndices[0]-1],
-				tmpUvs[uvIndices[1]-1],
-				tmpUvs[uvIndices[2]-1])
+}
+
+// parseCorner parses one of the v, v/vt, v//vn or v/vt/vn face index forms
+func (obj *objParser) parseCorner(field string) (objCorner, error) {
+
+	corner := objCorner{v: -1, vt: -1, vn: -1}
+
+	parts := strings.Split(field, "/")
+	if len(parts) > 3 || parts[0] == "" {
+		return corner, &ObjError{Token: field, Err: ErrObjSyntax}
+	}
+
+	var err error
+	if corner.v, err = resolveObjIndex(parts[0], len(obj.tmpVertices)); err != nil {
+		return corner, &ObjError{Token: field, Err: err}
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		if corner.vt, err = resolveObjIndex(parts[1], len(obj.tmpUvs)); err != nil {
+			return corner, &ObjError{Token: field, Err: err}
+		}
+	}
+
+	if len(parts) > 2 && parts[2] != "" {
+		if corner.vn, err = resolveObjIndex(parts[2], len(obj.tmpNormals)); err != nil {
+			return corner, &ObjError{Token: field, Err: err}
+		}
+	}
+
+	return corner, nil
 
-			normals = append(normals,
-				tmpNormals[normalIndices[0]-1],
-				tmpNormals[normalIndices[1]-1],
-				tmpNormals[normalIndices[2]-1])
+}
+
+func (obj *objParser) addTriangle(corners ...objCorner) {
+
+	if len(obj.meshes) == 0 || obj.meshes[len(obj.meshes)-1].objMeshState != obj.state {
+		obj.meshes = append(obj.meshes, objMeshRange{objMeshState: obj.state, start: len(obj.vertices)})
+	}
+
+	obj.smoothingGroups = append(obj.smoothingGroups, obj.smoothingGroup)
+
+	for _, corner := range corners {
+
+		obj.vertices = append(obj.vertices, obj.tmpVertices[corner.v])
 
+		if corner.vt >= 0 {
+			obj.uvs = append(obj.uvs, obj.tmpUvs[corner.vt])
+		} else {
+			obj.uvs = append(obj.uvs, mgl32.Vec2{})
 		}
 
+		if corner.vn >= 0 {
+			obj.normals = append(obj.normals, obj.tmpNormals[corner.vn])
+		} else {
+			obj.normals = append(obj.normals, mgl32.Vec3{})
+		}
+		obj.missingNormals = append(obj.missingNormals, corner.vn < 0)
+
+	}
+
+}
+
+// generateMissingNormals fills in the normals of vertices whose face didn't reference one, smoothing them according to
+// the s statements of the file
+func (obj *objParser) generateMissingNormals() {
+
+	var generated []mgl32.Vec3
+
+	for i, missing := range obj.missingNormals {
+
+		if !missing {
+			continue
+		}
+
+		if generated == nil {
+			generated = ComputeSmoothNormals(obj.vertices, obj.smoothingGroups, obj.creaseAngle)
+		}
+		obj.normals[i] = generated[i]
+
+	}
+
+}
+
+// resolveObjIndex converts a one based or negative (relative to the end of the pool) OBJ index to a zero based one
+func resolveObjIndex(field string, count int) (int, error) {
+
+	index, err := strconv.Atoi(field)
+	if err != nil {
+		return 0, ErrObjIndex
+	}
+
+	if index < 0 {
+		index += count
+	} else {
+		index--
+	}
+
+	if index < 0 || index >= count {
+		return 0, ErrObjIndexRange
+	}
+
+	return index, nil
+
+}
+
+// parseObjFloats parses between min and max floats following the statement keyword in fields[0], extra fields are
+// ignored and missing ones are 0
+func parseObjFloats(fields []string, min int, max int) ([]float32, error) {
+
+	if len(fields)-1 < min {
+		return nil, &ObjError{Token: strings.Join(fields, " "), Err: ErrObjNotEnoughData}
+	}
+
+	values := make([]float32, max)
+	for i := 0; i < max && i+1 < len(fields); i++ {
+		value, err := strconv.ParseFloat(fields[i+1], 32)
+		if err != nil {
+			return nil, &ObjError{Token: fields[i+1], Err: ErrObjNumber}
+		}
+		values[i] = float32(value)
 	}
 
-	return vertices, uvs, normals, nil
+	return values, nil
 
 }
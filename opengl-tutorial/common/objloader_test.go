@@ -0,0 +1,292 @@
+package common
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestLoadObjTutorialModels(t *testing.T) {
+
+	// Vertex counts and SHA-256 hashes of the vertex, uv and normal streams the tutorials got from LoadObj before it
+	// took quads, n-gons, negative indices and missing vt/vn
+	tests := []struct {
+		path     string
+		vertices int
+		hash     string
+	}{
+		{"../07-model-loading/cube.obj", 36, "b054d00370605779290c4b2211fe8829bbb6a8cffa19b276560974e8affdeaa8"},
+		{"../08-basic-shading/suzanne.obj", 2904, "79ac985265b4d9c47d79662935a2ef8394f37b01f82446bfdd08da01e4d7171c"},
+	}
+
+	for _, test := range tests {
+
+		vertices, uvs, normals, err := LoadObj(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vertices) != test.vertices || len(uvs) != test.vertices || len(normals) != test.vertices {
+			t.Errorf("%s: %d vertices, %d uvs and %d normals, want %d of each", test.path, len(vertices), len(uvs),
+				len(normals), test.vertices)
+		}
+
+		hash := sha256.New()
+		binary.Write(hash, binary.LittleEndian, vertices)
+		binary.Write(hash, binary.LittleEndian, uvs)
+		binary.Write(hash, binary.LittleEndian, normals)
+		if sum := fmt.Sprintf("%x", hash.Sum(nil)); sum != test.hash {
+			t.Errorf("%s: streams hash to %s, want %s", test.path, sum, test.hash)
+		}
+
+	}
+
+}
+
+const objSquare = "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\n"
+
+func TestLoadObjFrom(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		source   string
+		vertices []mgl32.Vec3
+		uvs      []mgl32.Vec2
+		normals  []mgl32.Vec3
+	}{
+		{
+			name:     "quad",
+			source:   objSquare + "f 1 2 3 4\n",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+		},
+		{
+			name:   "n-gon",
+			source: objSquare + "v -1 1 0\nf 1 2 3 4 5\n",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 0, 0}, {1, 1, 0}, {0, 1, 0},
+				{0, 0, 0}, {0, 1, 0}, {-1, 1, 0}},
+		},
+		{
+			name:     "negative indices",
+			source:   objSquare + "vt 0.5 0.25\nvn 0 0 -1\nf -3/-1/-1 -2/-1/-1 -1/-1/-1\n",
+			vertices: []mgl32.Vec3{{1, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+			uvs:      []mgl32.Vec2{{0.5, 0.25}, {0.5, 0.25}, {0.5, 0.25}},
+			normals:  []mgl32.Vec3{{0, 0, -1}, {0, 0, -1}, {0, 0, -1}},
+		},
+		{
+			name:     "position and normal",
+			source:   objSquare + "vn 0 0 -1\nf 1//1 2//1 3//1\n",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+			uvs:      []mgl32.Vec2{{}, {}, {}},
+			normals:  []mgl32.Vec3{{0, 0, -1}, {0, 0, -1}, {0, 0, -1}},
+		},
+		{
+			name:     "position and uv",
+			source:   objSquare + "vt 0.5 0.25\nvt 1\nf 1/1 2/2 3/1\n",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+			uvs:      []mgl32.Vec2{{0.5, 0.25}, {1, 0}, {0.5, 0.25}},
+			normals:  []mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+		},
+		{
+			name:     "CRLF and blank lines",
+			source:   "# square\r\n\r\nv 0 0 0\r\nv 1 0 0\r\n\r\n  \r\nv 1 1 0\r\nf 1 2 3\r\n\r\n",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+		},
+		{
+			name:     "no newline at the end",
+			source:   objSquare + "f 1 2 3",
+			vertices: []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+		},
+	}
+
+	for _, test := range tests {
+
+		vertices, uvs, normals, err := LoadObjFrom(strings.NewReader(test.source))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if !equalVec3s(vertices, test.vertices) {
+			t.Errorf("%s: vertices %v, want %v", test.name, vertices, test.vertices)
+		}
+		if test.uvs != nil && !equalVec2s(uvs, test.uvs) {
+			t.Errorf("%s: uvs %v, want %v", test.name, uvs, test.uvs)
+		}
+		if test.normals != nil && !equalVec3s(normals, test.normals) {
+			t.Errorf("%s: normals %v, want %v", test.name, normals, test.normals)
+		}
+		if len(uvs) != len(vertices) || len(normals) != len(vertices) {
+			t.Errorf("%s: %d vertices with %d uvs and %d normals", test.name, len(vertices), len(uvs), len(normals))
+		}
+
+	}
+
+}
+
+func TestLoadObjFromErrors(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		source string
+		err    error
+		line   int
+		token  string
+	}{
+		{"vertex past the end", objSquare + "f 1 2 5\n", ErrObjIndexRange, 5, "5"},
+		{"zero index", objSquare + "\nf 0 1 2\n", ErrObjIndexRange, 6, "0"},
+		{"negative index past the start", objSquare + "f -5 1 2\n", ErrObjIndexRange, 5, "-5"},
+		{"uv past the end", objSquare + "vt 0 0\nf 1/1 2/2 3/1\n", ErrObjIndexRange, 6, "2/2"},
+		{"normal past the end", objSquare + "f 1//1 2//1 3//1\n", ErrObjIndexRange, 5, "1//1"},
+		{"index that isn't a number", objSquare + "f 1 2 x\n", ErrObjIndex, 5, "x"},
+		{"too many slashes", objSquare + "f 1/1/1/1 2 3\n", ErrObjSyntax, 5, "1/1/1/1"},
+		{"two corners", objSquare + "f 1 2\n", ErrObjNotEnoughData, 5, "f 1 2"},
+		{"vertex that isn't a number", "v 0 0 0\r\nv 1 nope 0\r\n", ErrObjNumber, 2, "nope"},
+		{"line too long", objSquare + "# " + strings.Repeat("x", bufio.MaxScanTokenSize), bufio.ErrTooLong, 5, ""},
+	}
+
+	for _, test := range tests {
+
+		_, _, _, err := LoadObjFrom(strings.NewReader(test.source))
+
+		var objErr *ObjError
+		if !errors.As(err, &objErr) {
+			t.Errorf("%s: error %v isn't an *ObjError", test.name, err)
+			continue
+		}
+		if !errors.Is(err, test.err) || objErr.Line != test.line || objErr.Token != test.token {
+			t.Errorf("%s: %v at line %d on %q, want %v at line %d on %q", test.name, objErr.Err, objErr.Line,
+				objErr.Token, test.err, test.line, test.token)
+		}
+
+	}
+
+}
+
+func TestLoadObjCreaseAngle(t *testing.T) {
+
+	// The front and bottom faces of a cube meeting at a right angle in one smoothing group
+	path := filepath.Join(t.TempDir(), "corner.obj")
+	source := "v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nv 0 0 -1\nv 1 0 -1\ns 1\nf 1 2 3 4\nf 5 6 2 1\n"
+	if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		options *ObjLoadOptions
+		normal  mgl32.Vec3
+	}{
+		{nil, mgl32.Vec3{0, -1, 1}.Normalize()},
+		{&ObjLoadOptions{CreaseAngle: math.Pi / 4}, mgl32.Vec3{0, 0, 1}},
+		{&ObjLoadOptions{CreaseAngle: math.Pi * 3 / 4}, mgl32.Vec3{0, -1, 1}.Normalize()},
+	}
+
+	for _, test := range tests {
+
+		vertices, _, normals, err := LoadObjWithOptions(path, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The first corner of the front face is on the shared edge
+		if vertices[0] != (mgl32.Vec3{0, 0, 0}) || !normals[0].ApproxEqualThreshold(test.normal, 1e-5) {
+			t.Errorf("Options %+v: normal %v at %v, want %v", test.options, normals[0], vertices[0], test.normal)
+		}
+
+	}
+
+	_, _, normals, err := LoadObjFromWithOptions(strings.NewReader(source), &ObjLoadOptions{CreaseAngle: math.Pi / 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !normals[0].ApproxEqualThreshold(mgl32.Vec3{0, 0, 1}, 1e-5) {
+		t.Errorf("LoadObjFromWithOptions normal %v, want %v", normals[0], mgl32.Vec3{0, 0, 1})
+	}
+
+	model, err := LoadObjModelWithOptions(path, &ObjLoadOptions{CreaseAngle: math.Pi / 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if normal := model.Meshes[0].Normals[0]; !normal.ApproxEqualThreshold(mgl32.Vec3{0, 0, 1}, 1e-5) {
+		t.Errorf("LoadObjModelWithOptions normal %v, want %v", normal, mgl32.Vec3{0, 0, 1})
+	}
+
+}
+
+func TestLoadObjModelFrom(t *testing.T) {
+
+	libraries := map[string]string{"test.mtl": "newmtl red\nKd 1 0 0\nmap_Kd textures/red.png\n"}
+	openLibrary := func(name string) (io.ReadCloser, error) {
+		library, ok := libraries[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return ioutil.NopCloser(strings.NewReader(library)), nil
+	}
+	source := objSquare + "mtllib test.mtl missing.mtl\nusemtl red\nf 1 2 3\nusemtl blue\nf 1 3 4\n"
+
+	model, err := LoadObjModelFrom(strings.NewReader(source), openLibrary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.Meshes) != 2 || model.Meshes[0].Material.Diffuse != (mgl32.Vec3{1, 0, 0}) ||
+		model.Meshes[1].Material.Name != "blue" {
+		t.Fatalf("Loaded meshes %v", model.Meshes)
+	}
+
+	// Texture paths stay as the library gives them
+	if want := filepath.FromSlash("textures/red.png"); model.Meshes[0].Material.DiffuseMap != want {
+		t.Errorf("Diffuse map %q, want %q", model.Meshes[0].Material.DiffuseMap, want)
+	}
+
+	// Without a way to open the libraries every material has the defaults
+	model, err = LoadObjModelFrom(strings.NewReader(source), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *model.Meshes[0].Material != *NewMaterial("red") {
+		t.Errorf("Loaded %+v without libraries", model.Meshes[0].Material)
+	}
+
+}
+
+func equalVec3s(a []mgl32.Vec3, b []mgl32.Vec3) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].ApproxEqual(b[i]) {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+func equalVec2s(a []mgl32.Vec2, b []mgl32.Vec2) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].ApproxEqual(b[i]) {
+			return false
+		}
+	}
+
+	return true
+
+}
@@ -0,0 +1,188 @@
+package common
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+var (
+	ErrObjGroupRange     = errors.New("Group outside of the mesh")
+	ErrObjAttributeCount = errors.New("Attribute counts differ")
+)
+
+// ObjGroup names a run of Count triangles starting at triangle Start, and optionally the material they use. OBJ can't
+// unset a material so groups without one keep the material of the group before them. Groups without a name go back to
+// OBJ's default group rather than carrying on the name of the group before them.
+type ObjGroup struct {
+	Name     string
+	Material string
+	Start    int
+	Count    int
+}
+
+type ObjWriteOptions struct {
+	// MaterialLibrary is written as an mtllib statement when set
+	MaterialLibrary string
+
+	// Triangles outside of every group are written before the first group, triangles in several groups are only
+	// written in the first of them
+	Groups []ObjGroup
+}
+
+func SaveObj(path string, indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3,
+	options *ObjWriteOptions) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteObj(file, indices, vertices, uvs, normals, options); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
+
+// WriteObj writes an indexed triangle list such as IndexVBO's output as an OBJ file LoadObj reads back unchanged.
+// Positions, uvs and normals each go in their own pool without duplicates, uvs and normals are left out when nil and
+// options may be nil.
+func WriteObj(writer io.Writer, indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3,
+	options *ObjWriteOptions) error {
+
+	if (uvs != nil && len(uvs) != len(vertices)) || (normals != nil && len(normals) != len(vertices)) {
+		return ErrObjAttributeCount
+	}
+
+	if options == nil {
+		options = &ObjWriteOptions{}
+	}
+
+	triangleCount := len(indices) / 3
+	for _, group := range options.Groups {
+		if group.Start < 0 || group.Count < 0 || group.Start+group.Count > triangleCount {
+			return ErrObjGroupRange
+		}
+	}
+
+	for _, index := range indices {
+		if int(index) >= len(vertices) {
+			return ErrObjIndexRange
+		}
+	}
+
+	output := bufio.NewWriter(writer)
+	formatFloat := func(value float32) string {
+		return strconv.FormatFloat(float64(value), 'g', -1, 32)
+	}
+
+	if options.MaterialLibrary != "" {
+		fmt.Fprintf(output, "mtllib %s\n", options.MaterialLibrary)
+	}
+
+	// One based index of every vertex's position, uv and normal in the pools
+	positionIndices := make([]int, len(vertices))
+	positions := make(map[mgl32.Vec3]int)
+	for i, vertex := range vertices {
+		if positionIndices[i] = positions[vertex]; positionIndices[i] == 0 {
+			positionIndices[i] = len(positions) + 1
+			positions[vertex] = positionIndices[i]
+			fmt.Fprintf(output, "v %s %s %s\n", formatFloat(vertex[0]), formatFloat(vertex[1]), formatFloat(vertex[2]))
+		}
+	}
+
+	var uvIndices []int
+	if uvs != nil {
+		uvIndices = make([]int, len(uvs))
+		pool := make(map[mgl32.Vec2]int)
+		for i, uv := range uvs {
+			if uvIndices[i] = pool[uv]; uvIndices[i] == 0 {
+				uvIndices[i] = len(pool) + 1
+				pool[uv] = uvIndices[i]
+				fmt.Fprintf(output, "vt %s %s\n", formatFloat(uv[0]), formatFloat(uv[1]))
+			}
+		}
+	}
+
+	var normalIndices []int
+	if normals != nil {
+		normalIndices = make([]int, len(normals))
+		pool := make(map[mgl32.Vec3]int)
+		for i, normal := range normals {
+			if normalIndices[i] = pool[normal]; normalIndices[i] == 0 {
+				normalIndices[i] = len(pool) + 1
+				pool[normal] = normalIndices[i]
+				fmt.Fprintf(output, "vn %s %s %s\n", formatFloat(normal[0]), formatFloat(normal[1]),
+					formatFloat(normal[2]))
+			}
+		}
+	}
+
+	writeTriangle := func(t int) {
+
+		output.WriteString("f")
+		for _, index := range indices[t*3 : t*3+3] {
+
+			fmt.Fprintf(output, " %d", positionIndices[index])
+			switch {
+			case uvIndices != nil && normalIndices != nil:
+				fmt.Fprintf(output, "/%d/%d", uvIndices[index], normalIndices[index])
+			case uvIndices != nil:
+				fmt.Fprintf(output, "/%d", uvIndices[index])
+			case normalIndices != nil:
+				fmt.Fprintf(output, "//%d", normalIndices[index])
+			}
+
+		}
+		output.WriteString("\n")
+
+	}
+
+	// Group each triangle is written in, the first one it's in when groups overlap and -1 when it's in none
+	owners := make([]int, triangleCount)
+	for t := range owners {
+		owners[t] = -1
+	}
+	for g, group := range options.Groups {
+		for t := group.Start; t < group.Start+group.Count; t++ {
+			if owners[t] < 0 {
+				owners[t] = g
+			}
+		}
+	}
+
+	for t, owner := range owners {
+		if owner < 0 {
+			writeTriangle(t)
+		}
+	}
+
+	for g, group := range options.Groups {
+
+		if group.Name != "" {
+			fmt.Fprintf(output, "g %s\n", group.Name)
+		} else {
+			output.WriteString("g\n")
+		}
+		if group.Material != "" {
+			fmt.Fprintf(output, "usemtl %s\n", group.Material)
+		}
+		for t := group.Start; t < group.Start+group.Count; t++ {
+			if owners[t] == g {
+				writeTriangle(t)
+			}
+		}
+
+	}
+
+	return output.Flush()
+
+}
@@ -0,0 +1,162 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestWriteObjRoundTrip(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+
+	tests := []struct {
+		name    string
+		uvs     []mgl32.Vec2
+		normals []mgl32.Vec3
+	}{
+		{"positions", nil, nil},
+		{"uvs", uvs, nil},
+		{"normals", nil, normals},
+		{"uvs and normals", uvs, normals},
+	}
+
+	for _, test := range tests {
+
+		var buffer bytes.Buffer
+		if err := WriteObj(&buffer, indices, vertices, test.uvs, test.normals, nil); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		readVertices, readUvs, readNormals, err := LoadObjFrom(&buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if len(readVertices) != len(indices) {
+			t.Fatalf("%s: read %d vertices for %d corners", test.name, len(readVertices), len(indices))
+		}
+
+		// Without uvs LoadObj fills in zeros and without normals it generates them, so only compare what was written
+		for i, index := range indices {
+			if readVertices[i] != vertices[index] || (test.uvs != nil && readUvs[i] != uvs[index]) ||
+				(test.normals != nil && readNormals[i] != normals[index]) {
+				t.Fatalf("%s: corner %d read as %v %v %v, want %v %v %v", test.name, i, readVertices[i], readUvs[i],
+					readNormals[i], vertices[index], uvs[index], normals[index])
+			}
+		}
+
+	}
+
+}
+
+func TestWriteObjGroups(t *testing.T) {
+
+	// Four triangles along X, each with its own vertices so they're easy to tell apart
+	var indices []uint32
+	var vertices []mgl32.Vec3
+	for i := 0; i < 4; i++ {
+		x := float32(i)
+		vertices = append(vertices, mgl32.Vec3{x, 0, 0}, mgl32.Vec3{x + 1, 0, 0}, mgl32.Vec3{x, 1, 0})
+		indices = append(indices, uint32(i*3), uint32(i*3+1), uint32(i*3+2))
+	}
+
+	// The groups overlap on the second triangle and leave the last out
+	options := &ObjWriteOptions{
+		MaterialLibrary: "materials.mtl",
+		Groups: []ObjGroup{
+			{Name: "first", Material: "red", Start: 0, Count: 2},
+			{Name: "second", Material: "blue", Start: 1, Count: 2},
+		},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteObj(&buffer, indices, vertices, nil, nil, options); err != nil {
+		t.Fatal(err)
+	}
+	written := buffer.String()
+
+	if faces := strings.Count(written, "\nf "); faces != 4 {
+		t.Errorf("Wrote %d faces for 4 triangles:\n%s", faces, written)
+	}
+	for _, line := range []string{"mtllib materials.mtl\n", "g first\nusemtl red\n", "g second\nusemtl blue\n"} {
+		if !strings.Contains(written, line) {
+			t.Errorf("%q missing from:\n%s", line, written)
+		}
+	}
+
+	readVertices, _, _, err := LoadObjFrom(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ungrouped triangles come first, then each group's in order
+	for i, triangle := range []int{3, 0, 1, 2} {
+		if want := vertices[triangle*3 : triangle*3+3]; !equalVec3s(readVertices[i*3:i*3+3], want) {
+			t.Errorf("Triangle %d read as %v, want %v", i, readVertices[i*3:i*3+3], want)
+		}
+	}
+
+	options.Groups = append(options.Groups, ObjGroup{Start: 3, Count: 2})
+	if err := WriteObj(&buffer, indices, vertices, nil, nil, options); err != ErrObjGroupRange {
+		t.Errorf("Group past the last triangle gave error %v", err)
+	}
+
+}
+
+func TestWriteObjUnnamedGroup(t *testing.T) {
+
+	vertices := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}}
+	indices := []uint32{0, 1, 2, 2, 1, 3}
+
+	// The second group only switches material, it mustn't end up in the first group
+	options := &ObjWriteOptions{
+		Groups: []ObjGroup{
+			{Name: "named", Material: "red", Start: 0, Count: 1},
+			{Material: "blue", Start: 1, Count: 1},
+		},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteObj(&buffer, indices, vertices, nil, nil, options); err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := LoadObjModelFrom(&buffer, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(model.Meshes) != 2 {
+		t.Fatalf("Read %d meshes, want 2", len(model.Meshes))
+	}
+	for i, want := range []string{"named", ""} {
+		if model.Meshes[i].Group != want {
+			t.Errorf("Mesh %d is in group %q, want %q", i, model.Meshes[i].Group, want)
+		}
+	}
+
+}
+
+func TestWriteObjAttributeCount(t *testing.T) {
+
+	vertices := make([]mgl32.Vec3, 3)
+	indices := []uint32{0, 1, 2}
+
+	tests := []struct {
+		name    string
+		uvs     []mgl32.Vec2
+		normals []mgl32.Vec3
+	}{
+		{"short uvs", make([]mgl32.Vec2, 2), nil},
+		{"long normals", nil, make([]mgl32.Vec3, 4)},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		if err := WriteObj(&buffer, indices, vertices, test.uvs, test.normals, nil); err != ErrObjAttributeCount {
+			t.Errorf("%s: error %v, want %v", test.name, err, ErrObjAttributeCount)
+		}
+	}
+
+}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"math"
+
+	"github.com/go-gl/glfw/v3.1/glfw"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Viewport is the rectangle of the window drawn to, as passed to gl.Viewport
+type Viewport struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Unproject maps a point in window coordinates back into world space. Window coordinates count up from the bottom left
+// like gl.Viewport's, and depth is 0 on the near plane and 1 on the far one.
+func Unproject(point mgl32.Vec3, viewport Viewport, projection mgl32.Mat4, view mgl32.Mat4) (mgl32.Vec3, error) {
+	return mgl32.UnProject(point, view, projection, viewport.X, viewport.Y, viewport.Width, viewport.Height)
+}
+
+// RayFromCursor returns the world space ray through a cursor position as glfw reports it, measured down from the top
+// left of a window windowHeight high. The ray starts on the near plane and its direction is a unit vector.
+func RayFromCursor(cursorX float64, cursorY float64, windowHeight int, viewport Viewport, projection mgl32.Mat4,
+	view mgl32.Mat4) (mgl32.Vec3, mgl32.Vec3, error) {
+
+	point := mgl32.Vec3{float32(cursorX), float32(float64(windowHeight) - cursorY), 0}
+
+	near, err := Unproject(point, viewport, projection, view)
+	if err != nil {
+		return mgl32.Vec3{}, mgl32.Vec3{}, err
+	}
+
+	point[2] = 1
+	far, err := Unproject(point, viewport, projection, view)
+	if err != nil {
+		return mgl32.Vec3{}, mgl32.Vec3{}, err
+	}
+
+	return near, far.Sub(near).Normalize(), nil
+
+}
+
+// GetCursorRay is the ray under the cursor of the current window, using the matrices from the last call to
+// ComputeMatricesFromInputs and a viewport covering the whole window
+func GetCursorRay() (mgl32.Vec3, mgl32.Vec3, error) {
+
+	window := glfw.GetCurrentContext()
+	cursorX, cursorY := window.GetCursorPos()
+	width, height := window.GetSize()
+
+	return RayFromCursor(cursorX, cursorY, height, Viewport{Width: width, Height: height}, projectionMatrix,
+		viewMatrix)
+
+}
+
+// Pickable is an object in the scene that can be selected. Bounds and Mesh are in model space and Model places them in
+// the world, it must be set even if only to mgl32.Ident4() and can be changed between picks. Objects with a Mesh are
+// hit where the ray meets a triangle and Bounds is ignored, others are hit wherever the ray enters Bounds.
+type Pickable struct {
+	Model  mgl32.Mat4
+	Bounds AABB
+	Mesh   *BVH
+
+	// Value is whatever the caller wants back when the object is picked
+	Value interface{}
+}
+
+// Pick is what a ray hit. Triangle, U and V are only set for objects with a mesh.
+type Pick struct {
+	Object *Pickable
+	RayHit
+}
+
+// Picker finds the registered object closest along a ray
+type Picker struct {
+	objects []*Pickable
+}
+
+func (picker *Picker) Register(object *Pickable) {
+	picker.objects = append(picker.objects, object)
+}
+
+func (picker *Picker) Unregister(object *Pickable) {
+
+	for i, registered := range picker.objects {
+		if registered == object {
+			picker.objects = append(picker.objects[:i], picker.objects[i+1:]...)
+			return
+		}
+	}
+
+}
+
+// Pick casts a world space ray against every registered object, Distance in the result is in multiples of the
+// direction's length
+func (picker *Picker) Pick(origin mgl32.Vec3, direction mgl32.Vec3) (Pick, bool) {
+
+	closest := Pick{RayHit: RayHit{Triangle: -1, Distance: float32(math.Inf(1))}}
+
+	for _, object := range picker.objects {
+
+		bounds := object.Bounds
+		if object.Mesh != nil {
+			bounds = object.Mesh.Bounds()
+		}
+
+		// Moving the ray into model space keeps distances along it the same as in world space
+		inverse := object.Model.Inv()
+		modelOrigin := mgl32.TransformCoordinate(origin, inverse)
+		modelDirection := mgl32.TransformNormal(direction, inverse)
+
+		distance, hit := bounds.IntersectRay(modelOrigin, modelDirection)
+		if !hit || distance >= closest.Distance {
+			continue
+		}
+
+		if object.Mesh == nil {
+			closest = Pick{Object: object, RayHit: RayHit{Triangle: -1, Distance: distance}}
+			continue
+		}
+
+		if meshHit, hit := object.Mesh.Intersect(modelOrigin, modelDirection, closest.Distance); hit {
+			closest = Pick{Object: object, RayHit: meshHit}
+		}
+
+	}
+
+	return closest, closest.Object != nil
+
+}
+
+// PickCursor picks the object under the cursor of the current window
+func (picker *Picker) PickCursor() (Pick, bool) {
+
+	origin, direction, err := GetCursorRay()
+	if err != nil {
+		return Pick{}, false
+	}
+
+	return picker.Pick(origin, direction)
+
+}
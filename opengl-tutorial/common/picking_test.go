@@ -0,0 +1,242 @@
+package common
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestRayFromCursor(t *testing.T) {
+
+	fov := mgl32.DegToRad(45)
+	projection := mgl32.Perspective(fov, 4.0/3.0, 0.1, 100)
+	eye := mgl32.Vec3{3, 2, 5}
+	view := mgl32.LookAtV(eye, mgl32.Vec3{}, mgl32.Vec3{0, 1, 0})
+	forward := eye.Mul(-1).Normalize()
+
+	window := Viewport{Width: 800, Height: 600}
+
+	// Through the middle of the window the ray is the camera's forward, from the near plane
+	origin, direction, err := RayFromCursor(400, 300, 600, window, projection, view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nearVec3(direction, forward, 1e-4) {
+		t.Errorf("Center ray direction %v, want %v", direction, forward)
+	}
+	if want := eye.Add(forward.Mul(0.1)); !nearVec3(origin, want, 1e-4) {
+		t.Errorf("Center ray origin %v, want %v", origin, want)
+	}
+
+	// A viewport over the right half of the window has its middle under the cursor three quarters across
+	_, direction, err = RayFromCursor(600, 300, 600, Viewport{X: 400, Width: 400, Height: 600},
+		mgl32.Perspective(fov, 400.0/600.0, 0.1, 100), view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nearVec3(direction, forward, 1e-4) {
+		t.Errorf("Center ray of a viewport %v, want %v", direction, forward)
+	}
+
+	// From the origin looking down -Z the edges of the window are tan(fov/2) off the axis, with glfw's y counting down
+	// from the top
+	view = mgl32.LookAt(0, 0, 0, 0, 0, -1, 0, 1, 0)
+	slope := float32(math.Tan(float64(fov) / 2))
+
+	tests := []struct {
+		name             string
+		cursorX, cursorY float64
+		slopeX, slopeY   float32
+	}{
+		{"top", 400, 0, 0, slope},
+		{"bottom", 400, 600, 0, -slope},
+		{"left", 0, 300, -slope * 4 / 3, 0},
+		{"right", 800, 300, slope * 4 / 3, 0},
+		{"top left", 0, 0, -slope * 4 / 3, slope},
+	}
+
+	for _, test := range tests {
+
+		_, direction, err := RayFromCursor(test.cursorX, test.cursorY, 600, window, projection, view)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if math.Abs(float64(direction.Len())-1) > 1e-5 {
+			t.Errorf("%s: direction %v isn't a unit vector", test.name, direction)
+		}
+		slopeX, slopeY := direction.X()/-direction.Z(), direction.Y()/-direction.Z()
+		if math.Abs(float64(slopeX-test.slopeX)) > 1e-4 || math.Abs(float64(slopeY-test.slopeY)) > 1e-4 {
+			t.Errorf("%s: direction %v has slopes %v, %v, want %v, %v", test.name, direction, slopeX, slopeY,
+				test.slopeX, test.slopeY)
+		}
+
+	}
+
+}
+
+func TestUnproject(t *testing.T) {
+
+	projection := mgl32.Perspective(mgl32.DegToRad(60), 2, 1, 50)
+	view := mgl32.LookAt(-4, 3, 6, 1, 0, -2, 0, 1, 0)
+	viewport := Viewport{X: 100, Y: 50, Width: 640, Height: 320}
+
+	points := []mgl32.Vec3{{1, 0, -2}, {0, 0, 0}, {-2, 1.5, -10}, {3, -1, 2}}
+
+	for _, point := range points {
+
+		window := mgl32.Project(point, view, projection, viewport.X, viewport.Y, viewport.Width, viewport.Height)
+		unprojected, err := Unproject(window, viewport, projection, view)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !nearVec3(unprojected, point, 1e-3) {
+			t.Errorf("%v went to %v in the window and back to %v", point, window, unprojected)
+		}
+
+	}
+
+	// The middle of the viewport at depth 0 and 1 is on the near and far planes straight ahead of the camera
+	eye := mgl32.Vec3{-4, 3, 6}
+	forward := mgl32.Vec3{1, 0, -2}.Sub(eye).Normalize()
+	for depth, distance := range []float32{1, 50} {
+
+		center := mgl32.Vec3{100 + 320, 50 + 160, float32(depth)}
+		unprojected, err := Unproject(center, viewport, projection, view)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := eye.Add(forward.Mul(distance)); !nearVec3(unprojected, want, 1e-3*distance) {
+			t.Errorf("Depth %d unprojected to %v, want %v", depth, unprojected, want)
+		}
+
+	}
+
+	if _, err := Unproject(mgl32.Vec3{}, viewport, mgl32.Mat4{}, view); err == nil {
+		t.Errorf("Unprojecting through a singular matrix gave no error")
+	}
+
+}
+
+// pickingQuad is a unit square in the XY plane facing +Z, as two triangles
+func pickingQuad() *BVH {
+
+	vertices := []mgl32.Vec3{{-0.5, -0.5, 0}, {0.5, -0.5, 0}, {0.5, 0.5, 0}, {-0.5, 0.5, 0}}
+	return NewBVH([]uint32{0, 1, 2, 0, 2, 3}, vertices)
+
+}
+
+func TestPick(t *testing.T) {
+
+	box := AABB{Min: mgl32.Vec3{-0.5, -0.5, -0.5}, Max: mgl32.Vec3{0.5, 0.5, 0.5}}
+	origin, direction := mgl32.Vec3{}, mgl32.Vec3{0, 0, -1}
+
+	// Boxes one behind the other, the far one big enough to cover the near one from the camera
+	near := &Pickable{Model: mgl32.Translate3D(0, 0, -5), Bounds: box, Value: "near"}
+	far := &Pickable{Model: mgl32.Translate3D(0, 0, -10).Mul4(mgl32.Scale3D(4, 4, 4)), Bounds: box, Value: "far"}
+
+	// The same quads doubled in size and turned about Y and Z, so only the model matrix places them
+	turn := mgl32.HomogRotate3DY(mgl32.DegToRad(30)).Mul4(mgl32.HomogRotate3DZ(mgl32.DegToRad(45)))
+	nearMesh := &Pickable{Model: mgl32.Translate3D(0, 0, -3).Mul4(turn).Mul4(mgl32.Scale3D(2, 2, 2)),
+		Mesh: pickingQuad(), Value: "near mesh"}
+	farMesh := &Pickable{Model: mgl32.Translate3D(0, 0, -6).Mul4(turn).Mul4(mgl32.Scale3D(2, 2, 2)),
+		Mesh: pickingQuad(), Value: "far mesh"}
+
+	tests := []struct {
+		name     string
+		objects  []*Pickable
+		want     *Pickable
+		distance float32
+	}{
+		{"bounds, far registered first", []*Pickable{far, near}, near, 4.5},
+		{"bounds, near registered first", []*Pickable{near, far}, near, 4.5},
+		{"meshes, far registered first", []*Pickable{farMesh, nearMesh}, nearMesh, 3},
+		{"meshes, near registered first", []*Pickable{nearMesh, farMesh}, nearMesh, 3},
+		{"mesh in front of bounds", []*Pickable{far, near, farMesh, nearMesh}, nearMesh, 3},
+		{"bounds in front of a mesh", []*Pickable{farMesh, near}, near, 4.5},
+	}
+
+	for _, test := range tests {
+
+		picker := &Picker{}
+		for _, object := range test.objects {
+			picker.Register(object)
+		}
+
+		pick, hit := picker.Pick(origin, direction)
+		if !hit || pick.Object != test.want {
+			t.Errorf("%s: picked %v, %v, want %v", test.name, pick.Object, hit, test.want.Value)
+			continue
+		}
+
+		if math.Abs(float64(pick.Distance-test.distance)) > 1e-4 {
+			t.Errorf("%s: hit at %v, want %v", test.name, pick.Distance, test.distance)
+		}
+
+		if hasMesh := test.want.Mesh != nil; (pick.Triangle >= 0) != hasMesh {
+			t.Errorf("%s: triangle %d for an object with a mesh %v", test.name, pick.Triangle, hasMesh)
+		}
+
+	}
+
+	picker := &Picker{}
+	picker.Register(nearMesh)
+	if _, hit := picker.Pick(origin, mgl32.Vec3{0, 0, 1}); hit {
+		t.Errorf("Ray away from every object hit")
+	}
+
+	// The ray passes through the triangle's bounds but not the triangle, so it has to go on to the box behind
+	triangle := &Pickable{Model: mgl32.Translate3D(-0.9, -0.9, -2),
+		Mesh: NewBVH([]uint32{0, 1, 2}, []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}})}
+	picker = &Picker{}
+	picker.Register(triangle)
+	picker.Register(near)
+	if pick, hit := picker.Pick(origin, direction); !hit || pick.Object != near {
+		t.Errorf("Ray through the bounds of a missed triangle picked %v, %v", pick.Object, hit)
+	}
+
+}
+
+func TestPickerUnregister(t *testing.T) {
+
+	box := AABB{Min: mgl32.Vec3{-0.5, -0.5, -0.5}, Max: mgl32.Vec3{0.5, 0.5, 0.5}}
+	first := &Pickable{Model: mgl32.Translate3D(0, 0, -2), Bounds: box}
+	second := &Pickable{Model: mgl32.Translate3D(0, 0, -4), Bounds: box}
+	third := &Pickable{Model: mgl32.Translate3D(0, 0, -6), Bounds: box}
+
+	picker := &Picker{}
+	picker.Register(first)
+	picker.Register(second)
+	picker.Register(third)
+
+	pickAhead := func() *Pickable {
+		pick, _ := picker.Pick(mgl32.Vec3{}, mgl32.Vec3{0, 0, -1})
+		return pick.Object
+	}
+
+	// Unregistering an object that was never registered changes nothing
+	picker.Unregister(&Pickable{Model: mgl32.Ident4(), Bounds: box})
+	if picked := pickAhead(); picked != first {
+		t.Errorf("Picked %p, want the first object %p", picked, first)
+	}
+
+	for _, step := range []struct {
+		remove *Pickable
+		want   *Pickable
+	}{
+		{first, second},
+		{third, second},
+		{second, nil},
+	} {
+
+		picker.Unregister(step.remove)
+		if picked := pickAhead(); picked != step.want {
+			t.Errorf("After unregistering %p picked %p, want %p", step.remove, picked, step.want)
+		}
+
+	}
+
+}
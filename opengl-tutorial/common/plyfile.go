@@ -0,0 +1,550 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type PlyFormat int
+
+const (
+	PlyASCII PlyFormat = iota
+	PlyBinaryLittleEndian
+	PlyBinaryBigEndian
+)
+
+var (
+	ErrPlyHeader = errors.New("Invalid PLY header")
+	ErrPlyData   = errors.New("Invalid PLY data")
+)
+
+// Sizes of the PLY scalar types, under both their old and their sized names
+var plyTypeSizes = map[string]int{
+	"char": 1, "int8": 1, "uchar": 1, "uint8": 1,
+	"short": 2, "int16": 2, "ushort": 2, "uint16": 2,
+	"int": 4, "int32": 4, "uint": 4, "uint32": 4,
+	"float": 4, "float32": 4, "double": 8, "float64": 8,
+}
+
+// Vertex properties holding texture coordinates, as named by different exporters
+var plyUvProperties = [][2]string{{"s", "t"}, {"u", "v"}, {"texture_u", "texture_v"}, {"texture_s", "texture_t"}}
+
+type plyProperty struct {
+	name      string
+	valueType string
+
+	// List properties store a count of countType before their values
+	list      bool
+	countType string
+}
+
+type plyElement struct {
+	name       string
+	count      int
+	properties []plyProperty
+}
+
+type plyReader struct {
+	reader *bufio.Reader
+	format PlyFormat
+	order  binary.ByteOrder
+	words  *bufio.Scanner
+	buffer [8]byte
+}
+
+func LoadPly(path string) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+
+	vertices, uvs, normals, err := LoadPlyFrom(file)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return vertices, uvs, normals, nil
+
+}
+
+// LoadPlyFrom reads an ASCII or binary PLY file into triangles laid out like LoadObj's. Polygons are triangulated as
+// fans, missing texture coordinates are zero and missing normals are smoothed as scans are usually smooth surfaces,
+// keeping edges sharper than DefaultCreaseAngle hard.
+func LoadPlyFrom(reader io.Reader) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	ply := &plyReader{reader: bufio.NewReader(reader)}
+
+	elements, err := ply.readHeader()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var positions, pointNormals []mgl32.Vec3
+	var pointUvs []mgl32.Vec2
+	var faces [][]int
+
+	for _, element := range elements {
+
+		switch element.name {
+		case "vertex":
+			positions, pointUvs, pointNormals, err = ply.readVertices(element)
+		case "face":
+			faces, err = ply.readFaces(element)
+		default:
+			err = ply.skipElement(element)
+		}
+
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s element: %w", element.name, err)
+		}
+
+	}
+
+	var vertices, normals []mgl32.Vec3
+	var uvs []mgl32.Vec2
+
+	for _, face := range faces {
+		for i := 2; i < len(face); i++ {
+			for _, index := range []int{face[0], face[i-1], face[i]} {
+
+				if index < 0 || index >= len(positions) {
+					return nil, nil, nil, fmt.Errorf("%w: vertex %d out of range", ErrPlyData, index)
+				}
+
+				vertices = append(vertices, positions[index])
+				if pointUvs != nil {
+					uvs = append(uvs, pointUvs[index])
+				} else {
+					uvs = append(uvs, mgl32.Vec2{})
+				}
+				if pointNormals != nil {
+					normals = append(normals, pointNormals[index])
+				}
+
+			}
+		}
+	}
+
+	if pointNormals == nil {
+		normals = ComputeSmoothNormals(vertices, nil, DefaultCreaseAngle)
+	}
+
+	return vertices, uvs, normals, nil
+
+}
+
+func (ply *plyReader) readHeader() ([]*plyElement, error) {
+
+	var elements []*plyElement
+
+	for lineNumber := 1; ; lineNumber++ {
+
+		line, err := ply.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPlyHeader, err)
+		}
+
+		fields := strings.Fields(line)
+		if lineNumber == 1 {
+			if len(fields) != 1 || fields[0] != "ply" {
+				return nil, fmt.Errorf("%w: not a PLY file", ErrPlyHeader)
+			}
+			continue
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "format":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%w: %q", ErrPlyHeader, strings.TrimSpace(line))
+			}
+			switch fields[1] {
+			case "ascii":
+				ply.format = PlyASCII
+			case "binary_little_endian":
+				ply.format, ply.order = PlyBinaryLittleEndian, binary.LittleEndian
+			case "binary_big_endian":
+				ply.format, ply.order = PlyBinaryBigEndian, binary.BigEndian
+			default:
+				return nil, fmt.Errorf("%w: unknown format %q", ErrPlyHeader, fields[1])
+			}
+		case "element":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("%w: %q", ErrPlyHeader, strings.TrimSpace(line))
+			}
+			count, err := strconv.Atoi(fields[2])
+			if err != nil || count < 0 {
+				return nil, fmt.Errorf("%w: invalid element count %q", ErrPlyHeader, fields[2])
+			}
+			elements = append(elements, &plyElement{name: fields[1], count: count})
+		case "property":
+			if len(elements) == 0 {
+				return nil, fmt.Errorf("%w: property before any element", ErrPlyHeader)
+			}
+			property, err := parsePlyProperty(fields)
+			if err != nil {
+				return nil, err
+			}
+			element := elements[len(elements)-1]
+			element.properties = append(element.properties, property)
+		case "end_header":
+			if ply.format == PlyASCII {
+				ply.words = bufio.NewScanner(ply.reader)
+				ply.words.Split(bufio.ScanWords)
+			}
+			return elements, nil
+		case "comment", "obj_info":
+		default:
+			return nil, fmt.Errorf("%w: unknown keyword %q", ErrPlyHeader, fields[0])
+		}
+
+	}
+
+}
+
+func parsePlyProperty(fields []string) (plyProperty, error) {
+
+	if len(fields) == 5 && fields[1] == "list" {
+
+		if plyTypeSizes[fields[2]] == 0 || plyTypeSizes[fields[3]] == 0 {
+			return plyProperty{}, fmt.Errorf("%w: unknown type in %q", ErrPlyHeader, strings.Join(fields, " "))
+		}
+
+		return plyProperty{name: fields[4], valueType: fields[3], list: true, countType: fields[2]}, nil
+
+	}
+
+	if len(fields) != 3 || plyTypeSizes[fields[1]] == 0 {
+		return plyProperty{}, fmt.Errorf("%w: %q", ErrPlyHeader, strings.Join(fields, " "))
+	}
+
+	return plyProperty{name: fields[2], valueType: fields[1]}, nil
+
+}
+
+// read returns the next value of the given type
+func (ply *plyReader) read(valueType string) (float64, error) {
+
+	if ply.format == PlyASCII {
+
+		if !ply.words.Scan() {
+			if err := ply.words.Err(); err != nil {
+				return 0, err
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		value, err := strconv.ParseFloat(ply.words.Text(), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrPlyData, ply.words.Text())
+		}
+
+		return value, nil
+
+	}
+
+	data := ply.buffer[:plyTypeSizes[valueType]]
+	if _, err := io.ReadFull(ply.reader, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	switch valueType {
+	case "char", "int8":
+		return float64(int8(data[0])), nil
+	case "uchar", "uint8":
+		return float64(data[0]), nil
+	case "short", "int16":
+		return float64(int16(ply.order.Uint16(data))), nil
+	case "ushort", "uint16":
+		return float64(ply.order.Uint16(data)), nil
+	case "int", "int32":
+		return float64(int32(ply.order.Uint32(data))), nil
+	case "uint", "uint32":
+		return float64(ply.order.Uint32(data)), nil
+	case "float", "float32":
+		return float64(math.Float32frombits(ply.order.Uint32(data))), nil
+	}
+
+	return math.Float64frombits(ply.order.Uint64(data)), nil
+
+}
+
+// readElement reads one element, calling value with the index of each property and its values
+func (ply *plyReader) readElement(element *plyElement, value func(property int, values []float64)) error {
+
+	var values []float64
+
+	for p, property := range element.properties {
+
+		values = values[:0]
+
+		if property.list {
+
+			count, err := ply.read(property.countType)
+			if err != nil {
+				return err
+			}
+			if count < 0 || count > math.MaxInt32 {
+				return fmt.Errorf("%w: list of %v values", ErrPlyData, count)
+			}
+
+			for i := 0; i < int(count); i++ {
+				v, err := ply.read(property.valueType)
+				if err != nil {
+					return err
+				}
+				values = append(values, v)
+			}
+
+		} else {
+
+			v, err := ply.read(property.valueType)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+
+		}
+
+		value(p, values)
+
+	}
+
+	return nil
+
+}
+
+func (ply *plyReader) skipElement(element *plyElement) error {
+
+	for i := 0; i < element.count; i++ {
+		if err := ply.readElement(element, func(int, []float64) {}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+func (ply *plyReader) readVertices(element *plyElement) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	index := make(map[string]int)
+	for p, property := range element.properties {
+		if !property.list {
+			index[property.name] = p
+		}
+	}
+
+	// Which property feeds each component of the position, normal and uv, nil when the vertices lack one
+	lookup := func(names ...string) []int {
+		properties := make([]int, len(names))
+		for i, name := range names {
+			p, ok := index[name]
+			if !ok {
+				return nil
+			}
+			properties[i] = p
+		}
+		return properties
+	}
+
+	position := lookup("x", "y", "z")
+	if position == nil {
+		return nil, nil, nil, fmt.Errorf("%w: vertices have no position", ErrPlyHeader)
+	}
+
+	normal := lookup("nx", "ny", "nz")
+	var uv []int
+	for _, names := range plyUvProperties {
+		if uv = lookup(names[0], names[1]); uv != nil {
+			break
+		}
+	}
+
+	// The slices grow as vertices are read, sizing them from the header would let a corrupt count exhaust memory
+	var vertices, normals []mgl32.Vec3
+	var uvs []mgl32.Vec2
+
+	row := make([]float64, len(element.properties))
+	for i := 0; i < element.count; i++ {
+
+		err := ply.readElement(element, func(p int, values []float64) {
+			if len(values) > 0 {
+				row[p] = values[0]
+			}
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		vertices = append(vertices, mgl32.Vec3{float32(row[position[0]]), float32(row[position[1]]),
+			float32(row[position[2]])})
+		if uv != nil {
+			uvs = append(uvs, mgl32.Vec2{float32(row[uv[0]]), float32(row[uv[1]])})
+		}
+		if normal != nil {
+			normals = append(normals, mgl32.Vec3{float32(row[normal[0]]), float32(row[normal[1]]),
+				float32(row[normal[2]])})
+		}
+
+	}
+
+	return vertices, uvs, normals, nil
+
+}
+
+func (ply *plyReader) readFaces(element *plyElement) ([][]int, error) {
+
+	indices := -1
+	for p, property := range element.properties {
+		if property.list && (property.name == "vertex_indices" || property.name == "vertex_index") {
+			indices = p
+		}
+	}
+
+	if indices < 0 {
+		return nil, fmt.Errorf("%w: faces have no vertex indices", ErrPlyHeader)
+	}
+
+	var faces [][]int
+	for i := 0; i < element.count; i++ {
+
+		var face []int
+		err := ply.readElement(element, func(p int, values []float64) {
+			if p == indices {
+				for _, value := range values {
+					face = append(face, int(value))
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		faces = append(faces, face)
+
+	}
+
+	return faces, nil
+
+}
+
+func SavePly(path string, format PlyFormat, indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2,
+	normals []mgl32.Vec3) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WritePly(file, format, indices, vertices, uvs, normals); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
+
+// WritePly writes an indexed triangle list such as IndexVBO's output. Uvs and normals are optional and left out of the
+// file when nil.
+func WritePly(writer io.Writer, format PlyFormat, indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2,
+	normals []mgl32.Vec3) error {
+
+	if (uvs != nil && len(uvs) != len(vertices)) || (normals != nil && len(normals) != len(vertices)) {
+		return fmt.Errorf("%w: attribute counts differ", ErrPlyData)
+	}
+
+	output := bufio.NewWriter(writer)
+
+	formatNames := map[PlyFormat]string{
+		PlyASCII:              "ascii",
+		PlyBinaryLittleEndian: "binary_little_endian",
+		PlyBinaryBigEndian:    "binary_big_endian",
+	}
+
+	fmt.Fprintf(output, "ply\nformat %s 1.0\nelement vertex %d\n", formatNames[format], len(vertices))
+	fmt.Fprint(output, "property float x\nproperty float y\nproperty float z\n")
+	if normals != nil {
+		fmt.Fprint(output, "property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if uvs != nil {
+		fmt.Fprint(output, "property float s\nproperty float t\n")
+	}
+	fmt.Fprintf(output, "element face %d\nproperty list uchar uint vertex_indices\nend_header\n", len(indices)/3)
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if format == PlyBinaryBigEndian {
+		order = binary.BigEndian
+	}
+
+	var buffer [4]byte
+	writeValues := func(values ...float32) {
+		for i, value := range values {
+			if format == PlyASCII {
+				if i > 0 {
+					output.WriteByte(' ')
+				}
+				output.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+			} else {
+				order.PutUint32(buffer[:], math.Float32bits(value))
+				output.Write(buffer[:])
+			}
+		}
+	}
+
+	for i, vertex := range vertices {
+
+		writeValues(vertex[:]...)
+		if normals != nil {
+			if format == PlyASCII {
+				output.WriteByte(' ')
+			}
+			writeValues(normals[i][:]...)
+		}
+		if uvs != nil {
+			if format == PlyASCII {
+				output.WriteByte(' ')
+			}
+			writeValues(uvs[i][:]...)
+		}
+		if format == PlyASCII {
+			output.WriteByte('\n')
+		}
+
+	}
+
+	for t := 0; t+2 < len(indices); t += 3 {
+
+		if format == PlyASCII {
+			fmt.Fprintf(output, "3 %d %d %d\n", indices[t], indices[t+1], indices[t+2])
+			continue
+		}
+
+		output.WriteByte(3)
+		for _, index := range indices[t : t+3] {
+			order.PutUint32(buffer[:], index)
+			output.Write(buffer[:])
+		}
+
+	}
+
+	return output.Flush()
+
+}
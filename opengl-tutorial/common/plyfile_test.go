@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestWritePlyRoundTrip(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+
+	formats := map[string]PlyFormat{
+		"ascii":                PlyASCII,
+		"binary little endian": PlyBinaryLittleEndian,
+		"binary big endian":    PlyBinaryBigEndian,
+	}
+
+	for name, format := range formats {
+
+		var buffer bytes.Buffer
+		if err := WritePly(&buffer, format, indices, vertices, uvs, normals); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		readVertices, readUvs, readNormals, err := LoadPlyFrom(&buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(readVertices) != len(indices) || len(readUvs) != len(indices) || len(readNormals) != len(indices) {
+			t.Fatalf("%s: read %d vertices, %d uvs and %d normals for %d corners", name, len(readVertices),
+				len(readUvs), len(readNormals), len(indices))
+		}
+
+		// Floats are written with as many digits as they need, so even ASCII reads back exactly
+		for i, index := range indices {
+			if readVertices[i] != vertices[index] || readUvs[i] != uvs[index] || readNormals[i] != normals[index] {
+				t.Fatalf("%s: corner %d read as %v %v %v, want %v %v %v", name, i, readVertices[i], readUvs[i],
+					readNormals[i], vertices[index], uvs[index], normals[index])
+			}
+		}
+
+	}
+
+}
+
+func TestLoadPlyInvalid(t *testing.T) {
+
+	header := func(format string, elements ...string) string {
+		return "ply\nformat " + format + " 1.0\n" + strings.Join(elements, "\n") + "\nend_header\n"
+	}
+	vertex := "element vertex %s\nproperty float x\nproperty float y\nproperty float z"
+	face := "element face %s\nproperty list uchar int vertex_indices"
+	triangle := strings.Replace(vertex, "%s", "3", 1) + "\n" + strings.Replace(face, "%s", "1", 1)
+
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"not a PLY file", "solid mesh\n", ErrPlyHeader},
+		{"header without end", "ply\nformat ascii 1.0\nelement vertex 3\n", ErrPlyHeader},
+		{"unknown format", header("binary_middle_endian", triangle), ErrPlyHeader},
+		{"negative count", header("ascii", strings.Replace(vertex, "%s", "-1", 1)), ErrPlyHeader},
+		{"unknown type", header("ascii", "element vertex 1\nproperty half x"), ErrPlyHeader},
+		{"no positions", header("ascii", "element vertex 1\nproperty float s"), ErrPlyHeader},
+		{"text in ascii data", header("ascii", triangle) + "0 0 0\n1 0 zero\n", ErrPlyData},
+		{"index out of range", header("ascii", triangle) + "0 0 0\n1 0 0\n1 1 0\n3 0 1 3\n", ErrPlyData},
+		{"truncated ascii", header("ascii", triangle) + "0 0 0\n1 0 0\n1 1", io.ErrUnexpectedEOF},
+		{"truncated binary", header("binary_little_endian", triangle) + strings.Repeat("\x00", 30),
+			io.ErrUnexpectedEOF},
+
+		// Counts far past the data fail when it runs out rather than allocating for them up front
+		{"oversized vertex count", header("binary_little_endian", strings.Replace(vertex, "%s", "4000000000", 1)) +
+			strings.Repeat("\x00", 24), io.ErrUnexpectedEOF},
+		{"oversized face count", header("ascii", strings.Replace(vertex, "%s", "0", 1),
+			strings.Replace(face, "%s", "4000000000", 1)) + "3 0 1 2\n", io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		if _, _, _, err := LoadPlyFrom(strings.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	normals := make([]mgl32.Vec3, 1)
+	if err := WritePly(io.Discard, PlyASCII, nil, make([]mgl32.Vec3, 2), nil, normals); !errors.Is(err, ErrPlyData) {
+		t.Errorf("Wrote %d normals for 2 vertices, error %v", len(normals), err)
+	}
+
+}
+
+func TestLoadPlyGeneratedNormals(t *testing.T) {
+
+	// Two triangles sharing the edge from vertex 0 to vertex 1, the first facing +z
+	ply := "ply\nformat ascii 1.0\nelement vertex 4\nproperty float x\nproperty float y\nproperty float z\n" +
+		"element face 2\nproperty list uchar int vertex_indices\nend_header\n" +
+		"0 0 0\n1 0 0\n0 1 0\n%s\n3 0 1 2\n3 0 3 1\n"
+
+	tests := []struct {
+		name   string
+		vertex string
+		smooth bool
+	}{
+		{"right angle stays sharp", "0 0 1", false},
+		{"shallow angle is smoothed", "0 -1 0.2", true},
+	}
+
+	for _, test := range tests {
+
+		_, _, normals, err := LoadPlyFrom(strings.NewReader(strings.Replace(ply, "%s", test.vertex, 1)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		// The corner the first triangle shares with the second keeps its face normal only at a crease
+		if smooth := normals[0] != (mgl32.Vec3{0, 0, 1}); smooth != test.smooth {
+			t.Errorf("%s: shared corner normal %v", test.name, normals[0])
+		}
+		if !nearVec3(normals[2], mgl32.Vec3{0, 0, 1}, 1e-6) {
+			t.Errorf("%s: unshared corner normal %v, want %v", test.name, normals[2], mgl32.Vec3{0, 0, 1})
+		}
+
+	}
+
+}
@@ -0,0 +1,500 @@
+package common
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// LOD is one simplified level of detail of an indexed mesh
+type LOD struct {
+	Indices  []uint32
+	Vertices []mgl32.Vec3
+	Uvs      []mgl32.Vec2
+	Normals  []mgl32.Vec3
+
+	// Error is the root of the largest collapse cost paid to reach this LOD. Each cost is the area weighted mean of the
+	// squared distances from the merged vertex to the planes of the triangles around the collapsed edge, so Error is
+	// in model units and scales with the mesh, but it's a typical distance around the worst collapse rather than a
+	// bound on how far any point of the surface moved.
+	Error float32
+}
+
+// SimplifyVBO builds a chain of LODs from the output of IndexVBO using quadric error metric edge collapses, one for
+// each ratio of the original triangle count, from the most detailed down. Vertices on the border of the mesh or on uv
+// or normal seams are never moved, and nothing is moved onto a seam vertex from between two of its seams, so a LOD
+// can end up with more triangles than asked for if only those are left.
+func SimplifyVBO(indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3, ratios []float32) []LOD {
+
+	sorted := append([]float32(nil), ratios...)
+	sort.Sort(sort.Reverse(float32Slice(sorted)))
+
+	simplifier := newSimplifier(indices, vertices)
+
+	lods := make([]LOD, 0, len(sorted))
+	for _, ratio := range sorted {
+
+		simplifier.collapseTo(int(ratio * float32(len(indices)/3)))
+
+		lod := LOD{Error: float32(math.Sqrt(simplifier.maxError))}
+		lod.Indices, lod.Vertices, lod.Uvs, lod.Normals = simplifier.mesh(vertices, uvs, normals)
+		lods = append(lods, lod)
+
+	}
+
+	return lods
+
+}
+
+// SelectLOD picks the coarsest of lods, ordered as SimplifyVBO returns them, whose error covers at most maxPixelError
+// pixels on screen when the mesh centered on center is drawn with the model matrix and the camera from
+// GetViewMatrix and GetProjectionMatrix into a viewport viewportHeight pixels high
+func SelectLOD(lods []LOD, center mgl32.Vec3, model mgl32.Mat4, view mgl32.Mat4, projection mgl32.Mat4,
+	viewportHeight int, maxPixelError float32) int {
+
+	// Distance in front of the camera and the largest scale the model matrix applies
+	eye := view.Mul4(model).Mul4x1(center.Vec4(1))
+	distance := -eye.Z()
+
+	scale := float32(math.Max(float64(model.Col(0).Vec3().Len()),
+		math.Max(float64(model.Col(1).Vec3().Len()), float64(model.Col(2).Vec3().Len()))))
+
+	selected := 0
+	for i, lod := range lods {
+
+		// Anything at or behind the camera plane gets the full detail version
+		if distance <= 0 {
+			break
+		}
+
+		// projection[5] scales view space y at distance 1 to normalized device coordinates, which span 2 units
+		pixels := lod.Error * scale * projection[5] / distance * float32(viewportHeight) / 2
+		if pixels > maxPixelError {
+			break
+		}
+		selected = i
+
+	}
+
+	return selected
+
+}
+
+type float32Slice []float32
+
+func (s float32Slice) Len() int           { return len(s) }
+func (s float32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s float32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// quadric is the symmetric 4x4 matrix of the summed squared distances to a set of planes, stored as its upper triangle.
+// Planes weighted by area give length to the fourth power, divide by the summed weight to get back a squared distance.
+type quadric [10]float64
+
+func planeQuadric(normal mgl32.Vec3, point mgl32.Vec3, weight float64) quadric {
+
+	a, b, c := float64(normal[0]), float64(normal[1]), float64(normal[2])
+	d := -(a*float64(point[0]) + b*float64(point[1]) + c*float64(point[2]))
+
+	return quadric{
+		a * a * weight, a * b * weight, a * c * weight, a * d * weight,
+		b * b * weight, b * c * weight, b * d * weight,
+		c * c * weight, c * d * weight,
+		d * d * weight,
+	}
+
+}
+
+func (q *quadric) add(other quadric) {
+	for i := range q {
+		q[i] += other[i]
+	}
+}
+
+func (q *quadric) evaluate(v mgl32.Vec3) float64 {
+
+	x, y, z := float64(v[0]), float64(v[1]), float64(v[2])
+
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z +
+		q[9]
+
+}
+
+// collapse is a candidate to move every use of position from onto position to
+type collapse struct {
+	cost     float64
+	from, to int
+	version  int
+}
+
+type collapseQueue []collapse
+
+func (q collapseQueue) Len() int            { return len(q) }
+func (q collapseQueue) Less(i, j int) bool  { return q[i].cost < q[j].cost }
+func (q collapseQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *collapseQueue) Push(x interface{}) { *q = append(*q, x.(collapse)) }
+func (q *collapseQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// simplifier collapses edges between unique positions, the vertices sharing a position at a uv or normal seam are
+// what makes them locked
+type simplifier struct {
+	positions []mgl32.Vec3
+	quadrics  []quadric
+	weights   []float64
+	locked    []bool
+	removed   []bool
+	version   []int
+
+	// Triangles as both position and vertex indices, and the triangles around each position. The lists around a
+	// position can hold dead triangles or ones that no longer use it, check before using them.
+	trianglePositions [][3]int
+	triangleVertices  [][3]uint32
+	alive             []bool
+	aliveCount        int
+	positionTriangles [][]int
+
+	queue    collapseQueue
+	maxError float64
+
+	// Scratch space for neighbour lists. A position is in the list being built when its mark is the current stamp.
+	marks      []int
+	stamp      int
+	candidates []int
+	affected   []int
+	scratch    []int
+}
+
+func newSimplifier(indices []uint32, vertices []mgl32.Vec3) *simplifier {
+
+	s := &simplifier{}
+
+	// Weld vertices split by their other attributes back together by position
+	positionOf := make([]int, len(vertices))
+	positionIds := make(map[mgl32.Vec3]int)
+	wedges := make(map[int]int)
+
+	for v, position := range vertices {
+
+		id, ok := positionIds[position]
+		if !ok {
+			id = len(s.positions)
+			positionIds[position] = id
+			s.positions = append(s.positions, position)
+		}
+		positionOf[v] = id
+
+	}
+
+	triangleCount := len(indices) / 3
+	s.trianglePositions = make([][3]int, triangleCount)
+	s.triangleVertices = make([][3]uint32, triangleCount)
+	s.alive = make([]bool, triangleCount)
+	s.positionTriangles = make([][]int, len(s.positions))
+	s.quadrics = make([]quadric, len(s.positions))
+	s.weights = make([]float64, len(s.positions))
+	s.locked = make([]bool, len(s.positions))
+	s.removed = make([]bool, len(s.positions))
+	s.version = make([]int, len(s.positions))
+	s.marks = make([]int, len(s.positions))
+
+	// Positions used through more than one vertex are on a seam
+	used := make(map[uint32]bool)
+	for _, index := range indices[:triangleCount*3] {
+		if !used[index] {
+			used[index] = true
+			wedges[positionOf[index]]++
+		}
+	}
+	for position, count := range wedges {
+		s.locked[position] = count > 1
+	}
+
+	type edge struct{ a, b int }
+	edgeUses := make(map[edge]int)
+
+	for t := 0; t < triangleCount; t++ {
+
+		for c := 0; c < 3; c++ {
+			s.triangleVertices[t][c] = indices[t*3+c]
+			s.trianglePositions[t][c] = positionOf[indices[t*3+c]]
+		}
+
+		p := s.trianglePositions[t]
+		if p[0] == p[1] || p[1] == p[2] || p[0] == p[2] {
+			continue
+		}
+
+		s.alive[t] = true
+		s.aliveCount++
+
+		a, b, c := s.positions[p[0]], s.positions[p[1]], s.positions[p[2]]
+		normal := b.Sub(a).Cross(c.Sub(a))
+		area := float64(normal.Len()) / 2
+
+		for i := 0; i < 3; i++ {
+
+			s.positionTriangles[p[i]] = append(s.positionTriangles[p[i]], t)
+			if area > 0 {
+				s.quadrics[p[i]].add(planeQuadric(normal.Normalize(), a, area))
+				s.weights[p[i]] += area
+			}
+
+			e := edge{p[i], p[(i+1)%3]}
+			if e.a > e.b {
+				e.a, e.b = e.b, e.a
+			}
+			edgeUses[e]++
+
+		}
+
+	}
+
+	// Border and non manifold edges pin both their ends
+	for e, uses := range edgeUses {
+		if uses != 2 {
+			s.locked[e.a] = true
+			s.locked[e.b] = true
+		}
+	}
+
+	for p := range s.positions {
+		s.updateCandidate(p)
+	}
+
+	return s
+
+}
+
+// neighbours appends the positions sharing a live triangle with p to list once each, and leaves them marked with the
+// current stamp
+func (s *simplifier) neighbours(p int, list []int) []int {
+
+	s.stamp++
+	for _, t := range s.positionTriangles[p] {
+		if s.usesPosition(t, p) {
+			for _, q := range s.trianglePositions[t] {
+				if q != p && s.marks[q] != s.stamp {
+					s.marks[q] = s.stamp
+					list = append(list, q)
+				}
+			}
+		}
+	}
+
+	return list
+
+}
+
+// vertexOf returns the vertex triangle t uses for position p
+func (s *simplifier) vertexOf(t int, p int) uint32 {
+
+	for c, position := range s.trianglePositions[t] {
+		if position == p {
+			return s.triangleVertices[t][c]
+		}
+	}
+
+	return 0
+
+}
+
+func (s *simplifier) usesPosition(t int, p int) bool {
+
+	if !s.alive[t] {
+		return false
+	}
+
+	positions := s.trianglePositions[t]
+	return positions[0] == p || positions[1] == p || positions[2] == p
+
+}
+
+// updateCandidate queues the cheapest valid collapse of p, if it has one
+func (s *simplifier) updateCandidate(p int) {
+
+	s.version[p]++
+	if s.locked[p] || s.removed[p] {
+		return
+	}
+
+	best := collapse{cost: math.Inf(1), from: p, to: -1, version: s.version[p]}
+
+	s.candidates = s.neighbours(p, s.candidates[:0])
+	for _, q := range s.candidates {
+
+		merged := s.quadrics[p]
+		merged.add(s.quadrics[q])
+		cost := 0.0
+		if weight := s.weights[p] + s.weights[q]; weight > 0 {
+			cost = math.Max(0, merged.evaluate(s.positions[q])/weight)
+		}
+
+		if (cost < best.cost || cost == best.cost && q < best.to) && s.canCollapse(p, q) {
+			best.cost = cost
+			best.to = q
+		}
+
+	}
+
+	if best.to >= 0 {
+		heap.Push(&s.queue, best)
+	}
+
+}
+
+// canCollapse checks moving p onto q keeps the mesh manifold, leaves every triangle of p a vertex of q to use and
+// doesn't flip any triangle over
+func (s *simplifier) canCollapse(p int, q int) bool {
+
+	// Both triangles on the edge must use the same vertex of q. When a seam through q ends between them, as at the tip
+	// of a cone with separate uvs on each face, no vertex of q suits all of p's triangles.
+	shared := 0
+	var wedges [2]uint32
+	for _, t := range s.positionTriangles[p] {
+		if s.usesPosition(t, p) && s.usesPosition(t, q) {
+			if shared < 2 {
+				wedges[shared] = s.vertexOf(t, q)
+			}
+			shared++
+		}
+	}
+	if shared != 2 || wedges[0] != wedges[1] {
+		return false
+	}
+
+	// The only neighbours p and q have in common must be across the triangles on their edge. Counting q's neighbours
+	// still marked as p's moves each one to the next stamp, so it's only counted once.
+	s.scratch = s.neighbours(p, s.scratch[:0])
+	marked := s.stamp
+	s.stamp++
+	common := 0
+	for _, t := range s.positionTriangles[q] {
+		if s.usesPosition(t, q) {
+			for _, r := range s.trianglePositions[t] {
+				if r != q && s.marks[r] == marked {
+					s.marks[r] = s.stamp
+					common++
+				}
+			}
+		}
+	}
+	if common != 2 {
+		return false
+	}
+
+	for _, t := range s.positionTriangles[p] {
+
+		if !s.usesPosition(t, p) || s.usesPosition(t, q) {
+			continue
+		}
+
+		positions := s.trianglePositions[t]
+		var before, after [3]mgl32.Vec3
+		for c := 0; c < 3; c++ {
+			before[c] = s.positions[positions[c]]
+			after[c] = before[c]
+			if positions[c] == p {
+				after[c] = s.positions[q]
+			}
+		}
+
+		oldNormal := before[1].Sub(before[0]).Cross(before[2].Sub(before[0]))
+		newNormal := after[1].Sub(after[0]).Cross(after[2].Sub(after[0]))
+		if oldNormal.Dot(newNormal) <= 0 {
+			return false
+		}
+
+	}
+
+	return true
+
+}
+
+func (s *simplifier) collapseTo(targetTriangles int) {
+
+	for s.aliveCount > targetTriangles && s.queue.Len() > 0 {
+
+		candidate := heap.Pop(&s.queue).(collapse)
+		p, q := candidate.from, candidate.to
+
+		if candidate.version != s.version[p] || s.removed[q] || !s.canCollapse(p, q) {
+			// Stale, find p's current best collapse instead
+			if candidate.version == s.version[p] {
+				s.updateCandidate(p)
+			}
+			continue
+		}
+
+		s.maxError = math.Max(s.maxError, candidate.cost)
+
+		// The vertex of q on p's side of any seam through q, which canCollapse made sure both triangles on the edge
+		// agree on. p itself isn't on a seam.
+		var wedge uint32
+		for _, t := range s.positionTriangles[p] {
+			if s.usesPosition(t, p) && s.usesPosition(t, q) {
+				wedge = s.vertexOf(t, q)
+				break
+			}
+		}
+
+		for _, t := range s.positionTriangles[p] {
+
+			if !s.usesPosition(t, p) {
+				continue
+			}
+
+			if s.usesPosition(t, q) {
+				s.alive[t] = false
+				s.aliveCount--
+				continue
+			}
+
+			for c, position := range s.trianglePositions[t] {
+				if position == p {
+					s.trianglePositions[t][c] = q
+					s.triangleVertices[t][c] = wedge
+				}
+			}
+			s.positionTriangles[q] = append(s.positionTriangles[q], t)
+
+		}
+
+		s.removed[p] = true
+		s.positionTriangles[p] = nil
+		s.quadrics[q].add(s.quadrics[p])
+		s.weights[q] += s.weights[p]
+
+		s.updateCandidate(q)
+		s.affected = s.neighbours(q, s.affected[:0])
+		for _, r := range s.affected {
+			s.updateCandidate(r)
+		}
+
+	}
+
+}
+
+// mesh compacts the live triangles into a new indexed mesh, dropping the vertices they no longer use. Vertices never
+// move, only which ones each triangle uses changes.
+func (s *simplifier) mesh(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	indices := make([]uint32, 0, s.aliveCount*3)
+	for t, alive := range s.alive {
+		if alive {
+			indices = append(indices, s.triangleVertices[t][:]...)
+		}
+	}
+
+	indices, remap := OptimizeVertexFetch(indices, len(vertices))
+
+	return indices, RemapVec3(vertices, remap), RemapVec2(uvs, remap), RemapVec3(normals, remap)
+
+}
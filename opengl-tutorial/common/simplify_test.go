@@ -0,0 +1,183 @@
+package common
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestSimplifyVBO(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+	ratios := []float32{0.1, 1, 0.5, 0.25}
+	lods := SimplifyVBO(indices, vertices, uvs, normals, ratios)
+
+	if len(lods) != len(ratios) {
+		t.Fatalf("%d LODs for %d ratios", len(lods), len(ratios))
+	}
+	if len(lods[0].Indices) != len(indices) || lods[0].Error != 0 {
+		t.Errorf("Full detail LOD has %d triangles and error %v, want %d and 0", len(lods[0].Indices)/3,
+			lods[0].Error, len(indices)/3)
+	}
+
+	for i := 1; i < len(lods); i++ {
+
+		if len(lods[i].Indices) >= len(lods[i-1].Indices) || lods[i].Error < lods[i-1].Error {
+			t.Errorf("LOD %d has %d triangles and error %v after %d and %v", i, len(lods[i].Indices)/3,
+				lods[i].Error, len(lods[i-1].Indices)/3, lods[i-1].Error)
+		}
+
+		for _, index := range lods[i].Indices {
+			if int(index) >= len(lods[i].Vertices) {
+				t.Fatalf("LOD %d index %d past its %d vertices", i, index, len(lods[i].Vertices))
+			}
+		}
+
+	}
+
+	// Suzanne is under 3 units across, even the seams left at a tenth of its triangles shouldn't move it much more
+	if coarsest := lods[len(lods)-1].Error; coarsest <= 0 || coarsest > 0.5 {
+		t.Errorf("Error of the coarsest LOD is %v", coarsest)
+	}
+
+}
+
+func TestSimplifyVBOErrorScale(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+	ratios := []float32{0.5, 0.1}
+	lods := SimplifyVBO(indices, vertices, uvs, normals, ratios)
+
+	// The error is a distance, so it grows linearly with the size of the mesh. Powers of two scale every float exactly
+	// and give the same collapses, other scales round the positions a little differently.
+	tests := []struct {
+		scale     float32
+		tolerance float64
+	}{
+		{1.0 / 64, 1e-5},
+		{8, 1e-5},
+		{1024, 1e-5},
+		{0.1, 0.02},
+		{10, 0.02},
+		{1000, 0.02},
+	}
+
+	for _, test := range tests {
+
+		scaled := make([]mgl32.Vec3, len(vertices))
+		for i, vertex := range vertices {
+			scaled[i] = vertex.Mul(test.scale)
+		}
+
+		scaledLods := SimplifyVBO(indices, scaled, uvs, normals, ratios)
+		for i := range lods {
+			want := lods[i].Error * test.scale
+			if math.Abs(float64(scaledLods[i].Error-want)) > test.tolerance*float64(want) {
+				t.Errorf("Scaled by %v LOD %d has error %v, want %v", test.scale, i, scaledLods[i].Error, want)
+			}
+		}
+
+	}
+
+}
+
+func TestSimplifyVBOSeamEnds(t *testing.T) {
+
+	// A cone whose tip has its own uv on every face, so a seam between each pair of faces ends at the middle ring
+	const segments = 16
+	ring := func(i int, radius float32, y float32, v float32) (mgl32.Vec3, mgl32.Vec2) {
+		angle := 2 * math.Pi * float64(i) / segments
+		return mgl32.Vec3{radius * float32(math.Cos(angle)), y, -radius * float32(math.Sin(angle))},
+			mgl32.Vec2{float32(i) / segments, v}
+	}
+
+	var vertices []mgl32.Vec3
+	var uvs []mgl32.Vec2
+	corner := func(vertex mgl32.Vec3, uv mgl32.Vec2) {
+		vertices = append(vertices, vertex)
+		uvs = append(uvs, uv)
+	}
+
+	for i := 0; i < segments; i++ {
+
+		middle0, middleUv0 := ring(i, 0.5, 1, 0.5)
+		middle1, middleUv1 := ring(i+1, 0.5, 1, 0.5)
+		bottom0, bottomUv0 := ring(i, 1, 0, 0)
+		bottom1, bottomUv1 := ring(i+1, 1, 0, 0)
+
+		corner(mgl32.Vec3{0, 2, 0}, mgl32.Vec2{(float32(i) + 0.5) / segments, 1})
+		corner(middle0, middleUv0)
+		corner(middle1, middleUv1)
+
+		corner(middle0, middleUv0)
+		corner(bottom0, bottomUv0)
+		corner(bottom1, bottomUv1)
+		corner(middle0, middleUv0)
+		corner(bottom1, bottomUv1)
+		corner(middle1, middleUv1)
+
+	}
+
+	normals := make([]mgl32.Vec3, len(vertices))
+	for i := range normals {
+		normals[i] = mgl32.Vec3{0, 1, 0}
+	}
+
+	indices, vertices, uvs, normals := IndexVBO(vertices, uvs, normals)
+	lods := SimplifyVBO(indices, vertices, uvs, normals, []float32{0.75, 0.5, 0.25})
+	if len(lods[len(lods)-1].Indices) >= len(indices) {
+		t.Fatal("Nothing was collapsed")
+	}
+
+	// The tip of every face keeps a uv between those of the face's other corners, as it would if it came from it
+	for l, lod := range lods {
+		for i := 0; i < len(lod.Indices); i += 3 {
+
+			tip, others := -1, []float32{}
+			for _, index := range lod.Indices[i : i+3] {
+				if lod.Uvs[index].Y() == 1 {
+					tip = int(index)
+				} else {
+					others = append(others, lod.Uvs[index].X())
+				}
+			}
+
+			if tip < 0 || len(others) != 2 {
+				continue
+			}
+			if u := lod.Uvs[tip].X(); u < others[0] && u < others[1] || u > others[0] && u > others[1] {
+				t.Fatalf("LOD %d has a face with its tip at u %v and its other corners at %v", l, u, others)
+			}
+
+		}
+	}
+
+}
+
+func TestSelectLOD(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+	lods := SimplifyVBO(indices, vertices, uvs, normals, []float32{1, 0.5, 0.25, 0.1})
+	projection := mgl32.Perspective(mgl32.DegToRad(45), 4.0/3.0, 0.1, 1000)
+
+	selectAt := func(distance float32, scale float32) int {
+		view := mgl32.LookAtV(mgl32.Vec3{0, 0, distance}, mgl32.Vec3{}, mgl32.Vec3{0, 1, 0})
+		return SelectLOD(lods, mgl32.Vec3{}, mgl32.Scale3D(scale, scale, scale), view, projection, 768, 1)
+	}
+
+	if selected := selectAt(0.5, 1); selected != 0 {
+		t.Errorf("LOD %d selected right in front of the camera", selected)
+	}
+	if selected := selectAt(1000, 1); selected != len(lods)-1 {
+		t.Errorf("LOD %d selected far away", selected)
+	}
+
+	// The same mesh ten times the size ten times further away covers the same pixels
+	for _, distance := range []float32{3, 10, 30, 100} {
+		if near, far := selectAt(distance, 1), selectAt(distance*10, 10); near != far {
+			t.Errorf("LOD %d selected at %v and %d ten times the size and distance", near, distance, far)
+		}
+	}
+
+}
@@ -0,0 +1,248 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type StlFormat int
+
+const (
+	StlBinary StlFormat = iota
+	StlASCII
+)
+
+// Binary STL files start with an 80 byte header and a triangle count, then 50 bytes per triangle: the normal, three
+// vertices and a 16 bit attribute
+const (
+	stlHeaderSize   = 84
+	stlTriangleSize = 50
+)
+
+var ErrStlData = errors.New("Invalid STL data")
+
+func LoadStl(path string) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer file.Close()
+
+	vertices, uvs, normals, err := LoadStlFrom(file)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return vertices, uvs, normals, nil
+
+}
+
+// LoadStlFrom reads an ASCII or binary STL file into triangles laid out like LoadObj's. STL has no texture coordinates
+// so the uvs are zero, and every corner gets the facet normal, worked out from the vertices when the file leaves it
+// zero.
+func LoadStlFrom(reader io.Reader) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Some binary files start with "solid" too, so trust the size first
+	var vertices, normals []mgl32.Vec3
+	if len(data) >= stlHeaderSize &&
+		len(data) == stlHeaderSize+int(binary.LittleEndian.Uint32(data[80:]))*stlTriangleSize {
+		vertices, normals = readBinaryStl(data)
+	} else if bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		if vertices, normals, err = readASCIIStl(data); err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		return nil, nil, nil, fmt.Errorf("%w: file size doesn't match the triangle count", ErrStlData)
+	}
+
+	for i := 0; i+2 < len(vertices); i += 3 {
+		if normals[i].Len() == 0 {
+			normal := triangleNormal(vertices[i], vertices[i+1], vertices[i+2])
+			normals[i], normals[i+1], normals[i+2] = normal, normal, normal
+		}
+	}
+
+	return vertices, make([]mgl32.Vec2, len(vertices)), normals, nil
+
+}
+
+func readBinaryStl(data []byte) ([]mgl32.Vec3, []mgl32.Vec3) {
+
+	count := int(binary.LittleEndian.Uint32(data[80:]))
+	vertices := make([]mgl32.Vec3, 0, count*3)
+	normals := make([]mgl32.Vec3, 0, count*3)
+
+	readVec3 := func(offset int) mgl32.Vec3 {
+		var v mgl32.Vec3
+		for c := range v {
+			v[c] = math.Float32frombits(binary.LittleEndian.Uint32(data[offset+c*4:]))
+		}
+		return v
+	}
+
+	for t := 0; t < count; t++ {
+
+		offset := stlHeaderSize + t*stlTriangleSize
+		normal := readVec3(offset)
+		for corner := 1; corner <= 3; corner++ {
+			vertices = append(vertices, readVec3(offset+corner*12))
+			normals = append(normals, normal)
+		}
+
+	}
+
+	return vertices, normals
+
+}
+
+// readASCIIStl reads the facets of an ASCII file, loops of more than three vertices are triangulated as fans
+func readASCIIStl(data []byte) ([]mgl32.Vec3, []mgl32.Vec3, error) {
+
+	var vertices, normals, loop []mgl32.Vec3
+	var normal mgl32.Vec3
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		parseVec3 := func(values []string) (mgl32.Vec3, error) {
+			var v mgl32.Vec3
+			if len(values) != 3 {
+				return v, fmt.Errorf("%w: line %d: expected 3 values", ErrStlData, lineNumber)
+			}
+			for c, value := range values {
+				parsed, err := strconv.ParseFloat(value, 32)
+				if err != nil {
+					return v, fmt.Errorf("%w: line %d: %q", ErrStlData, lineNumber, value)
+				}
+				v[c] = float32(parsed)
+			}
+			return v, nil
+		}
+
+		var err error
+		switch fields[0] {
+		case "facet":
+			if len(fields) < 2 || fields[1] != "normal" {
+				return nil, nil, fmt.Errorf("%w: line %d: expected facet normal", ErrStlData, lineNumber)
+			}
+			normal, err = parseVec3(fields[2:])
+		case "outer":
+			loop = loop[:0]
+		case "vertex":
+			var vertex mgl32.Vec3
+			vertex, err = parseVec3(fields[1:])
+			loop = append(loop, vertex)
+		case "endloop":
+			for i := 2; i < len(loop); i++ {
+				vertices = append(vertices, loop[0], loop[i-1], loop[i])
+				normals = append(normals, normal, normal, normal)
+			}
+		case "endfacet", "solid", "endsolid":
+		default:
+			err = fmt.Errorf("%w: line %d: unknown keyword %q", ErrStlData, lineNumber, fields[0])
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+	}
+
+	return vertices, normals, scanner.Err()
+
+}
+
+func SaveStl(path string, format StlFormat, indices []uint32, vertices []mgl32.Vec3) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteStl(file, format, indices, vertices); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+
+}
+
+// WriteStl writes an indexed triangle list such as IndexVBO's output, STL only stores positions and a normal per facet
+func WriteStl(writer io.Writer, format StlFormat, indices []uint32, vertices []mgl32.Vec3) error {
+
+	for _, index := range indices {
+		if int(index) >= len(vertices) {
+			return fmt.Errorf("%w: vertex %d out of range", ErrStlData, index)
+		}
+	}
+
+	output := bufio.NewWriter(writer)
+	triangleCount := len(indices) / 3
+
+	if format == StlASCII {
+
+		formatVec3 := func(v mgl32.Vec3) string {
+			return fmt.Sprintf("%s %s %s", strconv.FormatFloat(float64(v[0]), 'e', -1, 32),
+				strconv.FormatFloat(float64(v[1]), 'e', -1, 32), strconv.FormatFloat(float64(v[2]), 'e', -1, 32))
+		}
+
+		fmt.Fprintln(output, "solid mesh")
+		for t := 0; t < triangleCount; t++ {
+
+			a, b, c := vertices[indices[t*3]], vertices[indices[t*3+1]], vertices[indices[t*3+2]]
+			fmt.Fprintf(output, "facet normal %s\nouter loop\n", formatVec3(triangleNormal(a, b, c)))
+			for _, vertex := range []mgl32.Vec3{a, b, c} {
+				fmt.Fprintf(output, "vertex %s\n", formatVec3(vertex))
+			}
+			fmt.Fprintln(output, "endloop\nendfacet")
+
+		}
+		fmt.Fprintln(output, "endsolid mesh")
+
+		return output.Flush()
+
+	}
+
+	var header [stlHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[80:], uint32(triangleCount))
+	output.Write(header[:])
+
+	var triangle [stlTriangleSize]byte
+	for t := 0; t < triangleCount; t++ {
+
+		a, b, c := vertices[indices[t*3]], vertices[indices[t*3+1]], vertices[indices[t*3+2]]
+		for v, vector := range []mgl32.Vec3{triangleNormal(a, b, c), a, b, c} {
+			for i, value := range vector {
+				binary.LittleEndian.PutUint32(triangle[v*12+i*4:], math.Float32bits(value))
+			}
+		}
+		output.Write(triangle[:])
+
+	}
+
+	return output.Flush()
+
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestWriteStlRoundTrip(t *testing.T) {
+
+	indices, vertices, _, _ := loadIndexedSuzanne(t)
+
+	formats := map[string]StlFormat{
+		"binary": StlBinary,
+		"ascii":  StlASCII,
+	}
+
+	for name, format := range formats {
+
+		var buffer bytes.Buffer
+		if err := WriteStl(&buffer, format, indices, vertices); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		readVertices, readUvs, readNormals, err := LoadStlFrom(&buffer)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(readVertices) != len(indices) || len(readUvs) != len(indices) || len(readNormals) != len(indices) {
+			t.Fatalf("%s: read %d vertices, %d uvs and %d normals for %d corners", name, len(readVertices),
+				len(readUvs), len(readNormals), len(indices))
+		}
+
+		// STL keeps one normal per facet, which the writer works out from the corners
+		for i, index := range indices {
+
+			normal := triangleNormal(vertices[indices[i/3*3]], vertices[indices[i/3*3+1]], vertices[indices[i/3*3+2]])
+			if readVertices[i] != vertices[index] || readNormals[i] != normal {
+				t.Fatalf("%s: corner %d read as %v with normal %v, want %v and %v", name, i, readVertices[i],
+					readNormals[i], vertices[index], normal)
+			}
+
+		}
+
+	}
+
+}
+
+func TestLoadStlInvalid(t *testing.T) {
+
+	// A binary header claiming a triangle the data doesn't hold
+	header := make([]byte, stlHeaderSize)
+	header[80] = 1
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"neither binary nor ascii", "mesh\n"},
+		{"truncated binary", string(header) + strings.Repeat("\x00", stlTriangleSize-1)},
+		{"oversized binary count", string(header[:80]) + "\xff\xff\xff\xff" + strings.Repeat("\x00", stlTriangleSize)},
+		{"short vertex", "solid mesh\nfacet normal 0 0 1\nouter loop\nvertex 0 0\n"},
+		{"text in a vertex", "solid mesh\nfacet normal 0 0 1\nouter loop\nvertex 0 zero 0\n"},
+		{"unknown keyword", "solid mesh\nfacet normal 0 0 1\nouter loop\npoint 0 0 0\n"},
+	}
+
+	for _, test := range tests {
+		if _, _, _, err := LoadStlFrom(strings.NewReader(test.data)); !errors.Is(err, ErrStlData) {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+	}
+
+}
+
+func TestWriteStlIndexRange(t *testing.T) {
+
+	vertices := []mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+
+	for _, format := range []StlFormat{StlBinary, StlASCII} {
+		var buffer bytes.Buffer
+		if err := WriteStl(&buffer, format, []uint32{0, 1, 3}, vertices); !errors.Is(err, ErrStlData) {
+			t.Errorf("Format %d: error %v, want %v", format, err, ErrStlData)
+		}
+		if buffer.Len() != 0 {
+			t.Errorf("Format %d: wrote %d bytes of a mesh it rejected", format, buffer.Len())
+		}
+	}
+
+}
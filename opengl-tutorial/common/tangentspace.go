@@ -0,0 +1,97 @@
+package common
+
+import "github.com/go-gl/mathgl/mgl32"
+
+// ComputeTangentBasis computes the tangent and bitangent of every vertex of a triangle list for normal mapping. The
+// triangle tangents are summed over the vertices sharing a position, uv, normal and handedness so they index together
+// in IndexVBOTBN, and triangles on either side of a mirrored uv seam don't cancel each other out. Each tangent is then
+// made orthogonal to its normal, and the bitangent is rebuilt from the two so the basis is orthonormal, pointing the
+// way the uvs do even on mirrored uv islands.
+func ComputeTangentBasis(vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]mgl32.Vec3, []mgl32.Vec3) {
+
+	type basisKey struct {
+		PackedVertex
+		mirrored bool
+	}
+	type basis struct {
+		tangent   mgl32.Vec3
+		bitangent mgl32.Vec3
+	}
+	sums := make(map[basisKey]basis)
+	keys := make([]basisKey, len(vertices))
+
+	for i := range vertices {
+		keys[i].PackedVertex = PackedVertex{position: vertices[i], uv: uvs[i], normal: normals[i]}
+	}
+
+	for i := 0; i+2 < len(vertices); i += 3 {
+
+		// Edges of the triangle : position delta
+		deltaPos1 := vertices[i+1].Sub(vertices[i])
+		deltaPos2 := vertices[i+2].Sub(vertices[i])
+
+		// UV delta
+		deltaUV1 := uvs[i+1].Sub(uvs[i])
+		deltaUV2 := uvs[i+2].Sub(uvs[i])
+
+		// Triangles with no uv area don't tell us anything about the tangent space
+		determinant := deltaUV1.X()*deltaUV2.Y() - deltaUV1.Y()*deltaUV2.X()
+		if determinant == 0 {
+			continue
+		}
+		r := 1.0 / determinant
+
+		tangent := deltaPos1.Mul(deltaUV2.Y()).Sub(deltaPos2.Mul(deltaUV1.Y())).Mul(r)
+		bitangent := deltaPos2.Mul(deltaUV1.X()).Sub(deltaPos1.Mul(deltaUV2.X())).Mul(r)
+
+		for j := i; j < i+3; j++ {
+			keys[j].mirrored = normals[j].Dot(tangent.Cross(bitangent)) < 0
+			sum := sums[keys[j]]
+			sums[keys[j]] = basis{sum.tangent.Add(tangent), sum.bitangent.Add(bitangent)}
+		}
+
+	}
+
+	tangents := make([]mgl32.Vec3, len(vertices))
+	bitangents := make([]mgl32.Vec3, len(vertices))
+
+	for i := range vertices {
+
+		sum := sums[keys[i]]
+		tangents[i], bitangents[i] = orthonormalTangentBasis(normals[i], sum.tangent, sum.bitangent)
+
+	}
+
+	return tangents, bitangents
+
+}
+
+// orthonormalTangentBasis Gram-Schmidt orthogonalises tangent against normal, and derives the bitangent from the
+// two with the handedness of the given bitangent
+func orthonormalTangentBasis(normal mgl32.Vec3, tangent mgl32.Vec3, bitangent mgl32.Vec3) (mgl32.Vec3, mgl32.Vec3) {
+
+	// Normals read from files are rarely exactly unit length
+	if length := normal.Len(); length > 0 {
+		normal = normal.Mul(1 / length)
+	}
+
+	tangent = tangent.Sub(normal.Mul(normal.Dot(tangent)))
+
+	// Without a usable tangent any vector perpendicular to the normal will do
+	if tangent.Len() < 1e-6 {
+		tangent = mgl32.Vec3{1, 0, 0}
+		if mgl32.Abs(normal.X()) > 0.9 {
+			tangent = mgl32.Vec3{0, 1, 0}
+		}
+		tangent = tangent.Sub(normal.Mul(normal.Dot(tangent)))
+	}
+	tangent = tangent.Normalize()
+
+	handedness := float32(1.0)
+	if normal.Cross(tangent).Dot(bitangent) < 0 {
+		handedness = -1.0
+	}
+
+	return tangent, normal.Cross(tangent).Mul(handedness)
+
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// mirroredStrip is two unit quads facing +Z either side of x = 0 whose u coordinate is mirrored about the seam
+// between them, as on the two halves of a symmetrical face
+func mirroredStrip() ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	vertices := []mgl32.Vec3{
+		{-1, 0, 0}, {0, 0, 0}, {0, 1, 0}, {-1, 0, 0}, {0, 1, 0}, {-1, 1, 0},
+		{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 0, 0}, {1, 1, 0}, {0, 1, 0},
+	}
+
+	uvs := make([]mgl32.Vec2, len(vertices))
+	normals := make([]mgl32.Vec3, len(vertices))
+	for i, vertex := range vertices {
+		uvs[i] = mgl32.Vec2{float32(math.Abs(float64(vertex.X()))), vertex.Y()}
+		normals[i] = mgl32.Vec3{0, 0, 1}
+	}
+
+	return vertices, uvs, normals
+
+}
+
+func TestComputeTangentBasis(t *testing.T) {
+
+	// A quad twice the size of its uvs still gets unit vectors along u and v
+	vertices := []mgl32.Vec3{{0, 0, 0}, {2, 0, 0}, {2, 2, 0}, {0, 0, 0}, {2, 2, 0}, {0, 2, 0}}
+	uvs := []mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 0}, {1, 1}, {0, 1}}
+	normals := []mgl32.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+
+	tangents, bitangents := ComputeTangentBasis(vertices, uvs, normals)
+	for i := range vertices {
+		if !nearVec3(tangents[i], mgl32.Vec3{1, 0, 0}, 1e-6) || !nearVec3(bitangents[i], mgl32.Vec3{0, 1, 0}, 1e-6) {
+			t.Errorf("Quad vertex %d has tangent %v and bitangent %v", i, tangents[i], bitangents[i])
+		}
+	}
+
+	// The left half's u runs towards -X, so its tangents do too while its bitangents still follow v
+	vertices, uvs, normals = mirroredStrip()
+	tangents, bitangents = ComputeTangentBasis(vertices, uvs, normals)
+	for i, vertex := range vertices {
+
+		tangent := mgl32.Vec3{1, 0, 0}
+		if i < 6 {
+			tangent = mgl32.Vec3{-1, 0, 0}
+		}
+
+		if !nearVec3(tangents[i], tangent, 1e-6) || !nearVec3(bitangents[i], mgl32.Vec3{0, 1, 0}, 1e-6) {
+			t.Errorf("Strip vertex %d at %v has tangent %v and bitangent %v, want %v and %v", i, vertex, tangents[i],
+				bitangents[i], tangent, mgl32.Vec3{0, 1, 0})
+		}
+
+	}
+
+}
+
+func TestComputeTangentBasisOrthonormal(t *testing.T) {
+
+	vertices, uvs, normals, err := LoadObj("../08-basic-shading/suzanne.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tangents, bitangents := ComputeTangentBasis(vertices, uvs, normals)
+	for i := range vertices {
+
+		normal, tangent, bitangent := normals[i].Normalize(), tangents[i], bitangents[i]
+		if math.Abs(float64(tangent.Len()-1)) > 1e-5 || math.Abs(float64(bitangent.Len()-1)) > 1e-5 {
+			t.Fatalf("Vertex %d has tangent %v and bitangent %v, which aren't unit length", i, tangent, bitangent)
+		}
+		if math.Abs(float64(tangent.Dot(normal))) > 1e-4 || math.Abs(float64(bitangent.Dot(normal))) > 1e-4 ||
+			math.Abs(float64(tangent.Dot(bitangent))) > 1e-4 {
+			t.Fatalf("Vertex %d has normal %v, tangent %v and bitangent %v, which aren't orthogonal", i, normal,
+				tangent, bitangent)
+		}
+
+	}
+
+}
+
+func TestIndexVBOTBN(t *testing.T) {
+
+	vertices, uvs, normals := mirroredStrip()
+	tangents, bitangents := ComputeTangentBasis(vertices, uvs, normals)
+
+	indices, indexedVertices, indexedUvs, indexedNormals, indexedTangents, indexedBitangents, err :=
+		IndexVBOTBN(vertices, uvs, normals, tangents, bitangents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The corners on the seam have the same position, uv and normal on both sides but not the same tangent
+	if len(indexedVertices) != 8 || len(indices) != len(vertices) {
+		t.Errorf("Indexed %d vertices into %d, want 8", len(vertices), len(indexedVertices))
+	}
+	if _, welded, _, _ := IndexVBO(vertices, uvs, normals); len(welded) != 6 {
+		t.Errorf("IndexVBO indexed %d vertices into %d, want 6", len(vertices), len(welded))
+	}
+
+	for i, index := range indices {
+		if indexedVertices[index] != vertices[i] || indexedUvs[index] != uvs[i] ||
+			indexedNormals[index] != normals[i] || indexedTangents[index] != tangents[i] ||
+			indexedBitangents[index] != bitangents[i] {
+			t.Errorf("Vertex %d was indexed to %d with different attributes", i, index)
+		}
+	}
+
+	_, _, _, _, _, _, err = IndexVBOTBN(vertices, uvs, normals, tangents, bitangents[1:])
+	if !errors.Is(err, ErrVertexAttribute) {
+		t.Errorf("Missing bitangent gave error %v", err)
+	}
+
+}
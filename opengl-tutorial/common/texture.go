@@ -1,182 +1,305 @@
 package common
 
 import (
-	"errors"
-	"os"
-
 	"fmt"
 
-	"io/ioutil"
-
-	"bytes"
-	"encoding/binary"
-
 	"github.com/go-gl/gl/v3.3-core/gl"
 )
 
+// glImageFormat is how an ImageFormat is given to OpenGL, compressed formats only need internalFormat
+type glImageFormat struct {
+	internalFormat int32
+	format         uint32
+	pixelType      uint32
+}
+
+// Compressed formats from extensions that not every version of the bindings names
 const (
-	FOURCC_DXT1 = 0x31545844
-	FOURCC_DXT3 = 0x33545844
-	FOURCC_DXT5 = 0x35545844
+	glCompressedSRGBAlphaS3TCDXT1 = 0x8C4D
+	glCompressedSRGBAlphaS3TCDXT3 = 0x8C4E
+	glCompressedSRGBAlphaS3TCDXT5 = 0x8C4F
+	glCompressedRGBABPTCUnorm     = 0x8E8C
+	glCompressedSRGBAlphaBPTC     = 0x8E8D
+	glCompressedRGBBPTCSigned     = 0x8E8E
+	glCompressedRGBBPTCUnsigned   = 0x8E8F
 )
 
-func LoadBmpCustom(filepath string) (int32, error) {
+var glImageFormats = map[ImageFormat]glImageFormat{
+	ImageRGB8:  {gl.RGB8, gl.RGB, gl.UNSIGNED_BYTE},
+	ImageRGBA8: {gl.RGBA8, gl.RGBA, gl.UNSIGNED_BYTE},
+	ImageDXT1:  {gl.COMPRESSED_RGBA_S3TC_DXT1_EXT, 0, 0},
+	ImageDXT3:  {gl.COMPRESSED_RGBA_S3TC_DXT3_EXT, 0, 0},
+	ImageDXT5:  {gl.COMPRESSED_RGBA_S3TC_DXT5_EXT, 0, 0},
+
+	ImageR8:  {gl.R8, gl.RED, gl.UNSIGNED_BYTE},
+	ImageRG8: {gl.RG8, gl.RG, gl.UNSIGNED_BYTE},
+	ImageL8:  {gl.R8, gl.RED, gl.UNSIGNED_BYTE},
+	ImageLA8: {gl.RG8, gl.RG, gl.UNSIGNED_BYTE},
+
+	ImageRGBA16F: {gl.RGBA16F, gl.RGBA, gl.HALF_FLOAT},
+	ImageRGB32F:  {gl.RGB32F, gl.RGB, gl.FLOAT},
+	ImageRGBA32F: {gl.RGBA32F, gl.RGBA, gl.FLOAT},
+
+	ImageBC4:        {gl.COMPRESSED_RED_RGTC1, 0, 0},
+	ImageBC4Signed:  {gl.COMPRESSED_SIGNED_RED_RGTC1, 0, 0},
+	ImageBC5:        {gl.COMPRESSED_RG_RGTC2, 0, 0},
+	ImageBC5Signed:  {gl.COMPRESSED_SIGNED_RG_RGTC2, 0, 0},
+	ImageBC6H:       {glCompressedRGBBPTCUnsigned, 0, 0},
+	ImageBC6HSigned: {glCompressedRGBBPTCSigned, 0, 0},
+	ImageBC7:        {glCompressedRGBABPTCUnorm, 0, 0},
+}
 
-	file, err := os.Open(filepath)
-	if err != nil {
-		return 0, errors.New("Image could not be opened")
-	}
-	defer file.Close()
+// Internal formats of sRGB encoded images, formats missing here can't be sRGB and are uploaded as linear
+var glSRGBFormats = map[ImageFormat]int32{
+	ImageRGB8:  gl.SRGB8,
+	ImageRGBA8: gl.SRGB8_ALPHA8,
+	ImageDXT1:  glCompressedSRGBAlphaS3TCDXT1,
+	ImageDXT3:  glCompressedSRGBAlphaS3TCDXT3,
+	ImageDXT5:  glCompressedSRGBAlphaS3TCDXT5,
+	ImageBC7:   glCompressedSRGBAlphaBPTC,
+}
 
-	//bufferedReader := bufio.NewReader(file)
-	header := make([]byte, 54)
+// Luminance is stored in the red channel and spread to the others when sampled
+var glImageSwizzles = map[ImageFormat][4]int32{
+	ImageL8:  {gl.RED, gl.RED, gl.RED, gl.ONE},
+	ImageLA8: {gl.RED, gl.RED, gl.RED, gl.GREEN},
+}
 
-	_, err = file.Read(header)
-	if err != nil {
-		return 0, errors.New("Not a correct bmp file")
-	}
+// Extensions compressed formats need beyond OpenGL 3.3, RGTC is part of the core
+var glCompressedFormatExtensions = map[ImageFormat]string{
+	ImageDXT1:       "GL_EXT_texture_compression_s3tc",
+	ImageDXT3:       "GL_EXT_texture_compression_s3tc",
+	ImageDXT5:       "GL_EXT_texture_compression_s3tc",
+	ImageBC6H:       "GL_ARB_texture_compression_bptc",
+	ImageBC6HSigned: "GL_ARB_texture_compression_bptc",
+	ImageBC7:        "GL_ARB_texture_compression_bptc",
+}
+
+// Extensions of the current context, read the first time they're needed
+var glExtensions map[string]bool
+
+func hasExtension(name string) bool {
+
+	if glExtensions == nil {
+
+		glExtensions = make(map[string]bool)
+
+		var count int32
+		gl.GetIntegerv(gl.NUM_EXTENSIONS, &count)
+		for i := uint32(0); i < uint32(count); i++ {
+			glExtensions[gl.GoStr(gl.GetStringi(gl.EXTENSIONS, i))] = true
+		}
 
-	if header[0] != 'B' || header[1] != 'M' {
-		return 0, errors.New("Not a correct bmp file")
 	}
 
-	// Read ints from the byte array
-	dataPos := intFromByteSlice(header[0x0A : 0x0A+4])
-	imageSize := intFromByteSlice(header[0x22 : 0x22+4])
-	width := intFromByteSlice(header[0x12 : 0x12+4])
-	height := intFromByteSlice(header[0x16 : 0x16+4])
+	return glExtensions[name]
 
-	// Some BMP files are misformatted, guess missing information
-	if imageSize == 0 {
-		imageSize = width * height * 3 // 3 : one byte for each Red, Green and Blue component
+}
+
+func compressedFormatSupported(format ImageFormat) bool {
+
+	extension, ok := glCompressedFormatExtensions[format]
+	return !ok || hasExtension(extension)
+
+}
+
+// ImageTarget is the texture target UploadImage binds an image to
+func ImageTarget(image *Image) uint32 {
+
+	switch {
+	case image.Cubemap && image.Layers > 0:
+		return gl.TEXTURE_CUBE_MAP_ARRAY
+	case image.Cubemap:
+		return gl.TEXTURE_CUBE_MAP
+	case image.Depth > 0:
+		return gl.TEXTURE_3D
+	case image.Layers > 0:
+		return gl.TEXTURE_2D_ARRAY
+	default:
+		return gl.TEXTURE_2D
 	}
 
-	if dataPos == 0 {
-		dataPos = 54 // The BMP header is done that way
+}
+
+// UploadImage creates a texture from an image and its mipmaps, bound to ImageTarget(image), with trilinear filtering
+// that repeats or for cubemaps clamps to the edges. Uncompressed images without mipmaps have them generated, and
+// compressed ones the driver can't handle are decompressed with DecompressImage when it can. It must be called on the
+// thread owning the GL context, but the image can be decoded anywhere beforehand. Cubemap arrays need OpenGL 4.
+func UploadImage(image *Image) (uint32, error) {
+
+	// Without the driver's support compressed images are expanded here, as llvmpipe and other software renderers need
+	if image.Format.Compressed() && !compressedFormatSupported(image.Format) && CanDecompress(image.Format) {
+		decompressed, err := DecompressImage(image)
+		if err != nil {
+			return 0, err
+		}
+		image = decompressed
 	}
 
-	// Create a buffer
-	data := make([]byte, 786432)
+	glFormat, ok := glImageFormats[image.Format]
+	if !ok {
+		return 0, fmt.Errorf("No OpenGL format for %v images", image.Format)
+	}
+	if internalFormat, ok := glSRGBFormats[image.Format]; ok && image.SRGB {
+		glFormat.internalFormat = internalFormat
+	}
 
-	// Read the actual data from the file into the buffer
-	_, err = file.Read(data)
-	if err != nil {
-		return 0, errors.New("bmp smaller than expected")
+	for level := 0; level < image.Levels(); level++ {
+		if data, _, _ := image.Level(level); len(data) < image.LevelDataSize(level) {
+			return 0, fmt.Errorf("Image level %d holds %d bytes instead of %d", level, len(data),
+				image.LevelDataSize(level))
+		}
 	}
 
+	target := ImageTarget(image)
+
 	// Create one OpenGL texture
 	var textureId uint32
 	gl.GenTextures(1, &textureId)
 
 	// "Bind" the newly created texture : all future texture functions will modify this texture
-	gl.BindTexture(gl.TEXTURE_2D, textureId)
+	gl.BindTexture(target, textureId)
+
+	// Rows of RGB pixels aren't always a multiple of 4 bytes long
+	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
 
 	// Give the image to OpenGL
-	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGB, int32(width), int32(height), 0, gl.BGR, gl.UNSIGNED_BYTE, gl.Ptr(data))
+	for level := 0; level < image.Levels(); level++ {
+
+		data, width, height := image.Level(level)
+		data = data[:image.LevelDataSize(level)]
+
+		switch target {
+		case gl.TEXTURE_2D:
+			uploadImage2D(gl.TEXTURE_2D, level, glFormat, image.Format, width, height, data)
+		case gl.TEXTURE_CUBE_MAP:
+			faceSize := image.Format.DataSize(width, height)
+			for face := 0; face < 6; face++ {
+				uploadImage2D(uint32(gl.TEXTURE_CUBE_MAP_POSITIVE_X+face), level, glFormat, image.Format, width,
+					height, data[face*faceSize:(face+1)*faceSize])
+			}
+		default:
+			// Volumes are uploaded a level at a time as are all the layers of arrays
+			depth := image.LevelDepth(level)
+			if image.Layers > 0 {
+				depth = image.Slices()
+			}
+			uploadImage3D(target, level, glFormat, image.Format, width, height, depth, data)
+		}
+
+	}
+
+	if swizzle, ok := glImageSwizzles[image.Format]; ok {
+		gl.TexParameteriv(target, gl.TEXTURE_SWIZZLE_RGBA, &swizzle[0])
+	}
 
 	// Poor filter, or ...
-	//gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
-	//gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	//gl.TexParameteri(target, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	//gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
 
 	// ... nice trilinear filtering
-	gl.TexParameterf(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.REPEAT)
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.REPEAT)
+	wrap := int32(gl.REPEAT)
+	if image.Cubemap {
+		wrap = gl.CLAMP_TO_EDGE
+	}
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_S, wrap)
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_T, wrap)
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_R, wrap)
 	// When MAGnifying the image (no bigger mipmap available), use LINEAR filtering
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
-	// When MINifying the image, use a LINEAR blend of two mipmaps, each filtered LINEARLY too
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
-	// Generate mipmaps, by the way.
-	gl.GenerateMipmap(gl.TEXTURE_2D)
+	gl.TexParameteri(target, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+
+	switch {
+	case image.Levels() > 1:
+		// Files can stop short of a 1x1 level, tell GL where the chain ends so the texture is complete
+		gl.TexParameteri(target, gl.TEXTURE_MAX_LEVEL, int32(image.Levels()-1))
+		gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	case !image.Format.Compressed():
+		// When MINifying the image, use a LINEAR blend of two mipmaps, each filtered LINEARLY too
+		gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+		// Generate mipmaps, by the way.
+		gl.GenerateMipmap(target)
+	default:
+		gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	}
 
-	return int32(textureId), nil
+	return textureId, nil
 
 }
 
-func LoadDDS(imagepath string) (uint32, error) {
+func uploadImage2D(target uint32, level int, glFormat glImageFormat, format ImageFormat, width int, height int,
+	data []byte) {
 
-	// try to open the file
-	file, err := os.Open(imagepath)
-	if err != nil {
-		return 0, errors.New(fmt.Sprintf("%s could not be opened. Are you in the right directory ? Don't forget to "+
-			"read the FAQ !\n", imagepath))
+	if format.Compressed() {
+		gl.CompressedTexImage2D(target, int32(level), uint32(glFormat.internalFormat), int32(width), int32(height), 0,
+			int32(len(data)), gl.Ptr(data))
+	} else {
+		gl.TexImage2D(target, int32(level), glFormat.internalFormat, int32(width), int32(height), 0, glFormat.format,
+			glFormat.pixelType, gl.Ptr(data))
 	}
-	defer file.Close()
 
-	fileData, err := ioutil.ReadAll(file)
-	if err != nil {
-		return 0, err
-	}
+}
 
-	// verify the type of file
-	if string(fileData[0:4]) != "DDS " {
-		return 0, errors.New("File was not of type DDS")
-	}
-
-	// get the surface desc
-	height := int32FromByteSlice(fileData[12:16])
-	width := int32FromByteSlice(fileData[16:20])
-	mipMapCount := int32FromByteSlice(fileData[28:32])
-	fourCC := int32FromByteSlice(fileData[84:88])
-
-	var format uint32
-	switch fourCC {
-	case FOURCC_DXT1:
-		format = gl.COMPRESSED_RGBA_S3TC_DXT1_EXT
-		break
-	case FOURCC_DXT3:
-		format = gl.COMPRESSED_RGBA_S3TC_DXT3_EXT
-		break
-	case FOURCC_DXT5:
-		format = gl.COMPRESSED_RGBA_S3TC_DXT5_EXT
-		break
-	default:
-		return 0, errors.New("FourCC not recognized")
+func uploadImage3D(target uint32, level int, glFormat glImageFormat, format ImageFormat, width int, height int,
+	depth int, data []byte) {
+
+	if format.Compressed() {
+		gl.CompressedTexImage3D(target, int32(level), uint32(glFormat.internalFormat), int32(width), int32(height),
+			int32(depth), 0, int32(len(data)), gl.Ptr(data))
+	} else {
+		gl.TexImage3D(target, int32(level), glFormat.internalFormat, int32(width), int32(height), int32(depth), 0,
+			glFormat.format, glFormat.pixelType, gl.Ptr(data))
 	}
 
-	// Create one OpenGL texture
-	var textureId uint32
-	gl.GenTextures(1, &textureId)
+}
 
-	// "Bind" the newly created texture : all future texture functions will modify this texture
-	gl.BindTexture(gl.TEXTURE_2D, textureId)
-	gl.PixelStorei(gl.UNPACK_ALIGNMENT, 1)
+// LoadBmpCustom decodes a BMP with LoadBmp and uploads it with UploadImage
+func LoadBmpCustom(filepath string) (int32, error) {
 
-	var blockSize int32
-	if format == gl.COMPRESSED_RGBA_S3TC_DXT1_EXT {
-		blockSize = 8
-	} else {
-		blockSize = 16
+	image, err := LoadBmp(filepath)
+	if err != nil {
+		return 0, err
 	}
 
-	buffer := make([]byte, len(fileData)-128)
+	textureId, err := UploadImage(image)
+	return int32(textureId), err
 
-	err = binary.Read(bytes.NewReader(fileData[128:]), binary.LittleEndian, buffer)
+}
+
+// LoadDDS reads a DDS with LoadDDSImage and uploads it with UploadImage
+func LoadDDS(imagepath string) (uint32, error) {
+
+	image, err := LoadDDSImage(imagepath)
 	if err != nil {
 		return 0, err
 	}
 
-	var offset int32
-	for level := int32(0); level < mipMapCount && (width > 0 || height > 0); level++ {
+	return UploadImage(image)
+
+}
 
-		size := int32(((width + 3) / 4) * ((height + 3) / 4) * blockSize)
+// LoadKTX reads a KTX 1 or KTX2 texture with LoadKTXImage and uploads it with UploadImage
+func LoadKTX(imagepath string) (uint32, error) {
 
-		gl.CompressedTexImage2D(gl.TEXTURE_2D, level, format, width, height, 0, size, gl.Ptr(&buffer[offset]))
+	image, err := LoadKTXImage(imagepath)
+	if err != nil {
+		return 0, err
+	}
 
-		offset += size
-		width /= 2
-		height /= 2
+	return UploadImage(image)
 
-		//// Deal with Non-Power-Of-Two textures. This code is not included in the webpage to reduce clutter.
-		if width < 1 {
-			width = 1
-		}
+}
 
-		if height < 1 {
-			height = 1
-		}
+// LoadTexture decodes a picture in any format LoadImage knows and uploads it with UploadImage. With srgb colour
+// pictures are sampled as sRGB, so shaders read them back linear, which suits albedo but not normal maps or other
+// data. Floating point pictures such as HDR are always linear, and DDS and KTX files that are sRGB stay so either way.
+func LoadTexture(path string, srgb bool) (uint32, error) {
 
+	image, _, err := LoadImage(path)
+	if err != nil {
+		return 0, err
 	}
+	image.SRGB = image.SRGB || srgb
 
-	return textureId, nil
+	return UploadImage(image)
 
 }
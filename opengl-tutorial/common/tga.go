@@ -0,0 +1,297 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Image types of a TGA header, the RLE compressed ones are the same plus 8
+const (
+	tgaColourMapped = 1
+	tgaTrueColour   = 2
+	tgaGrey         = 3
+	tgaRLE          = 8
+)
+
+const (
+	tgaHeaderSize = 18
+
+	// Bits of the image descriptor
+	tgaAlphaBits   = 0x0f
+	tgaRightToLeft = 0x10
+	tgaTopDown     = 0x20
+
+	tgaMaxPixels = 1 << 28
+)
+
+var (
+	ErrTgaHeader      = errors.New("Invalid TGA header")
+	ErrTgaData        = errors.New("Invalid TGA data")
+	ErrTgaUnsupported = errors.New("Unsupported TGA")
+)
+
+// LoadTga decodes a Truevision TGA into an Image without needing a GL context
+func LoadTga(path string) (*Image, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	image, err := LoadTgaFrom(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return image, nil
+
+}
+
+// LoadTgaFrom decodes colour mapped, true colour and greyscale TGAs, RLE compressed or not, in 8, 15, 16, 24 and 32
+// bits per pixel. Like LoadBmpFrom the rows come back bottom up whichever way the file stores them. True colour and
+// colour mapped images are RGBA when the descriptor gives them alpha bits and RGB otherwise, greyscale ones L8 or LA8.
+func LoadTgaFrom(reader io.Reader) (*Image, error) {
+
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < tgaHeaderSize {
+		return nil, fmt.Errorf("%w: file is only %d bytes", ErrTgaHeader, len(data))
+	}
+
+	idLength := int(data[0])
+	colourMapType := data[1]
+	imageType := int(data[2])
+	colourMapFirst := int(binary.LittleEndian.Uint16(data[3:]))
+	colourMapLength := int(binary.LittleEndian.Uint16(data[5:]))
+	colourMapDepth := int(data[7])
+	width := int(binary.LittleEndian.Uint16(data[12:]))
+	height := int(binary.LittleEndian.Uint16(data[14:]))
+	pixelDepth := int(data[16])
+	descriptor := data[17]
+
+	if !tgaHeaderValid(data) {
+		return nil, fmt.Errorf("%w: image type %d with %d bits per pixel", ErrTgaHeader, imageType, pixelDepth)
+	}
+	if width == 0 || height == 0 || width*height > tgaMaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTgaHeader, width, height)
+	}
+
+	rle := imageType&tgaRLE != 0
+	baseType := imageType &^ tgaRLE
+	alpha := descriptor&tgaAlphaBits != 0
+
+	image := &Image{Width: width, Height: height}
+	switch {
+	case baseType == tgaGrey && pixelDepth == 8:
+		image.Format = ImageL8
+	case baseType == tgaGrey && pixelDepth == 16:
+		image.Format = ImageLA8
+	case baseType == tgaGrey:
+		return nil, fmt.Errorf("%w: %d bit greyscale", ErrTgaUnsupported, pixelDepth)
+	case alpha:
+		image.Format = ImageRGBA8
+	default:
+		image.Format = ImageRGB8
+	}
+
+	offset := tgaHeaderSize + idLength
+	if offset > len(data) {
+		return nil, fmt.Errorf("%w: file ends in the image ID", ErrTgaData)
+	}
+
+	// Colour maps are read into the same layout as true colour pixels of their depth
+	var colourMap [][4]byte
+	if colourMapType == 1 {
+
+		entrySize := (colourMapDepth + 7) / 8
+		if offset+colourMapLength*entrySize > len(data) {
+			return nil, fmt.Errorf("%w: file ends in the colour map", ErrTgaData)
+		}
+
+		colourMap = make([][4]byte, colourMapFirst+colourMapLength)
+		for i := 0; i < colourMapLength; i++ {
+			colourMap[colourMapFirst+i], err = tgaColour(data[offset+i*entrySize:], colourMapDepth, alpha)
+			if err != nil {
+				return nil, err
+			}
+		}
+		offset += colourMapLength * entrySize
+
+	}
+	if baseType == tgaColourMapped && colourMap == nil {
+		return nil, fmt.Errorf("%w: colour mapped image without a colour map", ErrTgaHeader)
+	}
+
+	pixelSize := (pixelDepth + 7) / 8
+	pixelCount := width * height
+	pixels := data[offset:]
+
+	// Packets of RLE data are expanded first so both kinds decode the same way
+	if rle {
+		if pixels, err = decodeTgaRLE(pixels, pixelSize, pixelCount); err != nil {
+			return nil, err
+		}
+	}
+	if len(pixels) < pixelCount*pixelSize {
+		return nil, fmt.Errorf("%w: %d bytes of pixel data, %dx%d at %d bits per pixel needs %d", ErrTgaData,
+			len(pixels), width, height, pixelDepth, pixelCount*pixelSize)
+	}
+
+	channels := image.Format.BytesPerPixel()
+	image.Pixels = make([]byte, pixelCount*channels)
+
+	for y := 0; y < height; y++ {
+
+		// Rows are stored bottom up unless the descriptor says otherwise, as are pixels left to right
+		row := y
+		if descriptor&tgaTopDown != 0 {
+			row = height - 1 - y
+		}
+
+		for x := 0; x < width; x++ {
+
+			column := x
+			if descriptor&tgaRightToLeft != 0 {
+				column = width - 1 - x
+			}
+
+			source := pixels[(y*width+x)*pixelSize:]
+			var colour [4]byte
+
+			switch baseType {
+			case tgaGrey:
+				colour = [4]byte{source[0], source[pixelSize-1]}
+			case tgaColourMapped:
+				index := int(source[0])
+				if pixelSize == 2 {
+					index = int(binary.LittleEndian.Uint16(source))
+				}
+				if index >= len(colourMap) {
+					return nil, fmt.Errorf("%w: colour %d outside the colour map", ErrTgaData, index)
+				}
+				colour = colourMap[index]
+			default:
+				if colour, err = tgaColour(source, pixelDepth, alpha); err != nil {
+					return nil, err
+				}
+			}
+
+			target := (row*width + column) * channels
+			copy(image.Pixels[target:target+channels], colour[:channels])
+
+		}
+
+	}
+
+	return image, nil
+
+}
+
+// tgaHeaderValid checks the fields of a TGA header that only have a few allowed values. TGA files have no magic
+// number, so it's also how LoadImageFrom recognises them.
+func tgaHeaderValid(header []byte) bool {
+
+	if len(header) < tgaHeaderSize {
+		return false
+	}
+
+	colourMapType, imageType, colourMapDepth, pixelDepth := header[1], int(header[2]), int(header[7]), int(header[16])
+	// The top two bits of the descriptor were for interleaving, which nothing has written in decades
+	if colourMapType > 1 || header[17]&0xc0 != 0 {
+		return false
+	}
+	if colourMapType == 1 && colourMapDepth != 15 && colourMapDepth != 16 && colourMapDepth != 24 &&
+		colourMapDepth != 32 {
+		return false
+	}
+
+	switch imageType &^ tgaRLE {
+	case tgaColourMapped:
+		return colourMapType == 1 && (pixelDepth == 8 || pixelDepth == 16)
+	case tgaTrueColour:
+		return pixelDepth == 15 || pixelDepth == 16 || pixelDepth == 24 || pixelDepth == 32
+	case tgaGrey:
+		return pixelDepth == 8 || pixelDepth == 16
+	}
+
+	return false
+
+}
+
+// tgaColour reads a BGR or BGRA pixel, or an ARGB 1555 one at 15 and 16 bits, as RGBA
+func tgaColour(data []byte, depth int, alpha bool) ([4]byte, error) {
+
+	switch depth {
+	case 15, 16:
+		pixel := uint32(binary.LittleEndian.Uint16(data))
+		colour := [4]byte{tgaChannels[0].value(pixel), tgaChannels[1].value(pixel), tgaChannels[2].value(pixel), 255}
+		if alpha && pixel&0x8000 == 0 {
+			colour[3] = 0
+		}
+		return colour, nil
+	case 24:
+		return [4]byte{data[2], data[1], data[0], 255}, nil
+	case 32:
+		if !alpha {
+			return [4]byte{data[2], data[1], data[0], 255}, nil
+		}
+		return [4]byte{data[2], data[1], data[0], data[3]}, nil
+	}
+
+	return [4]byte{}, fmt.Errorf("%w: %d bit colours", ErrTgaUnsupported, depth)
+
+}
+
+var tgaChannels = [3]maskChannel{newMaskChannel(0x7c00), newMaskChannel(0x03e0), newMaskChannel(0x001f)}
+
+// decodeTgaRLE expands packets that either repeat one pixel or hold up to 128 pixels as they are
+func decodeTgaRLE(data []byte, pixelSize int, pixelCount int) ([]byte, error) {
+
+	pixels := make([]byte, 0, pixelCount*pixelSize)
+	offset := 0
+
+	for len(pixels) < pixelCount*pixelSize {
+
+		if offset >= len(data) {
+			return nil, fmt.Errorf("%w: RLE data ends after %d of %d pixels", ErrTgaData, len(pixels)/pixelSize,
+				pixelCount)
+		}
+
+		packet := data[offset]
+		count := int(packet&0x7f) + 1
+		offset++
+
+		if packet&0x80 != 0 {
+
+			if offset+pixelSize > len(data) {
+				return nil, fmt.Errorf("%w: RLE data ends in a run", ErrTgaData)
+			}
+			for i := 0; i < count; i++ {
+				pixels = append(pixels, data[offset:offset+pixelSize]...)
+			}
+			offset += pixelSize
+
+		} else {
+
+			if offset+count*pixelSize > len(data) {
+				return nil, fmt.Errorf("%w: RLE data ends in raw pixels", ErrTgaData)
+			}
+			pixels = append(pixels, data[offset:offset+count*pixelSize]...)
+			offset += count * pixelSize
+
+		}
+
+	}
+
+	// Packets may run across the end of the last row
+	return pixels[:pixelCount*pixelSize], nil
+
+}
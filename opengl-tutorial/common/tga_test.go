@@ -0,0 +1,195 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// tgaFile builds a TGA with a two byte image ID ahead of the colour map, which is left out when colourMap is nil
+func tgaFile(imageType int, width int, height int, pixelDepth int, descriptor byte, colourMapDepth int,
+	colourMap []byte, pixels []byte) []byte {
+
+	var buffer bytes.Buffer
+	colourMapType, colourMapLength := byte(0), 0
+	if colourMap != nil {
+		colourMapType, colourMapLength = 1, len(colourMap)/((colourMapDepth+7)/8)
+	}
+
+	buffer.Write([]byte{2, colourMapType, byte(imageType)})
+	binary.Write(&buffer, binary.LittleEndian, []uint16{0, uint16(colourMapLength)})
+	buffer.WriteByte(byte(colourMapDepth))
+	binary.Write(&buffer, binary.LittleEndian, []uint16{0, 0, uint16(width), uint16(height)})
+	buffer.Write([]byte{byte(pixelDepth), descriptor})
+	buffer.WriteString("id")
+	buffer.Write(colourMap)
+	buffer.Write(pixels)
+
+	return buffer.Bytes()
+
+}
+
+// Blue then red, stored as BGR
+var tgaTestColourMap = []byte{255, 0, 0, 0, 0, 255}
+
+func TestLoadTgaFrom(t *testing.T) {
+
+	// Four BGR pixels, the bottom row first in the file unless the descriptor says otherwise
+	twoRows := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format ImageFormat
+		pixels []byte
+	}{
+		{
+			name:   "bottom up",
+			data:   tgaFile(tgaTrueColour, 2, 2, 24, 0, 0, nil, twoRows),
+			format: ImageRGB8,
+			pixels: []byte{3, 2, 1, 6, 5, 4, 9, 8, 7, 12, 11, 10},
+		},
+		{
+			name:   "top down",
+			data:   tgaFile(tgaTrueColour, 2, 2, 24, tgaTopDown, 0, nil, twoRows),
+			format: ImageRGB8,
+			pixels: []byte{9, 8, 7, 12, 11, 10, 3, 2, 1, 6, 5, 4},
+		},
+		{
+			name:   "right to left",
+			data:   tgaFile(tgaTrueColour, 2, 1, 24, tgaRightToLeft, 0, nil, twoRows[:6]),
+			format: ImageRGB8,
+			pixels: []byte{6, 5, 4, 3, 2, 1},
+		},
+		{
+			name:   "32 bit with alpha",
+			data:   tgaFile(tgaTrueColour, 1, 1, 32, 8, 0, nil, []byte{10, 20, 30, 40}),
+			format: ImageRGBA8,
+			pixels: []byte{30, 20, 10, 40},
+		},
+		{
+			name:   "32 bit without alpha bits",
+			data:   tgaFile(tgaTrueColour, 1, 1, 32, 0, 0, nil, []byte{10, 20, 30, 40}),
+			format: ImageRGB8,
+			pixels: []byte{30, 20, 10},
+		},
+		{
+			// ARGB 1555, a red pixel with the alpha bit clear and a green one with it set
+			name:   "16 bit with alpha",
+			data:   tgaFile(tgaTrueColour, 2, 1, 16, 1, 0, nil, []byte{0x00, 0x7c, 0xe0, 0x83}),
+			format: ImageRGBA8,
+			pixels: []byte{255, 0, 0, 0, 0, 255, 0, 255},
+		},
+		{
+			name:   "15 bit",
+			data:   tgaFile(tgaTrueColour, 1, 1, 15, 0, 0, nil, []byte{0x1f, 0x00}),
+			format: ImageRGB8,
+			pixels: []byte{0, 0, 255},
+		},
+		{
+			name:   "greyscale",
+			data:   tgaFile(tgaGrey, 2, 1, 8, 0, 0, nil, []byte{50, 150}),
+			format: ImageL8,
+			pixels: []byte{50, 150},
+		},
+		{
+			name:   "greyscale with alpha",
+			data:   tgaFile(tgaGrey, 1, 1, 16, 8, 0, nil, []byte{50, 150}),
+			format: ImageLA8,
+			pixels: []byte{50, 150},
+		},
+		{
+			name:   "colour mapped",
+			data:   tgaFile(tgaColourMapped, 3, 1, 8, 0, 24, tgaTestColourMap, []byte{1, 0, 1}),
+			format: ImageRGB8,
+			pixels: []byte{255, 0, 0, 0, 0, 255, 255, 0, 0},
+		},
+		{
+			name:   "colour mapped with 16 bit indices",
+			data:   tgaFile(tgaColourMapped, 2, 1, 16, 0, 24, tgaTestColourMap, []byte{0, 0, 1, 0}),
+			format: ImageRGB8,
+			pixels: []byte{0, 0, 255, 255, 0, 0},
+		},
+		{
+			// A colour map on a true colour image is only a suggested palette and is skipped
+			name:   "true colour with a colour map",
+			data:   tgaFile(tgaTrueColour, 1, 1, 24, 0, 24, tgaTestColourMap, []byte{1, 2, 3}),
+			format: ImageRGB8,
+			pixels: []byte{3, 2, 1},
+		},
+		{
+			// A run of two then one raw pixel
+			name:   "RLE",
+			data:   tgaFile(tgaTrueColour|tgaRLE, 3, 1, 24, 0, 0, nil, []byte{0x81, 1, 2, 3, 0x00, 4, 5, 6}),
+			format: ImageRGB8,
+			pixels: []byte{3, 2, 1, 3, 2, 1, 6, 5, 4},
+		},
+		{
+			// One run covers both rows, and the raw packet after it is past the last pixel
+			name:   "RLE across rows",
+			data:   tgaFile(tgaTrueColour|tgaRLE, 2, 2, 24, tgaTopDown, 0, nil, []byte{0x83, 1, 2, 3, 0x00, 9, 9, 9}),
+			format: ImageRGB8,
+			pixels: []byte{3, 2, 1, 3, 2, 1, 3, 2, 1, 3, 2, 1},
+		},
+		{
+			name:   "RLE colour mapped",
+			data:   tgaFile(tgaColourMapped|tgaRLE, 3, 1, 8, 0, 24, tgaTestColourMap, []byte{0x01, 1, 0, 0x80, 1}),
+			format: ImageRGB8,
+			pixels: []byte{255, 0, 0, 0, 0, 255, 255, 0, 0},
+		},
+		{
+			name:   "RLE greyscale top down",
+			data:   tgaFile(tgaGrey|tgaRLE, 1, 3, 8, tgaTopDown, 0, nil, []byte{0x81, 20, 0x80, 80}),
+			format: ImageL8,
+			pixels: []byte{80, 20, 20},
+		},
+	}
+
+	for _, test := range tests {
+
+		image, err := LoadTgaFrom(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if image.Format != test.format || !bytes.Equal(image.Pixels, test.pixels) {
+			t.Errorf("%s: %v pixels %v, want %v %v", test.name, image.Format, image.Pixels, test.format, test.pixels)
+		}
+
+	}
+
+}
+
+func TestLoadTgaFromInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"too short", make([]byte, tgaHeaderSize-1), ErrTgaHeader},
+		{"unknown image type", tgaFile(4, 1, 1, 24, 0, 0, nil, []byte{1, 2, 3}), ErrTgaHeader},
+		{"true colour at 8 bits", tgaFile(tgaTrueColour, 1, 1, 8, 0, 0, nil, []byte{1}), ErrTgaHeader},
+		{"interleaved", tgaFile(tgaTrueColour, 1, 1, 24, 0x40, 0, nil, []byte{1, 2, 3}), ErrTgaHeader},
+		{"no pixels", tgaFile(tgaTrueColour, 0, 1, 24, 0, 0, nil, nil), ErrTgaHeader},
+		{"colour mapped without a colour map", tgaFile(tgaColourMapped, 1, 1, 8, 0, 0, nil, []byte{0}), ErrTgaHeader},
+		{"file ends in the image ID", tgaFile(tgaTrueColour, 1, 1, 24, 0, 0, nil, nil)[:tgaHeaderSize+1],
+			ErrTgaData},
+		{"file ends in the colour map", tgaFile(tgaColourMapped, 1, 1, 8, 0, 24, tgaTestColourMap, nil)[:23],
+			ErrTgaData},
+		{"short pixel data", tgaFile(tgaTrueColour, 2, 2, 24, 0, 0, nil, make([]byte, 11)), ErrTgaData},
+		{"colour past the colour map", tgaFile(tgaColourMapped, 1, 1, 8, 0, 24, tgaTestColourMap, []byte{2}),
+			ErrTgaData},
+		{"RLE without enough packets", tgaFile(tgaGrey|tgaRLE, 4, 1, 8, 0, 0, nil, []byte{0x81, 1}), ErrTgaData},
+		{"RLE ends in a run", tgaFile(tgaTrueColour|tgaRLE, 2, 1, 24, 0, 0, nil, []byte{0x81, 1, 2}), ErrTgaData},
+		{"RLE ends in raw pixels", tgaFile(tgaGrey|tgaRLE, 4, 1, 8, 0, 0, nil, []byte{0x03, 1, 2}), ErrTgaData},
+	}
+
+	for _, test := range tests {
+		if _, err := LoadTgaFrom(bytes.NewReader(test.data)); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
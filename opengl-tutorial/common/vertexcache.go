@@ -0,0 +1,406 @@
+package common
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Size of the cache simulated by OptimizeVertexCache, larger than most hardware so the ordering degrades gracefully
+const VertexCacheSize = 32
+
+// Scoring constants from Tom Forsyth's "Linear-Speed Vertex Cache Optimisation"
+const (
+	forsythCacheDecayPower   = 1.5
+	forsythLastTriangleScore = 0.75
+	forsythValenceBoostScale = 2.0
+	forsythValenceBoostPower = 0.5
+)
+
+// ACMR is the average cache miss ratio of drawing the triangle list in indices through a FIFO post transform cache of
+// cacheSize vertices: the number of vertices transformed per triangle, between 0.5 for an ideal mesh and 3.
+func ACMR(indices []uint32, cacheSize int) float32 {
+
+	if len(indices) < 3 {
+		return 0
+	}
+
+	var misses int
+	cache := make([]uint32, 0, cacheSize)
+
+	for _, index := range indices {
+
+		hit := false
+		for _, cached := range cache {
+			if cached == index {
+				hit = true
+				break
+			}
+		}
+
+		if hit {
+			continue
+		}
+
+		misses++
+		if len(cache) == cacheSize {
+			cache = append(cache[:0], cache[1:]...)
+		}
+		cache = append(cache, index)
+
+	}
+
+	return float32(misses) / float32(len(indices)/3)
+
+}
+
+// OptimizeVertexCache reorders the triangles of an indexed triangle list, as returned by IndexVBO, so consecutive
+// triangles reuse recently transformed vertices. Vertices aren't moved, follow up with OptimizeVertexFetch.
+func OptimizeVertexCache(indices []uint32, vertexCount int) []uint32 {
+
+	triangleCount := len(indices) / 3
+	optimized := make([]uint32, 0, triangleCount*3)
+
+	// Triangles using each vertex packed into one slice, vertex v's are vertexTriangles[start[v]:start[v]+valence[v]].
+	// Drawn triangles are swapped past the end of the range so valence only counts the ones left.
+	valence := make([]int, vertexCount)
+	for _, index := range indices[:triangleCount*3] {
+		valence[index]++
+	}
+
+	start := make([]int, vertexCount+1)
+	for v := 0; v < vertexCount; v++ {
+		start[v+1] = start[v] + valence[v]
+	}
+
+	vertexTriangles := make([]int, start[vertexCount])
+	filled := make([]int, vertexCount)
+	for t := 0; t < triangleCount; t++ {
+		for _, index := range indices[t*3 : t*3+3] {
+			vertexTriangles[start[index]+filled[index]] = t
+			filled[index]++
+		}
+	}
+
+	cachePosition := make([]int, vertexCount)
+	vertexScores := make([]float32, vertexCount)
+	for v := range cachePosition {
+		cachePosition[v] = -1
+		vertexScores[v] = forsythVertexScore(-1, valence[v])
+	}
+
+	triangleScores := make([]float32, triangleCount)
+	emitted := make([]bool, triangleCount)
+	for t := range triangleScores {
+		for _, index := range indices[t*3 : t*3+3] {
+			triangleScores[t] += vertexScores[index]
+		}
+	}
+
+	cache := make([]uint32, 0, VertexCacheSize+3)
+	nextUnemitted := 0
+	best := -1
+
+	for len(optimized) < triangleCount*3 {
+
+		// Nothing in the cache is adjacent to another triangle, start again from the first one left
+		if best < 0 {
+			for emitted[nextUnemitted] {
+				nextUnemitted++
+			}
+			best = nextUnemitted
+		}
+
+		triangle := indices[best*3 : best*3+3]
+		optimized = append(optimized, triangle...)
+		emitted[best] = true
+
+		// Move the triangle's vertices to the front of the LRU cache
+		newCache := make([]uint32, 0, VertexCacheSize+3)
+		newCache = append(newCache, triangle...)
+		for _, cached := range cache {
+			if cached != triangle[0] && cached != triangle[1] && cached != triangle[2] {
+				newCache = append(newCache, cached)
+			}
+		}
+
+		for _, index := range triangle {
+			remaining := vertexTriangles[start[index] : start[index]+valence[index]]
+			for i, t := range remaining {
+				if t == best {
+					remaining[i], remaining[len(remaining)-1] = remaining[len(remaining)-1], remaining[i]
+					break
+				}
+			}
+			valence[index]--
+		}
+
+		// Rescore the vertices in the cache and those that just fell out of it
+		for i, index := range newCache {
+
+			position := i
+			if position >= VertexCacheSize {
+				position = -1
+			}
+			cachePosition[index] = position
+
+			score := forsythVertexScore(position, valence[index])
+			delta := score - vertexScores[index]
+			vertexScores[index] = score
+
+			for _, t := range vertexTriangles[start[index] : start[index]+valence[index]] {
+				triangleScores[t] += delta
+			}
+
+		}
+
+		if len(newCache) > VertexCacheSize {
+			newCache = newCache[:VertexCacheSize]
+		}
+		cache = newCache
+
+		// The best next triangle is one touching the cache
+		best = -1
+		bestScore := float32(-1)
+		for _, index := range cache {
+			for _, t := range vertexTriangles[start[index] : start[index]+valence[index]] {
+				if triangleScores[t] > bestScore {
+					best = t
+					bestScore = triangleScores[t]
+				}
+			}
+		}
+
+	}
+
+	return optimized
+
+}
+
+// forsythVertexScore rates how much drawing a triangle using the vertex now would help, cachePosition is -1 when it
+// isn't cached
+func forsythVertexScore(cachePosition int, remainingTriangles int) float32 {
+
+	// No triangle left to use it
+	if remainingTriangles == 0 {
+		return -1
+	}
+
+	var score float64
+	if cachePosition >= 0 {
+		if cachePosition < 3 {
+			// The vertices of the last triangle get a fixed score so it isn't immediately reused
+			score = forsythLastTriangleScore
+		} else {
+			scale := 1.0 / float64(VertexCacheSize-3)
+			score = math.Pow(1.0-float64(cachePosition-3)*scale, forsythCacheDecayPower)
+		}
+	}
+
+	// Boost vertices with few triangles left so lone triangles don't get stranded
+	score += forsythValenceBoostScale * math.Pow(float64(remainingTriangles), -forsythValenceBoostPower)
+
+	return float32(score)
+
+}
+
+// OptimizeOverdraw reorders the output of OptimizeVertexCache to reduce overdraw. The triangles are split into clusters
+// where the cache starts cold, so their order can change without hurting the cache much, and the clusters facing away
+// from the center of the mesh are drawn first as they're the most likely to hide the others.
+func OptimizeOverdraw(indices []uint32, vertices []mgl32.Vec3) []uint32 {
+
+	type cluster struct {
+		start, end int
+		sortKey    float32
+	}
+
+	var clusters []cluster
+	cache := make([]uint32, 0, VertexCacheSize)
+
+	for t := 0; t+2 < len(indices); t += 3 {
+
+		misses := 0
+		for _, index := range indices[t : t+3] {
+
+			cached := false
+			for _, c := range cache {
+				if c == index {
+					cached = true
+					break
+				}
+			}
+
+			if !cached {
+				misses++
+				if len(cache) == VertexCacheSize {
+					cache = append(cache[:0], cache[1:]...)
+				}
+				cache = append(cache, index)
+			}
+
+		}
+
+		if misses == 3 || len(clusters) == 0 {
+			clusters = append(clusters, cluster{start: t})
+		}
+		clusters[len(clusters)-1].end = t + 3
+
+	}
+
+	// Area weighted centroid of the whole mesh, and of each cluster along with its average normal
+	var meshCentroid mgl32.Vec3
+	var meshArea float32
+	centroids := make([]mgl32.Vec3, len(clusters))
+	normals := make([]mgl32.Vec3, len(clusters))
+
+	for c, cl := range clusters {
+
+		var area float32
+		for t := cl.start; t < cl.end; t += 3 {
+
+			a, b, v := vertices[indices[t]], vertices[indices[t+1]], vertices[indices[t+2]]
+			normal := b.Sub(a).Cross(v.Sub(a))
+			triangleArea := normal.Len() / 2
+			centroid := a.Add(b).Add(v).Mul(1.0 / 3.0)
+
+			centroids[c] = centroids[c].Add(centroid.Mul(triangleArea))
+			normals[c] = normals[c].Add(normal)
+			area += triangleArea
+
+		}
+
+		meshCentroid = meshCentroid.Add(centroids[c])
+		meshArea += area
+		if area > 0 {
+			centroids[c] = centroids[c].Mul(1 / area)
+		}
+
+	}
+
+	if meshArea > 0 {
+		meshCentroid = meshCentroid.Mul(1 / meshArea)
+	}
+
+	for c := range clusters {
+		if normals[c].Len() > 0 {
+			clusters[c].sortKey = centroids[c].Sub(meshCentroid).Dot(normals[c].Normalize())
+		}
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].sortKey > clusters[j].sortKey
+	})
+
+	optimized := make([]uint32, 0, len(indices))
+	for _, cl := range clusters {
+		optimized = append(optimized, indices[cl.start:cl.end]...)
+	}
+
+	return optimized
+
+}
+
+// OptimizeVertexFetch renumbers the vertices of an indexed triangle list in the order they're first drawn so the
+// vertex fetch walks through memory linearly. remap maps each old vertex to its new index, or to math.MaxUint32 for
+// vertices no triangle uses, and is applied to the attributes with RemapVec2 and RemapVec3.
+func OptimizeVertexFetch(indices []uint32, vertexCount int) ([]uint32, []uint32) {
+
+	remap := make([]uint32, vertexCount)
+	for i := range remap {
+		remap[i] = math.MaxUint32
+	}
+
+	optimized := make([]uint32, len(indices))
+	var next uint32
+
+	for i, index := range indices {
+
+		if remap[index] == math.MaxUint32 {
+			remap[index] = next
+			next++
+		}
+		optimized[i] = remap[index]
+
+	}
+
+	return optimized, remap
+
+}
+
+func RemapVec2(data []mgl32.Vec2, remap []uint32) []mgl32.Vec2 {
+
+	remapped := make([]mgl32.Vec2, remappedCount(remap))
+	for i, index := range remap {
+		if index != math.MaxUint32 {
+			remapped[index] = data[i]
+		}
+	}
+
+	return remapped
+
+}
+
+func RemapVec3(data []mgl32.Vec3, remap []uint32) []mgl32.Vec3 {
+
+	remapped := make([]mgl32.Vec3, remappedCount(remap))
+	for i, index := range remap {
+		if index != math.MaxUint32 {
+			remapped[index] = data[i]
+		}
+	}
+
+	return remapped
+
+}
+
+func remappedCount(remap []uint32) int {
+
+	var count int
+	for _, index := range remap {
+		if index != math.MaxUint32 {
+			count++
+		}
+	}
+
+	return count
+
+}
+
+// OptimizeVBO runs the vertex cache, overdraw and vertex fetch optimisations over the output of IndexVBO
+func OptimizeVBO(indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	indices = OptimizeVertexCache(indices, len(vertices))
+	indices = OptimizeOverdraw(indices, vertices)
+	indices, remap := OptimizeVertexFetch(indices, len(vertices))
+
+	return indices, RemapVec3(vertices, remap), RemapVec2(uvs, remap), RemapVec3(normals, remap)
+
+}
+
+// Optimize runs the optimisations of OptimizeVBO over an IndexedMesh, remapping all of its attributes. Overdraw is only
+// optimised when the first attribute holds 3D positions.
+func (mesh *IndexedMesh) Optimize() {
+
+	vertexCount := mesh.VertexCount()
+	indices := OptimizeVertexCache(mesh.Indices, vertexCount)
+	if len(mesh.Attributes) > 0 && mesh.Attributes[0].Size == 3 {
+		indices = OptimizeOverdraw(indices, mesh.Attributes[0].Vec3s())
+	}
+	indices, remap := OptimizeVertexFetch(indices, vertexCount)
+
+	for a, attribute := range mesh.Attributes {
+
+		remapped := make([]float32, remappedCount(remap)*attribute.Size)
+		for i, index := range remap {
+			if index != math.MaxUint32 {
+				copy(remapped[int(index)*attribute.Size:], attribute.Data[i*attribute.Size:(i+1)*attribute.Size])
+			}
+		}
+		mesh.Attributes[a].Data = remapped
+
+	}
+
+	mesh.Indices = indices
+
+}
@@ -0,0 +1,123 @@
+package common
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func loadIndexedSuzanne(t testing.TB) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	vertices, uvs, normals, err := LoadObj("../08-basic-shading/suzanne.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return IndexVBO(vertices, uvs, normals)
+
+}
+
+// sortedTriangles lists the triangles of an index buffer as the positions of their corners in a canonical order, each
+// rotated to start at its smallest position so the winding is kept
+func sortedTriangles(indices []uint32, vertices []mgl32.Vec3) [][3]mgl32.Vec3 {
+
+	less := func(a mgl32.Vec3, b mgl32.Vec3) bool {
+		for c := range a {
+			if a[c] != b[c] {
+				return a[c] < b[c]
+			}
+		}
+		return false
+	}
+
+	triangles := make([][3]mgl32.Vec3, 0, len(indices)/3)
+	for i := 0; i+2 < len(indices); i += 3 {
+
+		corners := [3]mgl32.Vec3{vertices[indices[i]], vertices[indices[i+1]], vertices[indices[i+2]]}
+		for less(corners[1], corners[0]) || less(corners[2], corners[0]) {
+			corners = [3]mgl32.Vec3{corners[1], corners[2], corners[0]}
+		}
+		triangles = append(triangles, corners)
+
+	}
+
+	sort.Slice(triangles, func(i, j int) bool {
+		for c := range triangles[i] {
+			if triangles[i][c] != triangles[j][c] {
+				return less(triangles[i][c], triangles[j][c])
+			}
+		}
+		return false
+	})
+
+	return triangles
+
+}
+
+func sameTriangles(t *testing.T, name string, before [][3]mgl32.Vec3, after [][3]mgl32.Vec3) {
+
+	if len(before) != len(after) {
+		t.Fatalf("%s: %d triangles, want %d", name, len(after), len(before))
+	}
+
+	for i := range before {
+		if before[i] != after[i] {
+			t.Fatalf("%s: triangle %v isn't in the input", name, after[i])
+		}
+	}
+
+}
+
+func TestOptimizeVertexCache(t *testing.T) {
+
+	indices, vertices, _, _ := loadIndexedSuzanne(t)
+	optimized := OptimizeVertexCache(indices, len(vertices))
+
+	// Triangles keep their corners and winding, and none are dropped or repeated
+	sameTriangles(t, "OptimizeVertexCache", sortedTriangles(indices, vertices), sortedTriangles(optimized, vertices))
+
+	for _, cacheSize := range []int{16, VertexCacheSize} {
+
+		before, after := ACMR(indices, cacheSize), ACMR(optimized, cacheSize)
+		if after >= before {
+			t.Errorf("ACMR with %d vertices cached went from %v to %v", cacheSize, before, after)
+		}
+
+		// Suzanne has about as many vertices as triangles, so a good order gets close to 1
+		if after > 1.1 {
+			t.Errorf("ACMR with %d vertices cached is %v", cacheSize, after)
+		}
+
+	}
+
+}
+
+func TestOptimizeVBO(t *testing.T) {
+
+	indices, vertices, uvs, normals := loadIndexedSuzanne(t)
+	optimized, optimizedVertices, optimizedUvs, optimizedNormals := OptimizeVBO(indices, vertices, uvs, normals)
+
+	sameTriangles(t, "OptimizeVBO", sortedTriangles(indices, vertices),
+		sortedTriangles(optimized, optimizedVertices))
+
+	if len(optimizedVertices) != len(vertices) || len(optimizedUvs) != len(uvs) ||
+		len(optimizedNormals) != len(normals) {
+		t.Errorf("OptimizeVBO kept %d of %d vertices", len(optimizedVertices), len(vertices))
+	}
+	if ACMR(optimized, VertexCacheSize) >= ACMR(indices, VertexCacheSize) {
+		t.Errorf("ACMR went from %v to %v", ACMR(indices, VertexCacheSize), ACMR(optimized, VertexCacheSize))
+	}
+
+	// Vertices are numbered in the order they're first drawn
+	next := uint32(0)
+	for _, index := range optimized {
+		if index > next {
+			t.Fatalf("Vertex %d drawn before vertex %d", index, next)
+		}
+		if index == next {
+			next++
+		}
+	}
+
+}
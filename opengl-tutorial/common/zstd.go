@@ -0,0 +1,1041 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	zstdMagic          = 0xfd2fb528
+	zstdSkippableMagic = 0x184d2a50
+	zstdSkippableMask  = 0xfffffff0
+
+	// Blocks never hold more than this either compressed or decompressed
+	zstdMaxBlockSize = 128 << 10
+
+	zstdMaxHuffmanBits    = 11
+	zstdMaxWeightLog      = 6
+	zstdMaxLiteralLog     = 9
+	zstdMaxMatchLog       = 9
+	zstdMaxOffsetLog      = 8
+	zstdMaxLiteralSymbol  = 35
+	zstdMaxMatchSymbol    = 52
+	zstdMaxOffsetSymbol   = 31
+	zstdMaxHuffmanWeights = 255
+)
+
+// Block types of a block header
+const (
+	zstdRawBlock        = 0
+	zstdRLEBlock        = 1
+	zstdCompressedBlock = 2
+)
+
+// Literals section types, which for the sequence tables are the predefined, RLE, FSE compressed and repeat modes
+const (
+	zstdRawLiterals        = 0
+	zstdRLELiterals        = 1
+	zstdCompressedLiterals = 2
+	zstdTreelessLiterals   = 3
+
+	zstdPredefinedMode = 0
+	zstdRLEMode        = 1
+	zstdCompressedMode = 2
+	zstdRepeatMode     = 3
+)
+
+var (
+	ErrZstdData        = errors.New("Invalid Zstandard data")
+	ErrZstdUnsupported = errors.New("Unsupported Zstandard")
+)
+
+// Distributions of the sequence codes used in the predefined mode, where -1 is a probability below 1
+var (
+	zstdLiteralDistribution = []int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2,
+		1, 1, 1, 1, 1, -1, -1, -1, -1}
+	zstdMatchDistribution = []int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}
+	zstdOffsetDistribution = []int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1}
+)
+
+var (
+	zstdLiteralTable = newZstdFSETable(zstdLiteralDistribution, 6)
+	zstdMatchTable   = newZstdFSETable(zstdMatchDistribution, 6)
+	zstdOffsetTable  = newZstdFSETable(zstdOffsetDistribution, 5)
+)
+
+// Literal and match length codes are a baseline plus a number of extra bits read after them
+var (
+	zstdLiteralBaselines = [zstdMaxLiteralSymbol + 1]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	zstdLiteralExtraBits = [zstdMaxLiteralSymbol + 1]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	zstdMatchBaselines = [zstdMaxMatchSymbol + 1]uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19,
+		20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131,
+		259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539}
+	zstdMatchExtraBits = [zstdMaxMatchSymbol + 1]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+)
+
+// zstdFrame is what carries over from one block of a frame to the next
+type zstdFrame struct {
+	output []byte
+	start  int
+	limit  int
+
+	huffman   *zstdHuffmanTable
+	literals  *zstdFSETable
+	matches   *zstdFSETable
+	offsets   *zstdFSETable
+	repeats   [3]int
+	hasTables bool
+}
+
+// DecompressZstd decodes every Zstandard frame in data one after another, skipping skippable frames, and checks their
+// content sizes and checksums. Decoding stops with an error rather than produce more than limit bytes. Frames that
+// need a dictionary aren't supported.
+func DecompressZstd(data []byte, limit int) ([]byte, error) {
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: no frames", ErrZstdData)
+	}
+
+	var output []byte
+
+	for len(data) > 0 {
+
+		if len(data) < 8 {
+			return nil, fmt.Errorf("%w: file ends in a frame header", ErrZstdData)
+		}
+
+		magic := binary.LittleEndian.Uint32(data)
+		if magic&zstdSkippableMask == zstdSkippableMagic {
+			size := binary.LittleEndian.Uint32(data[4:])
+			if uint64(size) > uint64(len(data)-8) {
+				return nil, fmt.Errorf("%w: skippable frame of %d bytes past the end", ErrZstdData, size)
+			}
+			data = data[8+size:]
+			continue
+		}
+		if magic != zstdMagic {
+			return nil, fmt.Errorf("%w: magic number %#x", ErrZstdData, magic)
+		}
+
+		frame := &zstdFrame{output: output, start: len(output), limit: limit, repeats: [3]int{1, 4, 8}}
+		read, err := frame.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		output = frame.output
+		data = data[read:]
+
+	}
+
+	return output, nil
+
+}
+
+// decode reads one frame after its magic number and returns how many bytes it took up
+func (frame *zstdFrame) decode(data []byte) (int, error) {
+
+	descriptor := data[4]
+	contentSizeFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	checksum := descriptor&0x04 != 0
+	dictionaryFlag := descriptor & 0x03
+	if descriptor&0x08 != 0 {
+		return 0, fmt.Errorf("%w: reserved bit of the frame header set", ErrZstdData)
+	}
+
+	dictionarySize := [4]int{0, 1, 2, 4}[dictionaryFlag]
+	contentSizeSize := [4]int{0, 2, 4, 8}[contentSizeFlag]
+	if singleSegment && contentSizeFlag == 0 {
+		contentSizeSize = 1
+	}
+
+	position := 5
+	if !singleSegment {
+		position++
+	}
+	if position+dictionarySize+contentSizeSize > len(data) {
+		return 0, fmt.Errorf("%w: file ends in a frame header", ErrZstdData)
+	}
+
+	var dictionary uint64
+	for i := 0; i < dictionarySize; i++ {
+		dictionary |= uint64(data[position+i]) << uint(8*i)
+	}
+	if dictionary != 0 {
+		return 0, fmt.Errorf("%w: frame needs dictionary %d", ErrZstdUnsupported, dictionary)
+	}
+	position += dictionarySize
+
+	contentSize := uint64(0)
+	for i := 0; i < contentSizeSize; i++ {
+		contentSize |= uint64(data[position+i]) << uint(8*i)
+	}
+	if contentSizeSize == 2 {
+		contentSize += 256
+	}
+	position += contentSizeSize
+
+	if contentSizeSize > 0 && contentSize > uint64(frame.limit-frame.start) {
+		return 0, fmt.Errorf("%w: frame of %d bytes after %d, more than the limit of %d", ErrZstdData, contentSize,
+			frame.start, frame.limit)
+	}
+
+	for last := false; !last; {
+
+		if position+3 > len(data) {
+			return 0, fmt.Errorf("%w: file ends in a block header", ErrZstdData)
+		}
+
+		header := int(data[position]) | int(data[position+1])<<8 | int(data[position+2])<<16
+		last = header&1 != 0
+		blockType := header >> 1 & 3
+		size := header >> 3
+		position += 3
+
+		stored := size
+		if blockType == zstdRLEBlock {
+			stored = 1
+		}
+		if size > zstdMaxBlockSize || position+stored > len(data) {
+			return 0, fmt.Errorf("%w: block of %d bytes at %d in %d", ErrZstdData, size, position, len(data))
+		}
+		if blockType != zstdCompressedBlock && len(frame.output)+size > frame.limit {
+			return 0, fmt.Errorf("%w: more than the limit of %d bytes", ErrZstdData, frame.limit)
+		}
+
+		block := data[position : position+stored]
+		switch blockType {
+		case zstdRawBlock:
+			frame.output = append(frame.output, block...)
+		case zstdRLEBlock:
+			for i := 0; i < size; i++ {
+				frame.output = append(frame.output, block[0])
+			}
+		case zstdCompressedBlock:
+			if err := frame.decodeBlock(block); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("%w: reserved block type", ErrZstdData)
+		}
+		position += stored
+
+	}
+
+	produced := len(frame.output) - frame.start
+	if contentSizeSize > 0 && uint64(produced) != contentSize {
+		return 0, fmt.Errorf("%w: frame holds %d bytes instead of %d", ErrZstdData, produced, contentSize)
+	}
+
+	if checksum {
+		if position+4 > len(data) {
+			return 0, fmt.Errorf("%w: file ends in the checksum", ErrZstdData)
+		}
+		want := binary.LittleEndian.Uint32(data[position:])
+		if sum := uint32(xxHash64(frame.output[frame.start:])); sum != want {
+			return 0, fmt.Errorf("%w: checksum %#x instead of %#x", ErrZstdData, sum, want)
+		}
+		position += 4
+	}
+
+	return position, nil
+
+}
+
+// decodeBlock decodes the literals and sequences of a compressed block and carries out the sequences
+func (frame *zstdFrame) decodeBlock(block []byte) error {
+
+	literals, read, err := frame.decodeLiterals(block)
+	if err != nil {
+		return err
+	}
+	block = block[read:]
+
+	if len(block) < 1 {
+		return fmt.Errorf("%w: block ends before its sequences", ErrZstdData)
+	}
+
+	count := int(block[0])
+	switch {
+	case count < 128:
+		block = block[1:]
+	case count < 255 && len(block) >= 2:
+		count = (count-128)<<8 | int(block[1])
+		block = block[2:]
+	case count == 255 && len(block) >= 3:
+		count = int(block[1]) | int(block[2])<<8 + 0x7f00
+		block = block[3:]
+	default:
+		return fmt.Errorf("%w: block ends in the number of sequences", ErrZstdData)
+	}
+
+	if count == 0 {
+		return frame.emit(literals)
+	}
+
+	if len(block) < 1 {
+		return fmt.Errorf("%w: block ends before the sequence modes", ErrZstdData)
+	}
+	modes := block[0]
+	if modes&3 != 0 {
+		return fmt.Errorf("%w: reserved bits of the sequence modes set", ErrZstdData)
+	}
+	block = block[1:]
+
+	tables := []struct {
+		table      **zstdFSETable
+		mode       byte
+		predefined *zstdFSETable
+		maxLog     uint
+		maxSymbol  int
+	}{
+		{&frame.literals, modes >> 6, zstdLiteralTable, zstdMaxLiteralLog, zstdMaxLiteralSymbol},
+		{&frame.offsets, modes >> 4 & 3, zstdOffsetTable, zstdMaxOffsetLog, zstdMaxOffsetSymbol},
+		{&frame.matches, modes >> 2 & 3, zstdMatchTable, zstdMaxMatchLog, zstdMaxMatchSymbol},
+	}
+
+	for _, table := range tables {
+		switch table.mode {
+		case zstdPredefinedMode:
+			*table.table = table.predefined
+		case zstdRLEMode:
+			if len(block) < 1 || int(block[0]) > table.maxSymbol {
+				return fmt.Errorf("%w: RLE sequence code", ErrZstdData)
+			}
+			*table.table = &zstdFSETable{states: []zstdFSEState{{symbol: block[0]}}}
+			block = block[1:]
+		case zstdCompressedMode:
+			distribution, read, err := readZstdDistribution(block, table.maxLog, table.maxSymbol)
+			if err != nil {
+				return err
+			}
+			*table.table = newZstdFSETable(distribution.counts, distribution.log)
+			block = block[read:]
+		case zstdRepeatMode:
+			if !frame.hasTables {
+				return fmt.Errorf("%w: repeated sequence table before any", ErrZstdData)
+			}
+		}
+	}
+	frame.hasTables = true
+
+	return frame.decodeSequences(block, count, literals)
+
+}
+
+// decodeSequences reads the literal length, match length and offset of each sequence from the bitstream, and copies
+// the literals and then the match to the output for every one
+func (frame *zstdFrame) decodeSequences(stream []byte, count int, literals []byte) error {
+
+	reader, err := newZstdBackwardReader(stream)
+	if err != nil {
+		return err
+	}
+
+	literalState := frame.literals.start(reader)
+	offsetState := frame.offsets.start(reader)
+	matchState := frame.matches.start(reader)
+
+	for i := 0; i < count; i++ {
+
+		offsetCode := frame.offsets.states[offsetState].symbol
+		matchCode := frame.matches.states[matchState].symbol
+		literalCode := frame.literals.states[literalState].symbol
+		if offsetCode > zstdMaxOffsetSymbol || matchCode > zstdMaxMatchSymbol || literalCode > zstdMaxLiteralSymbol {
+			return fmt.Errorf("%w: sequence code out of range", ErrZstdData)
+		}
+
+		offsetValue := 1<<offsetCode + int(reader.read(uint(offsetCode)))
+		matchLength := int(zstdMatchBaselines[matchCode]) + int(reader.read(uint(zstdMatchExtraBits[matchCode])))
+		literalLength := int(zstdLiteralBaselines[literalCode]) +
+			int(reader.read(uint(zstdLiteralExtraBits[literalCode])))
+
+		offset, err := frame.repeatOffset(offsetValue, literalLength)
+		if err != nil {
+			return err
+		}
+
+		if i < count-1 {
+			literalState = frame.literals.next(literalState, reader)
+			matchState = frame.matches.next(matchState, reader)
+			offsetState = frame.offsets.next(offsetState, reader)
+		}
+
+		if literalLength > len(literals) {
+			return fmt.Errorf("%w: sequence of %d literals with %d left", ErrZstdData, literalLength, len(literals))
+		}
+		if err := frame.emit(literals[:literalLength]); err != nil {
+			return err
+		}
+		literals = literals[literalLength:]
+
+		if offset > len(frame.output)-frame.start {
+			return fmt.Errorf("%w: match %d bytes back after %d", ErrZstdData, offset, len(frame.output)-frame.start)
+		}
+		if len(frame.output)+matchLength > frame.limit {
+			return fmt.Errorf("%w: more than the limit of %d bytes", ErrZstdData, frame.limit)
+		}
+
+		// Matches can overlap what they're copying, so repeat the bytes behind one at a time
+		from := len(frame.output) - offset
+		for j := 0; j < matchLength; j++ {
+			frame.output = append(frame.output, frame.output[from+j])
+		}
+
+	}
+
+	if !reader.finished() {
+		return fmt.Errorf("%w: sequence bitstream not used up", ErrZstdData)
+	}
+
+	return frame.emit(literals)
+
+}
+
+// repeatOffset turns an offset value into the match offset, where 1 to 3 pick one of the last three offsets, and
+// updates them
+func (frame *zstdFrame) repeatOffset(value int, literalLength int) (int, error) {
+
+	repeats := &frame.repeats
+	if value > 3 {
+		repeats[0], repeats[1], repeats[2] = value-3, repeats[0], repeats[1]
+		return repeats[0], nil
+	}
+
+	// Without literals the first repeated offset would copy on from the last match, so the choices move along one
+	if literalLength == 0 {
+		value++
+	}
+
+	switch value {
+	case 1:
+	case 2:
+		repeats[0], repeats[1] = repeats[1], repeats[0]
+	case 3:
+		repeats[0], repeats[1], repeats[2] = repeats[2], repeats[0], repeats[1]
+	case 4:
+		if repeats[0] == 1 {
+			return 0, fmt.Errorf("%w: repeated offset of 0", ErrZstdData)
+		}
+		repeats[0], repeats[1], repeats[2] = repeats[0]-1, repeats[0], repeats[1]
+	}
+
+	return repeats[0], nil
+
+}
+
+func (frame *zstdFrame) emit(data []byte) error {
+
+	if len(frame.output)+len(data) > frame.limit {
+		return fmt.Errorf("%w: more than the limit of %d bytes", ErrZstdData, frame.limit)
+	}
+	frame.output = append(frame.output, data...)
+
+	return nil
+
+}
+
+// decodeLiterals reads the literals section at the start of a compressed block and returns the literals and the size
+// of the section
+func (frame *zstdFrame) decodeLiterals(block []byte) ([]byte, int, error) {
+
+	if len(block) < 1 {
+		return nil, 0, fmt.Errorf("%w: empty compressed block", ErrZstdData)
+	}
+
+	literalsType := block[0] & 3
+	sizeFormat := block[0] >> 2 & 3
+
+	if literalsType == zstdRawLiterals || literalsType == zstdRLELiterals {
+
+		var size, headerSize int
+		switch {
+		case sizeFormat&1 == 0:
+			size, headerSize = int(block[0]>>3), 1
+		case sizeFormat == 1 && len(block) >= 2:
+			size, headerSize = int(block[0]>>4)|int(block[1])<<4, 2
+		case sizeFormat == 3 && len(block) >= 3:
+			size, headerSize = int(block[0]>>4)|int(block[1])<<4|int(block[2])<<12, 3
+		default:
+			return nil, 0, fmt.Errorf("%w: block ends in the literals header", ErrZstdData)
+		}
+		if size > zstdMaxBlockSize {
+			return nil, 0, fmt.Errorf("%w: %d literals", ErrZstdData, size)
+		}
+
+		if literalsType == zstdRLELiterals {
+			if headerSize >= len(block) {
+				return nil, 0, fmt.Errorf("%w: block ends before the RLE literal", ErrZstdData)
+			}
+			literals := make([]byte, size)
+			for i := range literals {
+				literals[i] = block[headerSize]
+			}
+			return literals, headerSize + 1, nil
+		}
+
+		if headerSize+size > len(block) {
+			return nil, 0, fmt.Errorf("%w: block ends in its %d literals", ErrZstdData, size)
+		}
+		return block[headerSize : headerSize+size], headerSize + size, nil
+
+	}
+
+	// Compressed literals have both their sizes in 10, 14 or 18 bits, in one stream for the smallest with 10 bits
+	// and four streams otherwise
+	headerSize, sizeBits, streams := [4]int{3, 3, 4, 5}[sizeFormat], [4]uint{10, 10, 14, 18}[sizeFormat], 4
+	if sizeFormat == 0 {
+		streams = 1
+	}
+	if len(block) < headerSize {
+		return nil, 0, fmt.Errorf("%w: block ends in the literals header", ErrZstdData)
+	}
+
+	var header uint64
+	for i := 0; i < headerSize; i++ {
+		header |= uint64(block[i]) << uint(8*i)
+	}
+	size := int(header >> 4 & (1<<sizeBits - 1))
+	compressedSize := int(header >> (4 + sizeBits) & (1<<sizeBits - 1))
+	if size > zstdMaxBlockSize || headerSize+compressedSize > len(block) {
+		return nil, 0, fmt.Errorf("%w: %d literals in %d bytes", ErrZstdData, size, compressedSize)
+	}
+
+	compressed := block[headerSize : headerSize+compressedSize]
+	if literalsType == zstdCompressedLiterals {
+		table, read, err := readZstdHuffmanTable(compressed)
+		if err != nil {
+			return nil, 0, err
+		}
+		frame.huffman = table
+		compressed = compressed[read:]
+	} else if frame.huffman == nil {
+		return nil, 0, fmt.Errorf("%w: treeless literals before a Huffman table", ErrZstdData)
+	}
+
+	literals, err := frame.huffman.decodeStreams(compressed, size, streams)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return literals, headerSize + compressedSize, nil
+
+}
+
+type zstdHuffmanTable struct {
+	maxBits uint
+	symbols []byte
+	lengths []uint8
+}
+
+// readZstdHuffmanTable reads the weights of the Huffman codes, either FSE compressed or 4 bits each, and builds the
+// table to look codes up in
+func readZstdHuffmanTable(data []byte) (*zstdHuffmanTable, int, error) {
+
+	if len(data) < 1 {
+		return nil, 0, fmt.Errorf("%w: missing Huffman table", ErrZstdData)
+	}
+
+	var weights []byte
+	header := int(data[0])
+	read := 1
+
+	if header >= 128 {
+
+		count := header - 127
+		read += (count + 1) / 2
+		if read > len(data) {
+			return nil, 0, fmt.Errorf("%w: block ends in the Huffman weights", ErrZstdData)
+		}
+		for i := 0; i < count; i++ {
+			weights = append(weights, data[1+i/2]>>uint(4*(1-i%2))&0x0f)
+		}
+
+	} else {
+
+		read += header
+		if read > len(data) {
+			return nil, 0, fmt.Errorf("%w: block ends in the Huffman weights", ErrZstdData)
+		}
+
+		var err error
+		if weights, err = decodeZstdWeights(data[1:read]); err != nil {
+			return nil, 0, err
+		}
+
+	}
+
+	// The last symbol's weight is left out, as the one that brings the total up to a power of 2
+	total := 0
+	for _, weight := range weights {
+		if weight > zstdMaxHuffmanBits {
+			return nil, 0, fmt.Errorf("%w: Huffman weight %d", ErrZstdData, weight)
+		}
+		if weight > 0 {
+			total += 1 << (weight - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, fmt.Errorf("%w: Huffman weights all 0", ErrZstdData)
+	}
+
+	maxBits := uint(bits.Len(uint(total)))
+	left := 1<<maxBits - total
+	if maxBits > zstdMaxHuffmanBits || left&(left-1) != 0 {
+		return nil, 0, fmt.Errorf("%w: Huffman weights adding up to %d", ErrZstdData, total)
+	}
+	weights = append(weights, byte(bits.Len(uint(left))))
+
+	// Codes are given out from the longest, the lowest weight, and in symbol order within a weight
+	table := &zstdHuffmanTable{
+		maxBits: maxBits,
+		symbols: make([]byte, 1<<maxBits),
+		lengths: make([]uint8, 1<<maxBits),
+	}
+
+	var starts [zstdMaxHuffmanBits + 2]int
+	for _, weight := range weights {
+		if weight > 0 {
+			starts[weight] += 1 << (weight - 1)
+		}
+	}
+	next := 0
+	for weight := range starts {
+		next, starts[weight] = next+starts[weight], next
+	}
+
+	for symbol, weight := range weights {
+
+		if weight == 0 {
+			continue
+		}
+
+		entries := 1 << (weight - 1)
+		for i := starts[weight]; i < starts[weight]+entries; i++ {
+			table.symbols[i] = byte(symbol)
+			table.lengths[i] = uint8(maxBits + 1 - uint(weight))
+		}
+		starts[weight] += entries
+
+	}
+
+	return table, read, nil
+
+}
+
+// decodeZstdWeights decodes FSE compressed Huffman weights, which take turns between two states until the bitstream
+// runs out
+func decodeZstdWeights(data []byte) ([]byte, error) {
+
+	distribution, read, err := readZstdDistribution(data, zstdMaxWeightLog, zstdMaxHuffmanBits)
+	if err != nil {
+		return nil, err
+	}
+	table := newZstdFSETable(distribution.counts, distribution.log)
+
+	reader, err := newZstdBackwardReader(data[read:])
+	if err != nil {
+		return nil, err
+	}
+
+	states := [2]int{table.start(reader), table.start(reader)}
+	var weights []byte
+
+	for turn := 0; ; turn ^= 1 {
+
+		weights = append(weights, table.states[states[turn]].symbol)
+		states[turn] = table.next(states[turn], reader)
+
+		// Once updating a state reads past the start of the bitstream, the other state gives the last weight
+		if reader.overflowed() {
+			weights = append(weights, table.states[states[turn^1]].symbol)
+			break
+		}
+		if len(weights) > zstdMaxHuffmanWeights {
+			return nil, fmt.Errorf("%w: more than %d Huffman weights", ErrZstdData, zstdMaxHuffmanWeights)
+		}
+
+	}
+
+	if len(weights) > zstdMaxHuffmanWeights {
+		return nil, fmt.Errorf("%w: more than %d Huffman weights", ErrZstdData, zstdMaxHuffmanWeights)
+	}
+
+	return weights, nil
+
+}
+
+// decodeStreams decodes size literals from one Huffman stream, or from four whose first three sizes are in a 6 byte
+// jump table, each holding a quarter of the literals rounded up and the last the rest
+func (table *zstdHuffmanTable) decodeStreams(data []byte, size int, streams int) ([]byte, error) {
+
+	literals := make([]byte, 0, size)
+
+	if streams == 1 {
+		return table.decodeStream(data, size, literals)
+	}
+
+	if len(data) < 6 {
+		return nil, fmt.Errorf("%w: block ends in the jump table", ErrZstdData)
+	}
+
+	sizes := [4]int{int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])),
+		int(binary.LittleEndian.Uint16(data[4:]))}
+	sizes[3] = len(data) - 6 - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, fmt.Errorf("%w: Huffman streams past the end of the literals", ErrZstdData)
+	}
+
+	quarter := (size + 3) / 4
+	if quarter*3 > size {
+		return nil, fmt.Errorf("%w: %d literals in four streams", ErrZstdData, size)
+	}
+
+	data = data[6:]
+	for stream, streamSize := range sizes {
+
+		count := quarter
+		if stream == 3 {
+			count = size - 3*quarter
+		}
+
+		var err error
+		if literals, err = table.decodeStream(data[:streamSize], count, literals); err != nil {
+			return nil, err
+		}
+		data = data[streamSize:]
+
+	}
+
+	return literals, nil
+
+}
+
+func (table *zstdHuffmanTable) decodeStream(data []byte, count int, literals []byte) ([]byte, error) {
+
+	reader, err := newZstdBackwardReader(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < count; i++ {
+		code := reader.peek(table.maxBits)
+		literals = append(literals, table.symbols[code])
+		reader.skip(uint(table.lengths[code]))
+	}
+
+	if !reader.finished() {
+		return nil, fmt.Errorf("%w: Huffman stream not used up", ErrZstdData)
+	}
+
+	return literals, nil
+
+}
+
+type zstdDistribution struct {
+	counts []int16
+	log    uint
+}
+
+// readZstdDistribution reads the normalised counts of an FSE table, which are packed in fewer bits as the probability
+// left to share out goes down, and returns how many bytes they took
+func readZstdDistribution(data []byte, maxLog uint, maxSymbol int) (zstdDistribution, int, error) {
+
+	reader := zstdForwardReader{data: data}
+	distribution := zstdDistribution{log: uint(reader.read(4)) + 5}
+	if distribution.log > maxLog {
+		return distribution, 0, fmt.Errorf("%w: FSE accuracy log %d", ErrZstdData, distribution.log)
+	}
+
+	remaining := 1<<distribution.log + 1
+	threshold := 1 << distribution.log
+	size := distribution.log + 1
+
+	for remaining > 1 {
+
+		if len(distribution.counts) > maxSymbol {
+			return distribution, 0, fmt.Errorf("%w: FSE symbols past %d", ErrZstdData, maxSymbol)
+		}
+
+		// Small values take one bit fewer than the rest
+		maximum := 2*threshold - 1 - remaining
+		count := int(reader.peek(size - 1))
+		if count < maximum {
+			reader.skip(size - 1)
+		} else {
+			count = int(reader.peek(size))
+			if count >= threshold {
+				count -= maximum
+			}
+			reader.skip(size)
+		}
+
+		// Counts are stored one more than the probability, as -1 is a probability below 1
+		probability := count - 1
+		if probability < 0 {
+			remaining += probability
+		} else {
+			remaining -= probability
+		}
+		distribution.counts = append(distribution.counts, int16(probability))
+
+		// Zero probabilities are followed by how many more zeros come after them, 2 bits at a time while those are 3
+		if probability == 0 {
+			for {
+				zeros := int(reader.read(2))
+				for i := 0; i < zeros; i++ {
+					distribution.counts = append(distribution.counts, 0)
+				}
+				if zeros != 3 {
+					break
+				}
+			}
+		}
+
+		for remaining < threshold && threshold > 1 {
+			size--
+			threshold >>= 1
+		}
+
+	}
+
+	if remaining != 1 || len(distribution.counts) > maxSymbol+1 {
+		return distribution, 0, fmt.Errorf("%w: FSE probabilities don't add up", ErrZstdData)
+	}
+
+	read := int((reader.position + 7) / 8)
+	if read > len(data) {
+		return distribution, 0, fmt.Errorf("%w: block ends in an FSE table", ErrZstdData)
+	}
+
+	return distribution, read, nil
+
+}
+
+type zstdFSEState struct {
+	symbol   byte
+	bits     uint8
+	baseline uint16
+}
+
+type zstdFSETable struct {
+	log    uint
+	states []zstdFSEState
+}
+
+// newZstdFSETable spreads the symbols over the states by their probabilities, symbols below 1 taking one state each
+// from the end, and works out the bits each state reads to find the next
+func newZstdFSETable(counts []int16, log uint) *zstdFSETable {
+
+	size := 1 << log
+	table := &zstdFSETable{log: log, states: make([]zstdFSEState, size)}
+
+	high := size - 1
+	next := make([]int, len(counts))
+	for symbol, count := range counts {
+		if count == -1 {
+			table.states[high].symbol = byte(symbol)
+			high--
+			next[symbol] = 1
+		} else {
+			next[symbol] = int(count)
+		}
+	}
+
+	position := 0
+	step := size>>1 + size>>3 + 3
+	for symbol, count := range counts {
+		for i := 0; i < int(count); i++ {
+			table.states[position].symbol = byte(symbol)
+			for position = (position + step) & (size - 1); position > high; {
+				position = (position + step) & (size - 1)
+			}
+		}
+	}
+
+	for i := range table.states {
+		state := &table.states[i]
+		number := next[state.symbol]
+		next[state.symbol]++
+		state.bits = uint8(log - uint(bits.Len(uint(number))-1))
+		state.baseline = uint16(number<<state.bits - size)
+	}
+
+	return table
+
+}
+
+func (table *zstdFSETable) start(reader *zstdBackwardReader) int {
+	return int(reader.read(table.log))
+}
+
+func (table *zstdFSETable) next(state int, reader *zstdBackwardReader) int {
+	return int(table.states[state].baseline) + int(reader.read(uint(table.states[state].bits)))
+}
+
+// zstdBackwardReader reads a bitstream from its end, the last byte's highest set bit marking where it starts. Reads
+// past the beginning give 0 bits, which overflowed reports.
+type zstdBackwardReader struct {
+	data      []byte
+	remaining int
+}
+
+func newZstdBackwardReader(data []byte) (*zstdBackwardReader, error) {
+
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, fmt.Errorf("%w: bitstream without an end marker", ErrZstdData)
+	}
+
+	return &zstdBackwardReader{data: data, remaining: len(data)*8 - 9 + bits.Len8(data[len(data)-1])}, nil
+
+}
+
+func (reader *zstdBackwardReader) read(count uint) uint64 {
+
+	value := reader.peek(count)
+	reader.skip(count)
+
+	return value
+
+}
+
+// peek gives the next count bits, the first of them the most significant
+func (reader *zstdBackwardReader) peek(count uint) uint64 {
+
+	var value uint64
+	start := reader.remaining - int(count)
+	for i := 0; i < int(count); {
+
+		bit := start + i
+		if bit < 0 {
+			i = -start
+			continue
+		}
+
+		taken := 8 - bit&7
+		if taken > int(count)-i {
+			taken = int(count) - i
+		}
+		value |= uint64(reader.data[bit>>3]>>uint(bit&7)&(1<<uint(taken)-1)) << uint(i)
+		i += taken
+
+	}
+
+	return value
+
+}
+
+func (reader *zstdBackwardReader) skip(count uint) {
+	reader.remaining -= int(count)
+}
+
+func (reader *zstdBackwardReader) overflowed() bool {
+	return reader.remaining < 0
+}
+
+func (reader *zstdBackwardReader) finished() bool {
+	return reader.remaining == 0
+}
+
+// zstdForwardReader reads bits from the lowest of the first byte up, as FSE table descriptions are stored
+type zstdForwardReader struct {
+	data     []byte
+	position uint
+}
+
+func (reader *zstdForwardReader) read(count uint) uint64 {
+
+	value := reader.peek(count)
+	reader.skip(count)
+
+	return value
+
+}
+
+func (reader *zstdForwardReader) peek(count uint) uint64 {
+
+	var value uint64
+	for i := uint(0); i < count; i++ {
+		bit := reader.position + i
+		if bit>>3 < uint(len(reader.data)) {
+			value |= uint64(reader.data[bit>>3]>>(bit&7)&1) << i
+		}
+	}
+
+	return value
+
+}
+
+func (reader *zstdForwardReader) skip(count uint) {
+	reader.position += count
+}
+
+const (
+	xxHashPrime1 = 11400714785074694791
+	xxHashPrime2 = 14029467366897019727
+	xxHashPrime3 = 1609587929392839161
+	xxHashPrime4 = 9650029242287828579
+	xxHashPrime5 = 2870177450012600261
+)
+
+// xxHash64 is the 64 bit xxHash with a seed of 0, of which a Zstandard frame's checksum is the low 32 bits
+func xxHash64(data []byte) uint64 {
+
+	round := func(accumulator uint64, lane uint64) uint64 {
+		return bits.RotateLeft64(accumulator+lane*xxHashPrime2, 31) * xxHashPrime1
+	}
+
+	length := uint64(len(data))
+	var hash uint64
+
+	if len(data) >= 32 {
+
+		// The first prime is over 2^63, so it's added as a variable to wrap around instead of overflowing a constant
+		prime1 := uint64(xxHashPrime1)
+		lanes := [4]uint64{prime1 + xxHashPrime2, xxHashPrime2, 0, -prime1}
+		for ; len(data) >= 32; data = data[32:] {
+			for i := range lanes {
+				lanes[i] = round(lanes[i], binary.LittleEndian.Uint64(data[i*8:]))
+			}
+		}
+
+		hash = bits.RotateLeft64(lanes[0], 1) + bits.RotateLeft64(lanes[1], 7) + bits.RotateLeft64(lanes[2], 12) +
+			bits.RotateLeft64(lanes[3], 18)
+		for _, lane := range lanes {
+			hash = (hash^round(0, lane))*xxHashPrime1 + xxHashPrime4
+		}
+
+	} else {
+		hash = xxHashPrime5
+	}
+
+	hash += length
+
+	for ; len(data) >= 8; data = data[8:] {
+		hash = bits.RotateLeft64(hash^round(0, binary.LittleEndian.Uint64(data)), 27)*xxHashPrime1 + xxHashPrime4
+	}
+	if len(data) >= 4 {
+		hash = bits.RotateLeft64(hash^uint64(binary.LittleEndian.Uint32(data))*xxHashPrime1, 23)*xxHashPrime2 +
+			xxHashPrime3
+		data = data[4:]
+	}
+	for _, value := range data {
+		hash = bits.RotateLeft64(hash^uint64(value)*xxHashPrime5, 11) * xxHashPrime1
+	}
+
+	hash ^= hash >> 33
+	hash *= xxHashPrime2
+	hash ^= hash >> 29
+	hash *= xxHashPrime3
+	hash ^= hash >> 32
+
+	return hash
+
+}
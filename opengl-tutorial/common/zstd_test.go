@@ -0,0 +1,283 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+// zstdTestRandom is a xorshift generator, so the inputs compressed in testdata can be made again here
+type zstdTestRandom uint32
+
+func (state *zstdTestRandom) next() uint32 {
+
+	*state ^= *state << 13
+	*state ^= *state >> 17
+	*state ^= *state << 5
+
+	return uint32(*state)
+
+}
+
+// zstdTestText is words from a small vocabulary, the first ones far more often than the rest
+func zstdTestText(size int) []byte {
+
+	words := strings.Fields("the a texture of vertex and mipmap normal to shader in level block frame is with " +
+		"buffer matrix camera light for uniform sampler fragment triangle index quad sphere cube from depth " +
+		"stencil alpha colour blend cull frustum")
+
+	random := zstdTestRandom(1)
+	var text []byte
+	for len(text) < size {
+		pick := float64(random.next()) / (1 << 32)
+		text = append(text, words[int(pick*pick*float64(len(words)))]...)
+		text = append(text, ' ')
+	}
+
+	return text[:size]
+
+}
+
+// zstdTestSmall is bytes of only a few low values, which compress to a single Huffman stream with directly stored
+// weights
+func zstdTestSmall(size int) []byte {
+
+	random := zstdTestRandom(7)
+	small := make([]byte, size)
+	for i := range small {
+		small[i] = byte(bits.TrailingZeros32(random.next()) % 6)
+	}
+
+	return small
+
+}
+
+// zstdTestBlock builds a block header and its content, where an RLE block's size is how many times it repeats
+func zstdTestBlock(blockType int, content []byte, size int) []byte {
+
+	header := blockType<<1 | size<<3
+
+	return append([]byte{byte(header), byte(header >> 8), byte(header >> 16)}, content...)
+
+}
+
+// zstdTestFrame builds a frame of the blocks, marking the last, after a single segment header with a 4 byte content
+// size
+func zstdTestFrame(contentSize int, blocks ...[]byte) []byte {
+
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0xa0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(frame[5:], uint32(contentSize))
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			block = append([]byte{block[0] | 1}, block[1:]...)
+		}
+		frame = append(frame, block...)
+	}
+
+	return frame
+
+}
+
+func TestDecompressZstd(t *testing.T) {
+
+	uvmap, err := ioutil.ReadFile("../07-model-loading/uvmap.bmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files compressed by the zstd command line tool, which between them use every kind of block, literals section
+	// and sequence table
+	files := []struct {
+		name string
+		want []byte
+	}{
+		// 6 blocks at the highest level, repeating sequence tables and offsets
+		{"uvmap.bmp.zst", uvmap},
+
+		// 2 blocks, the second reusing the Huffman table of the first
+		{"text.zst", zstdTestText(150000)},
+		{"text-fast.zst", zstdTestText(150000)},
+
+		{"small.zst", zstdTestSmall(200)},
+	}
+
+	for _, file := range files {
+
+		data, err := ioutil.ReadFile("testdata/" + file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decompressed, err := DecompressZstd(data, len(file.want))
+		if err != nil {
+			t.Errorf("%s: %v", file.name, err)
+			continue
+		}
+		if !bytes.Equal(decompressed, file.want) {
+			t.Errorf("%s: decompressed to %d bytes that differ from the %d expected", file.name, len(decompressed),
+				len(file.want))
+		}
+
+	}
+
+	// 32512 sequences, which takes the 3 byte count, each of an RLE literal and a 3 byte match one back. The tables
+	// are RLE too so the bitstream is only its end marker.
+	sequences := []byte{1 | 3<<2 | 0<<4, 32512 >> 4 & 0xff, 32512 >> 12, 'z', 255, 0, 0, 0x54, 1, 0, 0, 1}
+
+	// The first block's match is 3 bytes 2 back. The second's has no literals and an offset value of 3, which is
+	// one less than the first offset, so 3 bytes 1 back.
+	offsets := [][]byte{{4 << 3, 'a', 'b', 'c', 'd', 1, 0x54, 4, 2, 0, 0x05}, {0, 1, 0x54, 0, 1, 0, 0x03}}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"raw block", zstdTestFrame(5, zstdTestBlock(zstdRawBlock, []byte("hello"), 5)), []byte("hello")},
+		{"RLE block", zstdTestFrame(900, zstdTestBlock(zstdRLEBlock, []byte{'a'}, 900)),
+			bytes.Repeat([]byte{'a'}, 900)},
+		{
+			name: "RLE literals and sequences",
+			data: zstdTestFrame(130048, zstdTestBlock(zstdCompressedBlock, sequences, len(sequences))),
+			want: bytes.Repeat([]byte{'z'}, 130048),
+		},
+		{
+			// A compressed block of only raw literals
+			name: "no sequences",
+			data: zstdTestFrame(3, zstdTestBlock(zstdCompressedBlock, []byte{3 << 3, 'a', 'b', 'c', 0}, 5)),
+			want: []byte("abc"),
+		},
+		{
+			name: "repeated offset without literals",
+			data: zstdTestFrame(10, zstdTestBlock(zstdCompressedBlock, offsets[0], len(offsets[0])),
+				zstdTestBlock(zstdCompressedBlock, offsets[1], len(offsets[1]))),
+			want: []byte("abcdcdcccc"),
+		},
+		{
+			name: "frames and skippable frames",
+			data: bytes.Join([][]byte{
+				zstdTestFrame(2, zstdTestBlock(zstdRawBlock, []byte("ab"), 2)),
+				{0x5a, 0x2a, 0x4d, 0x18, 3, 0, 0, 0, 'x', 'y', 'z'},
+				zstdTestFrame(2, zstdTestBlock(zstdRLEBlock, []byte{'c'}, 2)),
+				{0x50, 0x2a, 0x4d, 0x18, 0, 0, 0, 0},
+			}, nil),
+			want: []byte("abcc"),
+		},
+		{
+			// No content size, a window descriptor and a dictionary ID of 0, which is no dictionary
+			name: "frame header fields",
+			data: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x01, 0x00, 0x00, 0x19, 0, 0, 'x', 'y', 'z'},
+			want: []byte("xyz"),
+		},
+	}
+
+	for _, test := range tests {
+
+		decompressed, err := DecompressZstd(test.data, 1<<20)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(decompressed, test.want) {
+			t.Errorf("%s: decompressed to %q, want %q", test.name, truncate(decompressed), truncate(test.want))
+		}
+
+	}
+
+}
+
+func truncate(data []byte) []byte {
+
+	if len(data) > 16 {
+		return data[:16]
+	}
+
+	return data
+
+}
+
+func TestDecompressZstdInvalid(t *testing.T) {
+
+	text, err := ioutil.ReadFile("testdata/text.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// patched is a copy of data with the byte at offset changed
+	patched := func(data []byte, offset int, value byte) []byte {
+		data = append([]byte(nil), data...)
+		data[offset] = value
+		return data
+	}
+
+	raw := zstdTestFrame(5, zstdTestBlock(zstdRawBlock, []byte("hello"), 5))
+
+	// compressed is a frame of one compressed block
+	compressed := func(size int, content ...byte) []byte {
+		return zstdTestFrame(size, zstdTestBlock(zstdCompressedBlock, content, len(content)))
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		limit int
+		want  error
+	}{
+		{"empty", nil, 100, ErrZstdData},
+		{"not Zstandard", []byte("\x28\xb5\x2f\xfe\x00\x00\x00\x00\x00"), 100, ErrZstdData},
+		{"truncated header", raw[:7], 100, ErrZstdData},
+		{"reserved header bit", patched(raw, 4, 0xa8), 100, ErrZstdData},
+		{"dictionary", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x21, 7, 0, 1, 0, 0}, 100, ErrZstdUnsupported},
+		{"content past the limit", raw, 4, ErrZstdData},
+		{"wrong content size", patched(raw, 5, 6), 100, ErrZstdData},
+		{"truncated block", raw[:len(raw)-1], 100, ErrZstdData},
+		{"no last block", patched(raw, 9, raw[9]&^1), 100, ErrZstdData},
+		{"reserved block type", patched(raw, 9, raw[9]|6), 100, ErrZstdData},
+		{"skippable frame past the end", []byte{0x50, 0x2a, 0x4d, 0x18, 9, 0, 0, 0, 1}, 100, ErrZstdData},
+
+		// The frame's content size is left out, so only the blocks go past the limit
+		{"blocks past the limit", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x00, 0x2b, 0x00, 0x00, 'a'}, 4, ErrZstdData},
+		{"matches past the limit", text, 100000, ErrZstdData},
+
+		{"checksum", patched(text, len(text)-1, text[len(text)-1]^1), 150000, ErrZstdData},
+		{"corrupt compressed block", patched(text, len(text)/2, text[len(text)/2]^0x55), 150000, ErrZstdData},
+		{"treeless literals first", compressed(3, 3, 0, 0), 100, ErrZstdData},
+		{"repeated tables first", compressed(4, 1<<3, 'a', 1, 0xfc, 1), 100, ErrZstdData},
+		{"match before the frame", compressed(4, 0, 1, 0x54, 0, 0, 0, 1), 100, ErrZstdData},
+		{"repeated offset of 0", compressed(5, 2<<3, 'a', 'b', 1, 0x54, 0, 1, 0, 0x03), 100, ErrZstdData},
+	}
+
+	for _, test := range tests {
+		if _, err := DecompressZstd(test.data, test.limit); !errors.Is(err, test.want) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.want)
+		}
+	}
+
+}
+
+func TestXXHash64(t *testing.T) {
+
+	// Every length takes a different path through the stripes and the tail
+	tests := []struct {
+		data string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"message digest", 0x066ed728fceeb3be},
+		{"abcdefghijklmnopqrstuvwxyz", 0xcfe1f278fa89835c},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890", 0xe04a477f19ee145d},
+	}
+
+	for _, test := range tests {
+		if hash := xxHash64([]byte(test.data)); hash != test.want {
+			t.Errorf("%q: hash %#x, want %#x", test.data, hash, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,179 @@
+package primitives
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// meshBuilder collects an indexed triangle list laid out like the output of common.IndexVBO
+type meshBuilder struct {
+	indices  []uint32
+	vertices []mgl32.Vec3
+	uvs      []mgl32.Vec2
+	normals  []mgl32.Vec3
+
+	// Vertices added with sharedVertex, so shapes built from triangles can reuse them
+	shared map[sharedKey]uint32
+}
+
+type sharedKey struct {
+	position mgl32.Vec3
+	uv       mgl32.Vec2
+	normal   mgl32.Vec3
+}
+
+func (builder *meshBuilder) vertex(position mgl32.Vec3, uv mgl32.Vec2, normal mgl32.Vec3) uint32 {
+
+	builder.vertices = append(builder.vertices, position)
+	builder.uvs = append(builder.uvs, uv)
+	builder.normals = append(builder.normals, normal)
+
+	return uint32(len(builder.vertices) - 1)
+
+}
+
+func (builder *meshBuilder) sharedVertex(position mgl32.Vec3, uv mgl32.Vec2, normal mgl32.Vec3) uint32 {
+
+	if builder.shared == nil {
+		builder.shared = make(map[sharedKey]uint32)
+	}
+
+	key := sharedKey{position, uv, normal}
+	if index, ok := builder.shared[key]; ok {
+		return index
+	}
+
+	index := builder.vertex(position, uv, normal)
+	builder.shared[key] = index
+
+	return index
+
+}
+
+// triangle adds a triangle facing the same way as its vertex normals, whatever order the corners come in. Degenerate
+// triangles, such as the ones touching the poles of a sphere, are dropped.
+func (builder *meshBuilder) triangle(a, b, c uint32) {
+
+	pa, pb, pc := builder.vertices[a], builder.vertices[b], builder.vertices[c]
+	faceNormal := pb.Sub(pa).Cross(pc.Sub(pa))
+	if faceNormal.Len() < 1e-12 {
+		return
+	}
+
+	if faceNormal.Dot(builder.normals[a].Add(builder.normals[b]).Add(builder.normals[c])) < 0 {
+		b, c = c, b
+	}
+
+	builder.indices = append(builder.indices, a, b, c)
+
+}
+
+// quad adds the quad a, b, c, d as two triangles
+func (builder *meshBuilder) quad(a, b, c, d uint32) {
+
+	builder.triangle(a, b, c)
+	builder.triangle(a, c, d)
+
+}
+
+func (builder *meshBuilder) mesh() ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+	return builder.indices, builder.vertices, builder.uvs, builder.normals
+}
+
+// grid adds a flat rectangle of segmentsU by segmentsV quads facing along normal, from origin along the u and v edges.
+// Texture coordinates go from 0 to 1 along each edge.
+func (builder *meshBuilder) grid(origin mgl32.Vec3, u mgl32.Vec3, v mgl32.Vec3, normal mgl32.Vec3, segmentsU int,
+	segmentsV int) {
+
+	first := uint32(len(builder.vertices))
+	columns := uint32(segmentsU + 1)
+
+	for j := 0; j <= segmentsV; j++ {
+		for i := 0; i <= segmentsU; i++ {
+
+			s := float32(i) / float32(segmentsU)
+			t := float32(j) / float32(segmentsV)
+			builder.vertex(origin.Add(u.Mul(s)).Add(v.Mul(t)), mgl32.Vec2{s, t}, normal)
+
+		}
+	}
+
+	for j := uint32(0); j < uint32(segmentsV); j++ {
+		for i := uint32(0); i < uint32(segmentsU); i++ {
+
+			corner := first + j*columns + i
+			builder.quad(corner, corner+1, corner+columns+1, corner+columns)
+
+		}
+	}
+
+}
+
+// profilePoint is a point of the outline lathe spins around the Y axis, with the normal of the outline there and the
+// v texture coordinate it gets
+type profilePoint struct {
+	radius, y    float32
+	normalRadius float32
+	normalY      float32
+	textureV     float32
+}
+
+// lathe sweeps a profile around the Y axis in segments steps. The seam is duplicated so u runs from 0 to 1 all the
+// way round.
+func (builder *meshBuilder) lathe(profile []profilePoint, segments int) {
+
+	first := uint32(len(builder.vertices))
+	columns := uint32(segments + 1)
+
+	for _, point := range profile {
+		for s := 0; s <= segments; s++ {
+
+			u := float32(s) / float32(segments)
+			sin, cos := sinCos(u * 2 * math.Pi)
+
+			// Keep the seam exactly where it started
+			if s == segments {
+				sin, cos = 0, 1
+			}
+
+			builder.vertex(
+				mgl32.Vec3{point.radius * sin, point.y, point.radius * cos},
+				mgl32.Vec2{u, point.textureV},
+				mgl32.Vec3{point.normalRadius * sin, point.normalY, point.normalRadius * cos}.Normalize())
+
+		}
+	}
+
+	for p := uint32(0); p+1 < uint32(len(profile)); p++ {
+		for s := uint32(0); s < uint32(segments); s++ {
+
+			corner := first + p*columns + s
+			builder.quad(corner, corner+1, corner+columns+1, corner+columns)
+
+		}
+	}
+
+}
+
+// disc adds a flat circle at height y facing up or down, textured with the unit square stretched over it
+func (builder *meshBuilder) disc(y float32, radius float32, segments int, up bool) {
+
+	normal := mgl32.Vec3{0, -1, 0}
+	if up {
+		normal = mgl32.Vec3{0, 1, 0}
+	}
+
+	center := builder.vertex(mgl32.Vec3{0, y, 0}, mgl32.Vec2{0.5, 0.5}, normal)
+	for s := 0; s <= segments; s++ {
+
+		sin, cos := sinCos(float32(s) / float32(segments) * 2 * math.Pi)
+		builder.vertex(mgl32.Vec3{radius * sin, y, radius * cos}, mgl32.Vec2{0.5 + sin/2, 0.5 + cos/2}, normal)
+
+		if s > 0 {
+			builder.triangle(center, center+uint32(s), center+uint32(s)+1)
+		}
+
+	}
+
+}
@@ -0,0 +1,354 @@
+// Package primitives generates simple meshes with normals and texture coordinates. Every generator returns indices,
+// vertices, uvs and normals like common.IndexVBO, with counter clockwise front faces and Y up, centered on the origin.
+// Segment and ring counts below what a shape needs to enclose any space are raised to that minimum, so every count
+// gives a usable mesh.
+package primitives
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func sinCos(angle float32) (float32, float32) {
+
+	sin, cos := math.Sincos(float64(angle))
+	return float32(sin), float32(cos)
+
+}
+
+func atLeast(count int, minimum int) int {
+
+	if count < minimum {
+		return minimum
+	}
+
+	return count
+
+}
+
+// Unindex expands an indexed mesh into separate triangles, for drawing with gl.DrawArrays like the cube tables of the
+// early tutorials
+func Unindex(indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) ([]mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	outVertices := make([]mgl32.Vec3, len(indices))
+	outUvs := make([]mgl32.Vec2, len(indices))
+	outNormals := make([]mgl32.Vec3, len(indices))
+
+	for i, index := range indices {
+		outVertices[i] = vertices[index]
+		outUvs[i] = uvs[index]
+		outNormals[i] = normals[index]
+	}
+
+	return outVertices, outUvs, outNormals
+
+}
+
+// Cube has sides of length size split into segments by segments quads, each face showing the whole texture
+func Cube(size float32, segments int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	builder := &meshBuilder{}
+	half := size / 2
+	segments = atLeast(segments, 1)
+
+	// Each face as the corner at its texture origin, the directions u and v run in seen from outside, and its normal
+	faces := [][4]mgl32.Vec3{
+		{{-half, -half, half}, {size, 0, 0}, {0, size, 0}, {0, 0, 1}},   // front
+		{{half, -half, -half}, {-size, 0, 0}, {0, size, 0}, {0, 0, -1}}, // back
+		{{half, -half, half}, {0, 0, -size}, {0, size, 0}, {1, 0, 0}},   // right
+		{{-half, -half, -half}, {0, 0, size}, {0, size, 0}, {-1, 0, 0}}, // left
+		{{-half, half, half}, {size, 0, 0}, {0, 0, -size}, {0, 1, 0}},   // top
+		{{-half, -half, -half}, {size, 0, 0}, {0, 0, size}, {0, -1, 0}}, // bottom
+	}
+
+	for _, face := range faces {
+		builder.grid(face[0], face[1], face[2], face[3], segments, segments)
+	}
+
+	return builder.mesh()
+
+}
+
+// Plane lies in the XZ plane facing up, with width along X and depth along Z
+func Plane(width float32, depth float32, segmentsX int, segmentsZ int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	builder := &meshBuilder{}
+	builder.grid(mgl32.Vec3{-width / 2, 0, depth / 2}, mgl32.Vec3{width, 0, 0}, mgl32.Vec3{0, 0, -depth},
+		mgl32.Vec3{0, 1, 0}, atLeast(segmentsX, 1), atLeast(segmentsZ, 1))
+
+	return builder.mesh()
+
+}
+
+// UVSphere is a sphere of segments slices around the Y axis and rings stacks from pole to pole, with the texture
+// wrapped around it as an equirectangular map
+func UVSphere(radius float32, segments int, rings int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	segments, rings = atLeast(segments, 3), atLeast(rings, 2)
+
+	profile := make([]profilePoint, rings+1)
+	for r := range profile {
+
+		sin, cos := sinCos(float32(r) / float32(rings) * math.Pi)
+		if r == rings {
+			sin, cos = 0, -1
+		}
+
+		profile[r] = profilePoint{
+			radius:       radius * sin,
+			y:            radius * cos,
+			normalRadius: sin,
+			normalY:      cos,
+			textureV:     1 - float32(r)/float32(rings),
+		}
+
+	}
+
+	builder := &meshBuilder{}
+	builder.lathe(profile, segments)
+
+	return builder.mesh()
+
+}
+
+// Icosphere is an icosahedron whose triangles are split in four subdivisions times, giving evenly sized triangles.
+// Texture coordinates are an equirectangular map, u runs past 1 on the triangles crossing the seam so the texture
+// needs to repeat.
+func Icosphere(radius float32, subdivisions int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	// The icosahedron's vertices lie on three golden rectangles
+	t := float32((1 + math.Sqrt(5)) / 2)
+	points := []mgl32.Vec3{
+		{-1, t, 0}, {1, t, 0}, {-1, -t, 0}, {1, -t, 0},
+		{0, -1, t}, {0, 1, t}, {0, -1, -t}, {0, 1, -t},
+		{t, 0, -1}, {t, 0, 1}, {-t, 0, -1}, {-t, 0, 1},
+	}
+	for i := range points {
+		points[i] = points[i].Normalize()
+	}
+
+	triangles := [][3]int{
+		{0, 11, 5}, {0, 5, 1}, {0, 1, 7}, {0, 7, 10}, {0, 10, 11},
+		{1, 5, 9}, {5, 11, 4}, {11, 10, 2}, {10, 7, 6}, {7, 1, 8},
+		{3, 9, 4}, {3, 4, 2}, {3, 2, 6}, {3, 6, 8}, {3, 8, 9},
+		{4, 9, 5}, {2, 4, 11}, {6, 2, 10}, {8, 6, 7}, {9, 8, 1},
+	}
+
+	for i := 0; i < subdivisions; i++ {
+
+		midpoints := make(map[[2]int]int)
+		midpoint := func(a, b int) int {
+
+			if a > b {
+				a, b = b, a
+			}
+
+			if index, ok := midpoints[[2]int{a, b}]; ok {
+				return index
+			}
+
+			points = append(points, points[a].Add(points[b]).Normalize())
+			midpoints[[2]int{a, b}] = len(points) - 1
+
+			return len(points) - 1
+
+		}
+
+		subdivided := make([][3]int, 0, len(triangles)*4)
+		for _, triangle := range triangles {
+
+			ab := midpoint(triangle[0], triangle[1])
+			bc := midpoint(triangle[1], triangle[2])
+			ca := midpoint(triangle[2], triangle[0])
+
+			subdivided = append(subdivided,
+				[3]int{triangle[0], ab, ca},
+				[3]int{triangle[1], bc, ab},
+				[3]int{triangle[2], ca, bc},
+				[3]int{ab, bc, ca})
+
+		}
+		triangles = subdivided
+
+	}
+
+	builder := &meshBuilder{}
+	for _, triangle := range triangles {
+
+		var uvs [3]mgl32.Vec2
+		for c, point := range triangle {
+			uvs[c] = sphereUv(points[point])
+		}
+
+		// Triangles across the seam have corners at both ends of the texture, pull the ones near 0 over to 1
+		minU := math.Min(float64(uvs[0][0]), math.Min(float64(uvs[1][0]), float64(uvs[2][0])))
+		maxU := math.Max(float64(uvs[0][0]), math.Max(float64(uvs[1][0]), float64(uvs[2][0])))
+		if maxU-minU > 0.5 {
+			for c := range uvs {
+				if uvs[c][0] < 0.5 {
+					uvs[c][0] += 1
+				}
+			}
+		}
+
+		// The poles have no longitude, give them the middle of the other two corners
+		for c, point := range triangle {
+			if math.Abs(float64(points[point].Y())) > 0.9999 {
+				uvs[c][0] = (uvs[(c+1)%3][0] + uvs[(c+2)%3][0]) / 2
+			}
+		}
+
+		var corners [3]uint32
+		for c, point := range triangle {
+			corners[c] = builder.sharedVertex(points[point].Mul(radius), uvs[c], points[point])
+		}
+		builder.triangle(corners[0], corners[1], corners[2])
+
+	}
+
+	return builder.mesh()
+
+}
+
+// sphereUv maps a unit vector to equirectangular texture coordinates, matching the seam and orientation of UVSphere
+func sphereUv(direction mgl32.Vec3) mgl32.Vec2 {
+
+	u := float32(math.Atan2(float64(direction.X()), float64(direction.Z())) / (2 * math.Pi))
+	if u < 0 {
+		u += 1
+	}
+	v := 0.5 + float32(math.Asin(float64(mgl32.Clamp(direction.Y(), -1, 1)))/math.Pi)
+
+	return mgl32.Vec2{u, v}
+
+}
+
+// Cylinder stands on the Y axis, with its sides split into stacks rings and both ends capped
+func Cylinder(radius float32, height float32, segments int, stacks int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+	return truncatedCone(radius, radius, height, segments, stacks)
+}
+
+// Cone stands on the Y axis with its capped base at the bottom and its tip at the top
+func Cone(radius float32, height float32, segments int, stacks int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+	return truncatedCone(radius, 0, height, segments, stacks)
+}
+
+func truncatedCone(bottomRadius float32, topRadius float32, height float32, segments int,
+	stacks int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	segments, stacks = atLeast(segments, 3), atLeast(stacks, 1)
+
+	// The side's normal leans out by how much the radius shrinks over the height. A flat cylinder has no side to lean,
+	// its edge just faces out.
+	normalRadius, normalY := height, bottomRadius-topRadius
+	if normalRadius == 0 && normalY == 0 {
+		normalRadius = 1
+	}
+
+	profile := make([]profilePoint, stacks+1)
+	for s := range profile {
+
+		t := float32(s) / float32(stacks)
+		profile[s] = profilePoint{
+			radius:       bottomRadius + (topRadius-bottomRadius)*t,
+			y:            height * (t - 0.5),
+			normalRadius: normalRadius,
+			normalY:      normalY,
+			textureV:     t,
+		}
+
+	}
+
+	builder := &meshBuilder{}
+	builder.lathe(profile, segments)
+
+	if bottomRadius > 0 {
+		builder.disc(-height/2, bottomRadius, segments, false)
+	}
+	if topRadius > 0 {
+		builder.disc(height/2, topRadius, segments, true)
+	}
+
+	return builder.mesh()
+
+}
+
+// Torus lies in the XZ plane, majorRadius from its center to the middle of the tube and minorRadius around the tube
+func Torus(majorRadius float32, minorRadius float32, majorSegments int, minorSegments int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	majorSegments, minorSegments = atLeast(majorSegments, 3), atLeast(minorSegments, 3)
+
+	profile := make([]profilePoint, minorSegments+1)
+	for s := range profile {
+
+		t := float32(s) / float32(minorSegments)
+		sin, cos := sinCos(t * 2 * math.Pi)
+		if s == minorSegments {
+			sin, cos = 0, 1
+		}
+
+		profile[s] = profilePoint{
+			radius:       majorRadius + minorRadius*cos,
+			y:            minorRadius * sin,
+			normalRadius: cos,
+			normalY:      sin,
+			textureV:     t,
+		}
+
+	}
+
+	builder := &meshBuilder{}
+	builder.lathe(profile, majorSegments)
+
+	return builder.mesh()
+
+}
+
+// Capsule is a cylinder of the given height capped with hemispheres of rings stacks each, so its total height is
+// height+2*radius. The texture's v runs along the outline so it isn't stretched over the caps.
+func Capsule(radius float32, height float32, segments int, rings int) ([]uint32, []mgl32.Vec3, []mgl32.Vec2, []mgl32.Vec3) {
+
+	segments, rings = atLeast(segments, 3), atLeast(rings, 1)
+
+	length := math.Pi*radius + height
+	profile := make([]profilePoint, 0, (rings+1)*2)
+
+	for hemisphere := 0; hemisphere < 2; hemisphere++ {
+
+		center := height / 2
+		if hemisphere == 1 {
+			center = -height / 2
+		}
+
+		for r := 0; r <= rings; r++ {
+
+			angle := (float32(hemisphere) + float32(r)/float32(rings)) * math.Pi / 2
+			sin, cos := sinCos(angle)
+			if hemisphere == 1 && r == rings {
+				sin, cos = 0, -1
+			}
+
+			distance := angle * radius
+			if hemisphere == 1 {
+				distance += height
+			}
+
+			profile = append(profile, profilePoint{
+				radius:       radius * sin,
+				y:            center + radius*cos,
+				normalRadius: sin,
+				normalY:      cos,
+				textureV:     1 - distance/length,
+			})
+
+		}
+
+	}
+
+	builder := &meshBuilder{}
+	builder.lathe(profile, segments)
+
+	return builder.mesh()
+
+}
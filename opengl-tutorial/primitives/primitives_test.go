@@ -0,0 +1,265 @@
+package primitives
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type generatedMesh struct {
+	indices  []uint32
+	vertices []mgl32.Vec3
+	uvs      []mgl32.Vec2
+	normals  []mgl32.Vec3
+}
+
+func generated(indices []uint32, vertices []mgl32.Vec3, uvs []mgl32.Vec2, normals []mgl32.Vec3) generatedMesh {
+	return generatedMesh{indices, vertices, uvs, normals}
+}
+
+func finite(values ...float32) bool {
+
+	for _, value := range values {
+		if math.IsNaN(float64(value)) || math.IsInf(float64(value), 0) {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// checkMesh reports indices past the vertices, attributes of different lengths, and vertices that aren't finite or
+// whose normals aren't unit length
+func checkMesh(t *testing.T, name string, mesh generatedMesh) {
+
+	if len(mesh.uvs) != len(mesh.vertices) || len(mesh.normals) != len(mesh.vertices) {
+		t.Errorf("%s: %d vertices, %d uvs and %d normals", name, len(mesh.vertices), len(mesh.uvs), len(mesh.normals))
+		return
+	}
+
+	for i, index := range mesh.indices {
+		if int(index) >= len(mesh.vertices) {
+			t.Errorf("%s: index %d is %d, past the %d vertices", name, i, index, len(mesh.vertices))
+			return
+		}
+	}
+
+	for i, vertex := range mesh.vertices {
+
+		uv, normal := mesh.uvs[i], mesh.normals[i]
+		if !finite(vertex[0], vertex[1], vertex[2], uv[0], uv[1], normal[0], normal[1], normal[2]) {
+			t.Errorf("%s: vertex %d is %v with uv %v and normal %v", name, i, vertex, uv, normal)
+			return
+		}
+
+		if math.Abs(float64(normal.Len())-1) > 1e-5 {
+			t.Errorf("%s: vertex %d has normal %v of length %v", name, i, normal, normal.Len())
+			return
+		}
+
+	}
+
+}
+
+// signedVolume is the volume a closed mesh encloses, negative when its triangles face inwards
+func signedVolume(mesh generatedMesh) float64 {
+
+	volume := 0.0
+	for t := 0; t+2 < len(mesh.indices); t += 3 {
+		a, b, c := mesh.vertices[mesh.indices[t]], mesh.vertices[mesh.indices[t+1]], mesh.vertices[mesh.indices[t+2]]
+		volume += float64(a.Dot(b.Cross(c))) / 6
+	}
+
+	return volume
+
+}
+
+// unpairedEdges counts the edges of triangles that no other triangle runs along the other way. Vertices on texture
+// seams are duplicated, so edges are matched by position rather than by index.
+func unpairedEdges(mesh generatedMesh) int {
+
+	key := func(index uint32) [3]int64 {
+		vertex := mesh.vertices[index]
+		return [3]int64{int64(math.Round(float64(vertex[0]) * 1e4)), int64(math.Round(float64(vertex[1]) * 1e4)),
+			int64(math.Round(float64(vertex[2]) * 1e4))}
+	}
+
+	edges := make(map[[2][3]int64]int)
+	for t := 0; t+2 < len(mesh.indices); t += 3 {
+		for c := 0; c < 3; c++ {
+			edges[[2][3]int64{key(mesh.indices[t+c]), key(mesh.indices[t+(c+1)%3])}]++
+		}
+	}
+
+	unpaired := 0
+	for edge, count := range edges {
+		if reverse := edges[[2][3]int64{edge[1], edge[0]}]; reverse != count {
+			unpaired++
+		}
+	}
+
+	return unpaired
+
+}
+
+func TestGenerators(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		mesh      generatedMesh
+		triangles int
+		min, max  mgl32.Vec3
+
+		// Volume of the shape the mesh approximates, 0 for the open plane
+		volume float64
+	}{
+		{"cube", generated(Cube(2, 3)), 6 * 3 * 3 * 2, mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1}, 8},
+		{"plane", generated(Plane(4, 2, 4, 2)), 4 * 2 * 2, mgl32.Vec3{-2, 0, -1}, mgl32.Vec3{2, 0, 1}, 0},
+
+		// The triangles touching a pole or the tip of a cone lose a corner to it, leaving one per segment in that band
+		{"uv sphere", generated(UVSphere(1, 32, 16)), 32*14*2 + 32*2, mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1},
+			4.0 / 3 * math.Pi},
+		{"icosphere", generated(Icosphere(1, 3)), 20 * 4 * 4 * 4, mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1},
+			4.0 / 3 * math.Pi},
+		{"cylinder", generated(Cylinder(1, 2, 32, 4)), 32*4*2 + 32*2, mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1},
+			2 * math.Pi},
+		{"cone", generated(Cone(1, 2, 32, 4)), 32*3*2 + 32 + 32, mgl32.Vec3{-1, -1, -1}, mgl32.Vec3{1, 1, 1},
+			2 * math.Pi / 3},
+		{"torus", generated(Torus(1, 0.25, 32, 16)), 32 * 16 * 2, mgl32.Vec3{-1.25, -0.25, -1.25},
+			mgl32.Vec3{1.25, 0.25, 1.25}, 2 * math.Pi * math.Pi * 0.25 * 0.25},
+		{"capsule", generated(Capsule(0.5, 1, 32, 8)), 32 * 8 * 4, mgl32.Vec3{-0.5, -1, -0.5},
+			mgl32.Vec3{0.5, 1, 0.5}, math.Pi*0.25 + 4.0/3*math.Pi*0.125},
+	}
+
+	for _, test := range tests {
+
+		checkMesh(t, test.name, test.mesh)
+
+		if len(test.mesh.indices) != test.triangles*3 {
+			t.Errorf("%s: %d triangles, want %d", test.name, len(test.mesh.indices)/3, test.triangles)
+		}
+
+		min, max := test.mesh.vertices[0], test.mesh.vertices[0]
+		for _, vertex := range test.mesh.vertices {
+			for c := range vertex {
+				min[c] = float32(math.Min(float64(min[c]), float64(vertex[c])))
+				max[c] = float32(math.Max(float64(max[c]), float64(vertex[c])))
+			}
+		}
+		if !min.ApproxEqualThreshold(test.min, 1e-5) || !max.ApproxEqualThreshold(test.max, 1e-5) {
+			t.Errorf("%s: bounds %v to %v, want %v to %v", test.name, min, max, test.min, test.max)
+		}
+
+		if test.volume == 0 {
+			continue
+		}
+
+		// Closed meshes have every edge shared by two triangles running along it in opposite directions, and face out
+		// so they enclose a positive volume a little under that of the smooth shape
+		if unpaired := unpairedEdges(test.mesh); unpaired != 0 {
+			t.Errorf("%s: %d edges with no opposite triangle", test.name, unpaired)
+		}
+		if volume := signedVolume(test.mesh); volume > test.volume*1.0001 || volume < test.volume*0.95 {
+			t.Errorf("%s: encloses %v, want a little under %v", test.name, volume, test.volume)
+		}
+
+	}
+
+}
+
+func TestIcosphereSubdivisions(t *testing.T) {
+
+	for subdivisions := 0; subdivisions <= 4; subdivisions++ {
+
+		indices, vertices, _, _ := Icosphere(2, subdivisions)
+
+		if want := 20 << (2 * uint(subdivisions)); len(indices) != want*3 {
+			t.Errorf("%d subdivisions: %d triangles, want %d", subdivisions, len(indices)/3, want)
+		}
+
+		for _, vertex := range vertices {
+			if math.Abs(float64(vertex.Len())-2) > 1e-5 {
+				t.Errorf("%d subdivisions: vertex %v is %v from the center, want 2", subdivisions, vertex, vertex.Len())
+				break
+			}
+		}
+
+	}
+
+}
+
+func TestGeneratorMinimumCounts(t *testing.T) {
+
+	// Counts too low to enclose anything give the coarsest mesh of the shape
+	tests := []struct {
+		name    string
+		mesh    generatedMesh
+		minimum generatedMesh
+	}{
+		{"cube", generated(Cube(1, 0)), generated(Cube(1, 1))},
+		{"plane", generated(Plane(1, 1, 0, -1)), generated(Plane(1, 1, 1, 1))},
+		{"uv sphere", generated(UVSphere(1, 0, 1)), generated(UVSphere(1, 3, 2))},
+		{"icosphere", generated(Icosphere(1, -1)), generated(Icosphere(1, 0))},
+		{"cylinder", generated(Cylinder(1, 1, 2, 0)), generated(Cylinder(1, 1, 3, 1))},
+		{"cone", generated(Cone(1, 1, -4, -4)), generated(Cone(1, 1, 3, 1))},
+		{"torus", generated(Torus(1, 0.5, 0, 1)), generated(Torus(1, 0.5, 3, 3))},
+		{"capsule", generated(Capsule(1, 1, 0, 0)), generated(Capsule(1, 1, 3, 1))},
+	}
+
+	for _, test := range tests {
+
+		checkMesh(t, test.name, test.mesh)
+
+		if len(test.mesh.indices) == 0 {
+			t.Errorf("%s: no triangles", test.name)
+		}
+		if !reflect.DeepEqual(test.mesh, test.minimum) {
+			t.Errorf("%s: differs from the mesh at the minimum counts", test.name)
+		}
+
+	}
+
+}
+
+func TestGeneratorFlatShapes(t *testing.T) {
+
+	// Shapes squashed to no height still get finite, unit normals
+	tests := []struct {
+		name string
+		mesh generatedMesh
+	}{
+		{"flat cylinder", generated(Cylinder(1, 0, 8, 2))},
+		{"flat cone", generated(Cone(1, 0, 8, 2))},
+		{"empty cube", generated(Cube(0, 2))},
+		{"empty plane", generated(Plane(0, 0, 2, 2))},
+		{"flat capsule", generated(Capsule(1, 0, 8, 2))},
+	}
+
+	for _, test := range tests {
+		checkMesh(t, test.name, test.mesh)
+	}
+
+}
+
+func TestUnindex(t *testing.T) {
+
+	indices, vertices, uvs, normals := Cube(2, 1)
+	outVertices, outUvs, outNormals := Unindex(indices, vertices, uvs, normals)
+
+	// The 36 corners the early tutorials draw with gl.DrawArrays
+	if len(outVertices) != 36 || len(outUvs) != 36 || len(outNormals) != 36 {
+		t.Fatalf("%d vertices, %d uvs and %d normals, want 36 of each", len(outVertices), len(outUvs),
+			len(outNormals))
+	}
+
+	for i, index := range indices {
+		if outVertices[i] != vertices[index] || outUvs[i] != uvs[index] || outNormals[i] != normals[index] {
+			t.Errorf("Corner %d is %v %v %v, want %v %v %v", i, outVertices[i], outUvs[i], outNormals[i],
+				vertices[index], uvs[index], normals[index])
+		}
+	}
+
+}